@@ -3,15 +3,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/chaincfg"
 
 	"tanos/pkg/bitcoin"
 	"tanos/pkg/crypto"
 	"tanos/pkg/nostr"
 	"tanos/pkg/tanos"
+	"tanos/pkg/wallet"
 )
 
 func main() {
@@ -19,94 +20,166 @@ func main() {
 	fmt.Println("------------------------------------------------------")
 
 	// Step 1: Create a seller (Nostr content creator)
-	sellerPrivKey := nostr.GeneratePrivateKey()
-	seller, err := tanos.NewSeller(sellerPrivKey)
+	sellerKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		panic(fmt.Errorf("failed to generate seller key: %v", err))
+	}
+	seller, err := tanos.NewSeller(nostr.NewLocalSigner(sellerKey))
 	if err != nil {
 		panic(fmt.Errorf("failed to create seller: %v", err))
 	}
+	defer seller.Zero()
 	fmt.Println("Seller Public Key:", seller.NostrPubKey)
 
-	// Step 2: Create a buyer (Bitcoin holder)
-	buyer, err := tanos.NewBuyer()
+	// Step 2: Create a buyer (Bitcoin holder) with a key from an HD wallet,
+	// whose mnemonic backs up the keys of all the buyer's swaps
+	mnemonic, err := wallet.NewMnemonic()
+	if err != nil {
+		panic(fmt.Errorf("failed to create mnemonic: %v", err))
+	}
+	buyerWallet, err := wallet.FromMnemonic(mnemonic, "", &chaincfg.RegressionNetParams)
+	if err != nil {
+		panic(fmt.Errorf("failed to open wallet: %v", err))
+	}
+	defer buyerWallet.Zero()
+	buyer, err := tanos.NewWalletBuyer(buyerWallet)
 	if err != nil {
 		panic(fmt.Errorf("failed to create buyer: %v", err))
 	}
+	defer buyer.Zero()
+	fmt.Println("Buyer Key Path:", buyerWallet.Path(*buyer.KeyIndex))
 	fmt.Println("Buyer Public Key:", crypto.HexEncode(buyer.PublicKey.SerializeCompressed()))
 
-	// Step 3: Seller creates a Nostr event (but keeps signature secret initially)
+	// Step 3: Seller prepares a Nostr event (the signature does not exist yet)
 	err = seller.CreateEvent("Nostr event for TANOS atomic swap")
 	if err != nil {
 		panic(fmt.Errorf("failed to create event: %v", err))
 	}
 	fmt.Println("Event ID:", seller.Event.ID)
-	fmt.Println("Nonce R (from nostr sig):", crypto.HexEncode(seller.Nonce.SerializeCompressed()))
+	fmt.Println("Nonce R (of the future nostr sig):", crypto.HexEncode(seller.Nonce.SerializeCompressed()))
 	fmt.Println("Adaptor Commitment Point (T):", crypto.HexEncode(seller.Commitment.SerializeCompressed()))
 
-	// Step 4: Buyer creates and broadcasts a Bitcoin transaction with funds
+	// Step 4: Both sides open a swap over the seller's offer
+	sellerSwap, err := tanos.NewSellerSwap(seller)
+	if err != nil {
+		panic(fmt.Errorf("failed to create seller swap: %v", err))
+	}
+	buyerSwap, err := tanos.NewBuyerSwap(buyer, sellerSwap.Offer)
+	if err != nil {
+		panic(fmt.Errorf("failed to accept offer: %v", err))
+	}
+	if err := buyerSwap.Commit(); err != nil {
+		panic(err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		panic(err)
+	}
+
+	// Step 5: Buyer locks Bitcoin to the MuSig2 key of both parties, with a
+	// refund path after a timelock
 	// IMPORTANT: Buyer pays Bitcoin to obtain the Nostr signature
 	fmt.Println("\n--- Bitcoin Transaction Setup (Locking Phase) ---")
-	params := &chaincfg.TestNet3Params
-	dummyPrevTxID := "0000000000000000000000000000000000000000000000000000000000000000"
-	dummyPrevOutputIndex := uint32(0)
+	params := &chaincfg.RegressionNetParams
 
-	err = buyer.CreateLockingTransaction(
-		100000, // 0.001 BTC in satoshis
-		dummyPrevTxID,
-		dummyPrevOutputIndex,
-		params,
-	)
+	// An in-memory regtest chain stands in for the Bitcoin network
+	chain := bitcoin.NewSimChain()
+	ctx := context.Background()
+
+	// The funding output is a P2TR output controlled by the buyer
+	_, fundingScript, err := bitcoin.CreateP2TRAddress(buyer.PublicKey, params)
+	if err != nil {
+		panic(fmt.Errorf("failed to create funding script: %v", err))
+	}
+	fundingValue := int64(110000)
+	fundingTx := chain.Fund(fundingScript, fundingValue)
+	fmt.Println("Buyer funded by transaction:", fundingTx.TxHash().String())
+
+	err = buyerSwap.Fund(func(b *tanos.SwapBuyer, offer *tanos.Offer) error {
+		err := b.CreateMuSig2LockingTransaction(
+			100000, // 0.001 BTC in satoshis
+			fundingTx.TxHash().String(),
+			0,
+			fundingValue,
+			fundingScript,
+			offer.ClaimKey,
+			bitcoin.RelativeBlocks(144),
+			params,
+		)
+		if err != nil {
+			return err
+		}
+		return b.SignLockingTransaction()
+	})
 	if err != nil {
 		panic(fmt.Errorf("failed to create locking transaction: %v", err))
 	}
 
-	// Generate transaction and verify it's valid
-	_, err = bitcoin.SerializeTx(buyer.LockingTx)
+	// Broadcast the locking transaction and confirm it
+	txHash, err := chain.Broadcast(ctx, buyerSwap.LockingTx)
 	if err != nil {
-		panic(err)
+		panic(fmt.Errorf("failed to broadcast locking transaction: %v", err))
 	}
-	fmt.Println("Bitcoin Transaction (locking funds) Ready for Broadcast:")
-	fmt.Println("Transaction hash:", buyer.LockingTx.TxHash().String())
-	fmt.Println("Buyer locks Bitcoin in a transaction that can only be spent with knowledge of the Nostr signature")
+	height := chain.Mine(1)
+	fmt.Println("Bitcoin Transaction (locking funds) confirmed:")
+	fmt.Println("Transaction hash:", txHash.String(), "at height", height)
 
-	// Step 5: Buyer creates an adaptor signature
-	err = buyer.CreateAdaptorSignature(seller.Commitment)
+	notice, err := buyerSwap.FundingNotice()
 	if err != nil {
-		panic(fmt.Errorf("failed to create adaptor signature: %v", err))
+		panic(err)
+	}
+	if err := sellerSwap.ObserveFunding(notice); err != nil {
+		panic(fmt.Errorf("seller rejected the funding: %v", err))
+	}
+	// The seller only signs once the lock output is confirmed on chain
+	if err := sellerSwap.VerifyFunding(ctx, chain, 100000, 1); err != nil {
+		panic(fmt.Errorf("seller could not verify the funding: %v", err))
 	}
-	fmt.Println("Bitcoin Adaptor Signature created")
 
-	// Verify the adaptor signature
-	if buyer.VerifyAdaptorSignature(seller.Commitment) {
-		fmt.Println("Bitcoin adaptor signature verification: VALID")
-	} else {
-		fmt.Println("Bitcoin adaptor signature verification: INVALID")
+	// Step 6: Both sides sign the seller's claim, the buyer's signature
+	// completing an adaptor pre-signature for the commitment T
+	fmt.Println("\n--- Claim Signing (Adaptor Phase) ---")
+	buyerNonce, err := buyerSwap.ClaimNonce()
+	if err != nil {
+		panic(err)
 	}
+	if _, err := sellerSwap.ClaimNonce(); err != nil {
+		panic(err)
+	}
+	_, sellerScript, err := bitcoin.CreateP2TRAddress(sellerSwap.Offer.ClaimKey, params)
+	if err != nil {
+		panic(fmt.Errorf("failed to create seller script: %v", err))
+	}
+	proposal, err := sellerSwap.ProposeClaim(sellerScript, bitcoin.FeeRatePerVByte(5), buyerNonce)
+	if err != nil {
+		panic(fmt.Errorf("failed to propose claim: %v", err))
+	}
+	partial, err := buyerSwap.SignClaim(proposal)
+	if err != nil {
+		panic(fmt.Errorf("failed to sign claim: %v", err))
+	}
+	if err := sellerSwap.AcceptAdaptor(partial); err != nil {
+		panic(fmt.Errorf("failed to verify adaptor pre-signature: %v", err))
+	}
+	fmt.Println("MuSig2 adaptor pre-signature verified against T")
 
-	// Step 6: Swap execution - Seller reveals Nostr signature to complete the swap
+	// Step 7: Seller completes the claim with the Nostr secret and spends
+	// the lock, which publishes the signature on chain
 	fmt.Println("\n--- Swap Execution (Exchange Phase) ---")
-	fmt.Println("Seller reveals Nostr signature spending the transaction:", seller.Event.Sig)
-
-	// Step 7: Buyer completes the Bitcoin signature using the revealed Nostr signature
-	finalSig, err := buyer.CompleteAdaptorSignature(seller.Event.Sig)
+	claimTx, err := sellerSwap.CompleteClaim()
 	if err != nil {
-		panic(fmt.Errorf("failed to complete adaptor signature: %v", err))
+		panic(fmt.Errorf("failed to complete claim: %v", err))
 	}
-	fmt.Println("Final Bitcoin Schnorr Signature:", crypto.HexEncode(finalSig))
-
-	// Step 8: Buyer verifies the signature and uses the authentic Nostr event
-	fmt.Println("\n--- Nostr Event Authentication ---")
-
-	// Extract the secret from the completed signature
-	completedSigBytes := finalSig[32:]
-	completedSigScalar := new(btcec.ModNScalar)
-	if overflow := completedSigScalar.SetByteSlice(completedSigBytes); overflow {
-		panic(fmt.Errorf("scalar overflow in completed signature"))
+	if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+		panic(fmt.Errorf("failed to broadcast claim: %v", err))
 	}
+	fmt.Println("Seller claims the Bitcoin in transaction:", claimTx.TxHash().String())
 
-	// Verify the secret matches
-	matches, err := buyer.VerifyNostrSecret(completedSigScalar, seller.Event.Sig)
+	// Step 8: Buyer recovers the Nostr signature from the claim
+	fmt.Println("\n--- Nostr Event Authentication ---")
+	reveal, err := buyerSwap.WatchClaim(ctx, chain, height)
 	if err != nil {
-		panic(fmt.Errorf("failed to verify secret: %v", err))
+		panic(fmt.Errorf("failed to watch claim: %v", err))
 	}
-	fmt.Printf("Nostr signature verification: %v\n", matches)
+	fmt.Println("Recovered Nostr signature:", reveal.NostrSig)
+	fmt.Printf("Nostr signature verification: %v\n", reveal.NostrSig == seller.Event.Sig)
 }
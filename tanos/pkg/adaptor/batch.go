@@ -0,0 +1,301 @@
+package adaptor
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+)
+
+const (
+	// batchWindow is the wNAF window width of the multi-scalar
+	// multiplication. Every point gets 2^(batchWindow-2) precomputed odd
+	// multiples.
+	batchWindow = 5
+
+	// batchTableSize is the number of odd multiples P, 3P, ..., 15P kept
+	// for every point.
+	batchTableSize = 1 << (batchWindow - 2)
+
+	// batchFallbackSize is the size below which a failing batch is
+	// verified one signature at a time instead of being split further.
+	batchFallbackSize = 4
+)
+
+// BatchError lists the signatures that failed batch verification.
+type BatchError struct {
+	Invalid []int // Indices of the invalid signatures, in increasing order
+}
+
+// Error implements the error interface.
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d invalid adaptor signatures, the first at index %d", len(e.Invalid), e.Invalid[0])
+}
+
+// BatchVerify checks every sigs[i] against adaptorPoints[i], with the same
+// result as calling Verify on each but at a fraction of the cost. It returns
+// nil when all signatures are valid, and a *BatchError listing every invalid
+// one otherwise.
+//
+// The verification equations s_i*G = R_i + e_i*P_i are combined with random
+// 128-bit weights a_i, with a_0 = 1, into
+//
+//	(sum a_i*s_i)*G = sum a_i*R_i + sum (a_i*e_i)*P_i
+//
+// whose right-hand side is computed with a single multi-scalar
+// multiplication. A batch holding an invalid signature passes with
+// probability at most 2^-128. When a batch fails, it is split in halves
+// until the invalid signatures are found.
+func BatchVerify(sigs []*Signature, adaptorPoints []*secp.PublicKey) error {
+	if len(sigs) != len(adaptorPoints) {
+		return fmt.Errorf("%d signatures but %d adaptor points", len(sigs), len(adaptorPoints))
+	}
+
+	var invalid []int
+	findInvalid(sigs, adaptorPoints, 0, &invalid)
+	if len(invalid) > 0 {
+		return &BatchError{Invalid: invalid}
+	}
+
+	return nil
+}
+
+// findInvalid appends to invalid the indices, shifted by offset, of the
+// signatures that do not verify.
+func findInvalid(sigs []*Signature, adaptorPoints []*secp.PublicKey, offset int, invalid *[]int) {
+	if batchVerify(sigs, adaptorPoints) {
+		return
+	}
+
+	if len(sigs) <= batchFallbackSize {
+		for i, sig := range sigs {
+			if !sig.Verify(adaptorPoints[i]) {
+				*invalid = append(*invalid, offset+i)
+			}
+		}
+		return
+	}
+
+	mid := len(sigs) / 2
+	findInvalid(sigs[:mid], adaptorPoints[:mid], offset, invalid)
+	findInvalid(sigs[mid:], adaptorPoints[mid:], offset+mid, invalid)
+}
+
+// batchVerify reports whether the random linear combination of the
+// verification equations of sigs holds.
+func batchVerify(sigs []*Signature, adaptorPoints []*secp.PublicKey) bool {
+	if len(sigs) == 0 {
+		return true
+	}
+
+	weights, err := batchWeights(len(sigs))
+	if err != nil {
+		return false
+	}
+
+	// Recover every nonce point R, then make them all affine at once
+	points := make([]secp.JacobianPoint, 2*len(sigs))
+	nonces := make([]*secp.JacobianPoint, len(sigs))
+	for i, sig := range sigs {
+		if !sig.recoverNonce(adaptorPoints[i], &points[2*i], &points[2*i+1]) {
+			return false
+		}
+		nonces[i] = &points[2*i]
+	}
+	normalizeBatch(nonces)
+
+	var sSum secp.ModNScalar
+	scalars := make([]*secp.ModNScalar, 0, 2*len(sigs))
+	for i, sig := range sigs {
+		e, ok := sig.finishEquation(adaptorPoints[i], &points[2*i], &points[2*i+1])
+		if !ok {
+			return false
+		}
+
+		a := weights[i]
+		sSum.Add(new(secp.ModNScalar).Mul2(a, sig.S))
+		scalars = append(scalars, a, e.Mul(a))
+	}
+
+	var lhs, rhs secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(&sSum, &lhs)
+	multiScalarMult(scalars, points, &rhs)
+	if isInfinity(&lhs) || isInfinity(&rhs) {
+		return isInfinity(&lhs) && isInfinity(&rhs)
+	}
+	lhs.ToAffine()
+	rhs.ToAffine()
+
+	return lhs.X.Equals(&rhs.X) && lhs.Y.Equals(&rhs.Y)
+}
+
+// batchWeights returns n weights: 1 followed by random 128-bit scalars.
+func batchWeights(n int) ([]*secp.ModNScalar, error) {
+	randBytes := make([]byte, 16*(n-1))
+	if _, err := rand.Read(randBytes); err != nil {
+		return nil, fmt.Errorf("failed to read randomness: %v", err)
+	}
+
+	weights := make([]*secp.ModNScalar, n)
+	weights[0] = new(secp.ModNScalar).SetInt(1)
+	for i := 1; i < n; i++ {
+		weights[i] = new(secp.ModNScalar)
+		weights[i].SetByteSlice(randBytes[16*(i-1) : 16*i])
+	}
+
+	return weights, nil
+}
+
+// multiScalarMult sets result to sum(scalars[i] * points[i]) using Straus'
+// method: the doublings are shared by all points, and every point adds one
+// of its precomputed odd multiples for each non-zero wNAF digit of its
+// scalar. It runs in variable time, so it must only be used on public data.
+// The points must be affine and not the point at infinity.
+func multiScalarMult(scalars []*secp.ModNScalar, points []secp.JacobianPoint, result *secp.JacobianPoint) {
+	nafs := make([][]int8, len(scalars))
+	maxLen := 0
+	for i, k := range scalars {
+		nafs[i] = wnaf(k)
+		maxLen = max(maxLen, len(nafs[i]))
+	}
+	tables := oddMultiples(points)
+
+	var acc, sum, q secp.JacobianPoint
+	for bit := maxLen - 1; bit >= 0; bit-- {
+		secp.DoubleNonConst(&acc, &sum)
+		acc.Set(&sum)
+
+		for i, naf := range nafs {
+			if bit >= len(naf) || naf[bit] == 0 {
+				continue
+			}
+
+			d := naf[bit]
+			if d > 0 {
+				q.Set(&tables[i][d/2])
+			} else {
+				q.Set(&tables[i][-d/2])
+				negate(&q)
+			}
+			secp.AddNonConst(&acc, &q, &sum)
+			acc.Set(&sum)
+		}
+	}
+
+	result.Set(&acc)
+}
+
+// oddMultiples returns P, 3P, ..., 15P for every point P, in affine
+// coordinates so that the additions in multiScalarMult are mixed additions.
+func oddMultiples(points []secp.JacobianPoint) [][batchTableSize]secp.JacobianPoint {
+	tables := make([][batchTableSize]secp.JacobianPoint, len(points))
+	all := make([]*secp.JacobianPoint, 0, len(points)*batchTableSize)
+	for i := range points {
+		var twice secp.JacobianPoint
+		secp.DoubleNonConst(&points[i], &twice)
+
+		tables[i][0].Set(&points[i])
+		for j := 1; j < batchTableSize; j++ {
+			secp.AddNonConst(&tables[i][j-1], &twice, &tables[i][j])
+			all = append(all, &tables[i][j])
+		}
+	}
+	normalizeBatch(all)
+
+	return tables
+}
+
+// normalizeBatch converts points to affine coordinates with a single field
+// inversion, using Montgomery's trick. None may be the point at infinity.
+func normalizeBatch(points []*secp.JacobianPoint) {
+	if len(points) == 0 {
+		return
+	}
+
+	// prefix[i] is the product of the Z-coordinates of points[:i]
+	prefix := make([]secp.FieldVal, len(points))
+	var acc secp.FieldVal
+	acc.SetInt(1)
+	for i, p := range points {
+		p.Z.Normalize()
+		prefix[i].Set(&acc)
+		acc.Mul(&p.Z)
+	}
+	acc.Inverse()
+
+	var zInv, zInv2, zInv3 secp.FieldVal
+	for i := len(points) - 1; i >= 0; i-- {
+		p := points[i]
+
+		// acc is the inverse of the product of the Z-coordinates of points[:i+1]
+		zInv.Mul2(&acc, &prefix[i])
+		acc.Mul(&p.Z)
+
+		zInv2.SquareVal(&zInv)
+		zInv3.Mul2(&zInv2, &zInv)
+		p.X.Mul(&zInv2).Normalize()
+		p.Y.Mul(&zInv3).Normalize()
+		p.Z.SetInt(1)
+	}
+}
+
+// wnaf returns the width-batchWindow non-adjacent form of k, least
+// significant digit first. Every digit is zero or odd and smaller than
+// 2^(batchWindow-1) in absolute value.
+func wnaf(k *secp.ModNScalar) []int8 {
+	// Little endian 64-bit limbs, with room for the carry of negative digits
+	b := k.Bytes()
+	var limbs [5]uint64
+	for i := 0; i < 4; i++ {
+		limbs[i] = binary.BigEndian.Uint64(b[24-8*i : 32-8*i])
+	}
+
+	const (
+		width = 1 << batchWindow
+		half  = width / 2
+	)
+
+	naf := make([]int8, 0, 257)
+	for limbs != [5]uint64{} {
+		var digit int64
+		if limbs[0]&1 == 1 {
+			digit = int64(limbs[0] & (width - 1))
+			if digit >= half {
+				digit -= width
+			}
+
+			// Subtract the digit, which clears the low batchWindow bits
+			if digit > 0 {
+				borrow := uint64(digit)
+				for i := range limbs {
+					next := limbs[i] - borrow
+					if next <= limbs[i] {
+						limbs[i] = next
+						break
+					}
+					limbs[i], borrow = next, 1
+				}
+			} else {
+				carry := uint64(-digit)
+				for i := range limbs {
+					next := limbs[i] + carry
+					if next >= limbs[i] {
+						limbs[i] = next
+						break
+					}
+					limbs[i], carry = next, 1
+				}
+			}
+		}
+		naf = append(naf, int8(digit))
+
+		// Shift right by one bit
+		for i := 0; i < len(limbs)-1; i++ {
+			limbs[i] = limbs[i]>>1 | limbs[i+1]<<63
+		}
+		limbs[len(limbs)-1] >>= 1
+	}
+
+	return naf
+}
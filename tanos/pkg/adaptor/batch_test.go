@@ -0,0 +1,104 @@
+package adaptor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// newBatch creates n valid adaptor signatures with their adaptor points.
+func newBatch(t testing.TB, n int) ([]*Signature, []*secp.PublicKey) {
+	sigs := make([]*Signature, n)
+	adaptorPoints := make([]*secp.PublicKey, n)
+	for i := range sigs {
+		adaptorPoints[i] = generatePrivKey().PubKey()
+		message := chainhash.DoubleHashB([]byte{byte(i), byte(i >> 8)})
+
+		sig, err := New(generatePrivKey(), adaptorPoints[i], message)
+		if err != nil {
+			t.Fatalf("Failed to create adaptor signature: %v", err)
+		}
+		sigs[i] = sig
+	}
+
+	return sigs, adaptorPoints
+}
+
+// TestMultiScalarMult checks the multi-scalar multiplication against
+// separate multiplications.
+func TestMultiScalarMult(t *testing.T) {
+	scalars := []*secp.ModNScalar{
+		new(secp.ModNScalar).SetInt(1),
+		new(secp.ModNScalar).SetInt(31),
+		new(secp.ModNScalar).SetInt(1).Negate(),
+	}
+	for i := 0; i < 20; i++ {
+		scalars = append(scalars, &generatePrivKey().Key)
+	}
+
+	points := make([]secp.JacobianPoint, len(scalars))
+	var want secp.JacobianPoint
+	for i, k := range scalars {
+		generatePrivKey().PubKey().AsJacobian(&points[i])
+
+		var term, sum secp.JacobianPoint
+		secp.ScalarMultNonConst(k, &points[i], &term)
+		secp.AddNonConst(&want, &term, &sum)
+		want.Set(&sum)
+	}
+	want.ToAffine()
+
+	var got secp.JacobianPoint
+	multiScalarMult(scalars, points, &got)
+	got.ToAffine()
+	if !got.X.Equals(&want.X) || !got.Y.Equals(&want.Y) {
+		t.Fatalf("Multi-scalar multiplication differs from separate multiplications")
+	}
+}
+
+// TestBatchVerify checks that valid batches pass and that every invalid
+// signature of a batch is identified.
+func TestBatchVerify(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 7, 64} {
+		sigs, adaptorPoints := newBatch(t, n)
+		if err := BatchVerify(sigs, adaptorPoints); err != nil {
+			t.Fatalf("Valid batch of %d failed: %v", n, err)
+		}
+	}
+
+	sigs, adaptorPoints := newBatch(t, 40)
+
+	// Break a few signatures in different ways
+	sigs[3] = &Signature{
+		NoncePoint: sigs[3].NoncePoint,
+		S:          new(secp.ModNScalar).Add2(sigs[3].S, new(secp.ModNScalar).SetInt(1)),
+		PubKey:     sigs[3].PubKey,
+		Message:    sigs[3].Message,
+		Parity:     sigs[3].Parity,
+	}
+	adaptorPoints[17] = adaptorPoints[18]
+	sigs[18] = nil
+	sigs[39] = &Signature{
+		NoncePoint: sigs[39].NoncePoint,
+		S:          sigs[39].S,
+		PubKey:     sigs[39].PubKey,
+		Message:    []byte("another message"),
+		Parity:     sigs[39].Parity,
+	}
+
+	err := BatchVerify(sigs, adaptorPoints)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected a BatchError, got %v", err)
+	}
+	if want := []int{3, 17, 18, 39}; !reflect.DeepEqual(batchErr.Invalid, want) {
+		t.Fatalf("Expected invalid signatures %v, got %v", want, batchErr.Invalid)
+	}
+
+	if err := BatchVerify(sigs, adaptorPoints[:10]); err == nil || errors.As(err, &batchErr) {
+		t.Fatalf("Expected a length mismatch error, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package adaptor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// BenchmarkNew measures adaptor signature creation.
+func BenchmarkNew(b *testing.B) {
+	privKey := generatePrivKey()
+	adaptorPoint := generatePrivKey().PubKey()
+	message := chainhash.DoubleHashB([]byte("adaptor signature benchmark"))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := New(privKey, adaptorPoint, message); err != nil {
+			b.Fatalf("Failed to create adaptor signature: %v", err)
+		}
+	}
+}
+
+// BenchmarkVerify measures adaptor signature verification.
+func BenchmarkVerify(b *testing.B) {
+	privKey := generatePrivKey()
+	adaptorPoint := generatePrivKey().PubKey()
+	message := chainhash.DoubleHashB([]byte("adaptor signature benchmark"))
+	sig, err := New(privKey, adaptorPoint, message)
+	if err != nil {
+		b.Fatalf("Failed to create adaptor signature: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !sig.Verify(adaptorPoint) {
+			b.Fatalf("Adaptor signature failed verification")
+		}
+	}
+}
+
+// BenchmarkAddPubKeys measures public key addition.
+func BenchmarkAddPubKeys(b *testing.B) {
+	p1 := generatePrivKey().PubKey()
+	p2 := generatePrivKey().PubKey()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := AddPubKeys(p1, p2); err != nil {
+			b.Fatalf("Failed to add public keys: %v", err)
+		}
+	}
+}
+
+// BenchmarkBatchVerify compares BatchVerify with calling Verify on every
+// signature, reporting the cost per signature.
+func BenchmarkBatchVerify(b *testing.B) {
+	for _, n := range []int{16, 128} {
+		sigs, adaptorPoints := newBatch(b, n)
+
+		b.Run(fmt.Sprintf("single/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j, sig := range sigs {
+					if !sig.Verify(adaptorPoints[j]) {
+						b.Fatalf("Adaptor signature failed verification")
+					}
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/sig")
+		})
+
+		b.Run(fmt.Sprintf("batch/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := BatchVerify(sigs, adaptorPoints); err != nil {
+					b.Fatalf("Batch failed verification: %v", err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/sig")
+		})
+	}
+}
+
+// BenchmarkNewECDSA measures ECDSA adaptor signature creation.
+func BenchmarkNewECDSA(b *testing.B) {
+	privKey := generatePrivKey()
+	adaptorPoint := generatePrivKey().PubKey()
+	message := chainhash.DoubleHashB([]byte("adaptor signature benchmark"))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewECDSA(privKey, adaptorPoint, message); err != nil {
+			b.Fatalf("Failed to create ECDSA adaptor signature: %v", err)
+		}
+	}
+}
+
+// BenchmarkVerifyECDSA measures ECDSA adaptor signature verification.
+func BenchmarkVerifyECDSA(b *testing.B) {
+	privKey := generatePrivKey()
+	adaptorPoint := generatePrivKey().PubKey()
+	message := chainhash.DoubleHashB([]byte("adaptor signature benchmark"))
+	sig, err := NewECDSA(privKey, adaptorPoint, message)
+	if err != nil {
+		b.Fatalf("Failed to create ECDSA adaptor signature: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !sig.Verify(adaptorPoint) {
+			b.Fatalf("ECDSA adaptor signature failed verification")
+		}
+	}
+}
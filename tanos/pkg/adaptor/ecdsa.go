@@ -0,0 +1,197 @@
+package adaptor
+
+import (
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// ECDSASignature encapsulates the data of an ECDSA adaptor signature, also
+// called an encrypted signature. Completing it with the secret t of the
+// adaptor point T gives an ordinary low-S ECDSA signature (r, s), which
+// spends P2WPKH and P2WSH outputs as well as legacy ones.
+//
+// The signer picks a nonce k and publishes both R = k*T, whose x-coordinate
+// is the r of the final signature, and its own nonce point R_a = k*G,
+// together with a DLEQ proof that they share k. Then
+//
+//	s' = k^-1 * (z + r*x)
+//
+// and the final signature is s = s' * t^-1, since (k*t)^-1 * (z + r*x) is a
+// valid s for the nonce k*t, whose point is R. Anyone seeing both s' and s
+// recovers t = s' * s^-1.
+type ECDSASignature struct {
+	NoncePoint  *secp.PublicKey  // R = k*T, whose x-coordinate mod n is r
+	SignerNonce *secp.PublicKey  // R_a = k*G
+	S           *secp.ModNScalar // s' = k^-1 * (z + r*x)
+	Proof       *DLEQProof       // Proof that log_G(R_a) = log_T(R)
+	PubKey      *secp.PublicKey  // P, the public key of the signer
+	Message     []byte           // z, the 32-byte hash being signed
+	// The adaptor point T is not included here, it must be known by the verifier
+}
+
+// NewECDSA creates an ECDSA adaptor signature of the 32-byte hash message,
+// such as a segwit v0 sighash, for the adaptor point T.
+//
+// The nonce k is derived like the nonce of New, with its own tag, so the
+// same options apply and the same key can safely sign with both schemes.
+// The inverse of k is computed in constant time. The nonce and k*T use
+// multiplications with uniform table access, which are not constant-time.
+func NewECDSA(privateKey *secp.PrivateKey, adaptorPoint *secp.PublicKey, message []byte, opts ...SignOption) (*ECDSASignature, error) {
+	if len(message) != 32 {
+		return nil, fmt.Errorf("message must be a 32-byte hash, got %d bytes", len(message))
+	}
+	o, err := newSignOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var P secp.JacobianPoint
+	scalarBaseMult(&privateKey.Key, &P)
+	pubKey := secp.NewPublicKey(&P.X, &P.Y)
+
+	// Derive the nonce (k)
+	k, err := deriveNonce(tagECDSANonce, &privateKey.Key, o.auxRand,
+		adaptorPoint.SerializeCompressed(), pubKey.SerializeCompressed(), message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	defer k.Zero()
+
+	// Calculate the signer's nonce point R_a = k*G and the nonce point R = k*T
+	var Ra, R, T secp.JacobianPoint
+	scalarBaseMult(k, &Ra)
+	scalarMult(k, adaptorPoint, &R)
+	adaptorPoint.AsJacobian(&T)
+
+	r, ok := ecdsaR(&R)
+	if !ok {
+		return nil, fmt.Errorf("nonce point has a zero x-coordinate")
+	}
+
+	proof, err := proveDLEQ(k, &T, &Ra, &R, o.auxRand)
+	if err != nil {
+		return nil, err
+	}
+
+	// s' = k^-1 * (z + r*x) mod n
+	var z secp.ModNScalar
+	z.SetByteSlice(message)
+	kInv := inverse(k)
+	defer kInv.Zero()
+	s := new(secp.ModNScalar).Mul2(r, &privateKey.Key).Add(&z).Mul(kInv)
+	if s.IsZero() {
+		return nil, fmt.Errorf("adaptor signature has s = 0")
+	}
+
+	sig := &ECDSASignature{
+		NoncePoint:  secp.NewPublicKey(&R.X, &R.Y),
+		SignerNonce: secp.NewPublicKey(&Ra.X, &Ra.Y),
+		S:           s,
+		Proof:       proof,
+		PubKey:      pubKey,
+		Message:     message,
+	}
+
+	// Sanity check that the signature verifies before handing it out
+	if !sig.Verify(adaptorPoint) {
+		return nil, ErrSignatureCreation
+	}
+
+	return sig, nil
+}
+
+// ecdsaR returns r, the x-coordinate of the affine point R reduced mod n,
+// and false when it is zero.
+func ecdsaR(R *secp.JacobianPoint) (*secp.ModNScalar, bool) {
+	r := new(secp.ModNScalar)
+	r.SetByteSlice(xBytes(R))
+	return r, !r.IsZero()
+}
+
+// Verify checks if an ECDSA adaptor signature is valid for the adaptor
+// point T. It checks the DLEQ proof, which ties R to the signer's nonce,
+// and the ECDSA equation s'*R_a = z*G + r*P, so that completing the
+// signature with the secret of T gives a valid signature.
+func (a *ECDSASignature) Verify(adaptorPoint *secp.PublicKey) bool {
+	if a == nil || a.NoncePoint == nil || a.SignerNonce == nil || a.S == nil || a.PubKey == nil || adaptorPoint == nil {
+		return false
+	}
+	if len(a.Message) != 32 || a.S.IsZero() {
+		return false
+	}
+	if !a.Proof.Verify(adaptorPoint, a.SignerNonce, a.NoncePoint) {
+		return false
+	}
+
+	var R, Ra, P secp.JacobianPoint
+	a.NoncePoint.AsJacobian(&R)
+	a.SignerNonce.AsJacobian(&Ra)
+	a.PubKey.AsJacobian(&P)
+	r, ok := ecdsaR(&R)
+	if !ok {
+		return false
+	}
+
+	// Everything here is public, so the variable-time multiplications are used
+	var z secp.ModNScalar
+	z.SetByteSlice(a.Message)
+	var lhs, zG, rP, rhs secp.JacobianPoint
+	secp.ScalarMultNonConst(a.S, &Ra, &lhs)
+	secp.ScalarBaseMultNonConst(&z, &zG)
+	secp.ScalarMultNonConst(r, &P, &rP)
+	secp.AddNonConst(&zG, &rP, &rhs)
+	if isInfinity(&lhs) || isInfinity(&rhs) {
+		return false
+	}
+	lhs.ToAffine()
+	rhs.ToAffine()
+
+	return lhs.X.Equals(&rhs.X) && lhs.Y.Equals(&rhs.Y)
+}
+
+// Complete decrypts the adaptor signature with the secret.
+// Returns s = s' * t^-1, negated when needed to make it low-S as required
+// by the standardness rules, which is the s value of the final signature.
+func (a *ECDSASignature) Complete(secret *secp.ModNScalar) *secp.ModNScalar {
+	tInv := inverse(secret)
+	sFinal := new(secp.ModNScalar).Mul2(a.S, tInv)
+	tInv.Zero()
+
+	if sFinal.IsOverHalfOrder() {
+		sFinal.Negate()
+	}
+
+	return sFinal
+}
+
+// ExtractSecret extracts the secret from a completed signature.
+// It computes t = s' * s^-1, which is the secret up to the sign lost to the
+// low-S rule. The sign is the one for which t*R_a = R. There is exactly one
+// secret for each completed signature.
+func (a *ECDSASignature) ExtractSecret(completedSig *secp.ModNScalar) *secp.ModNScalar {
+	t := new(secp.ModNScalar).InverseValNonConst(completedSig).Mul(a.S)
+
+	// The completed signature is public, so this runs in variable time
+	var Ra, tRa secp.JacobianPoint
+	a.SignerNonce.AsJacobian(&Ra)
+	secp.ScalarMultNonConst(t, &Ra, &tRa)
+	tRa.ToAffine()
+	if !isInfinity(&tRa) && !secp.NewPublicKey(&tRa.X, &tRa.Y).IsEqual(a.NoncePoint) {
+		t.Negate()
+	}
+
+	return t
+}
+
+// GenerateFinalSignature generates the DER encoded ECDSA signature (r, s)
+// from a completed adaptor signature. Spending a segwit v0 output needs the
+// sighash type appended to it.
+func (a *ECDSASignature) GenerateFinalSignature(completedSig *secp.ModNScalar) []byte {
+	var R secp.JacobianPoint
+	a.NoncePoint.AsJacobian(&R)
+	r, _ := ecdsaR(&R)
+
+	return ecdsa.NewSignature(r, completedSig).Serialize()
+}
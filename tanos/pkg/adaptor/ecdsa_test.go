@@ -0,0 +1,176 @@
+package adaptor
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestECDSAAdaptor checks that completed ECDSA adaptor signatures verify
+// with btcec, are low-S, and give back exactly the secret.
+func TestECDSAAdaptor(t *testing.T) {
+	iterations := 64
+	if testing.Short() {
+		iterations = 16
+	}
+
+	for i := 0; i < iterations; i++ {
+		privKey := generatePrivKey()
+		secret := generatePrivKey()
+		adaptorPoint := secret.PubKey()
+		message := chainhash.DoubleHashB([]byte{byte(i)})
+
+		sig, err := NewECDSA(privKey, adaptorPoint, message)
+		if err != nil {
+			t.Fatalf("Failed to create ECDSA adaptor signature: %v", err)
+		}
+		if !sig.Verify(adaptorPoint) {
+			t.Fatalf("ECDSA adaptor signature failed verification")
+		}
+
+		completed := sig.Complete(&secret.Key)
+		if completed.IsOverHalfOrder() {
+			t.Fatalf("Completed signature is not low-S")
+		}
+		final, err := ecdsa.ParseDERSignature(sig.GenerateFinalSignature(completed))
+		if err != nil {
+			t.Fatalf("Failed to parse final signature: %v", err)
+		}
+		if !final.Verify(message, privKey.PubKey()) {
+			t.Fatalf("Final signature does not verify")
+		}
+
+		if !sig.ExtractSecret(completed).Equals(&secret.Key) {
+			t.Fatalf("Extracted the wrong secret")
+		}
+	}
+}
+
+// TestECDSAVerifyRejects checks that tampered ECDSA adaptor signatures and
+// wrong adaptor points are rejected.
+func TestECDSAVerifyRejects(t *testing.T) {
+	privKey := generatePrivKey()
+	adaptorPoint := generatePrivKey().PubKey()
+	message := chainhash.DoubleHashB([]byte("ecdsa adaptor"))
+
+	sig, err := NewECDSA(privKey, adaptorPoint, message)
+	if err != nil {
+		t.Fatalf("Failed to create ECDSA adaptor signature: %v", err)
+	}
+
+	negT := negatePubKey(adaptorPoint)
+	if sig.Verify(negT) || sig.Verify(generatePrivKey().PubKey()) {
+		t.Fatalf("Verified against the wrong adaptor point")
+	}
+
+	tampered := func(modify func(s *ECDSASignature)) *ECDSASignature {
+		s := *sig
+		modify(&s)
+		return &s
+	}
+	one := new(btcec.ModNScalar).SetInt(1)
+	cases := map[string]*ECDSASignature{
+		"s+1": tampered(func(s *ECDSASignature) {
+			s.S = new(btcec.ModNScalar).Add2(sig.S, one)
+		}),
+		"wrong message": tampered(func(s *ECDSASignature) {
+			s.Message = chainhash.DoubleHashB([]byte("another message"))
+		}),
+		"wrong public key": tampered(func(s *ECDSASignature) {
+			s.PubKey = generatePrivKey().PubKey()
+		}),
+		"unrelated nonce point": tampered(func(s *ECDSASignature) {
+			s.NoncePoint = generatePrivKey().PubKey()
+		}),
+		"wrong proof": tampered(func(s *ECDSASignature) {
+			s.Proof = &DLEQProof{E: sig.Proof.E, S: new(btcec.ModNScalar).Add2(sig.Proof.S, one)}
+		}),
+		"short message": tampered(func(s *ECDSASignature) {
+			s.Message = message[:31]
+		}),
+		"missing proof": tampered(func(s *ECDSASignature) {
+			s.Proof = nil
+		}),
+	}
+	for name, s := range cases {
+		if s.Verify(adaptorPoint) {
+			t.Fatalf("Tampered signature (%s) verified", name)
+		}
+	}
+
+	if _, err := NewECDSA(privKey, adaptorPoint, message[:20]); err == nil {
+		t.Fatalf("Signed a 20-byte message")
+	}
+}
+
+// negatePubKey returns -P.
+func negatePubKey(p *btcec.PublicKey) *btcec.PublicKey {
+	var j btcec.JacobianPoint
+	p.AsJacobian(&j)
+	negate(&j)
+	return btcec.NewPublicKey(&j.X, &j.Y)
+}
+
+// TestECDSAWitnessSpend spends a P2WPKH output with a completed ECDSA
+// adaptor signature, checked by the script interpreter.
+func TestECDSAWitnessSpend(t *testing.T) {
+	privKey := generatePrivKey()
+	secret := generatePrivKey()
+	pubKey := privKey.PubKey().SerializeCompressed()
+
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(pubKey), &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to create address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("Failed to create output script: %v", err)
+	}
+	prevOut := wire.NewTxOut(100_000, pkScript)
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(99_000, pkScript))
+
+	fetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+
+	// The script code of a P2WPKH input is the matching P2PKH script
+	scriptCode, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(pubKey)).
+		AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		t.Fatalf("Failed to create script code: %v", err)
+	}
+	sighash, err := txscript.CalcWitnessSigHash(scriptCode, sigHashes, txscript.SigHashAll, tx, 0, prevOut.Value)
+	if err != nil {
+		t.Fatalf("Failed to compute sighash: %v", err)
+	}
+
+	sig, err := NewECDSA(privKey, secret.PubKey(), sighash)
+	if err != nil {
+		t.Fatalf("Failed to create ECDSA adaptor signature: %v", err)
+	}
+	if !sig.Verify(secret.PubKey()) {
+		t.Fatalf("ECDSA adaptor signature failed verification")
+	}
+
+	final := sig.GenerateFinalSignature(sig.Complete(&secret.Key))
+	tx.TxIn[0].Witness = wire.TxWitness{append(final, byte(txscript.SigHashAll)), pubKey}
+
+	engine, err := txscript.NewEngine(pkScript, tx, 0, txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, fetcher)
+	if err != nil {
+		t.Fatalf("Failed to create script engine: %v", err)
+	}
+	if err := engine.Execute(); err != nil {
+		t.Fatalf("Witness failed to execute: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package adaptor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/crypto"
+)
+
+// EncodingVersion is the version of the Signature encodings.
+const EncodingVersion = 1
+
+// MaxMessageSize bounds the message of a decoded signature. Signed messages
+// are hashes, so anything larger is rejected before allocating it.
+const MaxMessageSize = 1024
+
+// ErrUnsupportedVersion is returned when decoding an encoding of an unknown version.
+var ErrUnsupportedVersion = fmt.Errorf("unsupported encoding version")
+
+// MarshalBinary encodes the signature as
+//
+//	version (1) || R' compressed (33) || s (32) || P compressed (33) || parity (1) || varint len(m) || m
+func (a *Signature) MarshalBinary() ([]byte, error) {
+	if a.NoncePoint == nil || a.S == nil || a.PubKey == nil {
+		return nil, fmt.Errorf("incomplete adaptor signature")
+	}
+	if len(a.Message) > MaxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds %d", len(a.Message), MaxMessageSize)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(EncodingVersion)
+	buf.Write(a.NoncePoint.SerializeCompressed())
+	buf.Write(crypto.SerializeModNScalar(a.S))
+	buf.Write(a.PubKey.SerializeCompressed())
+	buf.WriteByte(byte(a.Parity))
+	if err := wire.WriteVarBytes(&buf, 0, a.Message); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a signature encoded by MarshalBinary. Points must
+// be compressed and on the curve, s must be smaller than the curve order, the
+// parity must agree with the points and no trailing bytes are allowed.
+func (a *Signature) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty adaptor signature encoding")
+	}
+	if data[0] != EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[0])
+	}
+
+	r := bytes.NewReader(data[1:])
+	fields := make([]byte, 33+32+33+1)
+	if _, err := io.ReadFull(r, fields); err != nil {
+		return fmt.Errorf("truncated adaptor signature encoding")
+	}
+
+	noncePoint, err := crypto.ParseCompressedPubKey(fields[:33])
+	if err != nil {
+		return fmt.Errorf("invalid nonce point: %v", err)
+	}
+	s, err := crypto.ParseScalar(fields[33:65])
+	if err != nil {
+		return fmt.Errorf("invalid s: %v", err)
+	}
+	pubKey, err := crypto.ParseCompressedPubKey(fields[65:98])
+	if err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	parity, err := parseParity(fields[98], noncePoint, pubKey)
+	if err != nil {
+		return err
+	}
+
+	message, err := wire.ReadVarBytes(r, 0, MaxMessageSize, "message")
+	if err != nil {
+		return fmt.Errorf("invalid message: %v", err)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d trailing bytes after adaptor signature", r.Len())
+	}
+
+	*a = Signature{
+		NoncePoint: noncePoint,
+		S:          s,
+		PubKey:     pubKey,
+		Message:    message,
+		Parity:     parity,
+	}
+
+	return nil
+}
+
+// parseParity decodes a parity byte, checking it against the parities of
+// the nonce point and public key. The parities of R and T are checked when
+// the signature is verified against T.
+func parseParity(b byte, noncePoint, pubKey *secp.PublicKey) (Parity, error) {
+	parity := Parity(b)
+	if parity&^parityMask != 0 {
+		return 0, fmt.Errorf("unknown parity bits %#x", b)
+	}
+
+	var r, p secp.JacobianPoint
+	noncePoint.AsJacobian(&r)
+	pubKey.AsJacobian(&p)
+	if parity&(NonceOdd|KeyOdd) != pointParity(&r, NonceOdd)|pointParity(&p, KeyOdd) {
+		return 0, fmt.Errorf("parity %#x does not match the nonce point and public key", b)
+	}
+
+	return parity, nil
+}
+
+// signatureJSON is the JSON form of a Signature, with hex encoded fields.
+type signatureJSON struct {
+	Version    int    `json:"version"`
+	NoncePoint string `json:"nonce_point"`
+	S          string `json:"s"`
+	PubKey     string `json:"pubkey"`
+	Parity     Parity `json:"parity"`
+	Message    string `json:"message"`
+}
+
+// MarshalJSON encodes the signature as a versioned JSON object with
+// lowercase hex fields.
+func (a *Signature) MarshalJSON() ([]byte, error) {
+	if a.NoncePoint == nil || a.S == nil || a.PubKey == nil {
+		return nil, fmt.Errorf("incomplete adaptor signature")
+	}
+
+	return json.Marshal(signatureJSON{
+		Version:    EncodingVersion,
+		NoncePoint: crypto.HexEncode(a.NoncePoint.SerializeCompressed()),
+		S:          crypto.HexEncode(crypto.SerializeModNScalar(a.S)),
+		PubKey:     crypto.HexEncode(a.PubKey.SerializeCompressed()),
+		Parity:     a.Parity,
+		Message:    crypto.HexEncode(a.Message),
+	})
+}
+
+// UnmarshalJSON decodes a signature encoded by MarshalJSON, with the same
+// checks as UnmarshalBinary. Unknown fields are rejected.
+func (a *Signature) UnmarshalJSON(data []byte) error {
+	var v signatureJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid adaptor signature JSON: %v", err)
+	}
+	if v.Version != EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, v.Version)
+	}
+
+	var raw []byte
+	raw = append(raw, EncodingVersion)
+	for _, field := range []struct {
+		name  string
+		value string
+		size  int
+	}{
+		{"nonce_point", v.NoncePoint, secp.PubKeyBytesLenCompressed},
+		{"s", v.S, 32},
+		{"pubkey", v.PubKey, secp.PubKeyBytesLenCompressed},
+	} {
+		b, err := crypto.DecodeHexStrict(field.value, field.size)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", field.name, err)
+		}
+		raw = append(raw, b...)
+	}
+	raw = append(raw, byte(v.Parity))
+
+	message, err := crypto.DecodeHexStrict(v.Message, 0)
+	if err != nil {
+		return fmt.Errorf("invalid message: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := wire.WriteVarBytes(&buf, 0, message); err != nil {
+		return err
+	}
+
+	return a.UnmarshalBinary(append(raw, buf.Bytes()...))
+}
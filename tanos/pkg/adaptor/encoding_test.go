@@ -0,0 +1,129 @@
+package adaptor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// offCurveX returns a compressed encoding whose x-coordinate has no point
+// on the curve.
+func offCurveX(t *testing.T) []byte {
+	for x := byte(1); x < 255; x++ {
+		candidate := make([]byte, 33)
+		candidate[0] = 0x02
+		candidate[32] = x
+		if _, err := btcec.ParsePubKey(candidate); err != nil {
+			return candidate
+		}
+	}
+
+	t.Fatalf("No off-curve x-coordinate found")
+	return nil
+}
+
+// newTestSignature creates an adaptor signature over a test message.
+func newTestSignature(t *testing.T) *Signature {
+	message := chainhash.DoubleHashB([]byte("adaptor signature encoding"))
+	sig, err := New(generatePrivKey(), generatePrivKey().PubKey(), message)
+	if err != nil {
+		t.Fatalf("Failed to create adaptor signature: %v", err)
+	}
+
+	return sig
+}
+
+// TestSignatureEncodingRoundTrip checks that both encodings decode to the
+// original signature.
+func TestSignatureEncodingRoundTrip(t *testing.T) {
+	sig := newTestSignature(t)
+
+	raw, err := sig.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode signature: %v", err)
+	}
+	var fromBinary Signature
+	if err := fromBinary.UnmarshalBinary(raw); err != nil {
+		t.Fatalf("Failed to decode signature: %v", err)
+	}
+
+	js, err := json.Marshal(sig)
+	if err != nil {
+		t.Fatalf("Failed to encode signature as JSON: %v", err)
+	}
+	var fromJSON Signature
+	if err := json.Unmarshal(js, &fromJSON); err != nil {
+		t.Fatalf("Failed to decode signature JSON: %v", err)
+	}
+
+	for _, decoded := range []*Signature{&fromBinary, &fromJSON} {
+		if !decoded.NoncePoint.IsEqual(sig.NoncePoint) || !decoded.S.Equals(sig.S) ||
+			!decoded.PubKey.IsEqual(sig.PubKey) || !bytes.Equal(decoded.Message, sig.Message) ||
+			decoded.Parity != sig.Parity {
+			t.Fatalf("Decoded signature differs from the original")
+		}
+	}
+}
+
+// TestSignatureDecodingIsStrict checks that malformed encodings are rejected.
+func TestSignatureDecodingIsStrict(t *testing.T) {
+	raw, err := newTestSignature(t).MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode signature: %v", err)
+	}
+
+	mutate := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), raw...))
+	}
+	overflow := bytes.Repeat([]byte{0xff}, 32)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"unknown version", mutate(func(b []byte) []byte { b[0] = 3; return b })},
+		{"version 0", mutate(func(b []byte) []byte { b[0] = 0; return b })},
+		{"truncated", raw[:50]},
+		{"trailing bytes", append(append([]byte(nil), raw...), 0)},
+		{"off-curve nonce", mutate(func(b []byte) []byte { copy(b[1:34], offCurveX(t)); return b })},
+		{"uncompressed prefix", mutate(func(b []byte) []byte { b[1] = 0x04; return b })},
+		{"overflowing s", mutate(func(b []byte) []byte { copy(b[34:66], overflow); return b })},
+		{"off-curve pubkey", mutate(func(b []byte) []byte { copy(b[66:99], offCurveX(t)); return b })},
+		{"unknown parity bit", mutate(func(b []byte) []byte { b[99] |= 0x80; return b })},
+		{"wrong nonce parity", mutate(func(b []byte) []byte { b[99] ^= byte(NonceOdd); return b })},
+		{"wrong key parity", mutate(func(b []byte) []byte { b[99] ^= byte(KeyOdd); return b })},
+		{"oversized message", mutate(func(b []byte) []byte {
+			return append(b[:100], 0xfd, 0x01, 0x08) // Claims a 2049 byte message
+		})},
+	}
+
+	for _, test := range tests {
+		var sig Signature
+		if err := sig.UnmarshalBinary(test.data); err == nil {
+			t.Fatalf("%s: expected decoding to fail", test.name)
+		}
+	}
+
+	var sig Signature
+	if err := sig.UnmarshalBinary(mutate(func(b []byte) []byte { b[0] = 3; return b })); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+
+	js, _ := json.Marshal(newTestSignature(t))
+	badJSON := []string{
+		strings.Replace(string(js), `"version":1`, `"version":3`, 1),
+		strings.Replace(string(js), `{`, `{"extra":true,`, 1),
+		strings.ToUpper(string(js)),
+	}
+	for _, data := range badJSON {
+		if err := json.Unmarshal([]byte(data), &sig); err == nil {
+			t.Fatalf("Expected JSON decoding to fail for %s", data)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package adaptor
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Tags of the hashes used to derive nonces. The auxiliary randomness is
+// hashed as in BIP340, while the nonce hashes have their own tags because
+// they also commit to the adaptor point. Every scheme has a separate tag, so
+// a key used for both Schnorr and ECDSA never reuses a nonce.
+var (
+	tagAux        = []byte("BIP0340/aux")
+	tagNonce      = []byte("TANOS/adaptor/nonce")
+	tagECDSANonce = []byte("TANOS/adaptor/ecdsa/nonce")
+	tagDLEQNonce  = []byte("TANOS/adaptor/dleq/nonce")
+)
+
+// signOptions holds the optional inputs of adaptor signature creation.
+type signOptions struct {
+	auxRand []byte
+}
+
+// SignOption configures the creation of an adaptor signature.
+type SignOption func(*signOptions)
+
+// WithAuxRand sets the 32 bytes of auxiliary randomness mixed into the nonce
+// instead of reading fresh ones. Passing 32 zero bytes makes signing fully
+// deterministic, as done by the test vectors.
+func WithAuxRand(auxRand []byte) SignOption {
+	return func(o *signOptions) {
+		o.auxRand = auxRand
+	}
+}
+
+// newSignOptions applies opts, reading fresh auxiliary randomness unless
+// WithAuxRand was given.
+func newSignOptions(opts []SignOption) (*signOptions, error) {
+	o := &signOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.auxRand == nil {
+		auxRand, err := freshAuxRand()
+		if err != nil {
+			return nil, err
+		}
+		o.auxRand = auxRand
+	}
+
+	return o, nil
+}
+
+// deriveNonce derives a nonce from the secret d, tagged with tag, and the
+// public data it must be unique to, following BIP340:
+//
+//	t = d XOR H_aux(a)
+//	k = H_tag(t || data...) mod n
+//
+// For Schnorr adaptor signatures d is the even-Y private key and the data is
+// the compressed adaptor point T, the x-only public key P and the message m.
+// The nonce is unique to every key, adaptor point and message even if the
+// auxiliary randomness a repeats or is predictable. Without fresh randomness
+// the same inputs give the same signature.
+func deriveNonce(tag []byte, d *secp.ModNScalar, auxRand []byte, data ...[]byte) (*secp.ModNScalar, error) {
+	if len(auxRand) != 32 {
+		return nil, fmt.Errorf("auxiliary randomness must have length 32, got %d", len(auxRand))
+	}
+
+	dBytes := d.Bytes()
+	aux := chainhash.TaggedHash(tagAux, auxRand)
+	for i := range dBytes {
+		dBytes[i] ^= aux[i]
+	}
+
+	size := 32
+	for _, b := range data {
+		size += len(b)
+	}
+	hashInput := make([]byte, 0, size)
+	hashInput = append(hashInput, dBytes[:]...)
+	for _, b := range data {
+		hashInput = append(hashInput, b...)
+	}
+	hash := chainhash.TaggedHash(tag, hashInput)
+
+	for i := range dBytes {
+		dBytes[i] = 0
+		hashInput[i] = 0
+	}
+
+	k := new(secp.ModNScalar)
+	k.SetBytes((*[32]byte)(hash))
+	if k.IsZero() {
+		return nil, fmt.Errorf("derived nonce is zero")
+	}
+
+	return k, nil
+}
+
+// freshAuxRand reads 32 bytes of auxiliary randomness.
+func freshAuxRand() ([]byte, error) {
+	auxRand := make([]byte, 32)
+	if _, err := rand.Read(auxRand); err != nil {
+		return nil, fmt.Errorf("failed to read randomness: %v", err)
+	}
+
+	return auxRand, nil
+}
@@ -0,0 +1,173 @@
+package adaptor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// adaptorVectors is the layout of testdata/adaptor_vectors.json.
+type adaptorVectors struct {
+	Valid []struct {
+		SecretKey     string `json:"secret_key"`
+		PubKey        string `json:"pubkey"`
+		AdaptorSecret string `json:"adaptor_secret"`
+		AdaptorPoint  string `json:"adaptor_point"`
+		AuxRand       string `json:"aux_rand"`
+		Message       string `json:"message"`
+		NoncePoint    string `json:"nonce_point"`
+		S             string `json:"s"`
+		Parity        Parity `json:"parity"`
+		Signature     string `json:"signature"`
+		Comment       string `json:"comment"`
+	} `json:"valid_test_cases"`
+	VerifyFail []struct {
+		PubKey       string `json:"pubkey"`
+		AdaptorPoint string `json:"adaptor_point"`
+		Message      string `json:"message"`
+		NoncePoint   string `json:"nonce_point"`
+		S            string `json:"s"`
+		Parity       Parity `json:"parity"`
+		Comment      string `json:"comment"`
+	} `json:"verify_fail_test_cases"`
+}
+
+// mustDecodeHex decodes a hex string or fails the test.
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// mustParsePubKey decodes a hex encoded public key or fails the test.
+func mustParsePubKey(t *testing.T, s string) *btcec.PublicKey {
+	t.Helper()
+
+	pubKey, err := btcec.ParsePubKey(mustDecodeHex(t, s))
+	if err != nil {
+		t.Fatalf("Invalid public key %q: %v", s, err)
+	}
+	return pubKey
+}
+
+// TestAdaptorVectors checks signing, completion, extraction and verification
+// against testdata/adaptor_vectors.json.
+func TestAdaptorVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/adaptor_vectors.json")
+	if err != nil {
+		t.Fatalf("Failed to read test vectors: %v", err)
+	}
+	var vectors adaptorVectors
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("Failed to parse test vectors: %v", err)
+	}
+
+	for i, v := range vectors.Valid {
+		privKey, pubKey := btcec.PrivKeyFromBytes(mustDecodeHex(t, v.SecretKey))
+		secret, adaptorPoint := btcec.PrivKeyFromBytes(mustDecodeHex(t, v.AdaptorSecret))
+		message := mustDecodeHex(t, v.Message)
+		if !pubKey.IsEqual(mustParsePubKey(t, v.PubKey)) || !adaptorPoint.IsEqual(mustParsePubKey(t, v.AdaptorPoint)) {
+			t.Fatalf("Vector %d: keys do not match their secrets", i)
+		}
+
+		sig, err := New(privKey, adaptorPoint, message, WithAuxRand(mustDecodeHex(t, v.AuxRand)))
+		if err != nil {
+			t.Fatalf("Vector %d: failed to sign: %v", i, err)
+		}
+		sBytes := sig.S.Bytes()
+		if hex.EncodeToString(sig.NoncePoint.SerializeCompressed()) != v.NoncePoint ||
+			hex.EncodeToString(sBytes[:]) != v.S || sig.Parity != v.Parity {
+			t.Fatalf("Vector %d (%s): unexpected adaptor signature", i, v.Comment)
+		}
+		if !sig.Verify(adaptorPoint) {
+			t.Fatalf("Vector %d: adaptor signature failed verification", i)
+		}
+
+		completed := sig.Complete(&secret.Key)
+		final := sig.GenerateFinalSignature(completed)
+		if hex.EncodeToString(final) != v.Signature {
+			t.Fatalf("Vector %d: unexpected final signature", i)
+		}
+
+		// btcec only verifies signatures of 32-byte messages
+		if len(message) == 32 {
+			parsed, err := schnorr.ParseSignature(final)
+			if err != nil || !parsed.Verify(message, pubKey) {
+				t.Fatalf("Vector %d: final signature does not verify: %v", i, err)
+			}
+		}
+		if !sig.ExtractSecret(completed).Equals(&secret.Key) {
+			t.Fatalf("Vector %d: extracted the wrong secret", i)
+		}
+	}
+
+	for i, v := range vectors.VerifyFail {
+		s := new(btcec.ModNScalar)
+		if overflow := s.SetByteSlice(mustDecodeHex(t, v.S)); overflow {
+			t.Fatalf("Vector %d: s overflows", i)
+		}
+		sig := &Signature{
+			NoncePoint: mustParsePubKey(t, v.NoncePoint),
+			S:          s,
+			PubKey:     mustParsePubKey(t, v.PubKey),
+			Message:    mustDecodeHex(t, v.Message),
+			Parity:     v.Parity,
+		}
+		if sig.Verify(mustParsePubKey(t, v.AdaptorPoint)) {
+			t.Fatalf("Verify failure vector %d (%s) verified", i, v.Comment)
+		}
+	}
+}
+
+// TestNonceDerivation checks that fixed auxiliary randomness gives
+// reproducible signatures, and that fresh randomness gives new nonces.
+func TestNonceDerivation(t *testing.T) {
+	privKey := generatePrivKey()
+	adaptorPoint := generatePrivKey().PubKey()
+	message := chainhash.DoubleHashB([]byte("deterministic nonces"))
+	zero := make([]byte, 32)
+
+	sign := func(opts ...SignOption) *Signature {
+		sig, err := New(privKey, adaptorPoint, message, opts...)
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		return sig
+	}
+
+	first, second := sign(WithAuxRand(zero)), sign(WithAuxRand(zero))
+	if !first.NoncePoint.IsEqual(second.NoncePoint) || !first.S.Equals(second.S) {
+		t.Fatalf("Signatures with the same auxiliary randomness differ")
+	}
+
+	aux := bytes.Repeat([]byte{1}, 32)
+	if sign(WithAuxRand(aux)).NoncePoint.IsEqual(first.NoncePoint) {
+		t.Fatalf("Auxiliary randomness did not change the nonce")
+	}
+	if sign().NoncePoint.IsEqual(sign().NoncePoint) {
+		t.Fatalf("Fresh auxiliary randomness repeated a nonce")
+	}
+
+	// The nonce also commits to the adaptor point and the message
+	other, err := New(privKey, generatePrivKey().PubKey(), message, WithAuxRand(zero))
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if other.S.Equals(first.S) {
+		t.Fatalf("Nonce does not depend on the adaptor point")
+	}
+
+	if _, err := New(privKey, adaptorPoint, message, WithAuxRand(zero[:31])); err == nil {
+		t.Fatalf("Accepted 31 bytes of auxiliary randomness")
+	}
+}
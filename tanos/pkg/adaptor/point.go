@@ -0,0 +1,210 @@
+package adaptor
+
+import (
+	"crypto/subtle"
+	"sync"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+)
+
+// baseTable[i][j] holds the affine point (j+1) * 16^i * G, for every 4-bit
+// window i of a scalar and every window value j. baseOffset holds -C where
+// C = sum(16^i * G) for i = 0..63. Adding (w+1) * 16^i * G for every window
+// value w adds C on top of the product, which baseOffset removes again.
+// Adding a non-zero multiple for every window keeps the number of additions
+// independent of the secret's zero windows.
+var (
+	baseTableOnce sync.Once
+	baseTable     [64][16]secp.JacobianPoint
+	baseOffset    secp.JacobianPoint
+)
+
+// initBaseTable computes baseTable and baseOffset.
+func initBaseTable() {
+	var base secp.JacobianPoint
+	one := new(secp.ModNScalar).SetInt(1)
+	secp.ScalarBaseMultNonConst(one, &base)
+	base.ToAffine()
+
+	for i := range baseTable {
+		baseTable[i][0].Set(&base)
+		for j := 1; j < len(baseTable[i]); j++ {
+			secp.AddNonConst(&baseTable[i][j-1], &base, &baseTable[i][j])
+			baseTable[i][j].ToAffine()
+		}
+
+		// 16^(i+1) * G is the last entry of this window
+		base.Set(&baseTable[i][15])
+	}
+
+	// C is 0x1111...11 * G, as sum(16^i) for i = 0..63 has 64 hex digits of 1
+	var c [32]byte
+	for i := range c {
+		c[i] = 0x11
+	}
+	var offset secp.ModNScalar
+	offset.SetBytes(&c)
+	secp.ScalarBaseMultNonConst(&offset, &baseOffset)
+	baseOffset.ToAffine()
+	negate(&baseOffset)
+}
+
+// selectBase sets result to (w+1) * 16^i * G, reading every entry of the
+// window's table so the memory access pattern does not depend on w.
+func selectBase(i int, w uint8, result *secp.JacobianPoint) {
+	selectPoint(&baseTable[i], w, result)
+}
+
+// selectPoint sets result to the affine point table[w], reading every entry
+// of the table so the memory access pattern does not depend on w.
+func selectPoint(table *[16]secp.JacobianPoint, w uint8, result *secp.JacobianPoint) {
+	var x, y, tmp secp.FieldVal
+	for j := range table {
+		bit := uint8(subtle.ConstantTimeByteEq(uint8(j), w))
+		x.Add(tmp.Set(&table[j].X).MulInt(bit))
+		y.Add(tmp.Set(&table[j].Y).MulInt(bit))
+	}
+
+	result.X.Set(x.Normalize())
+	result.Y.Set(y.Normalize())
+	result.Z.SetInt(1)
+}
+
+// scalarBaseMult sets result to k*G in affine coordinates. Unlike
+// secp.ScalarBaseMultNonConst, it reads every table entry and performs one
+// addition per window for every k. This is uniform table access, not
+// constant-time: the additions use secp.AddNonConst, whose formulas branch
+// on the points, so its timing can still depend on k.
+func scalarBaseMult(k *secp.ModNScalar, result *secp.JacobianPoint) {
+	baseTableOnce.Do(initBaseTable)
+
+	kBytes := k.Bytes()
+	defer func() {
+		for i := range kBytes {
+			kBytes[i] = 0
+		}
+	}()
+
+	// Window i holds bits 4i..4i+3 of k, counted from the least significant
+	var acc, sum, addend secp.JacobianPoint
+	acc.Set(&baseOffset)
+	for i := 0; i < 64; i++ {
+		w := kBytes[31-i/2] & 0x0f
+		if i%2 == 1 {
+			w = kBytes[31-i/2] >> 4
+		}
+
+		selectBase(i, w, &addend)
+		secp.AddNonConst(&acc, &addend, &sum)
+		acc.Set(&sum)
+	}
+	addend.X.Zero()
+	addend.Y.Zero()
+
+	result.Set(&acc)
+	result.ToAffine()
+}
+
+// scalarMult sets result to k*P in affine coordinates, for a secret k and
+// an arbitrary point P that is not the point at infinity. Like
+// scalarBaseMult it adds (w+1) * P for every 4-bit window w of k, from the
+// most significant one down, and removes the extra C*P at the end. It has
+// the same uniform table access and is not constant-time either, as the
+// doublings and additions use the NonConst formulas.
+func scalarMult(k *secp.ModNScalar, point *secp.PublicKey, result *secp.JacobianPoint) {
+	// table[j] holds (j+1) * P
+	var table [16]secp.JacobianPoint
+	point.AsJacobian(&table[0])
+	entries := make([]*secp.JacobianPoint, 0, len(table)-1)
+	for j := 1; j < len(table); j++ {
+		secp.AddNonConst(&table[j-1], &table[0], &table[j])
+		entries = append(entries, &table[j])
+	}
+	normalizeBatch(entries)
+
+	kBytes := k.Bytes()
+	defer func() {
+		for i := range kBytes {
+			kBytes[i] = 0
+		}
+	}()
+
+	var acc, sum, addend secp.JacobianPoint
+	for i := 63; i >= 0; i-- {
+		w := kBytes[31-i/2] & 0x0f
+		if i%2 == 1 {
+			w = kBytes[31-i/2] >> 4
+		}
+
+		selectPoint(&table, w, &addend)
+		if i == 63 {
+			acc.Set(&addend)
+			continue
+		}
+		for j := 0; j < 4; j++ {
+			secp.DoubleNonConst(&acc, &sum)
+			acc.Set(&sum)
+		}
+		secp.AddNonConst(&acc, &addend, &sum)
+		acc.Set(&sum)
+	}
+	addend.X.Zero()
+	addend.Y.Zero()
+
+	// C is public, so the offset is computed in variable time
+	var c [32]byte
+	for i := range c {
+		c[i] = 0x11
+	}
+	var offset secp.ModNScalar
+	offset.SetBytes(&c)
+	var cP, pJ secp.JacobianPoint
+	point.AsJacobian(&pJ)
+	secp.ScalarMultNonConst(&offset, &pJ, &cP)
+	cP.ToAffine()
+	negate(&cP)
+
+	secp.AddNonConst(&acc, &cP, result)
+	result.ToAffine()
+}
+
+// inverse returns k^-1 mod n computed as k^(n-2), with a sequence of
+// operations that only depends on the public exponent. k must not be zero.
+func inverse(k *secp.ModNScalar) *secp.ModNScalar {
+	// n - 2, big endian
+	exp := [32]byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe,
+		0xba, 0xae, 0xdc, 0xe6, 0xaf, 0x48, 0xa0, 0x3b,
+		0xbf, 0xd2, 0x5e, 0x8c, 0xd0, 0x36, 0x41, 0x3f,
+	}
+
+	result := new(secp.ModNScalar).SetInt(1)
+	for _, b := range exp {
+		for bit := 7; bit >= 0; bit-- {
+			result.Square()
+			if b>>bit&1 == 1 {
+				result.Mul(k)
+			}
+		}
+	}
+
+	return result
+}
+
+// isInfinity reports whether the point is the point at infinity.
+func isInfinity(p *secp.JacobianPoint) bool {
+	return (p.X.IsZero() && p.Y.IsZero()) || p.Z.IsZero()
+}
+
+// negate sets p to -p. p must be in affine coordinates.
+func negate(p *secp.JacobianPoint) {
+	p.Y.Negate(1).Normalize()
+}
+
+// xBytes returns the 32-byte big endian x-coordinate of an affine point.
+func xBytes(p *secp.JacobianPoint) []byte {
+	var b [32]byte
+	p.X.PutBytes(&b)
+	return b[:]
+}
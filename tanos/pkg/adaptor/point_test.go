@@ -0,0 +1,68 @@
+package adaptor
+
+import (
+	"testing"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+)
+
+// TestScalarBaseMult checks the constant-time base point multiplication
+// against the variable-time one from btcec.
+func TestScalarBaseMult(t *testing.T) {
+	scalars := []*secp.ModNScalar{
+		new(secp.ModNScalar).SetInt(1),
+		new(secp.ModNScalar).SetInt(15),
+		new(secp.ModNScalar).SetInt(16),
+		new(secp.ModNScalar).SetInt(1).Negate(),
+	}
+	for i := 0; i < 256; i++ {
+		scalars = append(scalars, &generatePrivKey().Key)
+	}
+
+	for _, k := range scalars {
+		var got, want secp.JacobianPoint
+		scalarBaseMult(k, &got)
+		secp.ScalarBaseMultNonConst(k, &want)
+		want.ToAffine()
+
+		if !got.X.Equals(&want.X) || !got.Y.Equals(&want.Y) {
+			t.Fatalf("scalarBaseMult(%x) differs from btcec", k.Bytes())
+		}
+	}
+
+	var zero secp.JacobianPoint
+	scalarBaseMult(new(secp.ModNScalar), &zero)
+	if !isInfinity(&zero) {
+		t.Fatalf("scalarBaseMult(0) is not the point at infinity")
+	}
+}
+
+// TestScalarMult checks the constant-time multiplication of arbitrary points
+// and the constant-time inverse against the variable-time ones from btcec.
+func TestScalarMult(t *testing.T) {
+	scalars := []*secp.ModNScalar{
+		new(secp.ModNScalar).SetInt(1),
+		new(secp.ModNScalar).SetInt(16),
+		new(secp.ModNScalar).SetInt(1).Negate(),
+	}
+	for i := 0; i < 64; i++ {
+		scalars = append(scalars, &generatePrivKey().Key)
+	}
+
+	for _, k := range scalars {
+		point := generatePrivKey().PubKey()
+
+		var p, got, want secp.JacobianPoint
+		point.AsJacobian(&p)
+		scalarMult(k, point, &got)
+		secp.ScalarMultNonConst(k, &p, &want)
+		want.ToAffine()
+		if !got.X.Equals(&want.X) || !got.Y.Equals(&want.Y) {
+			t.Fatalf("scalarMult(%x) differs from btcec", k.Bytes())
+		}
+
+		if !inverse(k).Equals(new(secp.ModNScalar).InverseValNonConst(k)) {
+			t.Fatalf("inverse(%x) differs from btcec", k.Bytes())
+		}
+	}
+}
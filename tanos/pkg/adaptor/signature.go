@@ -1,10 +1,19 @@
 // Package adaptor implements adaptor signatures based on Schnorr.
 // Adaptor signatures allow creating signatures that reveal a secret
 // when completed, enabling atomic swaps and other protocols.
+//
+// The completed signatures are BIP340 signatures: they verify against the
+// x-only form of the signer's key, with the x-only form of the nonce
+// R' = R + T. Every negation this needs is decided once, when signing, and
+// recorded in the signature's Parity, so completing a signature and
+// extracting the secret from it are exact inverses.
+//
+// ECDSASignature provides the same operations for ECDSA, for outputs that
+// cannot be spent with Schnorr signatures such as P2WPKH and P2WSH. The
+// segwit swaps of the tanos package sign their P2WSH claims with it.
 package adaptor
 
 import (
-	"bytes"
 	"fmt"
 	"math/big"
 
@@ -18,323 +27,305 @@ import (
 // ErrSignatureCreation is returned when signature creation fails
 var ErrSignatureCreation = fmt.Errorf("adaptor signature creation failed: verification equation does not hold")
 
+// Parity records the Y-coordinate parities an adaptor signature was created
+// with. A set bit means the corresponding Y-coordinate is odd.
+type Parity uint8
+
+const (
+	// NonceOdd is set when R' = R + T has an odd Y. BIP340 commits to the
+	// even point -R', so the signer negated k and the secret enters the
+	// completed signature negated.
+	NonceOdd Parity = 1 << iota
+
+	// KeyOdd is set when P has an odd Y. BIP340 signs for the even point
+	// -P, so the signer negated its private key.
+	KeyOdd
+
+	// RandomNonceOdd is set when the signer's own nonce R = k*G has an odd Y.
+	RandomNonceOdd
+
+	// AdaptorOdd is set when the adaptor point T has an odd Y. A verifier
+	// holding -T, which has the same x-coordinate, is rejected.
+	AdaptorOdd
+
+	// parityMask covers every defined parity bit.
+	parityMask = NonceOdd | KeyOdd | RandomNonceOdd | AdaptorOdd
+)
+
+// Has reports whether every bit of flag is set.
+func (p Parity) Has(flag Parity) bool {
+	return p&flag == flag
+}
+
 // Signature encapsulates the data of an adaptor signature.
 type Signature struct {
 	NoncePoint *secp.PublicKey  // R' = R + T, where T is the adaptor point
-	S          *secp.ModNScalar // s_a = k + e*x (or -k + e*x if R'.Y is odd)
+	S          *secp.ModNScalar // s = ±k + e*(±x), with the signs given by Parity
 	PubKey     *secp.PublicKey  // P, the public key of the signer
 	Message    []byte           // m, the message being signed
+	Parity     Parity           // The parities of R', P, R and T at signing time
 	// The adaptor point T is not included here, it must be known by the verifier
 }
 
+// pointParity returns flag if p has an odd Y-coordinate, and zero otherwise.
+func pointParity(p *secp.JacobianPoint, flag Parity) Parity {
+	if p.Y.IsOdd() {
+		return flag
+	}
+	return 0
+}
+
+// challengeHash computes the BIP340 tagged hash H(R'.x || P.x || m).
+func challengeHash(noncePoint, pubKey *secp.JacobianPoint, message []byte) *chainhash.Hash {
+	hashInput := make([]byte, 0, 64+len(message))
+	hashInput = append(hashInput, xBytes(noncePoint)...)
+	hashInput = append(hashInput, xBytes(pubKey)...)
+	hashInput = append(hashInput, message...)
+
+	return chainhash.TaggedHash(chainhash.TagBIP0340Challenge, hashInput)
+}
+
+// challenge computes the BIP340 challenge e = H(R'.x || P.x || m) mod n.
+func challenge(noncePoint, pubKey *secp.JacobianPoint, message []byte) *secp.ModNScalar {
+	hash := challengeHash(noncePoint, pubKey, message)
+
+	e := new(secp.ModNScalar)
+	e.SetBytes((*[32]byte)(hash))
+
+	return e
+}
+
 // New creates a new adaptor signature.
 // It implements the key part of the atomic swap protocol - creating a
 // signature that will reveal a secret when completed.
 // This follows the BIP340 Schnorr signature scheme with an adaptor point.
 //
-// BIP340 requires the nonce point to have an even Y-coordinate for challenge calculation.
-// When R'.Y is odd, we:
-// 1. Negate the nonce scalar k
-// 2. Use an adjusted nonce with even Y for challenge calculation
-// These steps ensure compatibility with the BIP340 verification process.
-func New(privateKey *secp.PrivateKey, adaptorPoint *secp.PublicKey, message []byte) (*Signature, error) {
-	// Generate a random nonce (k)
-	k, err := secp.NewPrivateKey()
+// BIP340 only knows even points, so:
+// 1. When P.Y is odd, the private key x is negated
+// 2. When R'.Y is odd, the nonce scalar k is negated
+// Both choices are recorded in the Parity of the signature.
+//
+// The nonce k is derived from the private key, the adaptor point, the
+// message and 32 bytes of auxiliary randomness, which are read fresh unless
+// given with WithAuxRand. A weak random number generator therefore cannot
+// leak the private key, and fixed auxiliary randomness gives reproducible
+// signatures.
+//
+// The nonce and public key are computed with a base point multiplication
+// with uniform table access, though not constant-time, and all arithmetic
+// on k and x uses constant-time scalars.
+func New(privateKey *secp.PrivateKey, adaptorPoint *secp.PublicKey, message []byte, opts ...SignOption) (*Signature, error) {
+	o, err := newSignOptions(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+		return nil, err
 	}
 
-	// Calculate the nonce point R = k*G
-	R := k.PubKey()
+	// Calculate the public key P = x*G, negating x for an odd P per BIP340
+	var P secp.JacobianPoint
+	scalarBaseMult(&privateKey.Key, &P)
+	var x secp.ModNScalar
+	x.Set(&privateKey.Key)
+	if P.Y.IsOdd() {
+		x.Negate()
+	}
+	defer x.Zero()
 
-	// Calculate the adaptor nonce point R' = R + T
-	adaptorNonce, err := AddPubKeys(R, adaptorPoint)
+	// Derive the nonce (k)
+	kScalar, err := deriveNonce(tagNonce, &x, o.auxRand, adaptorPoint.SerializeCompressed(), xBytes(&P), message)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add pubkeys for adaptor nonce: %v", err)
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
 	}
-
-	// Check if R'.Y is odd (BIP340 requires an even Y coordinate for challenge computation)
-	negateK := adaptorNonce.Y().Bit(0) == 1
-
-	// Create adjusted nonce point for challenge calculation if needed
-	adjustedAdaptorNonce := adaptorNonce
-	if negateK {
-		// Create a new point with same X but negated Y
-		fx := new(secp.FieldVal)
-		fy := new(secp.FieldVal)
-
-		if overflow := fx.SetByteSlice(adaptorNonce.X().Bytes()); overflow {
-			return nil, fmt.Errorf("overflow in field value")
-		}
-
-		// Negate Y value (p - y)
-		negY := new(big.Int).Sub(secp.S256().P, adaptorNonce.Y())
-
-		if overflow := fy.SetByteSlice(negY.Bytes()); overflow {
-			return nil, fmt.Errorf("overflow in field value")
-		}
-
-		adjustedAdaptorNonce = secp.NewPublicKey(fx, fy)
+	defer kScalar.Zero()
+
+	// Calculate the nonce point R = k*G and the adaptor nonce point R' = R + T
+	var R, T, adaptorNonce secp.JacobianPoint
+	scalarBaseMult(kScalar, &R)
+	adaptorPoint.AsJacobian(&T)
+	secp.AddNonConst(&R, &T, &adaptorNonce)
+	if isInfinity(&adaptorNonce) {
+		return nil, fmt.Errorf("adaptor nonce is the point at infinity")
 	}
+	adaptorNonce.ToAffine()
 
-	// Compute the challenge e = H(R' || P || m)
-	P := privateKey.PubKey()
-	eBigInt := SchnorrChallenge(adjustedAdaptorNonce, P, message)
-
-	// Convert to scalar
-	eScalar := new(secp.ModNScalar)
-	eBytes := crypto.PadTo32(eBigInt.Bytes())
-	if overflow := eScalar.SetByteSlice(eBytes); overflow {
-		return nil, fmt.Errorf("challenge scalar overflow")
-	}
+	parity := pointParity(&adaptorNonce, NonceOdd) | pointParity(&P, KeyOdd) |
+		pointParity(&R, RandomNonceOdd) | pointParity(&T, AdaptorOdd)
 
-	// Get the private key as scalar
-	xScalar := new(secp.ModNScalar)
-	xScalar.Set(&privateKey.Key)
+	noncePoint := secp.NewPublicKey(&adaptorNonce.X, &adaptorNonce.Y)
+	pubKey := secp.NewPublicKey(&P.X, &P.Y)
 
-	// Convert nonce to scalar
-	kScalar := new(secp.ModNScalar)
-	kScalar.Set(&k.Key)
+	// Compute the challenge e = H(R' || P || m), which only uses x-coordinates
+	e := challenge(&adaptorNonce, &P, message)
 
-	// If R'.Y is odd, negate k per BIP340
-	if negateK {
+	// Negate the nonce for an odd R' per BIP340
+	if parity.Has(NonceOdd) {
 		kScalar.Negate()
 	}
 
-	// s = k + e*d mod n
-	s := new(secp.ModNScalar)
-	s.Mul2(eScalar, xScalar) // s = e*d
-	s.Add(kScalar)           // s = k + e*d
-
-	// Verify the equation s*G = R + e*P during creation
-	// This is a sanity check to ensure our adaptor signature creation is correct
-	sBytes := crypto.SerializeModNScalar(s)
-	sgX, sgY := secp.S256().ScalarBaseMult(sBytes)
-
-	// Calculate e*P
-	eBytes = crypto.SerializeModNScalar(eScalar)
-	epX, epY := secp.S256().ScalarMult(P.X(), P.Y(), eBytes)
-
-	// Calculate the expected right side
-	// If negation was needed during signature creation,
-	// we use -R to match the negation of k
-	var checkPointX, checkPointY *big.Int
-	if negateK {
-		// Create -R
-		negR, err := crypto.NegatePoint(R)
-		if err != nil {
-			return nil, err
-		}
-
-		// Calculate (-R) + e*P
-		checkPointX, checkPointY = secp.S256().Add(negR.X(), negR.Y(), epX, epY)
-	} else {
-		// Calculate R + e*P
-		checkPointX, checkPointY = secp.S256().Add(R.X(), R.Y(), epX, epY)
-	}
-
-	// Verify equation s*G = R + e*P
-	if sgX.Cmp(checkPointX) != 0 || sgY.Cmp(checkPointY) != 0 {
-		return nil, ErrSignatureCreation
-	}
+	// s = k + e*x mod n
+	s := new(secp.ModNScalar).Mul2(e, &x).Add(kScalar)
 
-	// Double-check our R recovery logic
-	// Verify that R = R' - T
-	negT, err := crypto.NegatePoint(adaptorPoint)
-	if err != nil {
-		return nil, err
-	}
-
-	recoveredR, err := AddPubKeys(adaptorNonce, negT)
-	if err != nil {
-		return nil, err
+	sig := &Signature{
+		NoncePoint: noncePoint,
+		S:          s,
+		PubKey:     pubKey,
+		Message:    message,
+		Parity:     parity,
 	}
 
-	// Verify that the original R and the recovered R are identical
-	rCompare := bytes.Equal(R.SerializeCompressed(), recoveredR.SerializeCompressed())
-	if !rCompare {
-		return nil, fmt.Errorf("point recovery test failed: R ≠ R' - T")
+	// Sanity check that the signature verifies before handing it out
+	if !sig.Verify(adaptorPoint) {
+		return nil, ErrSignatureCreation
 	}
 
-	// Return the completed adaptor signature
-	return &Signature{
-		NoncePoint: adaptorNonce,
-		S:          s,
-		PubKey:     P,
-		Message:    message,
-	}, nil
+	return sig, nil
 }
 
 // Verify checks if an adaptor signature is valid.
 // For adaptor signatures, the verification equation is:
-// s*G = R + e*P, where R = R' - T
+// s*G = ±R + e*P', where R = R' - T and P' is the even form of P
 // The adaptor point T must be provided for verification.
 //
-// The verification process follows these important steps:
-// 1. Recover R from R' by calculating R = R' - T
-// 2. Use an even Y coordinate for challenge calculation as required by BIP340
-// 3. Handle the case when R'.Y is odd by negating R in the verification equation
-// 4. Compare points considering BIP340 rules where only X-coordinates are relevant
-//
-// BIP340 Parity Insight: When R'.Y is odd, the verification must negate the
-// recovered R point to maintain consistency with the signature creation process,
-// which negates the nonce scalar k when R'.Y is odd.
-//
-// This implementation handles all edge cases regarding Y-coordinate parity
-// to ensure robust verification.
+// R is negated exactly when R'.Y is odd, mirroring the negation of k at
+// signing time. The parities recorded in the signature must match the
+// points, so a signature cannot be verified against -T.
 func (a *Signature) Verify(adaptorPoint *secp.PublicKey) bool {
-	// For BIP340 challenge calculation, we need a nonce point with even Y
-	// Check if R'.Y is odd, in which case we need to use a modified point for challenge
-	negationNeeded := a.NoncePoint.Y().Bit(0) == 1
-
-	// Create an adjusted nonce point for challenge calculation if needed
-	adjustedNonce := a.NoncePoint
-
-	if negationNeeded {
-		// Create a new point with the same X but negated Y
-		fx := new(secp.FieldVal)
-		fy := new(secp.FieldVal)
-
-		if overflow := fx.SetByteSlice(a.NoncePoint.X().Bytes()); overflow {
-			return false
-		}
+	var R, P secp.JacobianPoint
+	e, ok := a.equation(adaptorPoint, &R, &P)
+	if !ok {
+		return false
+	}
 
-		// Negate Y value (p - y)
-		negY := new(big.Int).Sub(secp.S256().P, a.NoncePoint.Y())
+	// Compare s*G with R + e*P. Everything here is public, so the faster
+	// variable-time multiplications are used
+	var sG, eP, rhs secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(a.S, &sG)
+	secp.ScalarMultNonConst(e, &P, &eP)
+	secp.AddNonConst(&R, &eP, &rhs)
+	sG.ToAffine()
+	rhs.ToAffine()
 
-		if overflow := fy.SetByteSlice(negY.Bytes()); overflow {
-			return false
-		}
+	return sG.X.Equals(&rhs.X) && sG.Y.Equals(&rhs.Y)
+}
 
-		adjustedNonce = secp.NewPublicKey(fx, fy)
+// equation checks the parities of the signature against the adaptor point
+// and sets R and P to the affine, even-adjusted points of the verification
+// equation s*G = R + e*P. It returns the challenge e, and false when the
+// signature is malformed or its parities do not match.
+func (a *Signature) equation(adaptorPoint *secp.PublicKey, R, P *secp.JacobianPoint) (*secp.ModNScalar, bool) {
+	if !a.recoverNonce(adaptorPoint, R, P) {
+		return nil, false
 	}
+	R.ToAffine()
 
-	// Compute the challenge using the adjusted nonce point (with even Y)
-	eBigInt := SchnorrChallenge(adjustedNonce, a.PubKey, a.Message)
-
-	// Convert to scalar
-	eScalar := new(secp.ModNScalar)
-	eBytes := crypto.PadTo32(eBigInt.Bytes())
-	if overflow := eScalar.SetByteSlice(eBytes); overflow {
-		return false // Challenge scalar overflow
-	}
+	return a.finishEquation(adaptorPoint, R, P)
+}
 
-	// Get the original R = R' - T by negating T and adding to R'
-	// Calculate -T
-	negTPoint, err := crypto.NegatePoint(adaptorPoint)
-	if err != nil {
+// recoverNonce sets R to the signer's nonce point R = R' - T, in Jacobian
+// coordinates, and P to the affine public key.
+func (a *Signature) recoverNonce(adaptorPoint *secp.PublicKey, R, P *secp.JacobianPoint) bool {
+	if a == nil || a.NoncePoint == nil || a.S == nil || a.PubKey == nil || adaptorPoint == nil {
 		return false
 	}
-
-	// Calculate R = R' + (-T)
-	R, err := AddPubKeys(a.NoncePoint, negTPoint)
-	if err != nil {
+	if a.Parity&^parityMask != 0 {
 		return false
 	}
 
-	// Now we need to compute s*G and compare it with R + e*P
-	// 1. Calculate s*G (left-hand side)
-	sBytes := crypto.SerializeModNScalar(a.S)
-	sgX, sgY := secp.S256().ScalarBaseMult(sBytes)
-
-	// 2. Calculate e*P
-	eBytes = crypto.SerializeModNScalar(eScalar)
-	epX, epY := secp.S256().ScalarMult(a.PubKey.X(), a.PubKey.Y(), eBytes)
-
-	// 3. For adaptor signatures, we need to account for both the parity of R'.Y
-	// and the parity of the recovered R.Y in verification.
-	// Need to correctly match same verification context used in creation.
-
-	// If we needed to negate the nonce during signature creation (R'.Y is odd),
-	// we should use -R in verification instead of R, to mirror creation logic
-	var rhsX, rhsY *big.Int
-	if negationNeeded {
-		// Negate R to match the negation of k during signature creation
-		negR, err := crypto.NegatePoint(R)
-		if err != nil {
-			return false
-		}
-
-		// Calculate (-R) + e*P
-		rhsX, rhsY = secp.S256().Add(negR.X(), negR.Y(), epX, epY)
-	} else {
-		// If nonce doesn't need negation, use R directly
-		// Calculate R + e*P
-		rhsX, rhsY = secp.S256().Add(R.X(), R.Y(), epX, epY)
+	var adaptorNonce, negT secp.JacobianPoint
+	a.NoncePoint.AsJacobian(&adaptorNonce)
+	adaptorPoint.AsJacobian(&negT)
+	negate(&negT)
+	a.PubKey.AsJacobian(P)
+
+	secp.AddNonConst(&adaptorNonce, &negT, R)
+
+	return !isInfinity(R)
+}
+
+// finishEquation completes equation once R is affine.
+func (a *Signature) finishEquation(adaptorPoint *secp.PublicKey, R, P *secp.JacobianPoint) (*secp.ModNScalar, bool) {
+	var adaptorNonce, T secp.JacobianPoint
+	a.NoncePoint.AsJacobian(&adaptorNonce)
+	adaptorPoint.AsJacobian(&T)
+
+	parity := pointParity(&adaptorNonce, NonceOdd) | pointParity(P, KeyOdd) |
+		pointParity(R, RandomNonceOdd) | pointParity(&T, AdaptorOdd)
+	if parity != a.Parity {
+		return nil, false
 	}
 
-	// Compare the points
-	xMatch := sgX.Cmp(rhsX) == 0
-	yMatch := sgY.Cmp(rhsY) == 0
-
-	// Check for Y negation case (valid in BIP340)
-	// In BIP340 Schnorr, only the X-coordinate matters for signature verification,
-	// so two points with the same X but opposite Y are considered equivalent.
-	if xMatch && !yMatch {
-		// Check if lhsY + rhsY = p (the field prime)
-		ySum := new(big.Int).Add(sgY, rhsY)
-		ySum.Mod(ySum, secp.S256().P)
-
-		if ySum.Cmp(big.NewInt(0)) == 0 {
-			return true
-		}
+	e := challenge(&adaptorNonce, P, a.Message)
+
+	// Use the even forms of R' and P, as the signer did
+	if parity.Has(NonceOdd) {
+		negate(R)
+	}
+	if parity.Has(KeyOdd) {
+		negate(P)
 	}
 
-	return xMatch && yMatch
+	return e, true
 }
 
 // Complete combines the adaptor signature with the secret.
-// Returns s' = s + t where t is the secret.
+// Returns s' = s + t, or s' = s - t when R'.Y is odd, which is the s value
+// of the final BIP340 signature.
 func (a *Signature) Complete(secret *secp.ModNScalar) *secp.ModNScalar {
-	// s' = s + t
-	sFinal := new(secp.ModNScalar)
-	sFinal.Add2(a.S, secret)
+	t := new(secp.ModNScalar).Set(secret)
+	if a.Parity.Has(NonceOdd) {
+		t.Negate()
+	}
+
+	sFinal := new(secp.ModNScalar).Add2(a.S, t)
+	t.Zero()
+
 	return sFinal
 }
 
 // ExtractSecret extracts the secret from a completed signature.
-// Returns t = s' - s where s' is the completed signature value.
+// It inverts Complete: t = s' - s, or t = s - s' when R'.Y is odd. There is
+// exactly one secret for each completed signature.
 func (a *Signature) ExtractSecret(completedSig *secp.ModNScalar) *secp.ModNScalar {
-	// t = s' - s
-	t := new(secp.ModNScalar)
-
-	// Set t to s'
-	t.Set(completedSig)
-
-	// Compute t = -s
-	negS := new(secp.ModNScalar)
-	negS.Set(a.S)
-	negS.Negate()
-
-	// t = s' + (-s) = s' - s
-	t.Add(negS)
+	negS := new(secp.ModNScalar).Set(a.S).Negate()
+	t := new(secp.ModNScalar).Add2(completedSig, negS)
+	if a.Parity.Has(NonceOdd) {
+		t.Negate()
+	}
 
 	return t
 }
 
-// GenerateFinalSignature generates a final Schnorr signature from a completed adaptor signature.
-// Applies BIP340 parity rules to ensure the y-coordinate is even.
+// GenerateFinalSignature generates the final BIP340 signature R'.x || s' from
+// a completed adaptor signature. Complete already accounts for the parity of
+// R', so s' is used as is.
 func (a *Signature) GenerateFinalSignature(completedSig *secp.ModNScalar) []byte {
-	// Apply BIP340 parity rule - the nonce's y-coordinate must be even
-	return GenerateSchnorrSignature(a.NoncePoint, completedSig)
+	var r secp.JacobianPoint
+	a.NoncePoint.AsJacobian(&r)
+
+	signature := make([]byte, 64)
+	copy(signature, xBytes(&r))
+	completedSig.PutBytesUnchecked(signature[32:])
+
+	return signature
 }
 
 // GenerateSchnorrSignature creates a valid BIP340 Schnorr signature.
 // It handles the y-parity requirement by negating s if needed.
 func GenerateSchnorrSignature(R *secp.PublicKey, s *secp.ModNScalar) []byte {
-	sAdjusted := new(secp.ModNScalar)
-	sAdjusted.Set(s)
+	var r secp.JacobianPoint
+	R.AsJacobian(&r)
+
+	sAdjusted := new(secp.ModNScalar).Set(s)
 
 	// BIP340 requires the y-coordinate to be even
-	if R.Y().Bit(0) == 1 {
+	if r.Y.IsOdd() {
 		// If Y is odd, we negate s: s = n - s
 		sAdjusted.Negate()
 	}
 
 	// Serialize: R_x || s
 	signature := make([]byte, 64)
-	copy(signature, crypto.PadTo32(R.X().Bytes()))
-	copy(signature[32:], crypto.SerializeModNScalar(sAdjusted))
+	copy(signature, xBytes(&r))
+	sAdjusted.PutBytesUnchecked(signature[32:])
 
 	return signature
 }
@@ -371,21 +362,12 @@ func ExtractNonceFromSig(sig string) (*secp.PublicKey, error) {
 
 // SchnorrChallenge computes the BIP340 Schnorr challenge e = hash(R || P || m)
 // This is a critical security component of the Schnorr signature scheme.
+// Only the x-coordinates of R and P are hashed, as per BIP340.
 func SchnorrChallenge(R, P *secp.PublicKey, message []byte) *big.Int {
-	// We need only the x-coordinate (32 bytes) of both keys
-	// According to BIP340, we don't use SerializeCompressed because we only need the x-coordinate
-
-	// Extract x-coordinate of nonce R (32 bytes) with padding
-	rBytes := crypto.PadTo32(R.X().Bytes())
-
-	// Extract x-coordinate of public key P (32 bytes) with padding
-	pBytes := crypto.PadTo32(P.X().Bytes())
-
-	// Construct the input for the hash in the order: R || P || message
-	hashInput := append(append(rBytes, pBytes...), message...)
-
-	// Use the tagged hash as per BIP340
-	hash := chainhash.TaggedHash(chainhash.TagBIP0340Challenge, hashInput)
+	var r, p secp.JacobianPoint
+	R.AsJacobian(&r)
+	P.AsJacobian(&p)
+	hash := challengeHash(&r, &p, message)
 
 	// Convert to big.Int as expected
 	return new(big.Int).SetBytes(hash[:])
@@ -394,20 +376,14 @@ func SchnorrChallenge(R, P *secp.PublicKey, message []byte) *big.Int {
 // AddPubKeys returns the sum of two secp256k1 public keys.
 // This implements the EC point addition: R = P1 + P2.
 func AddPubKeys(p1, p2 *secp.PublicKey) (*secp.PublicKey, error) {
-	curve := secp.S256()
-	x1, y1 := p1.X(), p1.Y()
-	x2, y2 := p2.X(), p2.Y()
-	x3, y3 := curve.Add(x1, y1, x2, y2)
-
-	fx := new(secp.FieldVal)
-	fy := new(secp.FieldVal)
-
-	if overflow := fx.SetByteSlice(x3.Bytes()); overflow {
-		return nil, fmt.Errorf("x-coordinate overflow")
-	}
-	if overflow := fy.SetByteSlice(y3.Bytes()); overflow {
-		return nil, fmt.Errorf("y-coordinate overflow")
+	var a, b, sum secp.JacobianPoint
+	p1.AsJacobian(&a)
+	p2.AsJacobian(&b)
+	secp.AddNonConst(&a, &b, &sum)
+	if isInfinity(&sum) {
+		return nil, fmt.Errorf("sum of public keys is the point at infinity")
 	}
+	sum.ToAffine()
 
-	return secp.NewPublicKey(fx, fy), nil
+	return secp.NewPublicKey(&sum.X, &sum.Y), nil
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 
 	"tanos/pkg/crypto"
@@ -105,3 +106,59 @@ func TestParityHandling(t *testing.T) {
 	t.Logf("Successfully verified %d signatures (%d with even Y, %d with odd Y)",
 		testCases, evenCases, oddCases)
 }
+
+// TestParityCombinations checks, over thousands of random keys, that every
+// combination of R', P, R and T parities gives a valid BIP340 signature once
+// completed, that exactly one secret is extracted from it, and that the
+// adaptor signature does not verify against -T.
+func TestParityCombinations(t *testing.T) {
+	iterations := 4096
+	if testing.Short() {
+		iterations = 512
+	}
+
+	seen := make(map[Parity]int)
+	for i := 0; i < iterations; i++ {
+		privKey := generatePrivKey()
+		secret := generatePrivKey()
+		message := chainhash.DoubleHashB([]byte{byte(i), byte(i >> 8)})
+
+		adaptorSig, err := New(privKey, secret.PubKey(), message)
+		if err != nil {
+			t.Fatalf("Run %d: failed to create adaptor signature: %v", i, err)
+		}
+		seen[adaptorSig.Parity]++
+
+		if !adaptorSig.Verify(secret.PubKey()) {
+			t.Fatalf("Run %d: adaptor signature with parity %#x failed verification", i, adaptorSig.Parity)
+		}
+		negT, _ := crypto.NegatePoint(secret.PubKey())
+		if adaptorSig.Verify(negT) {
+			t.Fatalf("Run %d: adaptor signature verified against -T", i)
+		}
+
+		completed := adaptorSig.Complete(&secret.Key)
+		finalSig, err := schnorr.ParseSignature(adaptorSig.GenerateFinalSignature(completed))
+		if err != nil {
+			t.Fatalf("Run %d: invalid final signature: %v", i, err)
+		}
+		if !finalSig.Verify(message, privKey.PubKey()) {
+			t.Fatalf("Run %d: final signature with parity %#x does not verify", i, adaptorSig.Parity)
+		}
+
+		if !adaptorSig.ExtractSecret(completed).Equals(&secret.Key) {
+			t.Fatalf("Run %d: extracted the wrong secret with parity %#x", i, adaptorSig.Parity)
+		}
+
+		wrong := adaptorSig.Complete(&generatePrivKey().Key)
+		if finalSig, _ := schnorr.ParseSignature(adaptorSig.GenerateFinalSignature(wrong)); finalSig.Verify(message, privKey.PubKey()) {
+			t.Fatalf("Run %d: signature completed with the wrong secret verifies", i)
+		}
+	}
+
+	for parity := Parity(0); parity <= parityMask; parity++ {
+		if seen[parity] == 0 {
+			t.Fatalf("Parity combination %#x never occurred in %d runs", parity, iterations)
+		}
+	}
+}
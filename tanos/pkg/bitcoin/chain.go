@@ -0,0 +1,144 @@
+package bitcoin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrUTXONotFound is returned when an output does not exist or is spent.
+var ErrUTXONotFound = errors.New("utxo not found")
+
+// DefaultPollInterval is how often polling backends check for spends.
+const DefaultPollInterval = 5 * time.Second
+
+// ChainBackend is the view of the Bitcoin network a swap needs: looking up
+// and spending outputs, and following the chain until a swap output is
+// claimed or refunded.
+type ChainBackend interface {
+	// GetUTXO returns the unspent output at outpoint, including outputs of
+	// transactions still in the mempool. It returns ErrUTXONotFound when
+	// the output does not exist or is spent.
+	GetUTXO(ctx context.Context, outpoint wire.OutPoint) (*UTXO, error)
+
+	// Broadcast submits a signed transaction to the network.
+	Broadcast(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error)
+
+	// WatchSpend reports the transaction spending outpoint, whether it is
+	// in the mempool or in a block. Blocks below heightHint, typically the
+	// height the output was created at, are not searched. The channel
+	// receives at most one spend and is closed afterwards, or once ctx is
+	// done.
+	WatchSpend(ctx context.Context, outpoint wire.OutPoint, heightHint int32) (<-chan *SpendEvent, error)
+
+	// GetTipHeight returns the height of the best block.
+	GetTipHeight(ctx context.Context) (int32, error)
+
+	// EstimateFee returns the fee rate expected to confirm a transaction
+	// within targetBlocks blocks.
+	EstimateFee(ctx context.Context, targetBlocks uint32) (FeeRate, error)
+}
+
+// ScriptScanner is implemented by backends that can find the unspent
+// outputs paying to given scripts, which recovering the keys of a wallet
+// from its seed needs.
+type ScriptScanner interface {
+	// ScanScripts returns the unspent outputs paying to any of pkScripts,
+	// mempool included.
+	ScanScripts(ctx context.Context, pkScripts [][]byte) ([]*UTXO, error)
+}
+
+// HistoryScanner is implemented by backends that index the transactions of
+// every script, so that a wallet also finds the keys whose outputs are all
+// spent. Bitcoin Core keeps no such index.
+type HistoryScanner interface {
+	// UsedScripts returns the ones of pkScripts that a transaction, mined
+	// or in the mempool, has paid to.
+	UsedScripts(ctx context.Context, pkScripts [][]byte) ([][]byte, error)
+}
+
+// UTXO is an unspent transaction output.
+type UTXO struct {
+	OutPoint wire.OutPoint
+	Output   *wire.TxOut
+	Height   int32 // Zero while the transaction is unconfirmed
+}
+
+// SpendEvent describes the transaction spending a watched output.
+type SpendEvent struct {
+	OutPoint   wire.OutPoint
+	SpendingTx *wire.MsgTx
+	InputIndex uint32
+	Height     int32 // Zero while the transaction is unconfirmed
+}
+
+// FeeRate is a fee rate in satoshis per 1000 virtual bytes.
+type FeeRate int64
+
+// FeeRatePerVByte converts a rate in satoshis per virtual byte.
+func FeeRatePerVByte(satPerVByte float64) FeeRate {
+	return FeeRate(satPerVByte * 1000)
+}
+
+// FeeForVSize returns the fee of a transaction of the given virtual size,
+// rounded up.
+func (r FeeRate) FeeForVSize(vsize int64) btcutil.Amount {
+	return btcutil.Amount((int64(r)*vsize + 999) / 1000)
+}
+
+// findSpend returns the spend of outpoint by tx, if tx spends it.
+func findSpend(tx *wire.MsgTx, outpoint wire.OutPoint, height int32) *SpendEvent {
+	for i, txIn := range tx.TxIn {
+		if txIn.PreviousOutPoint == outpoint {
+			return &SpendEvent{
+				OutPoint:   outpoint,
+				SpendingTx: tx,
+				InputIndex: uint32(i),
+				Height:     height,
+			}
+		}
+	}
+
+	return nil
+}
+
+// deliverSpend sends the spend on a new channel that is then closed.
+func deliverSpend(spend *SpendEvent) <-chan *SpendEvent {
+	ch := make(chan *SpendEvent, 1)
+	ch <- spend
+	close(ch)
+	return ch
+}
+
+// pollSpend calls check every interval until it finds the spend or ctx is
+// done. The returned channel follows the WatchSpend contract.
+func pollSpend(ctx context.Context, interval time.Duration, check func() (*SpendEvent, error)) <-chan *SpendEvent {
+	ch := make(chan *SpendEvent, 1)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			// Errors are transient for a watcher, the next poll retries
+			if spend, err := check(); err == nil && spend != nil {
+				ch <- spend
+				return
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
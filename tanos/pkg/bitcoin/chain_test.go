@@ -0,0 +1,343 @@
+package bitcoin
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testSpend returns an outpoint and a transaction spending it.
+func testSpend(t *testing.T) (wire.OutPoint, *wire.MsgTx, string) {
+	outpoint := wire.OutPoint{Hash: chainhash.Hash{7}, Index: 1}
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&outpoint, nil, wire.TxWitness{{1}}))
+	tx.AddTxOut(wire.NewTxOut(9000, []byte{0x51}))
+
+	txHex, err := SerializeTx(tx)
+	if err != nil {
+		t.Fatalf("Failed to serialize transaction: %v", err)
+	}
+
+	return outpoint, tx, txHex
+}
+
+// TestCoreRPCBackend runs the Core backend against a fake node.
+func TestCoreRPCBackend(t *testing.T) {
+	outpoint, spendTx, spendHex := testSpend(t)
+	var spent atomic.Bool
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			ID     uint64            `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Params == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var result any
+		switch req.Method {
+		case "getblockcount":
+			result = 120
+		case "gettxout":
+			if !spent.Load() {
+				result = map[string]any{
+					"confirmations": 3,
+					"value":         0.0001,
+					"scriptPubKey":  map[string]any{"hex": "51"},
+				}
+			}
+		case "sendrawtransaction":
+			spent.Store(true)
+			result = spendTx.TxHash().String()
+		case "getrawmempool":
+			result = []string{}
+			if spent.Load() {
+				result = []string{spendTx.TxHash().String()}
+			}
+		case "getrawtransaction":
+			result = spendHex
+		case "estimatesmartfee":
+			result = map[string]any{"feerate": 0.00012, "blocks": 6}
+		case "scantxoutset":
+			result = map[string]any{
+				"success": true,
+				"unspents": []any{map[string]any{
+					"txid": outpoint.Hash.String(), "vout": outpoint.Index,
+					"scriptPubKey": "51", "amount": 0.0001, "height": 118,
+				}},
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{
+				"id":    req.ID,
+				"error": map[string]any{"code": -32601, "message": "Method not found"},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": result})
+	}))
+	defer node.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	backend := NewCoreRPC(node.URL, "user", "pass")
+	backend.SetPollInterval(10 * time.Millisecond)
+	var _ ChainBackend = backend
+
+	utxo, err := backend.GetUTXO(ctx, outpoint)
+	if err != nil || utxo.Output.Value != 10000 || utxo.Height != 118 {
+		t.Fatalf("Unexpected UTXO %+v: %v", utxo, err)
+	}
+	if rate, err := backend.EstimateFee(ctx, 6); err != nil || rate != 12000 {
+		t.Fatalf("Unexpected fee rate %d: %v", rate, err)
+	}
+	var _ ScriptScanner = backend
+	utxos, err := backend.ScanScripts(ctx, [][]byte{{0x51}})
+	if err != nil || len(utxos) != 1 || utxos[0].OutPoint != outpoint || utxos[0].Output.Value != 10000 {
+		t.Fatalf("Unexpected scan result %+v: %v", utxos, err)
+	}
+
+	spends, err := backend.WatchSpend(ctx, outpoint, 100)
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	if txid, err := backend.Broadcast(ctx, spendTx); err != nil || *txid != spendTx.TxHash() {
+		t.Fatalf("Broadcast failed: %v", err)
+	}
+	if spend := <-spends; spend == nil || spend.SpendingTx.TxHash() != spendTx.TxHash() {
+		t.Fatalf("Spend not reported")
+	}
+	if _, err := backend.GetUTXO(ctx, outpoint); err != ErrUTXONotFound {
+		t.Fatalf("Expected ErrUTXONotFound, got %v", err)
+	}
+
+	// The scan sees the mempool spend and its output
+	utxos, err = backend.ScanScripts(ctx, [][]byte{{0x51}})
+	if err != nil || len(utxos) != 1 || utxos[0].OutPoint.Hash != spendTx.TxHash() || utxos[0].Height != 0 {
+		t.Fatalf("Unexpected scan result with the mempool %+v: %v", utxos, err)
+	}
+
+	if err := backend.call(ctx, "nosuchmethod", nil, nil); err == nil {
+		t.Fatalf("Expected an RPC error")
+	}
+	if _, err := NewCoreRPC(node.URL, "user", "wrong").GetTipHeight(ctx); err == nil {
+		t.Fatalf("Expected an authentication error")
+	}
+}
+
+// TestCoreRPCMempoolSpend checks that WatchSpend finds a mempool spend
+// with gettxspendingprevout, and without it fetches each mempool
+// transaction only once.
+func TestCoreRPCMempoolSpend(t *testing.T) {
+	outpoint, spendTx, spendHex := testSpend(t)
+	other := wire.NewMsgTx(2)
+	other.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{8}}, nil, wire.TxWitness{{1}}))
+	other.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	otherHex, _ := SerializeTx(other)
+	spendID, otherID := spendTx.TxHash().String(), other.TxHash().String()
+
+	for _, spendingRPC := range []bool{true, false} {
+		var polls, mempoolCalls atomic.Int32
+		var fetched sync.Map
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				ID     uint64 `json:"id"`
+				Method string `json:"method"`
+				Params []any  `json:"params"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+
+			// The spend shows up in the mempool at the third poll
+			var result any
+			switch req.Method {
+			case "getblockcount":
+				result = 120
+			case "gettxout":
+			case "gettxspendingprevout":
+				if !spendingRPC {
+					json.NewEncoder(w).Encode(map[string]any{
+						"id":    req.ID,
+						"error": map[string]any{"code": -32601, "message": "Method not found"},
+					})
+					return
+				}
+				prevout := map[string]any{"txid": outpoint.Hash.String(), "vout": outpoint.Index}
+				if polls.Add(1) >= 3 {
+					prevout["spendingtxid"] = spendID
+				}
+				result = []any{prevout}
+			case "getrawmempool":
+				mempoolCalls.Add(1)
+				txids := []string{otherID}
+				if polls.Add(1) >= 3 {
+					txids = append(txids, spendID)
+				}
+				result = txids
+			case "getrawtransaction":
+				txid := req.Params[0].(string)
+				count, _ := fetched.LoadOrStore(txid, new(atomic.Int32))
+				count.(*atomic.Int32).Add(1)
+				result = map[string]string{spendID: spendHex, otherID: otherHex}[txid]
+			}
+			json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": result})
+		}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		backend := NewCoreRPC(node.URL, "user", "pass")
+		backend.SetPollInterval(10 * time.Millisecond)
+		spends, err := backend.WatchSpend(ctx, outpoint, 121)
+		if err != nil {
+			t.Fatalf("Failed to watch: %v", err)
+		}
+		if spend := <-spends; spend == nil || spend.SpendingTx.TxHash() != spendTx.TxHash() {
+			t.Fatalf("Spend not reported")
+		}
+		cancel()
+		node.Close()
+
+		if spendingRPC {
+			if mempoolCalls.Load() != 0 {
+				t.Fatalf("Listed the mempool although gettxspendingprevout is available")
+			}
+			continue
+		}
+		if count, ok := fetched.Load(otherID); !ok || count.(*atomic.Int32).Load() != 1 {
+			t.Fatalf("Unrelated mempool transaction not fetched exactly once")
+		}
+	}
+}
+
+// TestEsploraBackend runs the Esplora backend against a fake server.
+func TestEsploraBackend(t *testing.T) {
+	outpoint, spendTx, spendHex := testSpend(t)
+	spendID := spendTx.TxHash().String()
+	var spent atomic.Bool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tx/{txid}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("txid") != outpoint.Hash.String() {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"vout": []any{
+				map[string]any{"scriptpubkey": "00", "value": 1},
+				map[string]any{"scriptpubkey": "51", "value": 10000},
+			},
+			"status": map[string]any{"confirmed": true, "block_height": 118},
+		})
+	})
+	mux.HandleFunc("GET /tx/{txid}/outspend/{vout}", func(w http.ResponseWriter, r *http.Request) {
+		if !spent.Load() {
+			fmt.Fprint(w, `{"spent":false}`)
+			return
+		}
+		fmt.Fprintf(w, `{"spent":true,"txid":%q,"vin":0,"status":{"confirmed":false}}`, spendID)
+	})
+	mux.HandleFunc("GET /tx/{txid}/hex", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, spendHex)
+	})
+	mux.HandleFunc("POST /tx", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != spendHex {
+			http.Error(w, "bad-txns", http.StatusBadRequest)
+			return
+		}
+		spent.Store(true)
+		fmt.Fprint(w, spendID)
+	})
+	mux.HandleFunc("GET /scripthash/{hash}/utxo", func(w http.ResponseWriter, r *http.Request) {
+		scriptHash := sha256.Sum256([]byte{0x51})
+		if r.PathValue("hash") != hex.EncodeToString(scriptHash[:]) {
+			fmt.Fprint(w, "[]")
+			return
+		}
+		fmt.Fprintf(w, `[{"txid":%q,"vout":1,"value":10000,"status":{"confirmed":true,"block_height":118}}]`, outpoint.Hash)
+	})
+	mux.HandleFunc("GET /scripthash/{hash}", func(w http.ResponseWriter, r *http.Request) {
+		scriptHash := sha256.Sum256([]byte{0x52})
+		if r.PathValue("hash") != hex.EncodeToString(scriptHash[:]) {
+			fmt.Fprint(w, `{"chain_stats":{"tx_count":0},"mempool_stats":{"tx_count":0}}`)
+			return
+		}
+		fmt.Fprint(w, `{"chain_stats":{"tx_count":0},"mempool_stats":{"tx_count":1}}`)
+	})
+	mux.HandleFunc("GET /blocks/tip/height", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "120")
+	})
+	mux.HandleFunc("GET /fee-estimates", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"1":20.5,"3":10,"6":4.2,"144":1}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	backend := NewEsplora(server.URL + "/")
+	backend.SetPollInterval(10 * time.Millisecond)
+	var _ ChainBackend = backend
+
+	utxo, err := backend.GetUTXO(ctx, outpoint)
+	if err != nil || utxo.Output.Value != 10000 || hex.EncodeToString(utxo.Output.PkScript) != "51" || utxo.Height != 118 {
+		t.Fatalf("Unexpected UTXO %+v: %v", utxo, err)
+	}
+	if _, err := backend.GetUTXO(ctx, wire.OutPoint{Index: 1}); err != ErrUTXONotFound {
+		t.Fatalf("Expected ErrUTXONotFound for an unknown transaction, got %v", err)
+	}
+	if tip, err := backend.GetTipHeight(ctx); err != nil || tip != 120 {
+		t.Fatalf("Unexpected tip %d: %v", tip, err)
+	}
+	var _ ScriptScanner = backend
+	utxos, err := backend.ScanScripts(ctx, [][]byte{{0x51}, {0x52}})
+	if err != nil || len(utxos) != 1 || utxos[0].OutPoint != outpoint || utxos[0].Height != 118 {
+		t.Fatalf("Unexpected scan result %+v: %v", utxos, err)
+	}
+	var _ HistoryScanner = backend
+	used, err := backend.UsedScripts(ctx, [][]byte{{0x51}, {0x52}})
+	if err != nil || len(used) != 1 || !bytes.Equal(used[0], []byte{0x52}) {
+		t.Fatalf("Unexpected used scripts %x: %v", used, err)
+	}
+
+	for target, want := range map[uint32]FeeRate{1: 20500, 5: 10000, 6: 4200, 1000: 1000} {
+		if rate, err := backend.EstimateFee(ctx, target); err != nil || rate != want {
+			t.Fatalf("Target %d: expected %d, got %d (%v)", target, want, rate, err)
+		}
+	}
+
+	spends, err := backend.WatchSpend(ctx, outpoint, 0)
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	if txid, err := backend.Broadcast(ctx, spendTx); err != nil || txid.String() != spendID {
+		t.Fatalf("Broadcast failed: %v", err)
+	}
+	if spend := <-spends; spend == nil || spend.InputIndex != 0 || spend.Height != 0 {
+		t.Fatalf("Spend not reported")
+	}
+	if _, err := backend.GetUTXO(ctx, outpoint); err != ErrUTXONotFound {
+		t.Fatalf("Expected ErrUTXONotFound, got %v", err)
+	}
+}
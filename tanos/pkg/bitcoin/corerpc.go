@@ -0,0 +1,449 @@
+package bitcoin
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// rpcMethodNotFound is the error code of an RPC method the node lacks.
+const rpcMethodNotFound = -32601
+
+// CoreRPC is a ChainBackend talking to a Bitcoin Core node over JSON-RPC.
+// The node does not index spends, so WatchSpend polls the mempool and the
+// blocks from the height hint on. Mempool spends are looked up with
+// gettxspendingprevout on nodes that have it, Bitcoin Core 24 and later.
+type CoreRPC struct {
+	url           string
+	user          string
+	password      string
+	client        *http.Client
+	pollInterval  time.Duration
+	nextID        atomic.Uint64
+	noSpendingRPC atomic.Bool // Set once gettxspendingprevout is found missing
+}
+
+// NewCoreRPC creates a backend for the node's RPC endpoint, such as
+// "http://127.0.0.1:18443", authenticating with user and password.
+func NewCoreRPC(url, user, password string) *CoreRPC {
+	return &CoreRPC{
+		url:          url,
+		user:         user,
+		password:     password,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		pollInterval: DefaultPollInterval,
+	}
+}
+
+// SetPollInterval changes how often WatchSpend polls the node.
+func (b *CoreRPC) SetPollInterval(interval time.Duration) {
+	b.pollInterval = interval
+}
+
+// rpcError is the error object of a JSON-RPC response.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// call invokes an RPC method and decodes its result into result.
+func (b *CoreRPC) call(ctx context.Context, method string, params []any, result any) error {
+	if params == nil {
+		params = []any{}
+	}
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "1.0",
+		"id":      b.nextID.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %v", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %v", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(b.user, b.password)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	// Bitcoin Core reports RPC errors with a 4xx or 5xx status and a body
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s request failed with status %s", method, resp.Status)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("%s failed: %w", method, reply.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(reply.Result, result); err != nil {
+		return fmt.Errorf("failed to decode %s result: %v", method, err)
+	}
+
+	return nil
+}
+
+// GetUTXO returns the unspent output at outpoint, from the UTXO set or the
+// mempool.
+func (b *CoreRPC) GetUTXO(ctx context.Context, outpoint wire.OutPoint) (*UTXO, error) {
+	var result *struct {
+		Confirmations int64   `json:"confirmations"`
+		Value         float64 `json:"value"`
+		ScriptPubKey  struct {
+			Hex string `json:"hex"`
+		} `json:"scriptPubKey"`
+	}
+	if err := b.call(ctx, "gettxout", []any{outpoint.Hash.String(), outpoint.Index, true}, &result); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, ErrUTXONotFound
+	}
+
+	value, err := btcutil.NewAmount(result.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output value: %v", err)
+	}
+	pkScript, err := hex.DecodeString(result.ScriptPubKey.Hex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output script: %v", err)
+	}
+
+	utxo := &UTXO{OutPoint: outpoint, Output: wire.NewTxOut(int64(value), pkScript)}
+	if result.Confirmations > 0 {
+		tip, err := b.GetTipHeight(ctx)
+		if err != nil {
+			return nil, err
+		}
+		utxo.Height = tip - int32(result.Confirmations) + 1
+	}
+
+	return utxo, nil
+}
+
+// ScanScripts returns the unspent outputs paying to any of pkScripts.
+// scantxoutset only searches the UTXO set of the best block, so every
+// mempool transaction is fetched too, for its outputs and its spends.
+func (b *CoreRPC) ScanScripts(ctx context.Context, pkScripts [][]byte) ([]*UTXO, error) {
+	wanted := make(map[string]struct{}, len(pkScripts))
+	for _, pkScript := range pkScripts {
+		wanted[string(pkScript)] = struct{}{}
+	}
+	// The mempool is listed first, so a transaction mined in between is in
+	// the UTXO set instead of missed
+	mempool, spent, err := b.scanMempool(ctx, wanted)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := make([]any, len(pkScripts))
+	for i, pkScript := range pkScripts {
+		descriptors[i] = "raw(" + hex.EncodeToString(pkScript) + ")"
+	}
+
+	var result struct {
+		Success  bool `json:"success"`
+		Unspents []struct {
+			TxID         string  `json:"txid"`
+			Vout         uint32  `json:"vout"`
+			ScriptPubKey string  `json:"scriptPubKey"`
+			Amount       float64 `json:"amount"`
+			Height       int32   `json:"height"`
+		} `json:"unspents"`
+	}
+	if err := b.call(ctx, "scantxoutset", []any{"start", descriptors}, &result); err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("scantxoutset did not complete")
+	}
+
+	utxos := make([]*UTXO, 0, len(result.Unspents)+len(mempool))
+	found := make(map[wire.OutPoint]struct{}, len(result.Unspents))
+	for _, unspent := range result.Unspents {
+		txHash, err := chainhash.NewHashFromStr(unspent.TxID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction ID: %v", err)
+		}
+		value, err := btcutil.NewAmount(unspent.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output value: %v", err)
+		}
+		pkScript, err := hex.DecodeString(unspent.ScriptPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output script: %v", err)
+		}
+		outpoint := wire.OutPoint{Hash: *txHash, Index: unspent.Vout}
+		found[outpoint] = struct{}{}
+		if _, ok := spent[outpoint]; ok {
+			continue
+		}
+		utxos = append(utxos, &UTXO{
+			OutPoint: outpoint,
+			Output:   wire.NewTxOut(int64(value), pkScript),
+			Height:   unspent.Height,
+		})
+	}
+	for _, utxo := range mempool {
+		if _, ok := found[utxo.OutPoint]; ok {
+			continue
+		}
+		if _, ok := spent[utxo.OutPoint]; !ok {
+			utxos = append(utxos, utxo)
+		}
+	}
+
+	return utxos, nil
+}
+
+// scanMempool returns the outputs of mempool transactions paying to the
+// wanted scripts, and every outpoint the mempool spends.
+func (b *CoreRPC) scanMempool(ctx context.Context, wanted map[string]struct{}) ([]*UTXO, map[wire.OutPoint]struct{}, error) {
+	var txids []string
+	if err := b.call(ctx, "getrawmempool", nil, &txids); err != nil {
+		return nil, nil, err
+	}
+
+	var utxos []*UTXO
+	spent := make(map[wire.OutPoint]struct{})
+	for _, txid := range txids {
+		tx, err := b.getTransaction(ctx, txid)
+		if err != nil {
+			// Mined or evicted since the listing
+			continue
+		}
+		for _, txIn := range tx.TxIn {
+			spent[txIn.PreviousOutPoint] = struct{}{}
+		}
+		txHash := tx.TxHash()
+		for i, txOut := range tx.TxOut {
+			if _, ok := wanted[string(txOut.PkScript)]; ok {
+				utxos = append(utxos, &UTXO{OutPoint: wire.OutPoint{Hash: txHash, Index: uint32(i)}, Output: txOut})
+			}
+		}
+	}
+
+	return utxos, spent, nil
+}
+
+// Broadcast submits tx with sendrawtransaction.
+func (b *CoreRPC) Broadcast(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error) {
+	txHex, err := SerializeTx(tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize transaction: %v", err)
+	}
+
+	var txid string
+	if err := b.call(ctx, "sendrawtransaction", []any{txHex}, &txid); err != nil {
+		return nil, err
+	}
+
+	return chainhash.NewHashFromStr(txid)
+}
+
+// WatchSpend polls the node until outpoint is spent.
+func (b *CoreRPC) WatchSpend(ctx context.Context, outpoint wire.OutPoint, heightHint int32) (<-chan *SpendEvent, error) {
+	if _, err := b.GetTipHeight(ctx); err != nil {
+		return nil, err
+	}
+
+	// Blocks below scanned have been searched already
+	scanned := heightHint
+	mempool := &mempoolScan{seen: make(map[string]struct{})}
+	check := func() (*SpendEvent, error) {
+		if _, err := b.GetUTXO(ctx, outpoint); !errors.Is(err, ErrUTXONotFound) {
+			return nil, err
+		}
+
+		spend, err := b.findMempoolSpend(ctx, outpoint, mempool)
+		if err != nil || spend != nil {
+			return spend, err
+		}
+
+		tip, err := b.GetTipHeight(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for ; scanned <= tip; scanned++ {
+			block, err := b.getBlock(ctx, scanned)
+			if err != nil {
+				return nil, err
+			}
+			for _, tx := range block.Transactions {
+				if spend := findSpend(tx, outpoint, scanned); spend != nil {
+					return spend, nil
+				}
+			}
+		}
+
+		return nil, nil
+	}
+
+	return pollSpend(ctx, b.pollInterval, check), nil
+}
+
+// mempoolScan is what a watcher without gettxspendingprevout has already
+// searched of the mempool.
+type mempoolScan struct {
+	seen map[string]struct{} // Transactions of the mempool not spending the outpoint
+}
+
+// findMempoolSpend returns the mempool transaction spending outpoint, if
+// any. It asks the node with gettxspendingprevout, and otherwise fetches
+// the mempool transactions it has not seen at an earlier poll.
+func (b *CoreRPC) findMempoolSpend(ctx context.Context, outpoint wire.OutPoint, scan *mempoolScan) (*SpendEvent, error) {
+	if !b.noSpendingRPC.Load() {
+		var result []struct {
+			SpendingTxID string `json:"spendingtxid"`
+		}
+		prevout := map[string]any{"txid": outpoint.Hash.String(), "vout": outpoint.Index}
+		err := b.call(ctx, "gettxspendingprevout", []any{[]any{prevout}}, &result)
+		var rpcErr *rpcError
+		switch {
+		case errors.As(err, &rpcErr) && rpcErr.Code == rpcMethodNotFound:
+			b.noSpendingRPC.Store(true)
+		case err != nil:
+			return nil, err
+		case len(result) == 0 || result[0].SpendingTxID == "":
+			return nil, nil
+		default:
+			tx, err := b.getTransaction(ctx, result[0].SpendingTxID)
+			if err != nil {
+				// Mined since, the block scan finds it
+				return nil, nil
+			}
+			return findSpend(tx, outpoint, 0), nil
+		}
+	}
+
+	var txids []string
+	if err := b.call(ctx, "getrawmempool", nil, &txids); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(txids))
+	defer func() { scan.seen = seen }()
+	for _, txid := range txids {
+		if _, ok := scan.seen[txid]; ok {
+			seen[txid] = struct{}{}
+			continue
+		}
+		tx, err := b.getTransaction(ctx, txid)
+		if err != nil {
+			// Mined or evicted since the listing
+			continue
+		}
+		if spend := findSpend(tx, outpoint, 0); spend != nil {
+			return spend, nil
+		}
+		seen[txid] = struct{}{}
+	}
+
+	return nil, nil
+}
+
+// getTransaction fetches a mempool transaction, which needs no txindex.
+func (b *CoreRPC) getTransaction(ctx context.Context, txid string) (*wire.MsgTx, error) {
+	var txHex string
+	if err := b.call(ctx, "getrawtransaction", []any{txid}, &txHex); err != nil {
+		return nil, err
+	}
+
+	return decodeTxHex(txHex)
+}
+
+// getBlock fetches the block at height.
+func (b *CoreRPC) getBlock(ctx context.Context, height int32) (*wire.MsgBlock, error) {
+	var hash string
+	if err := b.call(ctx, "getblockhash", []any{height}, &hash); err != nil {
+		return nil, err
+	}
+
+	var blockHex string
+	if err := b.call(ctx, "getblock", []any{hash, 0}, &blockHex); err != nil {
+		return nil, err
+	}
+
+	raw, err := hex.DecodeString(blockHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block %s: %v", hash, err)
+	}
+	var block wire.MsgBlock
+	if err := block.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid block %s: %v", hash, err)
+	}
+
+	return &block, nil
+}
+
+// GetTipHeight returns the node's block count.
+func (b *CoreRPC) GetTipHeight(ctx context.Context) (int32, error) {
+	var height int32
+	if err := b.call(ctx, "getblockcount", nil, &height); err != nil {
+		return 0, err
+	}
+
+	return height, nil
+}
+
+// EstimateFee uses estimatesmartfee.
+func (b *CoreRPC) EstimateFee(ctx context.Context, targetBlocks uint32) (FeeRate, error) {
+	var result struct {
+		FeeRate *float64 `json:"feerate"` // BTC per 1000 vbytes
+		Errors  []string `json:"errors"`
+	}
+	if err := b.call(ctx, "estimatesmartfee", []any{targetBlocks}, &result); err != nil {
+		return 0, err
+	}
+	if result.FeeRate == nil {
+		return 0, fmt.Errorf("no fee estimate available: %v", result.Errors)
+	}
+
+	rate, err := btcutil.NewAmount(*result.FeeRate)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fee rate: %v", err)
+	}
+
+	return FeeRate(rate), nil
+}
+
+// decodeTxHex parses a hex serialized transaction.
+func decodeTxHex(txHex string) (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction hex: %v", err)
+	}
+
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+
+	return &tx, nil
+}
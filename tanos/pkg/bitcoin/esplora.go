@@ -0,0 +1,309 @@
+package bitcoin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Esplora is a ChainBackend using the REST API of an Esplora server, such
+// as blockstream.info or mempool.space.
+type Esplora struct {
+	baseURL      string
+	client       *http.Client
+	pollInterval time.Duration
+}
+
+// NewEsplora creates a backend for the API at baseURL, such as
+// "https://blockstream.info/testnet/api".
+func NewEsplora(baseURL string) *Esplora {
+	return &Esplora{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		client:       &http.Client{Timeout: 30 * time.Second},
+		pollInterval: DefaultPollInterval,
+	}
+}
+
+// SetPollInterval changes how often WatchSpend polls the server.
+func (b *Esplora) SetPollInterval(interval time.Duration) {
+	b.pollInterval = interval
+}
+
+// errNotFound is returned by request for a 404 response.
+var errNotFound = errors.New("not found")
+
+// request performs an HTTP request and returns the response body.
+func (b *Esplora) request(ctx context.Context, method, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response to %s: %v", path, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request %s failed with status %s: %s", path, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
+
+// getJSON performs a GET request and decodes the JSON response.
+func (b *Esplora) getJSON(ctx context.Context, path string, result any) error {
+	data, err := b.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("failed to decode response to %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// esploraStatus is the confirmation status of a transaction.
+type esploraStatus struct {
+	Confirmed   bool  `json:"confirmed"`
+	BlockHeight int32 `json:"block_height"`
+}
+
+// height returns the confirmation height, or zero if unconfirmed.
+func (s esploraStatus) height() int32 {
+	if !s.Confirmed {
+		return 0
+	}
+	return s.BlockHeight
+}
+
+// esploraOutspend is the spend status of an output.
+type esploraOutspend struct {
+	Spent  bool          `json:"spent"`
+	TxID   string        `json:"txid"`
+	Vin    uint32        `json:"vin"`
+	Status esploraStatus `json:"status"`
+}
+
+// GetUTXO returns the output at outpoint if it is unspent.
+func (b *Esplora) GetUTXO(ctx context.Context, outpoint wire.OutPoint) (*UTXO, error) {
+	var tx struct {
+		Vout []struct {
+			ScriptPubKey string `json:"scriptpubkey"`
+			Value        int64  `json:"value"`
+		} `json:"vout"`
+		Status esploraStatus `json:"status"`
+	}
+	err := b.getJSON(ctx, "/tx/"+outpoint.Hash.String(), &tx)
+	if errors.Is(err, errNotFound) {
+		return nil, ErrUTXONotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int(outpoint.Index) >= len(tx.Vout) {
+		return nil, ErrUTXONotFound
+	}
+
+	spend, err := b.outspend(ctx, outpoint)
+	if err != nil {
+		return nil, err
+	}
+	if spend.Spent {
+		return nil, ErrUTXONotFound
+	}
+
+	out := tx.Vout[outpoint.Index]
+	pkScript, err := hex.DecodeString(out.ScriptPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output script: %v", err)
+	}
+
+	return &UTXO{
+		OutPoint: outpoint,
+		Output:   wire.NewTxOut(out.Value, pkScript),
+		Height:   tx.Status.height(),
+	}, nil
+}
+
+// ScanScripts returns the unspent outputs paying to any of pkScripts, with
+// one request per script, mempool included.
+func (b *Esplora) ScanScripts(ctx context.Context, pkScripts [][]byte) ([]*UTXO, error) {
+	var utxos []*UTXO
+	for _, pkScript := range pkScripts {
+		var outputs []struct {
+			TxID   string        `json:"txid"`
+			Vout   uint32        `json:"vout"`
+			Value  int64         `json:"value"`
+			Status esploraStatus `json:"status"`
+		}
+		scriptHash := sha256.Sum256(pkScript)
+		if err := b.getJSON(ctx, "/scripthash/"+hex.EncodeToString(scriptHash[:])+"/utxo", &outputs); err != nil {
+			return nil, err
+		}
+
+		for _, out := range outputs {
+			txHash, err := chainhash.NewHashFromStr(out.TxID)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transaction ID: %v", err)
+			}
+			utxos = append(utxos, &UTXO{
+				OutPoint: wire.OutPoint{Hash: *txHash, Index: out.Vout},
+				Output:   wire.NewTxOut(out.Value, pkScript),
+				Height:   out.Status.height(),
+			})
+		}
+	}
+
+	return utxos, nil
+}
+
+// UsedScripts returns the ones of pkScripts with transactions, mined or in
+// the mempool, with one request per script.
+func (b *Esplora) UsedScripts(ctx context.Context, pkScripts [][]byte) ([][]byte, error) {
+	var used [][]byte
+	for _, pkScript := range pkScripts {
+		var stats struct {
+			ChainStats struct {
+				TxCount int `json:"tx_count"`
+			} `json:"chain_stats"`
+			MempoolStats struct {
+				TxCount int `json:"tx_count"`
+			} `json:"mempool_stats"`
+		}
+		scriptHash := sha256.Sum256(pkScript)
+		if err := b.getJSON(ctx, "/scripthash/"+hex.EncodeToString(scriptHash[:]), &stats); err != nil {
+			return nil, err
+		}
+
+		if stats.ChainStats.TxCount > 0 || stats.MempoolStats.TxCount > 0 {
+			used = append(used, pkScript)
+		}
+	}
+
+	return used, nil
+}
+
+// outspend returns the spend status of outpoint.
+func (b *Esplora) outspend(ctx context.Context, outpoint wire.OutPoint) (*esploraOutspend, error) {
+	var spend esploraOutspend
+	path := fmt.Sprintf("/tx/%s/outspend/%d", outpoint.Hash, outpoint.Index)
+	if err := b.getJSON(ctx, path, &spend); err != nil {
+		return nil, err
+	}
+
+	return &spend, nil
+}
+
+// Broadcast posts the serialized transaction.
+func (b *Esplora) Broadcast(ctx context.Context, tx *wire.MsgTx) (*chainhash.Hash, error) {
+	txHex, err := SerializeTx(tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize transaction: %v", err)
+	}
+
+	data, err := b.request(ctx, http.MethodPost, "/tx", strings.NewReader(txHex))
+	if err != nil {
+		return nil, err
+	}
+
+	return chainhash.NewHashFromStr(strings.TrimSpace(string(data)))
+}
+
+// WatchSpend polls the spend status of outpoint. Esplora indexes spends, so
+// the height hint is not needed.
+func (b *Esplora) WatchSpend(ctx context.Context, outpoint wire.OutPoint, _ int32) (<-chan *SpendEvent, error) {
+	check := func() (*SpendEvent, error) {
+		status, err := b.outspend(ctx, outpoint)
+		if err != nil || !status.Spent {
+			return nil, err
+		}
+
+		data, err := b.request(ctx, http.MethodGet, "/tx/"+status.TxID+"/hex", nil)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := decodeTxHex(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, err
+		}
+
+		spend := findSpend(tx, outpoint, status.Status.height())
+		if spend == nil {
+			return nil, fmt.Errorf("transaction %s does not spend %s", status.TxID, outpoint)
+		}
+		return spend, nil
+	}
+
+	return pollSpend(ctx, b.pollInterval, check), nil
+}
+
+// GetTipHeight returns the height of the server's best block.
+func (b *Esplora) GetTipHeight(ctx context.Context) (int32, error) {
+	data, err := b.request(ctx, http.MethodGet, "/blocks/tip/height", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	height, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tip height: %v", err)
+	}
+
+	return int32(height), nil
+}
+
+// EstimateFee returns the server's estimate for the largest confirmation
+// target not above targetBlocks, or the smallest target it has.
+func (b *Esplora) EstimateFee(ctx context.Context, targetBlocks uint32) (FeeRate, error) {
+	var estimates map[string]float64 // sat/vB by confirmation target
+	if err := b.getJSON(ctx, "/fee-estimates", &estimates); err != nil {
+		return 0, err
+	}
+
+	targets := make([]int, 0, len(estimates))
+	for key := range estimates {
+		target, err := strconv.Atoi(key)
+		if err != nil {
+			return 0, fmt.Errorf("invalid fee estimate target %q", key)
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return 0, fmt.Errorf("no fee estimate available")
+	}
+	sort.Ints(targets)
+
+	best := targets[0]
+	for _, target := range targets {
+		if target <= int(targetBlocks) {
+			best = target
+		}
+	}
+
+	return FeeRatePerVByte(estimates[strconv.Itoa(best)]), nil
+}
@@ -0,0 +1,150 @@
+package bitcoin
+
+import (
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// SequenceRBF is the sequence of an input opting its transaction in to
+// replacement by one paying a higher fee, as BIP125 allows. It still lets
+// the lock time of the transaction apply.
+const SequenceRBF = wire.MaxTxInSequenceNum - 2
+
+// IncrementalRelayFee is the default rate at which nodes require a
+// replacement to pay for its own relay, on top of the fees it replaces.
+const IncrementalRelayFee FeeRate = 1000
+
+// SignalsRBF reports whether tx opts in to replacement, which any input with
+// a sequence below MaxTxInSequenceNum-1 does, relative timelocks included.
+func SignalsRBF(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence < wire.MaxTxInSequenceNum-1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FeeForTx returns the fee, at the rate, of a transaction whose inputs have
+// the given weights and which pays to outputs.
+func (r FeeRate) FeeForTx(inputWeights []int64, outputs []*wire.TxOut) int64 {
+	return int64(r.FeeForVSize(VSize(TxWeight(inputWeights, outputs))))
+}
+
+// TxFee returns the fee paid by tx, which spends prevOuts in input order.
+func TxFee(tx *wire.MsgTx, prevOuts []*wire.TxOut) (int64, error) {
+	if len(prevOuts) != len(tx.TxIn) {
+		return 0, fmt.Errorf("got %d previous outputs for %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+
+	var fee int64
+	for _, out := range prevOuts {
+		fee += out.Value
+	}
+	for _, out := range tx.TxOut {
+		fee -= out.Value
+	}
+	if fee < 0 {
+		return 0, fmt.Errorf("outputs exceed inputs by %d satoshis", -fee)
+	}
+
+	return fee, nil
+}
+
+// ReplacementFee returns the fee a replacement of vsize virtual bytes must
+// pay to replace transactions paying oldFee in total and to reach the rate.
+// BIP125 requires it to pay for what it replaces and for its own relay at
+// IncrementalRelayFee.
+func ReplacementFee(oldFee, vsize int64, rate FeeRate) int64 {
+	fee := oldFee + int64(IncrementalRelayFee.FeeForVSize(vsize))
+	if atRate := int64(rate.FeeForVSize(vsize)); atRate > fee {
+		return atRate
+	}
+
+	return fee
+}
+
+// CPFPFee returns the fee a child of childVSize virtual bytes must pay for
+// it and its unconfirmed parent, of parentVSize paying parentFee, to reach
+// the rate together. The child pays at least the rate for itself.
+func CPFPFee(parentVSize, parentFee, childVSize int64, rate FeeRate) int64 {
+	fee := int64(rate.FeeForVSize(parentVSize+childVSize)) - parentFee
+	if own := int64(rate.FeeForVSize(childVSize)); fee < own {
+		return own
+	}
+
+	return fee
+}
+
+// ClaimFee returns the fee at the rate of the claim transaction built by
+// CreateClaimTransaction, a key path spend paying to destScript.
+func ClaimFee(rate FeeRate, destScript []byte) int64 {
+	return rate.FeeForTx([]int64{KeyPathInputWeight}, []*wire.TxOut{wire.NewTxOut(0, destScript)})
+}
+
+// RefundFee returns the fee at the rate of the refund transaction built by
+// CreateRefundTransaction, which spends the refund leaf of refundPubKey.
+func RefundFee(
+	rate FeeRate,
+	lockOutput *TaprootOutput,
+	lock Timelock,
+	refundPubKey *secp.PublicKey,
+	destScript []byte,
+) (int64, error) {
+	refundScript, err := CreateRefundScript(refundPubKey, lock)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create refund script: %v", err)
+	}
+	leafIndex := lockOutput.LeafIndex(refundScript)
+	if leafIndex < 0 {
+		return 0, fmt.Errorf("refund leaf not found in lock output")
+	}
+	weight, err := ScriptPathInputWeight(lockOutput, leafIndex, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return rate.FeeForTx([]int64{weight}, []*wire.TxOut{wire.NewTxOut(0, destScript)}), nil
+}
+
+// CreateCPFPTransaction creates an unsigned child spending output index of
+// the unconfirmed, signed parent, which paid parentFee, to destScript. The
+// child pays what brings both to the rate, and returns it with its fee. The
+// output spent must be a key path P2TR or a P2WPKH output.
+func CreateCPFPTransaction(
+	parent *wire.MsgTx,
+	index uint32,
+	parentFee int64,
+	destScript []byte,
+	rate FeeRate,
+) (*wire.MsgTx, int64, error) {
+	if int(index) >= len(parent.TxOut) {
+		return nil, 0, fmt.Errorf("parent transaction has no output %d", index)
+	}
+	prevOut := parent.TxOut[index]
+	inputWeight, err := InputWeight(prevOut.PkScript)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	output := wire.NewTxOut(0, destScript)
+	childVSize := VSize(TxWeight([]int64{inputWeight}, []*wire.TxOut{output}))
+	fee := CPFPFee(TxVSize(parent), parentFee, childVSize, rate)
+	output.Value = prevOut.Value - fee
+	if output.Value <= 0 || mempool.IsDust(output, minRelayFee) {
+		return nil, 0, fmt.Errorf("output of %d satoshis cannot pay a fee of %d", prevOut.Value, fee)
+	}
+
+	tx := wire.NewMsgTx(2)
+	parentHash := parent.TxHash()
+	txIn := wire.NewTxIn(wire.NewOutPoint(&parentHash, index), nil, nil)
+	txIn.Sequence = SequenceRBF
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(output)
+
+	return tx, fee, nil
+}
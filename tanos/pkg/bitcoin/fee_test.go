@@ -0,0 +1,110 @@
+package bitcoin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestSpendVSize checks the estimated size and fee of key path claims and
+// script path refunds against the signed transactions, for both kinds of
+// refund timelock.
+func TestSpendVSize(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	rate := FeeRatePerVByte(7)
+
+	nostrKey, _ := btcec.NewPrivateKey()
+	commitment, _ := btcec.NewPrivateKey()
+	buyer, _ := btcec.NewPrivateKey()
+	_, destScript, _ := CreateP2TRAddress(buyer.PubKey(), params)
+
+	for _, lock := range []Timelock{RelativeBlocks(144), AbsoluteHeight(800000)} {
+		lockOutput, err := CreateNostrSignatureLockOutput(nostrKey.PubKey(), commitment.PubKey(), buyer.PubKey(), lock, params)
+		if err != nil {
+			t.Fatalf("Failed to create lock output: %v", err)
+		}
+		lockTx := wire.NewMsgTx(2)
+		lockTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+		lockTx.AddTxOut(wire.NewTxOut(100000, lockOutput.PkScript))
+
+		fee, err := RefundFee(rate, lockOutput, lock, buyer.PubKey(), destScript)
+		if err != nil {
+			t.Fatalf("Failed to estimate refund fee: %v", err)
+		}
+		refundTx, err := CreateRefundTransaction(lockTx, 0, lockOutput, lock, buyer, destScript, fee)
+		if err != nil {
+			t.Fatalf("Failed to create refund: %v", err)
+		}
+		if want := int64(rate.FeeForVSize(TxVSize(refundTx))); fee != want {
+			t.Fatalf("Refund fee %d, signed refund needs %d", fee, want)
+		}
+		if !SignalsRBF(refundTx) {
+			t.Fatalf("Refund with %v does not signal RBF", lock.Type)
+		}
+
+		// A key path claim has the same size whatever the tree
+		claimFee := ClaimFee(rate, destScript)
+		claimTx, sigHash, err := CreateClaimTransaction(lockTx, 0, destScript, claimFee)
+		if err != nil {
+			t.Fatalf("Failed to create claim: %v", err)
+		}
+		sig, _ := schnorr.Sign(nostrKey, sigHash)
+		claimTx.TxIn[0].Witness = wire.TxWitness{sig.Serialize()}
+		if want := int64(rate.FeeForVSize(TxVSize(claimTx))); claimFee != want {
+			t.Fatalf("Claim fee %d, signed claim needs %d", claimFee, want)
+		}
+		if !SignalsRBF(claimTx) {
+			t.Fatalf("Claim does not signal RBF")
+		}
+	}
+}
+
+// TestCPFP checks that a child brings a low fee parent and itself to the
+// target rate, and is accepted by the chain.
+func TestCPFP(t *testing.T) {
+	ctx := context.Background()
+	params := &chaincfg.RegressionNetParams
+	chain := NewSimChain()
+
+	key, _ := btcec.NewPrivateKey()
+	_, pkScript, _ := CreateP2TRAddress(key.PubKey(), params)
+	fundTx := chain.Fund(pkScript, 100000)
+	parent := rbfSpend(t, wire.OutPoint{Hash: fundTx.TxHash()}, fundTx.TxOut[0], key, pkScript, 111)
+	if _, err := chain.Broadcast(ctx, parent); err != nil {
+		t.Fatalf("Parent rejected: %v", err)
+	}
+
+	rate := FeeRatePerVByte(20)
+	child, fee, err := CreateCPFPTransaction(parent, 0, 111, pkScript, rate)
+	if err != nil {
+		t.Fatalf("Failed to create child: %v", err)
+	}
+	prevOut := parent.TxOut[0]
+	fetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+	child.TxIn[0].Witness, err = txscript.TaprootWitnessSignature(child, txscript.NewTxSigHashes(child, fetcher), 0,
+		prevOut.Value, prevOut.PkScript, txscript.SigHashDefault, key)
+	if err != nil {
+		t.Fatalf("Failed to sign child: %v", err)
+	}
+
+	packageVSize := TxVSize(parent) + TxVSize(child)
+	if fee+111 < int64(rate.FeeForVSize(packageVSize)) {
+		t.Fatalf("Package pays %d for %d vbytes, below the rate", fee+111, packageVSize)
+	}
+	if fee+111 > int64(rate.FeeForVSize(packageVSize))+1 {
+		t.Fatalf("Child overpays: %d", fee)
+	}
+	if _, err := chain.Broadcast(ctx, child); err != nil {
+		t.Fatalf("Child rejected: %v", err)
+	}
+
+	if _, _, err := CreateCPFPTransaction(parent, 0, 111, pkScript, FeeRatePerVByte(1000)); err == nil {
+		t.Fatalf("Created a child spending more than its input")
+	}
+}
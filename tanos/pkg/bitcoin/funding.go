@@ -0,0 +1,225 @@
+package bitcoin
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrInsufficientFunds is returned when the coins cannot pay for the output
+// and the fee.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// bnbMaxTries bounds the branch-and-bound search, as Bitcoin Core does.
+const bnbMaxTries = 100000
+
+// minRelayFee is the default minimum relay fee of nodes, in satoshis per
+// 1000 bytes, which sets the dust limit of outputs.
+const minRelayFee = 1000
+
+// FundingBuilder selects coins to pay for an output and builds the
+// transaction, with change when the selected coins leave enough over.
+type FundingBuilder struct {
+	UTXOs        []*UTXO // Coins that may be spent, by key path or P2WPKH
+	FeeRate      FeeRate // Rate the transaction must pay
+	ChangeScript []byte  // Script of the change output
+}
+
+// Funding is a transaction built by a FundingBuilder, not signed yet.
+type Funding struct {
+	Tx          *wire.MsgTx // Pays the output at index 0, and change
+	Inputs      []*UTXO     // Coins spent by Tx, in input order
+	ChangeIndex int         // Index of the change output, or -1
+	Fee         int64       // Fee paid by Tx, in satoshis
+	VSize       int64       // Virtual size of Tx once signed
+}
+
+// PrevOuts returns the outputs spent by the transaction, in input order.
+func (f *Funding) PrevOuts() []*wire.TxOut {
+	prevOuts := make([]*wire.TxOut, len(f.Inputs))
+	for i, utxo := range f.Inputs {
+		prevOuts[i] = utxo.Output
+	}
+
+	return prevOuts
+}
+
+// coin is a UTXO with the cost of spending it.
+type coin struct {
+	utxo      *UTXO
+	weight    int64 // Weight of the input spending it
+	effective int64 // Value minus the fee of its input
+}
+
+// Build selects coins to pay output, which is placed at index 0, and the
+// fee at the builder's rate. Branch-and-bound looks for coins that match
+// the target closely enough to need no change; failing that, the largest
+// coins are taken and the rest returned as change. The fee reported is
+// exact, and the virtual size is exact for taproot inputs and an upper
+// bound for P2WPKH ones.
+func (b *FundingBuilder) Build(output *wire.TxOut) (*Funding, error) {
+	if b.FeeRate <= 0 {
+		return nil, fmt.Errorf("fee rate must be positive")
+	}
+	if len(b.ChangeScript) == 0 {
+		return nil, fmt.Errorf("no change script")
+	}
+	if mempool.IsDust(output, minRelayFee) {
+		return nil, fmt.Errorf("output of %d satoshis is dust", output.Value)
+	}
+
+	coins := make([]coin, 0, len(b.UTXOs))
+	for _, utxo := range b.UTXOs {
+		weight, err := InputWeight(utxo.Output.PkScript)
+		if err != nil {
+			return nil, fmt.Errorf("coin %v: %v", utxo.OutPoint, err)
+		}
+		// Coins worth less than their input only add to the fee
+		effective := utxo.Output.Value - b.FeeRate.FeeForWeight(weight)
+		if effective > 0 {
+			coins = append(coins, coin{utxo: utxo, weight: weight, effective: effective})
+		}
+	}
+	sort.SliceStable(coins, func(i, j int) bool {
+		return coins[i].effective > coins[j].effective
+	})
+
+	target := b.target(output)
+
+	changeOutput := wire.NewTxOut(0, b.ChangeScript)
+	changeFee := b.FeeRate.FeeForWeight(OutputWeight(b.ChangeScript))
+	changeSpendFee := b.FeeRate.FeeForWeight(KeyPathInputWeight)
+	if weight, err := InputWeight(b.ChangeScript); err == nil {
+		changeSpendFee = b.FeeRate.FeeForWeight(weight)
+	}
+
+	if selected := selectBnB(coins, target, changeFee+changeSpendFee); selected != nil {
+		return b.build(output, nil, selected)
+	}
+
+	// Fall back to the largest coins, with change
+	var selected []coin
+	var sum int64
+	for _, c := range coins {
+		selected = append(selected, c)
+		sum += c.effective
+		if sum >= target+changeFee {
+			if funding, err := b.build(output, changeOutput, selected); err == nil {
+				return funding, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: coins worth %d satoshis after fees, need %d", ErrInsufficientFunds, sum, target)
+}
+
+// target returns what the effective values of the coins must add up to:
+// the output and the fixed part of the transaction, plus the rounding of
+// its weight up to whole virtual bytes.
+func (b *FundingBuilder) target(output *wire.TxOut) int64 {
+	weight := TxWeight(nil, []*wire.TxOut{output}) + blockchain.WitnessScaleFactor - 1
+	return output.Value + b.FeeRate.FeeForWeight(weight)
+}
+
+// build creates the transaction spending the selected coins. The change
+// output is dropped when it would be dust.
+func (b *FundingBuilder) build(output, change *wire.TxOut, selected []coin) (*Funding, error) {
+	tx := wire.NewMsgTx(2)
+	inputs := make([]*UTXO, len(selected))
+	weights := make([]int64, len(selected))
+	var total int64
+	for i, c := range selected {
+		outpoint := c.utxo.OutPoint
+		tx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+		inputs[i] = c.utxo
+		weights[i] = c.weight
+		total += c.utxo.Output.Value
+	}
+	tx.AddTxOut(wire.NewTxOut(output.Value, output.PkScript))
+
+	funding := &Funding{Tx: tx, Inputs: inputs, ChangeIndex: -1}
+	if change != nil {
+		withChange := []*wire.TxOut{output, change}
+		vsize := VSize(TxWeight(weights, withChange))
+		changeOut := wire.NewTxOut(total-output.Value-int64(b.FeeRate.FeeForVSize(vsize)), change.PkScript)
+		if !mempool.IsDust(changeOut, minRelayFee) {
+			tx.AddTxOut(changeOut)
+			funding.ChangeIndex = 1
+		}
+	}
+
+	funding.VSize = VSize(TxWeight(weights, tx.TxOut))
+	var spent int64
+	for _, out := range tx.TxOut {
+		spent += out.Value
+	}
+	funding.Fee = total - spent
+	if funding.Fee < int64(b.FeeRate.FeeForVSize(funding.VSize)) {
+		return nil, fmt.Errorf("%w: selected coins do not pay the fee", ErrInsufficientFunds)
+	}
+
+	return funding, nil
+}
+
+// selectBnB searches, depth first, for coins whose effective values add up
+// to between target and target+window, so that dropping the excess to the
+// fee costs less than a change output. coins must be sorted by decreasing
+// effective value. It returns the selection wasting the least, or nil.
+func selectBnB(coins []coin, target, window int64) []coin {
+	// remaining[i] is the sum of the coins from i on
+	remaining := make([]int64, len(coins)+1)
+	for i := len(coins) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + coins[i].effective
+	}
+	if remaining[0] < target {
+		return nil
+	}
+
+	var best []int
+	bestExcess := window + 1
+	var current []int
+	tries := 0
+
+	var search func(i int, sum int64)
+	search = func(i int, sum int64) {
+		tries++
+		if tries > bnbMaxTries || sum > target+window || sum+remaining[i] < target {
+			return
+		}
+		if sum >= target {
+			if excess := sum - target; excess < bestExcess {
+				bestExcess = excess
+				best = append(best[:0], current...)
+			}
+			return
+		}
+		if i == len(coins) {
+			return
+		}
+
+		// Taking a coin equal to the one just skipped gives the same sums
+		skippedEqual := i > 0 && coins[i].effective == coins[i-1].effective &&
+			(len(current) == 0 || current[len(current)-1] != i-1)
+		if !skippedEqual {
+			current = append(current, i)
+			search(i+1, sum+coins[i].effective)
+			current = current[:len(current)-1]
+		}
+		search(i+1, sum)
+	}
+	search(0, 0)
+
+	if best == nil {
+		return nil
+	}
+	selected := make([]coin, len(best))
+	for i, idx := range best {
+		selected[i] = coins[idx]
+	}
+
+	return selected
+}
@@ -0,0 +1,129 @@
+package bitcoin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testCoins returns key path coins of the given values, all spendable by key.
+func testCoins(t *testing.T, key *btcec.PrivateKey, values ...int64) []*UTXO {
+	t.Helper()
+
+	_, script, err := CreateP2TRAddress(key.PubKey(), &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to create script: %v", err)
+	}
+	coins := make([]*UTXO, len(values))
+	for i, value := range values {
+		coins[i] = &UTXO{
+			OutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(i + 1)}},
+			Output:   wire.NewTxOut(value, script),
+		}
+	}
+
+	return coins
+}
+
+// signFunding signs every input of the funding by the key path of key.
+func signFunding(t *testing.T, funding *Funding, key *btcec.PrivateKey) {
+	t.Helper()
+
+	fetcher, err := NewPrevOutputFetcher(funding.Tx, funding.PrevOuts())
+	if err != nil {
+		t.Fatalf("Failed to create fetcher: %v", err)
+	}
+	sigHashes := txscript.NewTxSigHashes(funding.Tx, fetcher)
+	for i, utxo := range funding.Inputs {
+		witness, err := txscript.TaprootWitnessSignature(funding.Tx, sigHashes, i, utxo.Output.Value,
+			utxo.Output.PkScript, txscript.SigHashDefault, key)
+		if err != nil {
+			t.Fatalf("Failed to sign input %d: %v", i, err)
+		}
+		funding.Tx.TxIn[i].Witness = witness
+	}
+}
+
+// TestFundingExactMatch checks that branch-and-bound finds coins paying the
+// output and fee exactly, without change.
+func TestFundingExactMatch(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	rate := FeeRatePerVByte(2)
+	output := wire.NewTxOut(50000, testCoins(t, key, 0)[0].Output.PkScript)
+
+	inputFee := rate.FeeForWeight(KeyPathInputWeight)
+	builder := &FundingBuilder{FeeRate: rate, ChangeScript: output.PkScript}
+	target := builder.target(output)
+	builder.UTXOs = testCoins(t, key, 1000000, target-30000+inputFee, 30000+inputFee, 7000)
+
+	funding, err := builder.Build(output)
+	if err != nil {
+		t.Fatalf("Failed to build funding: %v", err)
+	}
+	if funding.ChangeIndex != -1 || len(funding.Tx.TxOut) != 1 {
+		t.Fatalf("Exact match should need no change")
+	}
+	if len(funding.Inputs) != 2 || funding.Inputs[0].Output.Value == 1000000 || funding.Inputs[1].Output.Value == 1000000 {
+		t.Fatalf("Unexpected coins selected")
+	}
+	if funding.Tx.TxOut[0].Value != output.Value {
+		t.Fatalf("Output value changed to %d", funding.Tx.TxOut[0].Value)
+	}
+	if funding.Fee < int64(rate.FeeForVSize(funding.VSize)) {
+		t.Fatalf("Fee %d is below the rate for %d vbytes", funding.Fee, funding.VSize)
+	}
+}
+
+// TestFundingWithChange checks the fallback to change, and that the size
+// and fee reported match the signed transaction.
+func TestFundingWithChange(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	rate := FeeRatePerVByte(5)
+	coins := testCoins(t, key, 40000, 30000, 20000)
+	output := wire.NewTxOut(55000, coins[0].Output.PkScript)
+	builder := &FundingBuilder{UTXOs: coins, FeeRate: rate, ChangeScript: coins[0].Output.PkScript}
+
+	funding, err := builder.Build(output)
+	if err != nil {
+		t.Fatalf("Failed to build funding: %v", err)
+	}
+	if funding.ChangeIndex != 1 || len(funding.Inputs) != 2 {
+		t.Fatalf("Expected the two largest coins with change, got %d inputs and change at %d",
+			len(funding.Inputs), funding.ChangeIndex)
+	}
+	if funding.Fee != int64(rate.FeeForVSize(funding.VSize)) {
+		t.Fatalf("Fee %d does not match %d vbytes at the rate", funding.Fee, funding.VSize)
+	}
+
+	signFunding(t, funding, key)
+	if err := VerifyTransaction(funding.Tx, funding.PrevOuts()); err != nil {
+		t.Fatalf("Signed funding is invalid: %v", err)
+	}
+	if vsize := mempool.GetTxVirtualSize(btcutil.NewTx(funding.Tx)); vsize != funding.VSize {
+		t.Fatalf("Signed transaction has %d vbytes, estimated %d", vsize, funding.VSize)
+	}
+}
+
+// TestFundingInsufficient checks that coins short of the output and fee are
+// reported as insufficient funds.
+func TestFundingInsufficient(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	coins := testCoins(t, key, 30000, 20000)
+	builder := &FundingBuilder{UTXOs: coins, FeeRate: FeeRatePerVByte(1), ChangeScript: coins[0].Output.PkScript}
+
+	// The coins add up to the output, but not to its fee
+	_, err := builder.Build(wire.NewTxOut(50000, coins[0].Output.PkScript))
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("Expected insufficient funds, got %v", err)
+	}
+	if _, err := builder.Build(wire.NewTxOut(100, coins[0].Output.PkScript)); err == nil {
+		t.Fatalf("Built a dust output")
+	}
+}
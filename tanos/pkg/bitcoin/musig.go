@@ -0,0 +1,95 @@
+package bitcoin
+
+import (
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/musig2"
+)
+
+// CreateMuSig2LockOutput creates a swap output whose key path is a MuSig2
+// 2-of-2 aggregate of the buyer and seller keys, with a timelocked refund
+// leaf for the buyer. It also returns the key aggregation context, already
+// tweaked with the output's taproot commitment, which both parties need to
+// sign the cooperative key path spend.
+func CreateMuSig2LockOutput(
+	buyerPubKey *secp.PublicKey,
+	sellerPubKey *secp.PublicKey,
+	lock Timelock,
+	params *chaincfg.Params,
+) (*TaprootOutput, *musig2.KeyAggContext, error) {
+	keyCtx, err := musig2.AggregateKeys(musig2.SortKeys([]*secp.PublicKey{buyerPubKey, sellerPubKey}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to aggregate keys: %v", err)
+	}
+
+	output, err := CreateRefundableLockOutput(keyCtx.AggregateKey(), buyerPubKey, lock, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyCtx, err = keyCtx.TaprootTweak(output.MerkleRoot())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to tweak aggregate key: %v", err)
+	}
+
+	// Sanity check that the signers will sign for the key in the output
+	if !keyCtx.AggregateKey().IsEqual(output.OutputKey) {
+		return nil, nil, fmt.Errorf("tweaked aggregate key does not match the output key")
+	}
+
+	return output, keyCtx, nil
+}
+
+// CreateClaimTransaction creates an unsigned transaction spending the key
+// path of the lock output at lockOutputIndex of lockTx, sending its value
+// minus fee to destScript. It returns the transaction together with the
+// BIP341 signature hash the key path signature must commit to. The claim
+// signals RBF, so that its fee can be raised while it races the refund.
+func CreateClaimTransaction(
+	lockTx *wire.MsgTx,
+	lockOutputIndex uint32,
+	destScript []byte,
+	fee int64,
+) (*wire.MsgTx, []byte, error) {
+	if int(lockOutputIndex) >= len(lockTx.TxOut) {
+		return nil, nil, fmt.Errorf("locking transaction has no output %d", lockOutputIndex)
+	}
+	prevOut := lockTx.TxOut[lockOutputIndex]
+
+	outputAmount := prevOut.Value - fee
+	if outputAmount <= 0 {
+		return nil, nil, fmt.Errorf("fee too high: %d, exceeds amount: %d", fee, prevOut.Value)
+	}
+
+	tx := wire.NewMsgTx(2) // Version 2 for taproot support
+
+	lockHash := lockTx.TxHash()
+	txIn := wire.NewTxIn(wire.NewOutPoint(&lockHash, lockOutputIndex), nil, nil)
+	txIn.Sequence = SequenceRBF
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(outputAmount, destScript))
+
+	sigHash, err := KeyPathSighash(tx, prevOut)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tx, sigHash, nil
+}
+
+// KeyPathSighash returns the SIGHASH_DEFAULT key path signature hash of the
+// first input of a single-input transaction spending prevOut.
+func KeyPathSighash(tx *wire.MsgTx, prevOut *wire.TxOut) ([]byte, error) {
+	prevOutFetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+	sigHash, err := CalculateSighash(tx, 0, prevOutFetcher, SigHashDefault)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate signature hash: %v", err)
+	}
+
+	return sigHash, nil
+}
@@ -0,0 +1,96 @@
+package bitcoin
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/musig2"
+)
+
+// TestMuSig2ClaimIsValid signs the key path of a MuSig2 lock output with an
+// adaptor session, completes it with the secret and checks the claim against
+// the script engine and that the secret can be extracted from the witness.
+func TestMuSig2ClaimIsValid(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+
+	buyer, _ := btcec.NewPrivateKey()
+	seller, _ := btcec.NewPrivateKey()
+	secret, _ := btcec.NewPrivateKey()
+
+	lockOutput, keyCtx, err := CreateMuSig2LockOutput(buyer.PubKey(), seller.PubKey(), RelativeBlocks(144), params)
+	if err != nil {
+		t.Fatalf("Failed to create lock output: %v", err)
+	}
+
+	lockTx := wire.NewMsgTx(2)
+	lockTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	lockTx.AddTxOut(wire.NewTxOut(100000, lockOutput.PkScript))
+
+	_, destScript, err := CreateP2TRAddress(seller.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create destination: %v", err)
+	}
+
+	claimTx, sigHash, err := CreateClaimTransaction(lockTx, 0, destScript, 1000)
+	if err != nil {
+		t.Fatalf("Failed to create claim transaction: %v", err)
+	}
+
+	buyerSec, buyerNonce, err := musig2.GenerateNonce(buyer.PubKey())
+	if err != nil {
+		t.Fatalf("Failed to generate buyer nonce: %v", err)
+	}
+	sellerSec, sellerNonce, err := musig2.GenerateNonce(seller.PubKey())
+	if err != nil {
+		t.Fatalf("Failed to generate seller nonce: %v", err)
+	}
+	aggNonce, err := musig2.AggregateNonces([]*musig2.PublicNonce{buyerNonce, sellerNonce})
+	if err != nil {
+		t.Fatalf("Failed to aggregate nonces: %v", err)
+	}
+
+	session, err := musig2.NewSession(keyCtx, aggNonce, sigHash, secret.PubKey())
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	buyerSig, err := session.Sign(buyerSec, buyer)
+	if err != nil {
+		t.Fatalf("Buyer failed to sign: %v", err)
+	}
+	sellerSig, err := session.Sign(sellerSec, seller)
+	if err != nil {
+		t.Fatalf("Seller failed to sign: %v", err)
+	}
+	preSig, err := session.AggregateAdaptor([]*btcec.ModNScalar{buyerSig, sellerSig})
+	if err != nil {
+		t.Fatalf("Failed to aggregate pre-signature: %v", err)
+	}
+
+	claimTx.TxIn[0].Witness = wire.TxWitness{preSig.Complete(&secret.Key)}
+
+	prevOut := lockTx.TxOut[0]
+	fetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+	engine, err := txscript.NewEngine(
+		prevOut.PkScript, claimTx, 0, txscript.StandardVerifyFlags, nil,
+		txscript.NewTxSigHashes(claimTx, fetcher), prevOut.Value, fetcher,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create script engine: %v", err)
+	}
+	if err := engine.Execute(); err != nil {
+		t.Fatalf("Claim transaction rejected by script engine: %v", err)
+	}
+
+	extracted, err := preSig.ExtractSecret(claimTx.TxIn[0].Witness[0])
+	if err != nil {
+		t.Fatalf("Failed to extract secret: %v", err)
+	}
+	if !extracted.Equals(&secret.Key) {
+		t.Fatalf("Extracted secret does not match")
+	}
+}
@@ -0,0 +1,230 @@
+package bitcoin
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// NewPSBT creates a BIP174 PSBT for tx, which is copied without its
+// signatures. prevOuts must hold the output spent by every input, in input
+// order, and is recorded as the witness UTXO of each input.
+func NewPSBT(tx *wire.MsgTx, prevOuts []*wire.TxOut) (*psbt.Packet, error) {
+	if len(prevOuts) != len(tx.TxIn) {
+		return nil, fmt.Errorf("got %d spent outputs for %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+
+	unsigned := tx.Copy()
+	for _, txIn := range unsigned.TxIn {
+		txIn.SignatureScript = nil
+		txIn.Witness = nil
+	}
+
+	packet, err := psbt.NewFromUnsignedTx(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PSBT: %v", err)
+	}
+	for i, prevOut := range prevOuts {
+		if prevOut == nil {
+			return nil, fmt.Errorf("missing spent output of input %d", i)
+		}
+		packet.Inputs[i].WitnessUtxo = wire.NewTxOut(prevOut.Value, prevOut.PkScript)
+	}
+
+	return packet, nil
+}
+
+// AddTaprootInput records the BIP371 fields of input index, which spends
+// output: the internal key, the merkle root and every leaf script with its
+// control block, so a signer can take either spend path.
+func AddTaprootInput(packet *psbt.Packet, index int, output *TaprootOutput) error {
+	if index < 0 || index >= len(packet.Inputs) {
+		return fmt.Errorf("PSBT has no input %d", index)
+	}
+	input := &packet.Inputs[index]
+	if input.WitnessUtxo == nil || !bytes.Equal(input.WitnessUtxo.PkScript, output.PkScript) {
+		return fmt.Errorf("input %d does not spend the taproot output", index)
+	}
+
+	input.TaprootInternalKey = schnorr.SerializePubKey(output.InternalKey)
+	if output.Root == nil {
+		return nil
+	}
+
+	input.TaprootMerkleRoot = output.MerkleRoot()
+	input.TaprootLeafScript = nil
+	for i, leaf := range output.Leaves {
+		controlBlock, err := output.ControlBlock(i)
+		if err != nil {
+			return err
+		}
+		input.TaprootLeafScript = append(input.TaprootLeafScript, &psbt.TaprootTapLeafScript{
+			ControlBlock: controlBlock,
+			Script:       leaf.Script,
+			LeafVersion:  leaf.LeafVersion,
+		})
+	}
+
+	return nil
+}
+
+// AddTaprootOutput records the BIP371 fields of output index, which pays to
+// output: the internal key and the script tree, so a wallet can check where
+// the funds go.
+func AddTaprootOutput(packet *psbt.Packet, index int, output *TaprootOutput) error {
+	if index < 0 || index >= len(packet.Outputs) {
+		return fmt.Errorf("PSBT has no output %d", index)
+	}
+	if !bytes.Equal(packet.UnsignedTx.TxOut[index].PkScript, output.PkScript) {
+		return fmt.Errorf("output %d does not pay to the taproot output", index)
+	}
+
+	packet.Outputs[index].TaprootInternalKey = schnorr.SerializePubKey(output.InternalKey)
+	if len(output.Leaves) > 0 {
+		packet.Outputs[index].TaprootTapTree = tapTree(output)
+	}
+
+	return nil
+}
+
+// tapTree serializes the script tree of the output as BIP371 expects: the
+// depth, leaf version and script of every leaf, in depth-first order.
+func tapTree(output *TaprootOutput) []byte {
+	var buf bytes.Buffer
+	for i, leaf := range output.Leaves {
+		buf.WriteByte(byte(len(output.proofs[i]) / 32))
+		buf.WriteByte(byte(leaf.LeafVersion))
+		_ = wire.WriteVarBytes(&buf, 0, leaf.Script)
+	}
+
+	return buf.Bytes()
+}
+
+// EncodePSBT encodes the PSBT in base64, the format wallets exchange.
+func EncodePSBT(packet *psbt.Packet) (string, error) {
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode PSBT: %v", err)
+	}
+
+	return encoded, nil
+}
+
+// DecodePSBT decodes a base64 PSBT.
+func DecodePSBT(encoded string) (*psbt.Packet, error) {
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(strings.TrimSpace(encoded)), true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PSBT: %v", err)
+	}
+
+	return packet, nil
+}
+
+// SignPSBTLeaf signs input index of the PSBT through the leaf with the
+// given script, adding a SIGHASH_DEFAULT script path signature by privKey.
+// The leaf must be one of the input's BIP371 leaf scripts.
+func SignPSBTLeaf(packet *psbt.Packet, index int, script []byte, privKey *secp.PrivateKey) error {
+	if index < 0 || index >= len(packet.Inputs) {
+		return fmt.Errorf("PSBT has no input %d", index)
+	}
+
+	var leaf *psbt.TaprootTapLeafScript
+	for _, leafScript := range packet.Inputs[index].TaprootLeafScript {
+		if bytes.Equal(leafScript.Script, script) {
+			leaf = leafScript
+			break
+		}
+	}
+	if leaf == nil {
+		return fmt.Errorf("input %d has no such leaf script", index)
+	}
+
+	prevOuts := make([]*wire.TxOut, len(packet.Inputs))
+	for i, input := range packet.Inputs {
+		prevOuts[i] = input.WitnessUtxo
+	}
+	fetcher, err := NewPrevOutputFetcher(packet.UnsignedTx, prevOuts)
+	if err != nil {
+		return err
+	}
+
+	tapLeaf := txscript.NewTapLeaf(leaf.LeafVersion, leaf.Script)
+	sigHash, err := CalculateSighash(packet.UnsignedTx, index, fetcher, SigHashDefault, WithTapLeaf(tapLeaf))
+	if err != nil {
+		return fmt.Errorf("failed to calculate signature hash: %v", err)
+	}
+	sig, err := schnorr.Sign(privKey, sigHash)
+	if err != nil {
+		return fmt.Errorf("failed to create schnorr signature: %v", err)
+	}
+
+	leafHash := tapLeaf.TapHash()
+	packet.Inputs[index].TaprootScriptSpendSig = append(packet.Inputs[index].TaprootScriptSpendSig, &psbt.TaprootScriptSpendSig{
+		XOnlyPubKey: schnorr.SerializePubKey(privKey.PubKey()),
+		LeafHash:    leafHash[:],
+		Signature:   sig.Serialize(),
+		SigHash:     SigHashDefault,
+	})
+
+	return nil
+}
+
+// ImportPSBT decodes a PSBT signed by another wallet for the unsigned
+// transaction tx, finalizes the inputs that are not final yet and returns
+// the signed transaction. The transaction must keep the ID of tx, and every
+// input is verified against prevOuts, the outputs spent by tx in input
+// order, rather than against the outputs claimed by the PSBT.
+func ImportPSBT(encoded string, tx *wire.MsgTx, prevOuts []*wire.TxOut) (*wire.MsgTx, error) {
+	packet, err := DecodePSBT(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if packet.UnsignedTx.TxHash() != tx.TxHash() {
+		return nil, fmt.Errorf("PSBT is for transaction %s, not %s", packet.UnsignedTx.TxHash(), tx.TxHash())
+	}
+
+	if err := psbt.MaybeFinalizeAll(packet); err != nil {
+		return nil, fmt.Errorf("failed to finalize PSBT: %v", err)
+	}
+	signed, err := psbt.Extract(packet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract transaction: %v", err)
+	}
+
+	if err := VerifyTransaction(signed, prevOuts); err != nil {
+		return nil, err
+	}
+
+	return signed, nil
+}
+
+// VerifyTransaction runs the scripts of every input of tx against the
+// outputs it spends, given in input order.
+func VerifyTransaction(tx *wire.MsgTx, prevOuts []*wire.TxOut) error {
+	fetcher, err := NewPrevOutputFetcher(tx, prevOuts)
+	if err != nil {
+		return err
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	for i, prevOut := range prevOuts {
+		engine, err := txscript.NewEngine(
+			prevOut.PkScript, tx, i, txscript.StandardVerifyFlags, nil,
+			sigHashes, prevOut.Value, fetcher,
+		)
+		if err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+		if err := engine.Execute(); err != nil {
+			return fmt.Errorf("input %d: script verification failed: %v", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package bitcoin
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestRefundPSBTRoundTrip signs the refund leaf through a PSBT, round-trips
+// it through base64 and checks that importing it gives the same transaction
+// as CreateRefundTransaction.
+func TestRefundPSBTRoundTrip(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	lock := RelativeBlocks(144)
+
+	nostrKey, _ := btcec.NewPrivateKey()
+	commitment, _ := btcec.NewPrivateKey()
+	buyer, _ := btcec.NewPrivateKey()
+
+	lockOutput, err := CreateNostrSignatureLockOutput(nostrKey.PubKey(), commitment.PubKey(), buyer.PubKey(), lock, params)
+	if err != nil {
+		t.Fatalf("Failed to create lock output: %v", err)
+	}
+	lockTx := wire.NewMsgTx(2)
+	lockTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	lockTx.AddTxOut(wire.NewTxOut(100000, lockOutput.PkScript))
+	_, destScript, err := CreateP2TRAddress(buyer.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create destination: %v", err)
+	}
+
+	packet, err := NewRefundPSBT(lockTx, 0, lockOutput, lock, buyer.PubKey(), destScript, 1000)
+	if err != nil {
+		t.Fatalf("Failed to create refund PSBT: %v", err)
+	}
+	input := packet.Inputs[0]
+	if !bytes.Equal(input.TaprootInternalKey, schnorr.SerializePubKey(lockOutput.InternalKey)) {
+		t.Fatalf("PSBT has the wrong internal key")
+	}
+	if !bytes.Equal(input.TaprootMerkleRoot, lockOutput.MerkleRoot()) {
+		t.Fatalf("PSBT has the wrong merkle root")
+	}
+	if len(input.TaprootLeafScript) != 1 || !bytes.Equal(input.TaprootLeafScript[0].Script, lockOutput.Leaves[0].Script) {
+		t.Fatalf("PSBT does not carry the refund leaf")
+	}
+
+	if err := SignPSBTLeaf(packet, 0, lockOutput.Leaves[0].Script, buyer); err != nil {
+		t.Fatalf("Failed to sign refund leaf: %v", err)
+	}
+	encoded, err := EncodePSBT(packet)
+	if err != nil {
+		t.Fatalf("Failed to encode PSBT: %v", err)
+	}
+
+	refundTx, err := CreateRefundTransaction(lockTx, 0, lockOutput, lock, buyer, destScript, 1000)
+	if err != nil {
+		t.Fatalf("Failed to create refund transaction: %v", err)
+	}
+	prevOuts := []*wire.TxOut{lockTx.TxOut[0]}
+	imported, err := ImportPSBT(encoded, refundTx, prevOuts)
+	if err != nil {
+		t.Fatalf("Failed to import refund PSBT: %v", err)
+	}
+	if imported.WitnessHash() != refundTx.WitnessHash() {
+		t.Fatalf("Imported refund differs from the directly signed one")
+	}
+
+	// The PSBT must be for the transaction and the outputs it spends
+	other := refundTx.Copy()
+	other.TxOut[0].Value--
+	if _, err := ImportPSBT(encoded, other, prevOuts); err == nil {
+		t.Fatalf("Imported a PSBT for another transaction")
+	}
+	if _, err := ImportPSBT(encoded, refundTx, []*wire.TxOut{wire.NewTxOut(100001, lockOutput.PkScript)}); err == nil {
+		t.Fatalf("Imported a PSBT against the wrong spent output")
+	}
+}
+
+// TestTaprootOutputPSBTFields checks the BIP371 fields of a swap output.
+func TestTaprootOutputPSBTFields(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	output, err := CreateRefundableLockOutput(key.PubKey(), key.PubKey(), RelativeBlocks(10), &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to create output: %v", err)
+	}
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(5000, output.PkScript))
+	packet, err := NewPSBT(tx, []*wire.TxOut{wire.NewTxOut(6000, output.PkScript)})
+	if err != nil {
+		t.Fatalf("Failed to create PSBT: %v", err)
+	}
+	if err := AddTaprootOutput(packet, 0, output); err != nil {
+		t.Fatalf("Failed to add output fields: %v", err)
+	}
+
+	// A single leaf sits at depth 0
+	script := output.Leaves[0].Script
+	want := append([]byte{0, byte(output.Leaves[0].LeafVersion), byte(len(script))}, script...)
+	if !bytes.Equal(packet.Outputs[0].TaprootTapTree, want) {
+		t.Fatalf("Unexpected tap tree %x", packet.Outputs[0].TaprootTapTree)
+	}
+
+	encoded, err := EncodePSBT(packet)
+	if err != nil {
+		t.Fatalf("Failed to encode PSBT: %v", err)
+	}
+	decoded, err := DecodePSBT(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode PSBT: %v", err)
+	}
+	if !bytes.Equal(decoded.Outputs[0].TaprootInternalKey, schnorr.SerializePubKey(output.InternalKey)) {
+		t.Fatalf("Decoded PSBT lost the output internal key")
+	}
+
+	other, _ := btcec.NewPrivateKey()
+	wrong, _ := CreateRefundableLockOutput(other.PubKey(), key.PubKey(), RelativeBlocks(10), &chaincfg.RegressionNetParams)
+	if err := AddTaprootOutput(packet, 0, wrong); err == nil {
+		t.Fatalf("Added fields of another output")
+	}
+}
@@ -0,0 +1,269 @@
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrRefundBranch is returned by SegwitClaimSignatures for a witness that
+// spends the refund branch of a segwit lock output.
+var ErrRefundBranch = errors.New("witness spends the refund branch")
+
+// maxECDSASigSize is the largest low-S DER signature with its sighash type
+// byte, as in P2WPKHWitnessSize.
+const maxECDSASigSize = 72
+
+// SegwitLockOutput describes a P2WSH swap output, for counterparties that
+// can only sign with ECDSA.
+type SegwitLockOutput struct {
+	WitnessScript []byte // Script committed to by the output
+	PkScript      []byte // OP_0 <sha256(witness script)>
+	Address       string // bech32 encoding of the output
+}
+
+// CreateSegwitLockScript creates the witness script of a P2WSH swap output:
+//
+//	OP_IF
+//	  <sellerKey> OP_CHECKSIGVERIFY <buyerKey> OP_CHECKSIG
+//	OP_ELSE
+//	  <value> OP_CHECKSEQUENCEVERIFY|OP_CHECKLOCKTIMEVERIFY OP_DROP <buyerKey> OP_CHECKSIG
+//	OP_ENDIF
+//
+// The claim branch needs the signatures of both keys, and the refund branch
+// the buyer's once the timelock has expired.
+func CreateSegwitLockScript(buyerPubKey, sellerPubKey *secp.PublicKey, lock Timelock) ([]byte, error) {
+	if err := lock.Validate(); err != nil {
+		return nil, err
+	}
+
+	builder := txscript.NewScriptBuilder()
+	builder.AddOp(txscript.OP_IF)
+	builder.AddData(sellerPubKey.SerializeCompressed())
+	builder.AddOp(txscript.OP_CHECKSIGVERIFY)
+	builder.AddData(buyerPubKey.SerializeCompressed())
+	builder.AddOp(txscript.OP_CHECKSIG)
+	builder.AddOp(txscript.OP_ELSE)
+	builder.AddInt64(int64(lock.Value))
+	builder.AddOp(lock.opcode())
+	builder.AddOp(txscript.OP_DROP)
+	builder.AddData(buyerPubKey.SerializeCompressed())
+	builder.AddOp(txscript.OP_CHECKSIG)
+	builder.AddOp(txscript.OP_ENDIF)
+
+	return builder.Script()
+}
+
+// CreateSegwitLockOutput creates the P2WSH output of the lock script of
+// CreateSegwitLockScript.
+func CreateSegwitLockOutput(
+	buyerPubKey *secp.PublicKey,
+	sellerPubKey *secp.PublicKey,
+	lock Timelock,
+	params *chaincfg.Params,
+) (*SegwitLockOutput, error) {
+	witnessScript, err := CreateSegwitLockScript(buyerPubKey, sellerPubKey, lock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock script: %v", err)
+	}
+
+	scriptHash := sha256.Sum256(witnessScript)
+	address, err := btcutil.NewAddressWitnessScriptHash(scriptHash[:], params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create P2WSH address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create P2WSH script: %v", err)
+	}
+
+	return &SegwitLockOutput{
+		WitnessScript: witnessScript,
+		PkScript:      pkScript,
+		Address:       address.EncodeAddress(),
+	}, nil
+}
+
+// SigHash returns the BIP143 SIGHASH_ALL signature hash of input index of
+// tx, which spends value satoshis locked in the output.
+func (o *SegwitLockOutput) SigHash(tx *wire.MsgTx, index int, value int64) ([]byte, error) {
+	if index < 0 || index >= len(tx.TxIn) {
+		return nil, fmt.Errorf("transaction has no input %d", index)
+	}
+
+	fetcher := txscript.NewCannedPrevOutputFetcher(o.PkScript, value)
+	sigHash, err := txscript.CalcWitnessSigHash(
+		o.WitnessScript, txscript.NewTxSigHashes(tx, fetcher), txscript.SigHashAll, tx, index, value,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate signature hash: %v", err)
+	}
+
+	return sigHash, nil
+}
+
+// CreateSegwitClaimTransaction creates an unsigned transaction spending the
+// claim branch of the segwit lock output at lockOutputIndex of lockTx,
+// sending its value minus fee to destScript. It returns the transaction
+// with the BIP143 signature hash both signatures must commit to. Like the
+// MuSig2 claim, it signals RBF.
+func CreateSegwitClaimTransaction(
+	lockTx *wire.MsgTx,
+	lockOutputIndex uint32,
+	lockOutput *SegwitLockOutput,
+	destScript []byte,
+	fee int64,
+) (*wire.MsgTx, []byte, error) {
+	prevOut, err := segwitLockPrevOut(lockTx, lockOutputIndex, lockOutput)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outputAmount := prevOut.Value - fee
+	if outputAmount <= 0 {
+		return nil, nil, fmt.Errorf("fee too high: %d, exceeds amount: %d", fee, prevOut.Value)
+	}
+
+	tx := wire.NewMsgTx(2)
+
+	lockHash := lockTx.TxHash()
+	txIn := wire.NewTxIn(wire.NewOutPoint(&lockHash, lockOutputIndex), nil, nil)
+	txIn.Sequence = SequenceRBF
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(outputAmount, destScript))
+
+	sigHash, err := lockOutput.SigHash(tx, 0, prevOut.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tx, sigHash, nil
+}
+
+// SegwitClaimWitness returns the witness spending the claim branch of the
+// lock output with the seller's and the buyer's DER signatures, to which
+// the SIGHASH_ALL type is appended.
+func SegwitClaimWitness(lockOutput *SegwitLockOutput, sellerSig, buyerSig []byte) wire.TxWitness {
+	return wire.TxWitness{
+		append(append([]byte(nil), buyerSig...), byte(txscript.SigHashAll)),
+		append(append([]byte(nil), sellerSig...), byte(txscript.SigHashAll)),
+		{1}, // Selects the OP_IF branch
+		lockOutput.WitnessScript,
+	}
+}
+
+// SegwitClaimSignatures returns the seller's and the buyer's signatures from
+// the witness of a claim of the lock output. It returns ErrRefundBranch if
+// the witness spends the refund branch instead.
+func SegwitClaimSignatures(lockOutput *SegwitLockOutput, witness wire.TxWitness) (*ecdsa.Signature, *ecdsa.Signature, error) {
+	if len(witness) == 0 || !bytes.Equal(witness[len(witness)-1], lockOutput.WitnessScript) {
+		return nil, nil, fmt.Errorf("witness does not spend the lock output")
+	}
+	if len(witness) == 3 && len(witness[1]) == 0 {
+		return nil, nil, ErrRefundBranch
+	}
+	if len(witness) != 4 || !bytes.Equal(witness[2], []byte{1}) {
+		return nil, nil, fmt.Errorf("witness does not spend the claim branch")
+	}
+
+	sigs := make([]*ecdsa.Signature, 2)
+	for i, raw := range witness[:2] {
+		if len(raw) == 0 || raw[len(raw)-1] != byte(txscript.SigHashAll) {
+			return nil, nil, fmt.Errorf("claim signature %d is not SIGHASH_ALL", i)
+		}
+		sig, err := ecdsa.ParseDERSignature(raw[:len(raw)-1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid claim signature %d: %v", i, err)
+		}
+		sigs[i] = sig
+	}
+
+	return sigs[1], sigs[0], nil
+}
+
+// CreateSegwitRefundTransaction creates and signs a transaction that spends
+// the refund branch of the segwit lock output at lockOutputIndex of lockTx,
+// sending its value minus fee to destScript. It is only valid once the
+// timelock has expired.
+func CreateSegwitRefundTransaction(
+	lockTx *wire.MsgTx,
+	lockOutputIndex uint32,
+	lockOutput *SegwitLockOutput,
+	lock Timelock,
+	refundPrivKey *secp.PrivateKey,
+	destScript []byte,
+	fee int64,
+) (*wire.MsgTx, error) {
+	prevOut, err := segwitLockPrevOut(lockTx, lockOutputIndex, lockOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	outputAmount := prevOut.Value - fee
+	if outputAmount <= 0 {
+		return nil, fmt.Errorf("fee too high: %d, exceeds amount: %d", fee, prevOut.Value)
+	}
+
+	tx := wire.NewMsgTx(2) // Version 2 for BIP68 relative timelocks
+
+	lockHash := lockTx.TxHash()
+	txIn := wire.NewTxIn(wire.NewOutPoint(&lockHash, lockOutputIndex), nil, nil)
+	lock.apply(tx, txIn)
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(outputAmount, destScript))
+
+	sigHash, err := lockOutput.SigHash(tx, 0, prevOut.Value)
+	if err != nil {
+		return nil, err
+	}
+	sig := ecdsa.Sign(refundPrivKey, sigHash).Serialize()
+	tx.TxIn[0].Witness = wire.TxWitness{
+		append(sig, byte(txscript.SigHashAll)),
+		nil, // Selects the OP_ELSE branch
+		lockOutput.WitnessScript,
+	}
+
+	return tx, nil
+}
+
+// segwitLockPrevOut returns the output of lockTx at lockOutputIndex, which
+// must pay to the lock output.
+func segwitLockPrevOut(lockTx *wire.MsgTx, lockOutputIndex uint32, lockOutput *SegwitLockOutput) (*wire.TxOut, error) {
+	if int(lockOutputIndex) >= len(lockTx.TxOut) {
+		return nil, fmt.Errorf("locking transaction has no output %d", lockOutputIndex)
+	}
+	prevOut := lockTx.TxOut[lockOutputIndex]
+	if !bytes.Equal(prevOut.PkScript, lockOutput.PkScript) {
+		return nil, fmt.Errorf("output %d does not pay to the lock output", lockOutputIndex)
+	}
+
+	return prevOut, nil
+}
+
+// SegwitClaimFee returns the fee at the rate of the claim transaction built
+// by CreateSegwitClaimTransaction, for the largest signatures.
+func SegwitClaimFee(rate FeeRate, lockOutput *SegwitLockOutput, destScript []byte) int64 {
+	witness := 1 + 2*(1+maxECDSASigSize) + 1 + 1 + segwitScriptSize(lockOutput)
+	return rate.FeeForTx([]int64{inputBaseWeight + int64(witness)}, []*wire.TxOut{wire.NewTxOut(0, destScript)})
+}
+
+// SegwitRefundFee returns the fee at the rate of the refund transaction
+// built by CreateSegwitRefundTransaction, for the largest signature.
+func SegwitRefundFee(rate FeeRate, lockOutput *SegwitLockOutput, destScript []byte) int64 {
+	witness := 1 + 1 + maxECDSASigSize + 1 + segwitScriptSize(lockOutput)
+	return rate.FeeForTx([]int64{inputBaseWeight + int64(witness)}, []*wire.TxOut{wire.NewTxOut(0, destScript)})
+}
+
+// segwitScriptSize returns the size of the witness script as a witness
+// item, with its length prefix.
+func segwitScriptSize(lockOutput *SegwitLockOutput) int {
+	return wire.VarIntSerializeSize(uint64(len(lockOutput.WitnessScript))) + len(lockOutput.WitnessScript)
+}
@@ -0,0 +1,99 @@
+package bitcoin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestSegwitClaimAndRefund checks that the simulated chain accepts a claim
+// of a P2WSH lock output with both signatures, but not with one, and a
+// refund only once its timelock has expired.
+func TestSegwitClaimAndRefund(t *testing.T) {
+	ctx := context.Background()
+	params := &chaincfg.RegressionNetParams
+
+	for _, lock := range []Timelock{RelativeBlocks(10), AbsoluteHeight(20)} {
+		chain := NewSimChain()
+		buyer, _ := btcec.NewPrivateKey()
+		seller, _ := btcec.NewPrivateKey()
+
+		lockOutput, err := CreateSegwitLockOutput(buyer.PubKey(), seller.PubKey(), lock, params)
+		if err != nil {
+			t.Fatalf("Failed to create lock output: %v", err)
+		}
+		lockTx := chain.Fund(lockOutput.PkScript, 100000)
+
+		_, destScript, err := CreateP2TRAddress(seller.PubKey(), params)
+		if err != nil {
+			t.Fatalf("Failed to create destination: %v", err)
+		}
+		fee := SegwitClaimFee(FeeRatePerVByte(2), lockOutput, destScript)
+		claimTx, sigHash, err := CreateSegwitClaimTransaction(lockTx, 0, lockOutput, destScript, fee)
+		if err != nil {
+			t.Fatalf("Failed to create claim: %v", err)
+		}
+		sellerSig := ecdsa.Sign(seller, sigHash).Serialize()
+		buyerSig := ecdsa.Sign(buyer, sigHash).Serialize()
+
+		// The seller alone cannot claim
+		claimTx.TxIn[0].Witness = SegwitClaimWitness(lockOutput, sellerSig, sellerSig)
+		if _, err := chain.Broadcast(ctx, claimTx); err == nil {
+			t.Fatalf("Accepted a claim without the buyer's signature")
+		}
+
+		claimTx.TxIn[0].Witness = SegwitClaimWitness(lockOutput, sellerSig, buyerSig)
+		gotSeller, gotBuyer, err := SegwitClaimSignatures(lockOutput, claimTx.TxIn[0].Witness)
+		if err != nil {
+			t.Fatalf("Failed to read claim signatures: %v", err)
+		}
+		if !gotSeller.IsEqual(ecdsa.Sign(seller, sigHash)) || !gotBuyer.IsEqual(ecdsa.Sign(buyer, sigHash)) {
+			t.Fatalf("Claim signatures read back in the wrong order")
+		}
+
+		refundFee := SegwitRefundFee(FeeRatePerVByte(2), lockOutput, destScript)
+		refundTx, err := CreateSegwitRefundTransaction(lockTx, 0, lockOutput, lock, buyer, destScript, refundFee)
+		if err != nil {
+			t.Fatalf("Failed to create refund: %v", err)
+		}
+		if _, _, err := SegwitClaimSignatures(lockOutput, refundTx.TxIn[0].Witness); err != ErrRefundBranch {
+			t.Fatalf("Expected ErrRefundBranch for the refund witness, got %v", err)
+		}
+
+		// The refund is rejected before the timelock, and the claim is not
+		// held back by it
+		validTip := 10
+		if lock.Type == AbsoluteTimelock {
+			validTip = 20
+		}
+		chain.Mine(validTip - 2)
+		if _, err := chain.Broadcast(ctx, refundTx); err == nil {
+			t.Fatalf("Refund (type %d) accepted before its timelock", lock.Type)
+		}
+		if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+			t.Fatalf("Claim (type %d) rejected: %v", lock.Type, err)
+		}
+		weight := blockchain.GetTransactionWeight(btcutil.NewTx(claimTx))
+		if FeeRatePerVByte(2).FeeForWeight(weight) > fee {
+			t.Fatalf("Claim fee %d below the rate for weight %d", fee, weight)
+		}
+
+		// A second lock output checks the refund after the timelock
+		refundLockTx := chain.Fund(lockOutput.PkScript, 100000)
+		refundTx, err = CreateSegwitRefundTransaction(refundLockTx, 0, lockOutput, lock, buyer, destScript, refundFee)
+		if err != nil {
+			t.Fatalf("Failed to create refund: %v", err)
+		}
+		if lock.Type == RelativeTimelock {
+			chain.Mine(int(lock.Value) - 1)
+		}
+		if _, err := chain.Broadcast(ctx, refundTx); err != nil {
+			t.Fatalf("Refund (type %d) rejected after its timelock: %v", lock.Type, err)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// BIP341 sighash type flags. SigHashDefault commits to the whole transaction
+// exactly like SigHashAll but produces 64-byte signatures with no trailing
+// hash type byte.
+const (
+	SigHashDefault      = txscript.SigHashDefault
+	SigHashAll          = txscript.SigHashAll
+	SigHashNone         = txscript.SigHashNone
+	SigHashSingle       = txscript.SigHashSingle
+	SigHashAnyOneCanPay = txscript.SigHashAnyOneCanPay
+
+	// sigHashOutputMask selects the output mode (ALL, NONE or SINGLE).
+	sigHashOutputMask = 0x03
+
+	// annexTag is the first byte every taproot annex must start with.
+	annexTag = 0x50
+
+	// blankCodeSepPos is the codesep_pos value used when no OP_CODESEPARATOR
+	// has been executed.
+	blankCodeSepPos = 0xffffffff
+)
+
+// sighashOptions holds the optional parts of a BIP341 signature message.
+type sighashOptions struct {
+	annex      []byte
+	leaf       *txscript.TapLeaf
+	codeSepPos uint32
+}
+
+// SighashOption customises the signature message produced by CalculateSighash.
+type SighashOption func(*sighashOptions)
+
+// WithAnnex commits the signature hash to the annex that will be placed as the
+// last witness element of the input. The annex must start with 0x50.
+func WithAnnex(annex []byte) SighashOption {
+	return func(o *sighashOptions) {
+		o.annex = annex
+	}
+}
+
+// WithTapLeaf switches the signature hash to the script path (ext_flag = 1),
+// committing to the hash of the leaf being executed.
+func WithTapLeaf(leaf txscript.TapLeaf) SighashOption {
+	return func(o *sighashOptions) {
+		o.leaf = &leaf
+	}
+}
+
+// WithCodeSeparator sets the opcode position of the last executed
+// OP_CODESEPARATOR for script path spends. It has no effect on key path spends.
+func WithCodeSeparator(pos uint32) SighashOption {
+	return func(o *sighashOptions) {
+		o.codeSepPos = pos
+	}
+}
+
+// NewPrevOutputFetcher builds a fetcher for the outputs spent by tx.
+// prevOuts must hold the spent output of every input, in input order.
+func NewPrevOutputFetcher(tx *wire.MsgTx, prevOuts []*wire.TxOut) (*txscript.MultiPrevOutFetcher, error) {
+	if len(prevOuts) != len(tx.TxIn) {
+		return nil, fmt.Errorf("got %d previous outputs for %d inputs", len(prevOuts), len(tx.TxIn))
+	}
+
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, txIn := range tx.TxIn {
+		if prevOuts[i] == nil {
+			return nil, fmt.Errorf("missing previous output for input %d", i)
+		}
+		fetcher.AddPrevOut(txIn.PreviousOutPoint, prevOuts[i])
+	}
+
+	return fetcher, nil
+}
+
+// CalculateSighash calculates the BIP341 signature hash for a taproot input.
+// By default the key path message is produced; WithTapLeaf selects the script
+// path instead. prevOuts must be able to return the output spent by every
+// input of tx, since the digest commits to all spent amounts and scripts
+// unless SIGHASH_ANYONECANPAY is used.
+func CalculateSighash(
+	tx *wire.MsgTx,
+	inputIndex int,
+	prevOuts txscript.PrevOutputFetcher,
+	hashType txscript.SigHashType,
+	opts ...SighashOption,
+) ([]byte, error) {
+	msg, err := sigMsg(tx, inputIndex, prevOuts, hashType, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := chainhash.TaggedHash(chainhash.TagTapSighash, msg)
+	return hash[:], nil
+}
+
+// sigMsg serializes the BIP341 signature message, prefixed with the sighash
+// epoch byte, for the given input.
+func sigMsg(
+	tx *wire.MsgTx,
+	inputIndex int,
+	prevOuts txscript.PrevOutputFetcher,
+	hashType txscript.SigHashType,
+	opts ...SighashOption,
+) ([]byte, error) {
+	o := &sighashOptions{codeSepPos: blankCodeSepPos}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if !isValidTaprootSigHash(hashType) {
+		return nil, fmt.Errorf("invalid taproot sighash type: 0x%x", uint32(hashType))
+	}
+	if inputIndex < 0 || inputIndex >= len(tx.TxIn) {
+		return nil, fmt.Errorf("input index %d out of range [0, %d)", inputIndex, len(tx.TxIn))
+	}
+	if o.annex != nil && (len(o.annex) == 0 || o.annex[0] != annexTag) {
+		return nil, fmt.Errorf("annex must start with 0x%x", annexTag)
+	}
+
+	anyoneCanPay := hashType&SigHashAnyOneCanPay != 0
+	outputType := hashType & sigHashOutputMask
+	if hashType == SigHashDefault {
+		outputType = SigHashAll
+	}
+
+	var msg bytes.Buffer
+
+	// Sighash epoch, followed by the control fields.
+	msg.WriteByte(0x00)
+	msg.WriteByte(byte(hashType))
+	writeUint32(&msg, uint32(tx.Version))
+	writeUint32(&msg, tx.LockTime)
+
+	// Data about the whole transaction, unless only this input is signed.
+	if !anyoneCanPay {
+		var prevOutsBuf, amountsBuf, scriptsBuf, sequencesBuf bytes.Buffer
+		for i, txIn := range tx.TxIn {
+			prevOut := prevOuts.FetchPrevOutput(txIn.PreviousOutPoint)
+			if prevOut == nil {
+				return nil, fmt.Errorf("missing previous output for input %d", i)
+			}
+
+			if err := wire.WriteOutPoint(&prevOutsBuf, 0, 0, &txIn.PreviousOutPoint); err != nil {
+				return nil, err
+			}
+			writeUint64(&amountsBuf, uint64(prevOut.Value))
+			if err := wire.WriteVarBytes(&scriptsBuf, 0, prevOut.PkScript); err != nil {
+				return nil, err
+			}
+			writeUint32(&sequencesBuf, txIn.Sequence)
+		}
+
+		msg.Write(sha256Bytes(prevOutsBuf.Bytes()))
+		msg.Write(sha256Bytes(amountsBuf.Bytes()))
+		msg.Write(sha256Bytes(scriptsBuf.Bytes()))
+		msg.Write(sha256Bytes(sequencesBuf.Bytes()))
+	}
+
+	if outputType != SigHashNone && outputType != SigHashSingle {
+		var outputsBuf bytes.Buffer
+		for _, txOut := range tx.TxOut {
+			if err := wire.WriteTxOut(&outputsBuf, 0, 0, txOut); err != nil {
+				return nil, err
+			}
+		}
+		msg.Write(sha256Bytes(outputsBuf.Bytes()))
+	}
+
+	// Data about this input.
+	var spendType byte
+	if o.leaf != nil {
+		spendType |= 2
+	}
+	if o.annex != nil {
+		spendType |= 1
+	}
+	msg.WriteByte(spendType)
+
+	txIn := tx.TxIn[inputIndex]
+	if anyoneCanPay {
+		prevOut := prevOuts.FetchPrevOutput(txIn.PreviousOutPoint)
+		if prevOut == nil {
+			return nil, fmt.Errorf("missing previous output for input %d", inputIndex)
+		}
+
+		if err := wire.WriteOutPoint(&msg, 0, 0, &txIn.PreviousOutPoint); err != nil {
+			return nil, err
+		}
+		writeUint64(&msg, uint64(prevOut.Value))
+		if err := wire.WriteVarBytes(&msg, 0, prevOut.PkScript); err != nil {
+			return nil, err
+		}
+		writeUint32(&msg, txIn.Sequence)
+	} else {
+		writeUint32(&msg, uint32(inputIndex))
+	}
+
+	if o.annex != nil {
+		var annexBuf bytes.Buffer
+		if err := wire.WriteVarBytes(&annexBuf, 0, o.annex); err != nil {
+			return nil, err
+		}
+		msg.Write(sha256Bytes(annexBuf.Bytes()))
+	}
+
+	// Data about this output.
+	if outputType == SigHashSingle {
+		if inputIndex >= len(tx.TxOut) {
+			return nil, fmt.Errorf("SIGHASH_SINGLE input %d has no matching output", inputIndex)
+		}
+
+		var outputBuf bytes.Buffer
+		if err := wire.WriteTxOut(&outputBuf, 0, 0, tx.TxOut[inputIndex]); err != nil {
+			return nil, err
+		}
+		msg.Write(sha256Bytes(outputBuf.Bytes()))
+	}
+
+	// BIP342 extension for script path spends.
+	if o.leaf != nil {
+		leafHash := o.leaf.TapHash()
+		msg.Write(leafHash[:])
+		msg.WriteByte(0x00) // key_version
+		writeUint32(&msg, o.codeSepPos)
+	}
+
+	return msg.Bytes(), nil
+}
+
+// isValidTaprootSigHash reports whether hashType is one of the sighash types
+// allowed for taproot signatures.
+func isValidTaprootSigHash(hashType txscript.SigHashType) bool {
+	switch hashType {
+	case SigHashDefault, SigHashAll, SigHashNone, SigHashSingle,
+		SigHashAll | SigHashAnyOneCanPay,
+		SigHashNone | SigHashAnyOneCanPay,
+		SigHashSingle | SigHashAnyOneCanPay:
+		return true
+	default:
+		return false
+	}
+}
+
+func sha256Bytes(b []byte) []byte {
+	hash := sha256.Sum256(b)
+	return hash[:]
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
@@ -0,0 +1,283 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// bip341Vectors mirrors the layout of the official BIP341 wallet test vectors.
+type bip341Vectors struct {
+	ScriptPubKey []struct {
+		Given struct {
+			InternalPubkey string          `json:"internalPubkey"`
+			ScriptTree     json.RawMessage `json:"scriptTree"`
+		} `json:"given"`
+		Intermediary struct {
+			LeafHashes    []string `json:"leafHashes"`
+			MerkleRoot    *string  `json:"merkleRoot"`
+			Tweak         string   `json:"tweak"`
+			TweakedPubkey string   `json:"tweakedPubkey"`
+		} `json:"intermediary"`
+		Expected struct {
+			ScriptPubKey            string   `json:"scriptPubKey"`
+			Bip350Address           string   `json:"bip350Address"`
+			ScriptPathControlBlocks []string `json:"scriptPathControlBlocks"`
+		} `json:"expected"`
+	} `json:"scriptPubKey"`
+	KeyPathSpending []struct {
+		Given struct {
+			RawUnsignedTx string `json:"rawUnsignedTx"`
+			UtxosSpent    []struct {
+				ScriptPubKey string `json:"scriptPubKey"`
+				AmountSats   int64  `json:"amountSats"`
+			} `json:"utxosSpent"`
+		} `json:"given"`
+		InputSpending []struct {
+			Given struct {
+				TxinIndex       int     `json:"txinIndex"`
+				InternalPrivkey string  `json:"internalPrivkey"`
+				MerkleRoot      *string `json:"merkleRoot"`
+				HashType        uint32  `json:"hashType"`
+			} `json:"given"`
+			Intermediary struct {
+				SigMsg  string `json:"sigMsg"`
+				SigHash string `json:"sigHash"`
+			} `json:"intermediary"`
+		} `json:"inputSpending"`
+	} `json:"keyPathSpending"`
+}
+
+// loadBIP341Vectors reads the BIP341 wallet test vectors from testdata.
+func loadBIP341Vectors(t *testing.T) *bip341Vectors {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/bip341_wallet_vectors.json")
+	if err != nil {
+		t.Fatalf("Failed to read test vectors: %v", err)
+	}
+
+	var vectors bip341Vectors
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatalf("Failed to parse test vectors: %v", err)
+	}
+
+	return &vectors
+}
+
+// mustDecodeHex decodes a hex string or fails the test.
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// vectorTx parses the unsigned transaction of the key path vectors and builds
+// a fetcher for the outputs it spends.
+func vectorTx(t *testing.T, vectors *bip341Vectors) (*wire.MsgTx, txscript.PrevOutputFetcher) {
+	t.Helper()
+
+	given := vectors.KeyPathSpending[0].Given
+
+	tx := wire.NewMsgTx(2)
+	if err := tx.Deserialize(bytes.NewReader(mustDecodeHex(t, given.RawUnsignedTx))); err != nil {
+		t.Fatalf("Failed to deserialize transaction: %v", err)
+	}
+
+	prevOuts := make([]*wire.TxOut, len(given.UtxosSpent))
+	for i, utxo := range given.UtxosSpent {
+		prevOuts[i] = wire.NewTxOut(utxo.AmountSats, mustDecodeHex(t, utxo.ScriptPubKey))
+	}
+
+	fetcher, err := NewPrevOutputFetcher(tx, prevOuts)
+	if err != nil {
+		t.Fatalf("Failed to build prevout fetcher: %v", err)
+	}
+
+	return tx, fetcher
+}
+
+// TestCalculateSighashBIP341Vectors checks the signature message and hash of
+// every key path input of the official BIP341 test vectors.
+func TestCalculateSighashBIP341Vectors(t *testing.T) {
+	vectors := loadBIP341Vectors(t)
+	tx, fetcher := vectorTx(t, vectors)
+
+	for _, input := range vectors.KeyPathSpending[0].InputSpending {
+		hashType := txscript.SigHashType(input.Given.HashType)
+
+		msg, err := sigMsg(tx, input.Given.TxinIndex, fetcher, hashType)
+		if err != nil {
+			t.Fatalf("Input %d: failed to build sigMsg: %v", input.Given.TxinIndex, err)
+		}
+		if got := hex.EncodeToString(msg); got != input.Intermediary.SigMsg {
+			t.Fatalf("Input %d: sigMsg mismatch\n got: %s\nwant: %s", input.Given.TxinIndex, got, input.Intermediary.SigMsg)
+		}
+
+		sigHash, err := CalculateSighash(tx, input.Given.TxinIndex, fetcher, hashType)
+		if err != nil {
+			t.Fatalf("Input %d: failed to calculate sighash: %v", input.Given.TxinIndex, err)
+		}
+		if got := hex.EncodeToString(sigHash); got != input.Intermediary.SigHash {
+			t.Fatalf("Input %d: sighash mismatch\n got: %s\nwant: %s", input.Given.TxinIndex, got, input.Intermediary.SigHash)
+		}
+	}
+}
+
+// TestCalculateSighashScriptPathAndAnnex cross-checks script path and annex
+// digests for every sighash type against btcd's tapscript implementation.
+func TestCalculateSighashScriptPathAndAnnex(t *testing.T) {
+	vectors := loadBIP341Vectors(t)
+	tx, fetcher := vectorTx(t, vectors)
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+
+	leaf := txscript.NewBaseTapLeaf([]byte{txscript.OP_TRUE})
+	annex := []byte{annexTag, 0x01, 0x02, 0x03}
+
+	hashTypes := []txscript.SigHashType{
+		SigHashDefault, SigHashAll, SigHashNone, SigHashSingle,
+		SigHashAll | SigHashAnyOneCanPay,
+		SigHashNone | SigHashAnyOneCanPay,
+		SigHashSingle | SigHashAnyOneCanPay,
+	}
+
+	for _, hashType := range hashTypes {
+		// Only the first two outputs exist, which SIGHASH_SINGLE requires
+		for idx := 0; idx < len(tx.TxOut); idx++ {
+			got, err := CalculateSighash(tx, idx, fetcher, hashType, WithTapLeaf(leaf), WithAnnex(annex))
+			if err != nil {
+				t.Fatalf("Type 0x%x input %d: %v", uint32(hashType), idx, err)
+			}
+
+			want, err := txscript.CalcTapscriptSignaturehash(
+				sigHashes, hashType, tx, idx, fetcher, leaf, txscript.WithAnnex(annex),
+			)
+			if err != nil {
+				t.Fatalf("Type 0x%x input %d: txscript failed: %v", uint32(hashType), idx, err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Fatalf("Type 0x%x input %d: script path sighash mismatch", uint32(hashType), idx)
+			}
+		}
+	}
+}
+
+// TestCalculateSighashRejectsInvalidInput covers the error paths of the
+// signature message construction.
+func TestCalculateSighashRejectsInvalidInput(t *testing.T) {
+	vectors := loadBIP341Vectors(t)
+	tx, fetcher := vectorTx(t, vectors)
+
+	if _, err := CalculateSighash(tx, 0, fetcher, 0x04); err == nil {
+		t.Fatalf("Expected error for invalid sighash type")
+	}
+	if _, err := CalculateSighash(tx, len(tx.TxIn), fetcher, SigHashDefault); err == nil {
+		t.Fatalf("Expected error for out of range input")
+	}
+	if _, err := CalculateSighash(tx, len(tx.TxOut), fetcher, SigHashSingle); err == nil {
+		t.Fatalf("Expected error for SIGHASH_SINGLE without matching output")
+	}
+	if _, err := CalculateSighash(tx, 0, fetcher, SigHashDefault, WithAnnex([]byte{0x00})); err == nil {
+		t.Fatalf("Expected error for annex without 0x50 prefix")
+	}
+}
+
+// TestCreateP2TRAddressBIP341Vectors checks key-only outputs against the
+// BIP341 vectors and odd-Y keys against btcd's taproot tweak.
+func TestCreateP2TRAddressBIP341Vectors(t *testing.T) {
+	vectors := loadBIP341Vectors(t)
+
+	for i, v := range vectors.ScriptPubKey {
+		if string(v.Given.ScriptTree) != "null" {
+			continue
+		}
+
+		internalKey, err := schnorr.ParsePubKey(mustDecodeHex(t, v.Given.InternalPubkey))
+		if err != nil {
+			t.Fatalf("Vector %d: invalid internal key: %v", i, err)
+		}
+
+		address, pkScript, err := CreateP2TRAddress(internalKey, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("Vector %d: %v", i, err)
+		}
+		if got := hex.EncodeToString(pkScript); got != v.Expected.ScriptPubKey {
+			t.Fatalf("Vector %d: scriptPubKey mismatch\n got: %s\nwant: %s", i, got, v.Expected.ScriptPubKey)
+		}
+		if address != v.Expected.Bip350Address {
+			t.Fatalf("Vector %d: address mismatch: got %s, want %s", i, address, v.Expected.Bip350Address)
+		}
+	}
+
+	for i := 0; i < 16; i++ {
+		priv, err := btcec.NewPrivateKey()
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+
+		_, pkScript, err := CreateP2TRAddress(priv.PubKey(), &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("Key %d: %v", i, err)
+		}
+
+		want, err := txscript.PayToTaprootScript(txscript.ComputeTaprootKeyNoScript(priv.PubKey()))
+		if err != nil {
+			t.Fatalf("Key %d: %v", i, err)
+		}
+		if !bytes.Equal(pkScript, want) {
+			t.Fatalf("Key %d: P2TR script does not match BIP86 tweak", i)
+		}
+	}
+}
+
+// TestCreateSpendingTransactionIsValid runs the signed spending transaction
+// through the script engine to make sure the key path signature is accepted.
+func TestCreateSpendingTransactionIsValid(t *testing.T) {
+	signer, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	next, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	params := &chaincfg.RegressionNetParams
+	_, prevScript, err := CreateP2TRAddress(signer.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create previous output script: %v", err)
+	}
+
+	prevTxID := "7de20cbff686da83a54981d2b9bab3586f4ca7e48f57f5b55963115f3b334e9c"
+	const prevValue = 50000
+
+	tx, _, err := CreateSpendingTransaction(prevTxID, 1, prevValue, prevScript, 500, signer, next.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create spending transaction: %v", err)
+	}
+
+	fetcher := txscript.NewCannedPrevOutputFetcher(prevScript, prevValue)
+	engine, err := txscript.NewEngine(
+		prevScript, tx, 0, txscript.StandardVerifyFlags, nil,
+		txscript.NewTxSigHashes(tx, fetcher), prevValue, fetcher,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create script engine: %v", err)
+	}
+	if err := engine.Execute(); err != nil {
+		t.Fatalf("Spending transaction rejected by script engine: %v", err)
+	}
+}
@@ -0,0 +1,489 @@
+package bitcoin
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// simBlockInterval is the time between two simulated blocks.
+const simBlockInterval = 10 * time.Minute
+
+// simGenesisTime is the timestamp of the simulated genesis block.
+var simGenesisTime = time.Unix(1231006505, 0)
+
+// simOutput is an output of the simulated chain.
+type simOutput struct {
+	output *wire.TxOut
+	height int32 // Zero while in the mempool
+}
+
+// simWatch is a WatchSpend call waiting for its spend.
+type simWatch struct {
+	spends chan *SpendEvent
+	done   chan struct{} // Closed once the spend is delivered
+}
+
+// SimChain is an in-memory, regtest-style chain. It validates transactions
+// like a full node would, including scripts, timelocks, double spends and
+// BIP125 replacements, and only mines when told to, so swaps can be tested
+// end to end offline.
+type SimChain struct {
+	mu        sync.Mutex
+	height    int32
+	utxos     map[wire.OutPoint]*simOutput
+	mempool   []*wire.MsgTx
+	inMempool map[wire.OutPoint]*simOutput // Outputs spent by the mempool
+	txs       map[chainhash.Hash]struct{}  // Every accepted transaction
+	paid      map[string]struct{}          // Every script an accepted transaction paid to
+	spends    map[wire.OutPoint]*SpendEvent
+	watchers  map[wire.OutPoint][]*simWatch
+	feeRate   FeeRate
+	funded    uint64
+}
+
+// NewSimChain creates a chain holding only its genesis block.
+func NewSimChain() *SimChain {
+	return &SimChain{
+		utxos:     make(map[wire.OutPoint]*simOutput),
+		inMempool: make(map[wire.OutPoint]*simOutput),
+		txs:       make(map[chainhash.Hash]struct{}),
+		paid:      make(map[string]struct{}),
+		spends:    make(map[wire.OutPoint]*SpendEvent),
+		watchers:  make(map[wire.OutPoint][]*simWatch),
+		feeRate:   FeeRatePerVByte(1),
+	}
+}
+
+// Fund mines a block with an output of value paying to pkScript, out of
+// thin air, and returns the transaction that created it.
+func (c *SimChain) Fund(pkScript []byte, value int64) *wire.MsgTx {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A unique coinbase-like input keeps the funding transactions distinct
+	c.funded++
+	var nonce [8]byte
+	binary.BigEndian.PutUint64(nonce[:], c.funded)
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), nonce[:], nil))
+	tx.AddTxOut(wire.NewTxOut(value, pkScript))
+
+	c.addTx(tx)
+	c.mine()
+
+	return tx
+}
+
+// Mine mines the given number of blocks, the first one confirming the
+// whole mempool, and returns the new tip height.
+func (c *SimChain) Mine(blocks int) int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := 0; i < blocks; i++ {
+		c.mine()
+	}
+
+	return c.height
+}
+
+// mine adds a block confirming the mempool.
+func (c *SimChain) mine() {
+	c.height++
+	for _, tx := range c.mempool {
+		txHash := tx.TxHash()
+		for i := range tx.TxOut {
+			if out, ok := c.utxos[wire.OutPoint{Hash: txHash, Index: uint32(i)}]; ok {
+				out.height = c.height
+			}
+		}
+		for _, txIn := range tx.TxIn {
+			if spend, ok := c.spends[txIn.PreviousOutPoint]; ok {
+				spend.Height = c.height
+			}
+		}
+	}
+	c.mempool = nil
+	c.inMempool = make(map[wire.OutPoint]*simOutput)
+}
+
+// SetFeeRate sets the rate returned by EstimateFee.
+func (c *SimChain) SetFeeRate(rate FeeRate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.feeRate = rate
+}
+
+// Mempool returns the transactions waiting to be mined.
+func (c *SimChain) Mempool() []*wire.MsgTx {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]*wire.MsgTx(nil), c.mempool...)
+}
+
+// GetUTXO returns the unspent output at outpoint.
+func (c *SimChain) GetUTXO(_ context.Context, outpoint wire.OutPoint) (*UTXO, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out, ok := c.utxos[outpoint]
+	if !ok {
+		return nil, ErrUTXONotFound
+	}
+
+	return &UTXO{OutPoint: outpoint, Output: out.output, Height: out.height}, nil
+}
+
+// Broadcast validates tx against the chain and the mempool and adds it to
+// the mempool.
+func (c *SimChain) Broadcast(_ context.Context, tx *wire.MsgTx) (*chainhash.Hash, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	txHash := tx.TxHash()
+	if _, ok := c.txs[txHash]; ok {
+		return nil, fmt.Errorf("transaction %s already known", txHash)
+	}
+	replaced, err := c.validate(tx)
+	if err != nil {
+		return nil, fmt.Errorf("transaction %s rejected: %v", txHash, err)
+	}
+
+	for _, old := range replaced {
+		c.evict(old)
+	}
+	c.addTx(tx)
+	return &txHash, nil
+}
+
+// validate checks tx the way a node checks a transaction for its mempool,
+// and returns the mempool transactions it replaces.
+func (c *SimChain) validate(tx *wire.MsgTx) ([]*wire.MsgTx, error) {
+	if err := blockchain.CheckTransactionSanity(btcutil.NewTx(tx)); err != nil {
+		return nil, err
+	}
+	if blockchain.IsCoinBaseTx(tx) {
+		return nil, fmt.Errorf("coinbase transactions cannot be broadcast")
+	}
+
+	nextHeight := c.height + 1
+	if !blockchain.IsFinalizedTransaction(btcutil.NewTx(tx), nextHeight, c.blockTime(c.height)) {
+		return nil, fmt.Errorf("non-final transaction, lock time %d", tx.LockTime)
+	}
+
+	prevOuts := make(map[wire.OutPoint]*wire.TxOut, len(tx.TxIn))
+	var conflicts []*wire.MsgTx
+	var inputValue int64
+	for _, txIn := range tx.TxIn {
+		out, ok := c.utxos[txIn.PreviousOutPoint]
+		if !ok {
+			// Outputs spent in the mempool may be spent again by a replacement
+			spend, spent := c.spends[txIn.PreviousOutPoint]
+			out, ok = c.inMempool[txIn.PreviousOutPoint]
+			if !ok {
+				if spent {
+					return nil, fmt.Errorf("input %s already spent", txIn.PreviousOutPoint)
+				}
+				return nil, fmt.Errorf("input %s not found", txIn.PreviousOutPoint)
+			}
+			conflicts = append(conflicts, spend.SpendingTx)
+		}
+		if err := c.checkSequenceLock(tx, txIn, out); err != nil {
+			return nil, err
+		}
+
+		prevOuts[txIn.PreviousOutPoint] = out.output
+		inputValue += out.output.Value
+	}
+
+	var outputValue int64
+	for _, txOut := range tx.TxOut {
+		outputValue += txOut.Value
+	}
+	if outputValue > inputValue {
+		return nil, fmt.Errorf("outputs (%d) exceed inputs (%d)", outputValue, inputValue)
+	}
+
+	fetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	for i, txIn := range tx.TxIn {
+		prevOut := prevOuts[txIn.PreviousOutPoint]
+		engine, err := txscript.NewEngine(
+			prevOut.PkScript, tx, i, txscript.StandardVerifyFlags, nil,
+			sigHashes, prevOut.Value, fetcher,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %v", i, err)
+		}
+		if err := engine.Execute(); err != nil {
+			return nil, fmt.Errorf("input %d: script verification failed: %v", i, err)
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+	return c.checkReplacement(tx, inputValue-outputValue, conflicts)
+}
+
+// checkReplacement applies the BIP125 rules to tx, paying fee, replacing
+// the conflicting mempool transactions, and returns them with their
+// descendants, which are evicted along.
+func (c *SimChain) checkReplacement(tx *wire.MsgTx, fee int64, conflicts []*wire.MsgTx) ([]*wire.MsgTx, error) {
+	vsize := TxVSize(tx)
+	replaced := make(map[chainhash.Hash]*wire.MsgTx)
+	for _, conflict := range conflicts {
+		if !SignalsRBF(conflict) {
+			return nil, fmt.Errorf("conflicts with %s, which does not signal RBF", conflict.TxHash())
+		}
+		oldFee := c.mempoolFee(conflict)
+		if fee*TxVSize(conflict) <= oldFee*vsize {
+			return nil, fmt.Errorf("fee rate does not exceed that of %s", conflict.TxHash())
+		}
+		c.descendants(conflict, replaced)
+	}
+
+	var oldFee int64
+	list := make([]*wire.MsgTx, 0, len(replaced))
+	for _, old := range replaced {
+		oldFee += c.mempoolFee(old)
+		list = append(list, old)
+	}
+	if need := oldFee + int64(IncrementalRelayFee.FeeForVSize(vsize)); fee < need {
+		return nil, fmt.Errorf("replacement fee %d is below %d", fee, need)
+	}
+
+	return list, nil
+}
+
+// mempoolFee returns the fee paid by a mempool transaction.
+func (c *SimChain) mempoolFee(tx *wire.MsgTx) int64 {
+	var fee int64
+	for _, txIn := range tx.TxIn {
+		fee += c.inMempool[txIn.PreviousOutPoint].output.Value
+	}
+	for _, txOut := range tx.TxOut {
+		fee -= txOut.Value
+	}
+
+	return fee
+}
+
+// descendants adds tx and the mempool transactions spending its outputs,
+// recursively, to set.
+func (c *SimChain) descendants(tx *wire.MsgTx, set map[chainhash.Hash]*wire.MsgTx) {
+	txHash := tx.TxHash()
+	if _, ok := set[txHash]; ok {
+		return
+	}
+	set[txHash] = tx
+
+	for i := range tx.TxOut {
+		if spend, ok := c.spends[wire.OutPoint{Hash: txHash, Index: uint32(i)}]; ok {
+			c.descendants(spend.SpendingTx, set)
+		}
+	}
+}
+
+// evict removes a replaced transaction from the mempool, giving back the
+// outputs it spent.
+func (c *SimChain) evict(tx *wire.MsgTx) {
+	txHash := tx.TxHash()
+	for i, pending := range c.mempool {
+		if pending.TxHash() == txHash {
+			c.mempool = append(c.mempool[:i], c.mempool[i+1:]...)
+			break
+		}
+	}
+	delete(c.txs, txHash)
+
+	for i := range tx.TxOut {
+		outpoint := wire.OutPoint{Hash: txHash, Index: uint32(i)}
+		delete(c.utxos, outpoint)
+		delete(c.inMempool, outpoint)
+	}
+	for _, txIn := range tx.TxIn {
+		outpoint := txIn.PreviousOutPoint
+		if spend, ok := c.spends[outpoint]; ok && spend.SpendingTx == tx {
+			delete(c.spends, outpoint)
+		}
+		if out, ok := c.inMempool[outpoint]; ok {
+			c.utxos[outpoint] = out
+			delete(c.inMempool, outpoint)
+		}
+	}
+}
+
+// checkSequenceLock enforces the BIP68 relative lock time of an input.
+func (c *SimChain) checkSequenceLock(tx *wire.MsgTx, txIn *wire.TxIn, out *simOutput) error {
+	if tx.Version < 2 || txIn.Sequence&wire.SequenceLockTimeDisabled != 0 {
+		return nil
+	}
+
+	value := int64(txIn.Sequence & wire.SequenceLockTimeMask)
+	if value == 0 {
+		return nil
+	}
+	if out.height == 0 {
+		return fmt.Errorf("input %s has a relative lock time but is unconfirmed", txIn.PreviousOutPoint)
+	}
+
+	if txIn.Sequence&wire.SequenceLockTimeIsSeconds != 0 {
+		// Measured from the block before the one confirming the output
+		elapsed := c.blockTime(c.height).Sub(c.blockTime(out.height - 1))
+		if elapsed < time.Duration(value<<wire.SequenceLockTimeGranularity)*time.Second {
+			return fmt.Errorf("input %s is locked for %ds", txIn.PreviousOutPoint, value<<wire.SequenceLockTimeGranularity)
+		}
+		return nil
+	}
+
+	if int64(c.height+1-out.height) < value {
+		return fmt.Errorf("input %s is locked for %d blocks", txIn.PreviousOutPoint, value)
+	}
+
+	return nil
+}
+
+// blockTime returns the timestamp of the block at height. Simulated blocks
+// are exactly simBlockInterval apart, so it is also their median time past.
+func (c *SimChain) blockTime(height int32) time.Time {
+	return simGenesisTime.Add(time.Duration(height) * simBlockInterval)
+}
+
+// addTx adds an accepted transaction to the mempool and notifies the
+// watchers of the outputs it spends.
+func (c *SimChain) addTx(tx *wire.MsgTx) {
+	txHash := tx.TxHash()
+	c.txs[txHash] = struct{}{}
+	c.mempool = append(c.mempool, tx)
+
+	for i, txIn := range tx.TxIn {
+		outpoint := txIn.PreviousOutPoint
+		out, ok := c.utxos[outpoint]
+		if !ok {
+			continue
+		}
+		delete(c.utxos, outpoint)
+		c.inMempool[outpoint] = out
+
+		spend := &SpendEvent{OutPoint: outpoint, SpendingTx: tx, InputIndex: uint32(i)}
+		c.spends[outpoint] = spend
+		for _, w := range c.watchers[outpoint] {
+			copied := *spend
+			w.spends <- &copied
+			close(w.spends)
+			close(w.done)
+		}
+		delete(c.watchers, outpoint)
+	}
+
+	for i, txOut := range tx.TxOut {
+		c.utxos[wire.OutPoint{Hash: txHash, Index: uint32(i)}] = &simOutput{output: txOut}
+		c.paid[string(txOut.PkScript)] = struct{}{}
+	}
+}
+
+// WatchSpend reports the transaction spending outpoint. The height hint is
+// not needed, the simulated chain remembers every spend.
+func (c *SimChain) WatchSpend(ctx context.Context, outpoint wire.OutPoint, _ int32) (<-chan *SpendEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if spend, ok := c.spends[outpoint]; ok {
+		copied := *spend
+		return deliverSpend(&copied), nil
+	}
+
+	watch := &simWatch{spends: make(chan *SpendEvent, 1), done: make(chan struct{})}
+	c.watchers[outpoint] = append(c.watchers[outpoint], watch)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-watch.done:
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		// Remove the watcher unless the spend already closed it
+		watchers := c.watchers[outpoint]
+		for i, w := range watchers {
+			if w == watch {
+				c.watchers[outpoint] = append(watchers[:i], watchers[i+1:]...)
+				close(w.spends)
+				break
+			}
+		}
+		if len(c.watchers[outpoint]) == 0 {
+			delete(c.watchers, outpoint)
+		}
+	}()
+
+	return watch.spends, nil
+}
+
+// ScanScripts returns the unspent outputs paying to any of pkScripts,
+// mempool included.
+func (c *SimChain) ScanScripts(_ context.Context, pkScripts [][]byte) ([]*UTXO, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wanted := make(map[string]struct{}, len(pkScripts))
+	for _, pkScript := range pkScripts {
+		wanted[string(pkScript)] = struct{}{}
+	}
+
+	var utxos []*UTXO
+	for outpoint, out := range c.utxos {
+		if _, ok := wanted[string(out.output.PkScript)]; ok {
+			utxos = append(utxos, &UTXO{OutPoint: outpoint, Output: out.output, Height: out.height})
+		}
+	}
+
+	return utxos, nil
+}
+
+// UsedScripts returns the ones of pkScripts that an accepted transaction
+// paid to, spent or not, mempool included.
+func (c *SimChain) UsedScripts(_ context.Context, pkScripts [][]byte) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var used [][]byte
+	for _, pkScript := range pkScripts {
+		if _, ok := c.paid[string(pkScript)]; ok {
+			used = append(used, pkScript)
+		}
+	}
+
+	return used, nil
+}
+
+// GetTipHeight returns the height of the last mined block.
+func (c *SimChain) GetTipHeight(context.Context) (int32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.height, nil
+}
+
+// EstimateFee returns the rate set with SetFeeRate, 1 sat/vB by default.
+func (c *SimChain) EstimateFee(context.Context, uint32) (FeeRate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.feeRate, nil
+}
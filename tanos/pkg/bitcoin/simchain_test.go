@@ -0,0 +1,253 @@
+package bitcoin
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestSimChainValidatesSpends checks that the simulated chain accepts a
+// correctly signed spend and rejects a bad signature and a double spend.
+func TestSimChainValidatesSpends(t *testing.T) {
+	ctx := context.Background()
+	params := &chaincfg.RegressionNetParams
+	chain := NewSimChain()
+
+	key, _ := btcec.NewPrivateKey()
+	_, pkScript, err := CreateP2TRAddress(key.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create address: %v", err)
+	}
+	fundTx := chain.Fund(pkScript, 100000)
+	fundHash := fundTx.TxHash()
+	outpoint := wire.OutPoint{Hash: fundHash, Index: 0}
+
+	utxo, err := chain.GetUTXO(ctx, outpoint)
+	if err != nil || utxo.Height != 1 || utxo.Output.Value != 100000 {
+		t.Fatalf("Funded output not found at height 1: %v", err)
+	}
+
+	other, _ := btcec.NewPrivateKey()
+	spend := func(signer *btcec.PrivateKey, fee int64) *wire.MsgTx {
+		tx, _, err := CreateSpendingTransaction(fundHash.String(), 0, 100000, pkScript, fee, signer, other.PubKey(), params)
+		if err != nil {
+			t.Fatalf("Failed to create spend: %v", err)
+		}
+		return tx
+	}
+
+	if _, err := chain.Broadcast(ctx, spend(other, 1000)); err == nil {
+		t.Fatalf("Accepted a spend signed with the wrong key")
+	}
+	if _, err := chain.Broadcast(ctx, spend(key, 1000)); err != nil {
+		t.Fatalf("Valid spend rejected: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, spend(key, 2000)); err == nil {
+		t.Fatalf("Accepted a double spend")
+	}
+	if _, err := chain.GetUTXO(ctx, outpoint); err != ErrUTXONotFound {
+		t.Fatalf("Spent output still returned: %v", err)
+	}
+
+	if len(chain.Mempool()) != 1 || chain.Mine(1) != 2 || len(chain.Mempool()) != 0 {
+		t.Fatalf("Mining did not confirm the mempool")
+	}
+}
+
+// TestSimChainEnforcesTimelocks checks that CSV and CLTV refunds are only
+// accepted once their timelock has expired.
+func TestSimChainEnforcesTimelocks(t *testing.T) {
+	ctx := context.Background()
+	params := &chaincfg.RegressionNetParams
+
+	for _, lock := range []Timelock{RelativeBlocks(10), AbsoluteHeight(20)} {
+		chain := NewSimChain()
+		internal, _ := btcec.NewPrivateKey()
+		refund, _ := btcec.NewPrivateKey()
+
+		lockOutput, err := CreateRefundableLockOutput(internal.PubKey(), refund.PubKey(), lock, params)
+		if err != nil {
+			t.Fatalf("Failed to create lock output: %v", err)
+		}
+		lockTx := chain.Fund(lockOutput.PkScript, 100000)
+
+		refundTx, err := CreateRefundTransaction(lockTx, 0, lockOutput, lock, refund, lockOutput.PkScript, 1000)
+		if err != nil {
+			t.Fatalf("Failed to create refund: %v", err)
+		}
+
+		// The lock output confirmed at height 1: the CSV refund can go in
+		// block 11 and the CLTV refund in block 21, mined on top of tips 10
+		// and 20
+		validTip := 10
+		if lock.Type == AbsoluteTimelock {
+			validTip = 20
+		}
+		chain.Mine(validTip - 2)
+		if _, err := chain.Broadcast(ctx, refundTx); err == nil {
+			t.Fatalf("Refund (type %d) accepted before its timelock", lock.Type)
+		}
+
+		chain.Mine(1)
+		if _, err := chain.Broadcast(ctx, refundTx); err != nil {
+			t.Fatalf("Refund (type %d) rejected after its timelock: %v", lock.Type, err)
+		}
+	}
+}
+
+// TestSimChainWatchSpend checks that watchers see spends made before and
+// after they started watching, and that cancelling closes the channel.
+func TestSimChainWatchSpend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	params := &chaincfg.RegressionNetParams
+	chain := NewSimChain()
+
+	key, _ := btcec.NewPrivateKey()
+	_, pkScript, _ := CreateP2TRAddress(key.PubKey(), params)
+	fundTx := chain.Fund(pkScript, 100000)
+	fundHash := fundTx.TxHash()
+	outpoint := wire.OutPoint{Hash: fundHash, Index: 0}
+
+	spends, err := chain.WatchSpend(ctx, outpoint, 1)
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	unrelated, cancelUnrelated := context.WithCancel(ctx)
+	idle, _ := chain.WatchSpend(unrelated, wire.OutPoint{Hash: fundHash, Index: 1}, 1)
+
+	spendTx, _, err := CreateSpendingTransaction(fundHash.String(), 0, 100000, pkScript, 1000, key, key.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create spend: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, spendTx); err != nil {
+		t.Fatalf("Spend rejected: %v", err)
+	}
+
+	spend := <-spends
+	if spend == nil || spend.SpendingTx.TxHash() != spendTx.TxHash() || spend.Height != 0 {
+		t.Fatalf("Watcher did not report the mempool spend")
+	}
+	if _, ok := <-spends; ok {
+		t.Fatalf("Watch channel not closed after the spend")
+	}
+
+	chain.Mine(1)
+	late, _ := chain.WatchSpend(ctx, outpoint, 1)
+	if spend := <-late; spend == nil || spend.Height != 2 {
+		t.Fatalf("Late watcher did not see the confirmed spend")
+	}
+
+	cancelUnrelated()
+	if _, ok := <-idle; ok {
+		t.Fatalf("Cancelled watcher received a spend")
+	}
+
+	// A watch ends with its spend, even if its context never does
+	goroutines := runtime.NumGoroutine()
+	changeHash := spendTx.TxHash()
+	forever, _ := chain.WatchSpend(context.Background(), wire.OutPoint{Hash: changeHash, Index: 0}, 1)
+	changeTx, _, err := CreateSpendingTransaction(changeHash.String(), 0, spendTx.TxOut[0].Value, spendTx.TxOut[0].PkScript, 1000, key, key.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create spend: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, changeTx); err != nil {
+		t.Fatalf("Spend rejected: %v", err)
+	}
+	<-forever
+	for runtime.NumGoroutine() > goroutines {
+		if ctx.Err() != nil {
+			t.Fatalf("Watch goroutine outlived the delivered spend")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// rbfSpend spends prevOut, a key path output of key, to destScript, paying
+// fee and signaling RBF.
+func rbfSpend(t *testing.T, outpoint wire.OutPoint, prevOut *wire.TxOut, key *btcec.PrivateKey, destScript []byte, fee int64) *wire.MsgTx {
+	t.Helper()
+
+	tx := wire.NewMsgTx(2)
+	txIn := wire.NewTxIn(&outpoint, nil, nil)
+	txIn.Sequence = SequenceRBF
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(prevOut.Value-fee, destScript))
+
+	fetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+	witness, err := txscript.TaprootWitnessSignature(tx, txscript.NewTxSigHashes(tx, fetcher), 0,
+		prevOut.Value, prevOut.PkScript, txscript.SigHashDefault, key)
+	if err != nil {
+		t.Fatalf("Failed to sign spend: %v", err)
+	}
+	tx.TxIn[0].Witness = witness
+
+	return tx
+}
+
+// TestSimChainReplacement checks the BIP125 rules: a replacement must
+// conflict with transactions signaling RBF and pay for them, their
+// descendants and its own relay, which are then evicted.
+func TestSimChainReplacement(t *testing.T) {
+	ctx := context.Background()
+	params := &chaincfg.RegressionNetParams
+	chain := NewSimChain()
+
+	key, _ := btcec.NewPrivateKey()
+	_, pkScript, err := CreateP2TRAddress(key.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create address: %v", err)
+	}
+	fundTx := chain.Fund(pkScript, 100000)
+	outpoint := wire.OutPoint{Hash: fundTx.TxHash(), Index: 0}
+
+	first := rbfSpend(t, outpoint, fundTx.TxOut[0], key, pkScript, 500)
+	if _, err := chain.Broadcast(ctx, first); err != nil {
+		t.Fatalf("Spend rejected: %v", err)
+	}
+	child := rbfSpend(t, wire.OutPoint{Hash: first.TxHash()}, first.TxOut[0], key, pkScript, 500)
+	if _, err := chain.Broadcast(ctx, child); err != nil {
+		t.Fatalf("Child rejected: %v", err)
+	}
+
+	// The replacement must pay for the child it evicts too
+	if _, err := chain.Broadcast(ctx, rbfSpend(t, outpoint, fundTx.TxOut[0], key, pkScript, 900)); err == nil {
+		t.Fatalf("Accepted a replacement not paying for the evicted child")
+	}
+	fee := ReplacementFee(1000, TxVSize(first), FeeRatePerVByte(1))
+	replacement := rbfSpend(t, outpoint, fundTx.TxOut[0], key, pkScript, fee)
+	if _, err := chain.Broadcast(ctx, replacement); err != nil {
+		t.Fatalf("Replacement rejected: %v", err)
+	}
+	mempool := chain.Mempool()
+	if len(mempool) != 1 || mempool[0].TxHash() != replacement.TxHash() {
+		t.Fatalf("Replaced transactions were not evicted")
+	}
+	if _, err := chain.GetUTXO(ctx, wire.OutPoint{Hash: first.TxHash()}); err != ErrUTXONotFound {
+		t.Fatalf("Output of a replaced transaction still returned: %v", err)
+	}
+
+	// Transactions not signaling RBF cannot be replaced
+	chain.Mine(1)
+	fundTx = chain.Fund(pkScript, 100000)
+	final, _, err := CreateSpendingTransaction(fundTx.TxHash().String(), 0, 100000, pkScript, 500, key, key.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create spend: %v", err)
+	}
+	if SignalsRBF(final) {
+		t.Fatalf("Spending transaction signals RBF")
+	}
+	if _, err := chain.Broadcast(ctx, final); err != nil {
+		t.Fatalf("Spend rejected: %v", err)
+	}
+	outpoint = wire.OutPoint{Hash: fundTx.TxHash(), Index: 0}
+	if _, err := chain.Broadcast(ctx, rbfSpend(t, outpoint, fundTx.TxOut[0], key, pkScript, 5000)); err == nil {
+		t.Fatalf("Replaced a transaction not signaling RBF")
+	}
+}
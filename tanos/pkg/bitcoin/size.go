@@ -0,0 +1,103 @@
+package bitcoin
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Sizes of the parts of a segwit transaction, for estimating its weight
+// before it is signed.
+const (
+	// txOverheadWeight covers the version, the lock time and the segwit
+	// marker and flag.
+	txOverheadWeight = blockchain.WitnessScaleFactor*(4+4) + 2
+
+	// inputBaseWeight covers the outpoint, the empty signature script and
+	// the sequence of a segwit input.
+	inputBaseWeight = blockchain.WitnessScaleFactor * (32 + 4 + 1 + 4)
+
+	// TaprootKeyPathWitnessSize is the witness of a key path spend with a
+	// SIGHASH_DEFAULT signature: the item count and the signature.
+	TaprootKeyPathWitnessSize = 1 + 1 + 64
+
+	// KeyPathInputWeight is the weight of an input spending a P2TR output
+	// by its key path.
+	KeyPathInputWeight = inputBaseWeight + TaprootKeyPathWitnessSize
+
+	// P2WPKHWitnessSize is the witness of a P2WPKH spend, for the largest
+	// DER signature: the item count, the signature and the public key.
+	P2WPKHWitnessSize = 1 + 1 + 72 + 1 + 33
+)
+
+// InputWeight returns the weight of an input spending pkScript through its
+// key: the key path of a P2TR output or a P2WPKH output. Other scripts need
+// their witness to be known.
+func InputWeight(pkScript []byte) (int64, error) {
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.WitnessV1TaprootTy:
+		return KeyPathInputWeight, nil
+	case txscript.WitnessV0PubKeyHashTy:
+		return inputBaseWeight + P2WPKHWitnessSize, nil
+	default:
+		return 0, fmt.Errorf("cannot estimate the size of an input spending %x", pkScript)
+	}
+}
+
+// ScriptPathInputWeight returns the weight of an input spending the leaf of
+// output at leafIndex with sigs SIGHASH_DEFAULT signatures, the only stack
+// items the leaf scripts of the swap take, followed by the script and its
+// control block.
+func ScriptPathInputWeight(output *TaprootOutput, leafIndex int, sigs int) (int64, error) {
+	if leafIndex < 0 || leafIndex >= len(output.Leaves) {
+		return 0, fmt.Errorf("output has no leaf %d", leafIndex)
+	}
+	script := output.Leaves[leafIndex].Script
+	controlBlockSize := txscript.ControlBlockBaseSize + len(output.proofs[leafIndex])
+
+	witness := wire.VarIntSerializeSize(uint64(sigs+2)) + sigs*(1+64)
+	witness += wire.VarIntSerializeSize(uint64(len(script))) + len(script)
+	witness += wire.VarIntSerializeSize(uint64(controlBlockSize)) + controlBlockSize
+
+	return inputBaseWeight + int64(witness), nil
+}
+
+// OutputWeight returns the weight of an output paying to pkScript.
+func OutputWeight(pkScript []byte) int64 {
+	return blockchain.WitnessScaleFactor * int64(8+wire.VarIntSerializeSize(uint64(len(pkScript)))+len(pkScript))
+}
+
+// TxWeight returns the weight of a segwit transaction whose inputs have the
+// given weights and which pays to outputs.
+func TxWeight(inputWeights []int64, outputs []*wire.TxOut) int64 {
+	weight := int64(txOverheadWeight)
+	weight += blockchain.WitnessScaleFactor * int64(wire.VarIntSerializeSize(uint64(len(inputWeights))))
+	weight += blockchain.WitnessScaleFactor * int64(wire.VarIntSerializeSize(uint64(len(outputs))))
+	for _, w := range inputWeights {
+		weight += w
+	}
+	for _, out := range outputs {
+		weight += OutputWeight(out.PkScript)
+	}
+
+	return weight
+}
+
+// VSize converts a weight to virtual bytes, rounded up.
+func VSize(weight int64) int64 {
+	return (weight + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor
+}
+
+// TxVSize returns the virtual size of a signed transaction.
+func TxVSize(tx *wire.MsgTx) int64 {
+	return mempool.GetTxVirtualSize(btcutil.NewTx(tx))
+}
+
+// FeeForWeight returns the fee of the given weight at the rate, rounded up.
+func (r FeeRate) FeeForWeight(weight int64) int64 {
+	return (int64(r)*weight + 4*1000 - 1) / (4 * 1000)
+}
@@ -4,8 +4,6 @@ package bitcoin
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/binary"
 	"fmt"
 
 	secp "github.com/btcsuite/btcd/btcec/v2"
@@ -38,6 +36,13 @@ func CreateP2TRAddress(pubKey *secp.PublicKey, params *chaincfg.Params) (string,
 	// Extract the x-coordinate as an x-only pubkey (32 bytes)
 	xOnly := crypto.PadTo32(pubKey.X().Bytes())
 
+	// BIP341 internal keys are x-only, so lift the x-coordinate to the point
+	// with an even Y before tweaking
+	internalKey, err := schnorr.ParsePubKey(xOnly)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid internal key: %v", err)
+	}
+
 	// Calculate the Taproot tweak according to BIP341
 	tweakHash := chainhash.TaggedHash(chainhash.TagTapTweak, xOnly)
 
@@ -52,7 +57,7 @@ func CreateP2TRAddress(pubKey *secp.PublicKey, params *chaincfg.Params) (string,
 	tweakPubKey := tweakPrivKey.PubKey()
 
 	// Calculate P + H(P||c)*G
-	tweakedPubKey, err := adaptor.AddPubKeys(pubKey, tweakPubKey)
+	tweakedPubKey, err := adaptor.AddPubKeys(internalKey, tweakPubKey)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to add public keys: %v", err)
 	}
@@ -85,20 +90,24 @@ func CreateP2TRAddress(pubKey *secp.PublicKey, params *chaincfg.Params) (string,
 
 // CreateLockingTransaction creates a Bitcoin transaction that locks coins to a P2TR address.
 // This transaction represents the funding transaction in the atomic swap.
+// It also returns the BIP341 key path signature hash of its single input,
+// which spends prevOutputValue satoshis locked by prevOutputScript.
 func CreateLockingTransaction(
 	buyerPubKey *secp.PublicKey,
 	amount int64,
 	prevTxID string,
 	prevOutputIndex uint32,
+	prevOutputValue int64,
+	prevOutputScript []byte,
 	params *chaincfg.Params,
-) (*wire.MsgTx, []byte, error) {
+) (*wire.MsgTx, []byte, []byte, error) {
 	// Create a new transaction
 	tx := wire.NewMsgTx(2) // Version 2 for taproot support
 
 	// Parse previous transaction ID
 	prevHash, err := chainhash.NewHashFromStr(prevTxID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("invalid previous transaction ID: %v", err)
+		return nil, nil, nil, fmt.Errorf("invalid previous transaction ID: %v", err)
 	}
 
 	// Add the input using the provided previous outpoint
@@ -109,14 +118,21 @@ func CreateLockingTransaction(
 	// Create a P2TR address and script for the output
 	_, pkScript, err := CreateP2TRAddress(buyerPubKey, params)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// Add the output
 	txOut := wire.NewTxOut(amount, pkScript)
 	tx.AddTxOut(txOut)
 
-	return tx, pkScript, nil
+	// Calculate the signature hash of the funding input
+	prevOutFetcher := txscript.NewCannedPrevOutputFetcher(prevOutputScript, prevOutputValue)
+	sigHash, err := CalculateSighash(tx, 0, prevOutFetcher, SigHashDefault)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to calculate signature hash: %v", err)
+	}
+
+	return tx, pkScript, sigHash, nil
 }
 
 // SerializeTx serializes a Bitcoin transaction to hex.
@@ -128,26 +144,6 @@ func SerializeTx(tx *wire.MsgTx) (string, error) {
 	return crypto.HexEncode(buf.Bytes()), nil
 }
 
-// CalculateSighash calculates the signature hash for a taproot input.
-// This is a simplified version for demonstration purposes.
-func CalculateSighash(tx *wire.MsgTx, inputIndex int, scriptPubKey []byte) ([]byte, error) {
-	// This is a simplified sighash calculation for demonstration purposes
-	// In a real implementation, you would use the proper taproot sighash algorithm
-
-	// For now, we'll use a simple hash of the transaction
-	var buf bytes.Buffer
-	if err := tx.Serialize(&buf); err != nil {
-		return nil, err
-	}
-
-	// Add the output script being spent for context
-	buf.Write(scriptPubKey)
-
-	// Hash the data
-	hash := sha256.Sum256(buf.Bytes())
-	return hash[:], nil
-}
-
 // CreateSpendingTransaction creates a Bitcoin transaction that spends a previous UTXO
 // and locks the funds in a new Taproot output that can be spent with an adaptor signature.
 // This enables passing funds from one atomic swap to another by spending previous outputs.
@@ -191,39 +187,19 @@ func CreateSpendingTransaction(
 	txOut := wire.NewTxOut(outputAmount, pkScript)
 	tx.AddTxOut(txOut)
 
-	// Since the ComputeTaprootSignatureHash is not directly available,
-	// we'll use a simplified approach for demonstration purposes.
-	// In a production environment, you'd use the proper BIP341 sighash calculation
-
-	// Simplified sighash calculation for demonstration
-	var sigHash []byte
-	{
-		// Create a buffer to serialize the transaction
-		var buf bytes.Buffer
-		if err := tx.Serialize(&buf); err != nil {
-			return nil, nil, fmt.Errorf("failed to serialize tx: %v", err)
-		}
-
-		// Add the output script being spent for context
-		buf.Write(prevOutputScript)
-
-		// Add the output value being spent for context
-		valueBytes := make([]byte, 8)
-		binary.LittleEndian.PutUint64(valueBytes, uint64(prevOutputValue))
-		buf.Write(valueBytes)
-
-		// Add the input index for context
-		indexBytes := make([]byte, 4)
-		binary.LittleEndian.PutUint32(indexBytes, 0) // index 0
-		buf.Write(indexBytes)
-
-		// Hash the data
-		hash := sha256.Sum256(buf.Bytes())
-		sigHash = hash[:]
+	// Calculate the BIP341 key path signature hash of the input
+	prevOutFetcher := txscript.NewCannedPrevOutputFetcher(prevOutputScript, prevOutputValue)
+	sigHash, err := CalculateSighash(tx, 0, prevOutFetcher, SigHashDefault)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to calculate signature hash: %v", err)
 	}
 
+	// The previous output commits to the tweaked key, so sign with the
+	// matching tweaked private key
+	tweakedPrivKey := txscript.TweakTaprootPrivKey(*signerPrivKey, nil)
+
 	// Sign the hash with the private key using Schnorr signature
-	sig, err := schnorr.Sign(signerPrivKey, sigHash)
+	sig, err := schnorr.Sign(tweakedPrivKey, sigHash)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create schnorr signature: %v", err)
 	}
@@ -238,9 +214,9 @@ func CreateSpendingTransaction(
 // to be spent only with a valid Nostr signature. It uses the commitment
 // point derived from the Nostr event's signature nonce.
 //
-// The script is constructed with the following spending path:
-// 1. Key path: the Nostr public key, tweaked with the commitment
-// 2. Script path (optional): can include additional spending conditions
+// The output only has a key path: the Nostr public key, tweaked with the
+// commitment. Use CreateNostrSignatureLockOutput to add a timelocked refund
+// script path.
 //
 // When used in conjunction with adaptor signatures, this enables atomic swaps
 // between Bitcoin and Nostr events, as the act of spending the output reveals
@@ -0,0 +1,384 @@
+package bitcoin
+
+import (
+	"bytes"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/adaptor"
+)
+
+// TimelockType selects the opcode used to enforce a refund timelock.
+type TimelockType int
+
+const (
+	// RelativeTimelock enforces the lock with OP_CHECKSEQUENCEVERIFY, counting
+	// from the confirmation of the locking transaction.
+	RelativeTimelock TimelockType = iota
+
+	// AbsoluteTimelock enforces the lock with OP_CHECKLOCKTIMEVERIFY against
+	// a block height or unix timestamp.
+	AbsoluteTimelock
+)
+
+// Timelock describes when the refund branch of a swap output becomes spendable.
+// For a RelativeTimelock, Value is a BIP68 encoded sequence number; for an
+// AbsoluteTimelock it is a BIP65 lock time.
+type Timelock struct {
+	Type  TimelockType
+	Value uint32
+}
+
+// RelativeBlocks returns a CSV timelock that expires the given number of
+// blocks after the locking transaction confirms.
+func RelativeBlocks(blocks uint16) Timelock {
+	return Timelock{Type: RelativeTimelock, Value: uint32(blocks)}
+}
+
+// AbsoluteHeight returns a CLTV timelock that expires at the given block height.
+func AbsoluteHeight(height uint32) Timelock {
+	return Timelock{Type: AbsoluteTimelock, Value: height}
+}
+
+// Validate checks that the timelock can be enforced by its opcode.
+func (l Timelock) Validate() error {
+	switch l.Type {
+	case RelativeTimelock:
+		if l.Value&wire.SequenceLockTimeDisabled != 0 {
+			return fmt.Errorf("relative timelock has the disable flag set: 0x%x", l.Value)
+		}
+		if l.Value&^(wire.SequenceLockTimeIsSeconds|wire.SequenceLockTimeMask) != 0 {
+			return fmt.Errorf("relative timelock uses undefined sequence bits: 0x%x", l.Value)
+		}
+	case AbsoluteTimelock:
+	default:
+		return fmt.Errorf("unknown timelock type: %d", l.Type)
+	}
+
+	if l.Value == 0 {
+		return fmt.Errorf("timelock value must be positive")
+	}
+
+	return nil
+}
+
+// CreateRefundScript creates the tapscript of a timelocked refund leaf:
+//
+//	<value> OP_CHECKSEQUENCEVERIFY|OP_CHECKLOCKTIMEVERIFY OP_DROP <refundKey> OP_CHECKSIG
+//
+// The leaf can only be spent by the refund key once the timelock has expired.
+func CreateRefundScript(refundPubKey *secp.PublicKey, lock Timelock) ([]byte, error) {
+	if err := lock.Validate(); err != nil {
+		return nil, err
+	}
+
+	builder := txscript.NewScriptBuilder()
+	builder.AddInt64(int64(lock.Value))
+	builder.AddOp(lock.opcode())
+	builder.AddOp(txscript.OP_DROP)
+	builder.AddData(schnorr.SerializePubKey(refundPubKey))
+	builder.AddOp(txscript.OP_CHECKSIG)
+
+	return builder.Script()
+}
+
+// opcode returns the opcode enforcing the timelock.
+func (l Timelock) opcode() byte {
+	if l.Type == AbsoluteTimelock {
+		return txscript.OP_CHECKLOCKTIMEVERIFY
+	}
+
+	return txscript.OP_CHECKSEQUENCEVERIFY
+}
+
+// apply sets the sequence of txIn and the lock time of tx so that tx
+// satisfies the timelock.
+func (l Timelock) apply(tx *wire.MsgTx, txIn *wire.TxIn) {
+	if l.Type == RelativeTimelock {
+		// A relative timelock also signals RBF
+		txIn.Sequence = l.Value
+	} else {
+		// nLockTime is only enforced when the input is not final, and
+		// signaling RBF keeps the fee open to bumping
+		txIn.Sequence = SequenceRBF
+		tx.LockTime = l.Value
+	}
+}
+
+// TaprootOutput describes a P2TR output committing to an internal key and,
+// optionally, a tree of tapscript leaves.
+type TaprootOutput struct {
+	InternalKey *secp.PublicKey    // Key path key, before the taproot tweak
+	Root        txscript.TapNode   // Root of the script tree, nil for key-only outputs
+	Leaves      []txscript.TapLeaf // Leaves of the tree, in depth-first order
+	OutputKey   *secp.PublicKey    // Tweaked key placed in the output
+	PkScript    []byte             // OP_1 <output key>
+	Address     string             // bech32m encoding of the output
+
+	proofs [][]byte // Inclusion proof of every leaf, indexed like Leaves
+}
+
+// NewTaprootOutput builds a P2TR output from an internal key and the root of
+// an arbitrary script tree. A nil root creates a key path only output, which
+// commits to an empty script tree as recommended by BIP86.
+func NewTaprootOutput(internalKey *secp.PublicKey, root txscript.TapNode, params *chaincfg.Params) (*TaprootOutput, error) {
+	// BIP341 internal keys are x-only, so work with the even Y point
+	internalKey, err := schnorr.ParsePubKey(schnorr.SerializePubKey(internalKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid internal key: %v", err)
+	}
+
+	output := &TaprootOutput{
+		InternalKey: internalKey,
+		Root:        root,
+	}
+
+	if root != nil {
+		collectLeaves(root, nil, output)
+	}
+
+	output.OutputKey = txscript.ComputeTaprootOutputKey(internalKey, output.MerkleRoot())
+
+	output.PkScript, err = txscript.PayToTaprootScript(output.OutputKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create taproot script: %v", err)
+	}
+
+	address, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(output.OutputKey), params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create taproot address: %v", err)
+	}
+	output.Address = address.String()
+
+	return output, nil
+}
+
+// NewTaprootOutputFromScripts builds a P2TR output whose script tree holds the
+// given leaf scripts, arranged as a balanced tree.
+func NewTaprootOutputFromScripts(internalKey *secp.PublicKey, params *chaincfg.Params, scripts ...[]byte) (*TaprootOutput, error) {
+	var root txscript.TapNode
+	if len(scripts) > 0 {
+		leaves := make([]txscript.TapLeaf, len(scripts))
+		for i, script := range scripts {
+			leaves[i] = txscript.NewBaseTapLeaf(script)
+		}
+		root = txscript.AssembleTaprootScriptTree(leaves...).RootNode
+	}
+
+	return NewTaprootOutput(internalKey, root, params)
+}
+
+// collectLeaves walks the tree depth-first, recording every leaf together
+// with the sibling hashes from the leaf up to the root.
+func collectLeaves(node txscript.TapNode, siblings []chainhash.Hash, output *TaprootOutput) {
+	if leaf, ok := node.(txscript.TapLeaf); ok {
+		proof := make([]byte, 0, len(siblings)*chainhash.HashSize)
+		for i := len(siblings) - 1; i >= 0; i-- {
+			proof = append(proof, siblings[i][:]...)
+		}
+
+		output.Leaves = append(output.Leaves, leaf)
+		output.proofs = append(output.proofs, proof)
+		return
+	}
+
+	left, right := node.Left(), node.Right()
+	collectLeaves(left, append(siblings[:len(siblings):len(siblings)], right.TapHash()), output)
+	collectLeaves(right, append(siblings[:len(siblings):len(siblings)], left.TapHash()), output)
+}
+
+// MerkleRoot returns the root hash of the script tree, or an empty slice for
+// key path only outputs.
+func (o *TaprootOutput) MerkleRoot() []byte {
+	if o.Root == nil {
+		return []byte{}
+	}
+
+	root := o.Root.TapHash()
+	return root[:]
+}
+
+// LeafIndex returns the position of the leaf with the given script, or -1 if
+// the script is not part of the tree.
+func (o *TaprootOutput) LeafIndex(script []byte) int {
+	for i, leaf := range o.Leaves {
+		if bytes.Equal(leaf.Script, script) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// ControlBlock returns the serialized BIP341 control block that proves the
+// leaf at leafIndex is committed to by the output key.
+func (o *TaprootOutput) ControlBlock(leafIndex int) ([]byte, error) {
+	if leafIndex < 0 || leafIndex >= len(o.Leaves) {
+		return nil, fmt.Errorf("leaf index %d out of range [0, %d)", leafIndex, len(o.Leaves))
+	}
+
+	controlBlock := txscript.ControlBlock{
+		InternalKey:     o.InternalKey,
+		OutputKeyYIsOdd: o.OutputKey.Y().Bit(0) == 1,
+		LeafVersion:     o.Leaves[leafIndex].LeafVersion,
+		InclusionProof:  o.proofs[leafIndex],
+	}
+
+	return controlBlock.ToBytes()
+}
+
+// CreateRefundableLockOutput creates a P2TR output whose key path is keyed to
+// internalKey and whose single script leaf lets refundPubKey reclaim the
+// funds once the timelock expires.
+func CreateRefundableLockOutput(
+	internalKey *secp.PublicKey,
+	refundPubKey *secp.PublicKey,
+	lock Timelock,
+	params *chaincfg.Params,
+) (*TaprootOutput, error) {
+	refundScript, err := CreateRefundScript(refundPubKey, lock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund script: %v", err)
+	}
+
+	return NewTaprootOutputFromScripts(internalKey, params, refundScript)
+}
+
+// CreateRefundTransaction creates and signs a transaction that spends the
+// refund leaf of lockOutput, sending its value minus fee to destScript.
+// The locked output is lockTx's output at lockOutputIndex.
+func CreateRefundTransaction(
+	lockTx *wire.MsgTx,
+	lockOutputIndex uint32,
+	lockOutput *TaprootOutput,
+	lock Timelock,
+	refundPrivKey *secp.PrivateKey,
+	destScript []byte,
+	fee int64,
+) (*wire.MsgTx, error) {
+	tx, leafIndex, err := newRefundTx(lockTx, lockOutputIndex, lockOutput, lock, refundPrivKey.PubKey(), destScript, fee)
+	if err != nil {
+		return nil, err
+	}
+	prevOut := lockTx.TxOut[lockOutputIndex]
+	leaf := lockOutput.Leaves[leafIndex]
+
+	// Sign the script path spend of the refund leaf
+	prevOutFetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+	sigHash, err := CalculateSighash(tx, 0, prevOutFetcher, SigHashDefault, WithTapLeaf(leaf))
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate signature hash: %v", err)
+	}
+
+	sig, err := schnorr.Sign(refundPrivKey, sigHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schnorr signature: %v", err)
+	}
+
+	controlBlock, err := lockOutput.ControlBlock(leafIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create control block: %v", err)
+	}
+
+	tx.TxIn[0].Witness = wire.TxWitness{sig.Serialize(), leaf.Script, controlBlock}
+
+	return tx, nil
+}
+
+// NewRefundPSBT creates an unsigned PSBT of the refund transaction built by
+// CreateRefundTransaction, for refundPubKey to sign the refund leaf with an
+// external wallet.
+func NewRefundPSBT(
+	lockTx *wire.MsgTx,
+	lockOutputIndex uint32,
+	lockOutput *TaprootOutput,
+	lock Timelock,
+	refundPubKey *secp.PublicKey,
+	destScript []byte,
+	fee int64,
+) (*psbt.Packet, error) {
+	tx, _, err := newRefundTx(lockTx, lockOutputIndex, lockOutput, lock, refundPubKey, destScript, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	packet, err := NewPSBT(tx, []*wire.TxOut{lockTx.TxOut[lockOutputIndex]})
+	if err != nil {
+		return nil, err
+	}
+	if err := AddTaprootInput(packet, 0, lockOutput); err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
+
+// newRefundTx creates the unsigned refund transaction and returns it with
+// the index of the refund leaf of refundPubKey in lockOutput.
+func newRefundTx(
+	lockTx *wire.MsgTx,
+	lockOutputIndex uint32,
+	lockOutput *TaprootOutput,
+	lock Timelock,
+	refundPubKey *secp.PublicKey,
+	destScript []byte,
+	fee int64,
+) (*wire.MsgTx, int, error) {
+	if int(lockOutputIndex) >= len(lockTx.TxOut) {
+		return nil, 0, fmt.Errorf("locking transaction has no output %d", lockOutputIndex)
+	}
+	prevOut := lockTx.TxOut[lockOutputIndex]
+	if !bytes.Equal(prevOut.PkScript, lockOutput.PkScript) {
+		return nil, 0, fmt.Errorf("output %d does not pay to the lock output", lockOutputIndex)
+	}
+
+	refundScript, err := CreateRefundScript(refundPubKey, lock)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create refund script: %v", err)
+	}
+	leafIndex := lockOutput.LeafIndex(refundScript)
+	if leafIndex < 0 {
+		return nil, 0, fmt.Errorf("refund leaf not found in lock output")
+	}
+
+	outputAmount := prevOut.Value - fee
+	if outputAmount <= 0 {
+		return nil, 0, fmt.Errorf("fee too high: %d, exceeds amount: %d", fee, prevOut.Value)
+	}
+
+	tx := wire.NewMsgTx(2) // Version 2 for BIP68 relative timelocks
+
+	lockHash := lockTx.TxHash()
+	txIn := wire.NewTxIn(wire.NewOutPoint(&lockHash, lockOutputIndex), nil, nil)
+	lock.apply(tx, txIn)
+	tx.AddTxIn(txIn)
+	tx.AddTxOut(wire.NewTxOut(outputAmount, destScript))
+
+	return tx, leafIndex, nil
+}
+
+// CreateNostrSignatureLockOutput creates the swap output used by
+// CreateNostrSignatureLockScript, extended with a refund leaf so that
+// refundPubKey can reclaim the funds if the Nostr signature is never revealed.
+func CreateNostrSignatureLockOutput(
+	nostrPubKey *secp.PublicKey,
+	commitment *secp.PublicKey,
+	refundPubKey *secp.PublicKey,
+	lock Timelock,
+	params *chaincfg.Params,
+) (*TaprootOutput, error) {
+	tweakedKey, err := adaptor.AddPubKeys(nostrPubKey, commitment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tweaked key: %v", err)
+	}
+
+	return CreateRefundableLockOutput(tweakedKey, refundPubKey, lock, params)
+}
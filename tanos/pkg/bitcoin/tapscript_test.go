@@ -0,0 +1,178 @@
+package bitcoin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// parseVectorTree converts the nested JSON script tree of the BIP341 vectors
+// into a tap node.
+func parseVectorTree(t *testing.T, raw json.RawMessage) txscript.TapNode {
+	t.Helper()
+
+	var branch []json.RawMessage
+	if err := json.Unmarshal(raw, &branch); err == nil {
+		if len(branch) != 2 {
+			t.Fatalf("Branch with %d children", len(branch))
+		}
+		return txscript.NewTapBranch(parseVectorTree(t, branch[0]), parseVectorTree(t, branch[1]))
+	}
+
+	var leaf struct {
+		Script      string `json:"script"`
+		LeafVersion uint8  `json:"leafVersion"`
+	}
+	if err := json.Unmarshal(raw, &leaf); err != nil {
+		t.Fatalf("Invalid tree node: %v", err)
+	}
+
+	return txscript.NewTapLeaf(txscript.TapscriptLeafVersion(leaf.LeafVersion), mustDecodeHex(t, leaf.Script))
+}
+
+// TestTaprootOutputBIP341Vectors checks output keys, addresses and control
+// blocks of every script tree in the BIP341 vectors.
+func TestTaprootOutputBIP341Vectors(t *testing.T) {
+	vectors := loadBIP341Vectors(t)
+
+	for i, v := range vectors.ScriptPubKey {
+		internalKey, err := schnorr.ParsePubKey(mustDecodeHex(t, v.Given.InternalPubkey))
+		if err != nil {
+			t.Fatalf("Vector %d: invalid internal key: %v", i, err)
+		}
+
+		var root txscript.TapNode
+		if string(v.Given.ScriptTree) != "null" {
+			root = parseVectorTree(t, v.Given.ScriptTree)
+		}
+
+		output, err := NewTaprootOutput(internalKey, root, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("Vector %d: %v", i, err)
+		}
+
+		if got := hex.EncodeToString(output.PkScript); got != v.Expected.ScriptPubKey {
+			t.Fatalf("Vector %d: scriptPubKey mismatch\n got: %s\nwant: %s", i, got, v.Expected.ScriptPubKey)
+		}
+		if output.Address != v.Expected.Bip350Address {
+			t.Fatalf("Vector %d: address mismatch: got %s, want %s", i, output.Address, v.Expected.Bip350Address)
+		}
+		if v.Intermediary.MerkleRoot != nil {
+			if got := hex.EncodeToString(output.MerkleRoot()); got != *v.Intermediary.MerkleRoot {
+				t.Fatalf("Vector %d: merkle root mismatch", i)
+			}
+		}
+
+		if len(output.Leaves) != len(v.Expected.ScriptPathControlBlocks) {
+			t.Fatalf("Vector %d: got %d leaves, want %d", i, len(output.Leaves), len(v.Expected.ScriptPathControlBlocks))
+		}
+		for j, want := range v.Expected.ScriptPathControlBlocks {
+			leafHash := output.Leaves[j].TapHash()
+			if got := hex.EncodeToString(leafHash[:]); got != v.Intermediary.LeafHashes[j] {
+				t.Fatalf("Vector %d leaf %d: leaf hash mismatch", i, j)
+			}
+
+			controlBlock, err := output.ControlBlock(j)
+			if err != nil {
+				t.Fatalf("Vector %d leaf %d: %v", i, j, err)
+			}
+			if got := hex.EncodeToString(controlBlock); got != want {
+				t.Fatalf("Vector %d leaf %d: control block mismatch\n got: %s\nwant: %s", i, j, got, want)
+			}
+		}
+	}
+}
+
+// TestRefundTransactionIsValid spends the refund leaf of a swap output with
+// both timelock types and runs the result through the script engine.
+func TestRefundTransactionIsValid(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+
+	locks := []Timelock{
+		RelativeBlocks(144),
+		AbsoluteHeight(850000),
+	}
+
+	for _, lock := range locks {
+		nostrKey, _ := btcec.NewPrivateKey()
+		commitment, _ := btcec.NewPrivateKey()
+		buyer, _ := btcec.NewPrivateKey()
+
+		lockOutput, err := CreateNostrSignatureLockOutput(nostrKey.PubKey(), commitment.PubKey(), buyer.PubKey(), lock, params)
+		if err != nil {
+			t.Fatalf("Failed to create lock output: %v", err)
+		}
+
+		lockTx := wire.NewMsgTx(2)
+		lockTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil, nil))
+		lockTx.AddTxOut(wire.NewTxOut(100000, lockOutput.PkScript))
+
+		_, destScript, err := CreateP2TRAddress(buyer.PubKey(), params)
+		if err != nil {
+			t.Fatalf("Failed to create destination: %v", err)
+		}
+
+		refundTx, err := CreateRefundTransaction(lockTx, 0, lockOutput, lock, buyer, destScript, 1000)
+		if err != nil {
+			t.Fatalf("Failed to create refund transaction: %v", err)
+		}
+
+		prevOut := lockTx.TxOut[0]
+		fetcher := txscript.NewCannedPrevOutputFetcher(prevOut.PkScript, prevOut.Value)
+		engine, err := txscript.NewEngine(
+			prevOut.PkScript, refundTx, 0, txscript.StandardVerifyFlags, nil,
+			txscript.NewTxSigHashes(refundTx, fetcher), prevOut.Value, fetcher,
+		)
+		if err != nil {
+			t.Fatalf("Failed to create script engine: %v", err)
+		}
+		if err := engine.Execute(); err != nil {
+			t.Fatalf("Refund transaction (type %d) rejected by script engine: %v", lock.Type, err)
+		}
+
+		// A refund that does not satisfy the timelock must be rejected
+		early := refundTx.Copy()
+		if lock.Type == RelativeTimelock {
+			early.TxIn[0].Sequence = lock.Value - 1
+		} else {
+			early.LockTime = lock.Value - 1
+		}
+		engine, err = txscript.NewEngine(
+			prevOut.PkScript, early, 0, txscript.StandardVerifyFlags, nil,
+			txscript.NewTxSigHashes(early, fetcher), prevOut.Value, fetcher,
+		)
+		if err != nil {
+			t.Fatalf("Failed to create script engine: %v", err)
+		}
+		if err := engine.Execute(); err == nil {
+			t.Fatalf("Refund transaction (type %d) accepted before the timelock", lock.Type)
+		}
+	}
+}
+
+// TestRefundScriptRejectsInvalidTimelocks covers timelocks that cannot be
+// enforced by their opcode.
+func TestRefundScriptRejectsInvalidTimelocks(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+
+	invalid := []Timelock{
+		{Type: RelativeTimelock, Value: 0},
+		{Type: RelativeTimelock, Value: wire.SequenceLockTimeDisabled | 10},
+		{Type: RelativeTimelock, Value: 1 << 20},
+		{Type: AbsoluteTimelock, Value: 0},
+		{Type: TimelockType(7), Value: 10},
+	}
+
+	for _, lock := range invalid {
+		if _, err := CreateRefundScript(key.PubKey(), lock); err == nil {
+			t.Fatalf("Expected error for timelock %+v", lock)
+		}
+	}
+}
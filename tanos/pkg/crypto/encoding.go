@@ -0,0 +1,55 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// ParseCompressedPubKey decodes a 33-byte compressed public key. Unlike
+// btcec.ParsePubKey it rejects the uncompressed and hybrid formats, so every
+// point has a single valid encoding.
+func ParseCompressedPubKey(b []byte) (*btcec.PublicKey, error) {
+	if len(b) != btcec.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("compressed public key must be %d bytes, got %d", btcec.PubKeyBytesLenCompressed, len(b))
+	}
+	if b[0] != 0x02 && b[0] != 0x03 {
+		return nil, fmt.Errorf("invalid compressed public key prefix 0x%02x", b[0])
+	}
+
+	// ParsePubKey checks that the point is on the curve
+	return btcec.ParsePubKey(b)
+}
+
+// ParseScalar decodes a 32-byte big endian scalar, rejecting values that are
+// not smaller than the curve order.
+func ParseScalar(b []byte) (*btcec.ModNScalar, error) {
+	if len(b) != 32 {
+		return nil, fmt.Errorf("scalar must be 32 bytes, got %d", len(b))
+	}
+
+	s := new(btcec.ModNScalar)
+	if overflow := s.SetByteSlice(b); overflow {
+		return nil, fmt.Errorf("scalar is not smaller than the curve order")
+	}
+
+	return s, nil
+}
+
+// DecodeHexStrict decodes lowercase hex, as produced by HexEncode. A size
+// above zero also requires the decoded value to have exactly that length.
+func DecodeHexStrict(s string, size int) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if hex.EncodeToString(b) != s {
+		return nil, fmt.Errorf("hex must be lowercase")
+	}
+	if size > 0 && len(b) != size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", size, len(b))
+	}
+
+	return b, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd
+
+package crypto
+
+import "errors"
+
+// mlock is not supported on this platform.
+func mlock(b []byte) error {
+	return errors.New("memory locking is not supported on this platform")
+}
+
+// munlock is not supported on this platform.
+func munlock(b []byte) error {
+	return nil
+}
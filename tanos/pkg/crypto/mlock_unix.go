@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package crypto
+
+import "syscall"
+
+// mlock locks b into RAM.
+func mlock(b []byte) error {
+	return syscall.Mlock(b)
+}
+
+// munlock undoes mlock.
+func munlock(b []byte) error {
+	return syscall.Munlock(b)
+}
@@ -0,0 +1,183 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// ErrKeyZeroed is returned when a zeroed SecretKey is used.
+var ErrKeyZeroed = errors.New("secret key has been zeroed")
+
+// Signer holds a private key and only lends it out for the duration of a
+// call, so callers never keep a copy of it.
+type Signer interface {
+	// PubKey returns the public key of the signer.
+	PubKey() *btcec.PublicKey
+
+	// WithPrivateKey calls fn with the private key. fn must not keep the
+	// key, or anything derived from it, after it returns.
+	WithPrivateKey(fn func(priv *btcec.PrivateKey) error) error
+}
+
+// SecretKey is a private key kept in memory only as long as needed. It is
+// a Signer, prints as redacted with every fmt verb, refuses to be encoded
+// as JSON or text, and can be locked into RAM so it is never swapped out.
+// Zero wipes it. A SecretKey must not be copied.
+type SecretKey struct {
+	mu     sync.Mutex
+	priv   btcec.PrivateKey
+	pub    *btcec.PublicKey
+	zeroed bool
+	locked bool
+}
+
+// GenerateSecretKey creates a new random SecretKey.
+func GenerateSecretKey() (*SecretKey, error) {
+	priv, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+	defer priv.Zero()
+
+	return newSecretKey(&priv.Key), nil
+}
+
+// SecretKeyFromBytes creates a SecretKey from a 32-byte big endian private
+// key, which must be in the range [1, n-1]. The caller still owns b and
+// should zero it.
+func SecretKeyFromBytes(b []byte) (*SecretKey, error) {
+	if len(b) != 32 {
+		return nil, fmt.Errorf("private key must be 32 bytes, got %d", len(b))
+	}
+
+	var scalar btcec.ModNScalar
+	defer scalar.Zero()
+	if overflow := scalar.SetByteSlice(b); overflow || scalar.IsZero() {
+		return nil, fmt.Errorf("private key is out of range")
+	}
+
+	return newSecretKey(&scalar), nil
+}
+
+// SecretKeyFromHex creates a SecretKey from a hex private key, such as a
+// Nostr private key. Go strings cannot be wiped, so keys should come from
+// bytes where possible.
+func SecretKeyFromHex(s string) (*SecretKey, error) {
+	b, err := DecodeHexStrict(s, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	defer zeroBytes(b)
+
+	return SecretKeyFromBytes(b)
+}
+
+// newSecretKey copies the scalar into a new SecretKey.
+func newSecretKey(scalar *btcec.ModNScalar) *SecretKey {
+	k := &SecretKey{}
+	k.priv.Key.Set(scalar)
+	k.pub = k.priv.PubKey()
+
+	return k
+}
+
+// PubKey returns the public key. It stays available after Zero.
+func (k *SecretKey) PubKey() *btcec.PublicKey {
+	return k.pub
+}
+
+// WithPrivateKey calls fn with the private key, or fails with ErrKeyZeroed
+// once the key has been zeroed. fn must not call back into the key.
+func (k *SecretKey) WithPrivateKey(fn func(priv *btcec.PrivateKey) error) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.zeroed {
+		return ErrKeyZeroed
+	}
+
+	return fn(&k.priv)
+}
+
+// Lock locks the memory holding the key into RAM, so that it is never
+// written to swap. It is not supported on every platform.
+func (k *SecretKey) Lock() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.zeroed {
+		return ErrKeyZeroed
+	}
+	if k.locked {
+		return nil
+	}
+	if err := mlock(k.memory()); err != nil {
+		return fmt.Errorf("failed to lock secret key memory: %v", err)
+	}
+	k.locked = true
+
+	return nil
+}
+
+// Zero wipes the private key and unlocks its memory. The key cannot be used
+// afterwards. Zero can be called more than once.
+func (k *SecretKey) Zero() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.priv.Zero()
+	k.zeroed = true
+	if k.locked {
+		_ = munlock(k.memory())
+		k.locked = false
+	}
+}
+
+// IsZero reports whether the key has been zeroed.
+func (k *SecretKey) IsZero() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.zeroed
+}
+
+// memory returns the bytes of the private key scalar.
+func (k *SecretKey) memory() []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(&k.priv.Key)), unsafe.Sizeof(k.priv.Key))
+}
+
+// String hides the key.
+func (k *SecretKey) String() string {
+	return "SecretKey(redacted)"
+}
+
+// GoString hides the key from %#v.
+func (k *SecretKey) GoString() string {
+	return k.String()
+}
+
+// Format hides the key from every fmt verb, including %x and %+v.
+func (k *SecretKey) Format(f fmt.State, _ rune) {
+	fmt.Fprint(f, k.String())
+}
+
+// MarshalJSON refuses to encode the key.
+func (k *SecretKey) MarshalJSON() ([]byte, error) {
+	return nil, fmt.Errorf("refusing to encode a secret key")
+}
+
+// MarshalText refuses to encode the key.
+func (k *SecretKey) MarshalText() ([]byte, error) {
+	return nil, fmt.Errorf("refusing to encode a secret key")
+}
+
+// zeroBytes overwrites b with zeros.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
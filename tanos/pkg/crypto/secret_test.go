@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// TestSecretKeyRedacted checks that the key never shows up in formatted
+// output and cannot be encoded.
+func TestSecretKeyRedacted(t *testing.T) {
+	priv, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keyHex := HexEncode(priv.Serialize())
+
+	key, err := SecretKeyFromHex(keyHex)
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	if !key.PubKey().IsEqual(priv.PubKey()) {
+		t.Fatalf("Parsed key has a different public key")
+	}
+
+	holder := struct{ Key *SecretKey }{key}
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%x", "%X", "%q"} {
+		out := fmt.Sprintf(verb, holder)
+		if strings.Contains(strings.ToLower(out), keyHex) {
+			t.Fatalf("%s leaked the key: %s", verb, out)
+		}
+	}
+	if _, err := json.Marshal(holder); err == nil {
+		t.Fatalf("Encoded the key as JSON")
+	}
+}
+
+// TestSecretKeyZero checks that a zeroed key can no longer be used.
+func TestSecretKeyZero(t *testing.T) {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	pub := key.PubKey()
+
+	key.Zero()
+	if !key.IsZero() {
+		t.Fatalf("Key is not zeroed")
+	}
+	if !key.priv.Key.IsZero() {
+		t.Fatalf("Key scalar is not zeroed")
+	}
+	err = key.WithPrivateKey(func(*btcec.PrivateKey) error { return nil })
+	if !errors.Is(err, ErrKeyZeroed) {
+		t.Fatalf("Expected ErrKeyZeroed, got %v", err)
+	}
+	if !key.PubKey().IsEqual(pub) {
+		t.Fatalf("Public key changed after zeroing")
+	}
+}
+
+// TestSecretKeyFromBytes rejects keys outside [1, n-1].
+func TestSecretKeyFromBytes(t *testing.T) {
+	order := btcec.S256().N.Bytes()
+	for _, b := range [][]byte{make([]byte, 32), order, make([]byte, 31)} {
+		if _, err := SecretKeyFromBytes(b); err == nil {
+			t.Fatalf("Accepted invalid key %x", b)
+		}
+	}
+}
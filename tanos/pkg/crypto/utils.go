@@ -3,8 +3,6 @@ package crypto
 
 import (
 	"encoding/hex"
-	"fmt"
-	"math/big"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 )
@@ -43,21 +41,11 @@ func SerializeModNScalar(s *btcec.ModNScalar) []byte {
 // In elliptic curve cryptography, negating a point means keeping the same x-coordinate
 // but negating the y-coordinate.
 func NegatePoint(p *btcec.PublicKey) (*btcec.PublicKey, error) {
-	// Create a new point with the same X but negated Y
-	fx := new(btcec.FieldVal)
-	fy := new(btcec.FieldVal)
-
-	// Copy X
-	if overflow := fx.SetByteSlice(p.X().Bytes()); overflow {
-		return nil, fmt.Errorf("x-coordinate overflow when negating point")
-	}
+	var point btcec.JacobianPoint
+	p.AsJacobian(&point)
 
 	// Negate Y value (p - y) where p is the field prime
-	negY := new(big.Int).Sub(btcec.S256().P, p.Y())
-
-	if overflow := fy.SetByteSlice(negY.Bytes()); overflow {
-		return nil, fmt.Errorf("y-coordinate overflow when negating point")
-	}
+	point.Y.Negate(1).Normalize()
 
-	return btcec.NewPublicKey(fx, fy), nil
+	return btcec.NewPublicKey(&point.X, &point.Y), nil
 }
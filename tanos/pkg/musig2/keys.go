@@ -0,0 +1,186 @@
+// Package musig2 implements BIP327 MuSig2 multi-signatures, extended with
+// adaptor signatures. It allows two or more parties to jointly control a
+// single taproot key and to produce a pre-signature that only becomes a
+// valid BIP340 signature once an adaptor secret is added, revealing that
+// secret to everyone who saw the pre-signature.
+package musig2
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// BIP327 tagged hash tags.
+var (
+	tagKeyAggList        = []byte("KeyAgg list")
+	tagKeyAggCoefficient = []byte("KeyAgg coefficient")
+	tagNonceAux          = []byte("MuSig/aux")
+	tagNonce             = []byte("MuSig/nonce")
+	tagNonceCoef         = []byte("MuSig/noncecoef")
+)
+
+// ErrTweakOverflow is returned when a tweak is not smaller than the curve order.
+var ErrTweakOverflow = fmt.Errorf("the tweak must be less than n")
+
+// KeyAggContext holds the aggregate public key of a set of signers together
+// with the tweaks applied to it.
+type KeyAggContext struct {
+	pubKeys   [][]byte // Compressed signer keys, in aggregation order
+	keyHash   []byte   // L = hash of all signer keys
+	secondKey []byte   // First key different from pubKeys[0], if any
+
+	q    secp.JacobianPoint // Aggregate key Q, in affine coordinates
+	gacc secp.ModNScalar    // Accumulated sign flips of Q
+	tacc secp.ModNScalar    // Accumulated tweak
+}
+
+// SortKeys returns the keys sorted lexicographically by their compressed
+// encoding, as defined by BIP327 KeySort.
+func SortKeys(pubKeys []*secp.PublicKey) []*secp.PublicKey {
+	sorted := make([]*secp.PublicKey, len(pubKeys))
+	copy(sorted, pubKeys)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].SerializeCompressed(), sorted[j].SerializeCompressed()) < 0
+	})
+
+	return sorted
+}
+
+// AggregateKeys combines the signer keys into a single aggregate key. The
+// order of the keys matters; use SortKeys for an order independent result.
+func AggregateKeys(pubKeys []*secp.PublicKey) (*KeyAggContext, error) {
+	if len(pubKeys) == 0 {
+		return nil, fmt.Errorf("no public keys to aggregate")
+	}
+
+	ctx := &KeyAggContext{
+		pubKeys: make([][]byte, len(pubKeys)),
+	}
+
+	var keyList []byte
+	for i, pubKey := range pubKeys {
+		ctx.pubKeys[i] = pubKey.SerializeCompressed()
+		keyList = append(keyList, ctx.pubKeys[i]...)
+	}
+	ctx.keyHash = chainhash.TaggedHash(tagKeyAggList, keyList)[:]
+
+	ctx.secondKey = make([]byte, secp.PubKeyBytesLenCompressed)
+	for _, pubKey := range ctx.pubKeys[1:] {
+		if !bytes.Equal(pubKey, ctx.pubKeys[0]) {
+			ctx.secondKey = pubKey
+			break
+		}
+	}
+
+	// Q = sum(a_i * P_i)
+	for i, pubKey := range pubKeys {
+		a := ctx.coefficient(ctx.pubKeys[i])
+
+		var p, ap, sum secp.JacobianPoint
+		pubKey.AsJacobian(&p)
+		secp.ScalarMultNonConst(a, &p, &ap)
+		secp.AddNonConst(&ctx.q, &ap, &sum)
+		ctx.q.Set(&sum)
+	}
+
+	if isInfinity(&ctx.q) {
+		return nil, fmt.Errorf("aggregate key is the point at infinity")
+	}
+	ctx.q.ToAffine()
+
+	ctx.gacc.SetInt(1)
+
+	return ctx, nil
+}
+
+// coefficient returns the key aggregation coefficient of a signer key.
+func (c *KeyAggContext) coefficient(pubKey []byte) *secp.ModNScalar {
+	a := new(secp.ModNScalar)
+	if bytes.Equal(pubKey, c.secondKey) {
+		a.SetInt(1)
+		return a
+	}
+
+	hash := chainhash.TaggedHash(tagKeyAggCoefficient, c.keyHash, pubKey)
+	a.SetBytes((*[32]byte)(hash))
+	return a
+}
+
+// hasKey reports whether the compressed key is one of the signer keys.
+func (c *KeyAggContext) hasKey(pubKey []byte) bool {
+	for _, k := range c.pubKeys {
+		if bytes.Equal(k, pubKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tweak returns a new context with the tweak added to the aggregate key.
+// An x-only tweak first negates the key if it has an odd Y coordinate, as
+// BIP341 taproot tweaks do; a plain tweak is added as is.
+func (c *KeyAggContext) Tweak(tweak []byte, xOnly bool) (*KeyAggContext, error) {
+	if len(tweak) != 32 {
+		return nil, fmt.Errorf("the tweak must be a 32-byte array")
+	}
+
+	var t secp.ModNScalar
+	if overflow := t.SetByteSlice(tweak); overflow {
+		return nil, ErrTweakOverflow
+	}
+
+	tweaked := *c
+
+	// g = -1 if the x-only key must be flipped to even Y, else 1
+	var g secp.ModNScalar
+	g.SetInt(1)
+	if xOnly && c.q.Y.IsOdd() {
+		g.Negate()
+	}
+
+	// Q' = g*Q + t*G
+	var gq, tg secp.JacobianPoint
+	secp.ScalarMultNonConst(&g, &c.q, &gq)
+	secp.ScalarBaseMultNonConst(&t, &tg)
+	secp.AddNonConst(&gq, &tg, &tweaked.q)
+	if isInfinity(&tweaked.q) {
+		return nil, fmt.Errorf("the result of tweaking cannot be infinity")
+	}
+	tweaked.q.ToAffine()
+
+	// gacc' = g*gacc, tacc' = t + g*tacc
+	tweaked.gacc.Mul2(&g, &c.gacc)
+	tweaked.tacc.Mul2(&g, &c.tacc).Add(&t)
+
+	return &tweaked, nil
+}
+
+// TaprootTweak returns a new context tweaked into a BIP341 taproot output key
+// committing to merkleRoot. An empty merkleRoot gives the BIP86 key path
+// only output key.
+func (c *KeyAggContext) TaprootTweak(merkleRoot []byte) (*KeyAggContext, error) {
+	tweak := chainhash.TaggedHash(chainhash.TagTapTweak, c.XOnlyKey(), merkleRoot)
+	return c.Tweak(tweak[:], true)
+}
+
+// AggregateKey returns the (tweaked) aggregate public key.
+func (c *KeyAggContext) AggregateKey() *secp.PublicKey {
+	return secp.NewPublicKey(&c.q.X, &c.q.Y)
+}
+
+// XOnlyKey returns the 32-byte x-only encoding of the aggregate key.
+func (c *KeyAggContext) XOnlyKey() []byte {
+	return schnorr.SerializePubKey(c.AggregateKey())
+}
+
+// isInfinity reports whether the point is the point at infinity.
+func isInfinity(p *secp.JacobianPoint) bool {
+	return (p.X.IsZero() && p.Y.IsZero()) || p.Z.IsZero()
+}
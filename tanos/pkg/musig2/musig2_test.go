@@ -0,0 +1,538 @@
+package musig2
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// loadVectors reads a BIP327 test vector file from testdata.
+func loadVectors(t *testing.T, name string, v interface{}) {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Failed to read test vectors: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("Failed to parse test vectors: %v", err)
+	}
+}
+
+// mustDecodeHex decodes a hex string or fails the test.
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// parseKeys decodes the selected vector keys. The index of the first key that
+// fails to parse is returned, or -1 if all keys are valid.
+func parseKeys(t *testing.T, all []string, indices []int) ([]*secp.PublicKey, int) {
+	t.Helper()
+
+	keys := make([]*secp.PublicKey, len(indices))
+	for i, idx := range indices {
+		b := mustDecodeHex(t, all[idx])
+		if len(b) != secp.PubKeyBytesLenCompressed {
+			return nil, i
+		}
+		key, err := secp.ParsePubKey(b)
+		if err != nil {
+			return nil, i
+		}
+		keys[i] = key
+	}
+
+	return keys, -1
+}
+
+// applyTweaks applies the selected vector tweaks to the context.
+func applyTweaks(t *testing.T, ctx *KeyAggContext, all []string, indices []int, xOnly []bool) (*KeyAggContext, error) {
+	t.Helper()
+
+	var err error
+	for i, idx := range indices {
+		ctx, err = ctx.Tweak(mustDecodeHex(t, all[idx]), xOnly[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ctx, nil
+}
+
+// TestKeyAggVectors checks key aggregation against the BIP327 vectors.
+func TestKeyAggVectors(t *testing.T) {
+	var vectors struct {
+		PubKeys    []string `json:"pubkeys"`
+		Tweaks     []string `json:"tweaks"`
+		ValidCases []struct {
+			KeyIndices []int  `json:"key_indices"`
+			Expected   string `json:"expected"`
+		} `json:"valid_test_cases"`
+		ErrorCases []struct {
+			KeyIndices   []int  `json:"key_indices"`
+			TweakIndices []int  `json:"tweak_indices"`
+			IsXOnly      []bool `json:"is_xonly"`
+			Error        struct {
+				Type   string `json:"type"`
+				Signer int    `json:"signer"`
+			} `json:"error"`
+		} `json:"error_test_cases"`
+	}
+	loadVectors(t, "key_agg_vectors.json", &vectors)
+
+	for i, tc := range vectors.ValidCases {
+		keys, bad := parseKeys(t, vectors.PubKeys, tc.KeyIndices)
+		if bad >= 0 {
+			t.Fatalf("Case %d: invalid key %d", i, bad)
+		}
+
+		ctx, err := AggregateKeys(keys)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+		if got := hex.EncodeToString(ctx.XOnlyKey()); !strings.EqualFold(got, tc.Expected) {
+			t.Fatalf("Case %d: aggregate key mismatch\n got: %s\nwant: %s", i, got, tc.Expected)
+		}
+	}
+
+	for i, tc := range vectors.ErrorCases {
+		keys, bad := parseKeys(t, vectors.PubKeys, tc.KeyIndices)
+		if tc.Error.Type == "invalid_contribution" {
+			if bad != tc.Error.Signer {
+				t.Fatalf("Case %d: expected key %d to be rejected, got %d", i, tc.Error.Signer, bad)
+			}
+			continue
+		}
+
+		ctx, err := AggregateKeys(keys)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+		if _, err := applyTweaks(t, ctx, vectors.Tweaks, tc.TweakIndices, tc.IsXOnly); err == nil {
+			t.Fatalf("Case %d: expected tweak error", i)
+		}
+	}
+}
+
+// TestKeySortVectors checks KeySort against the BIP327 vectors.
+func TestKeySortVectors(t *testing.T) {
+	var vectors struct {
+		PubKeys       []string `json:"pubkeys"`
+		SortedPubKeys []string `json:"sorted_pubkeys"`
+	}
+	loadVectors(t, "key_sort_vectors.json", &vectors)
+
+	indices := make([]int, len(vectors.PubKeys))
+	for i := range indices {
+		indices[i] = i
+	}
+	keys, bad := parseKeys(t, vectors.PubKeys, indices)
+	if bad >= 0 {
+		t.Fatalf("Invalid key %d", bad)
+	}
+
+	for i, key := range SortKeys(keys) {
+		if got := hex.EncodeToString(key.SerializeCompressed()); !strings.EqualFold(got, vectors.SortedPubKeys[i]) {
+			t.Fatalf("Position %d: got %s, want %s", i, got, vectors.SortedPubKeys[i])
+		}
+	}
+}
+
+// TestNonceGenVectors checks nonce derivation against the BIP327 vectors.
+func TestNonceGenVectors(t *testing.T) {
+	var vectors struct {
+		TestCases []struct {
+			Rand             string  `json:"rand_"`
+			SK               *string `json:"sk"`
+			PK               string  `json:"pk"`
+			AggPK            *string `json:"aggpk"`
+			Msg              *string `json:"msg"`
+			ExtraIn          *string `json:"extra_in"`
+			ExpectedSecNonce string  `json:"expected_secnonce"`
+			ExpectedPubNonce string  `json:"expected_pubnonce"`
+		} `json:"test_cases"`
+	}
+	loadVectors(t, "nonce_gen_vectors.json", &vectors)
+
+	optional := func(s *string) []byte {
+		if s == nil {
+			return nil
+		}
+		return mustDecodeHex(t, *s)
+	}
+
+	for i, tc := range vectors.TestCases {
+		opts := &nonceOptions{
+			secretKey:    optional(tc.SK),
+			aggregateKey: optional(tc.AggPK),
+			message:      optional(tc.Msg),
+			extraInput:   optional(tc.ExtraIn),
+		}
+
+		secNonce, pubNonce, err := nonceGen(mustDecodeHex(t, tc.Rand), mustDecodeHex(t, tc.PK), opts)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+		if got := hex.EncodeToString(secNonce[:]); !strings.EqualFold(got, tc.ExpectedSecNonce) {
+			t.Fatalf("Case %d: secnonce mismatch\n got: %s\nwant: %s", i, got, tc.ExpectedSecNonce)
+		}
+		if got := hex.EncodeToString(pubNonce[:]); !strings.EqualFold(got, tc.ExpectedPubNonce) {
+			t.Fatalf("Case %d: pubnonce mismatch\n got: %s\nwant: %s", i, got, tc.ExpectedPubNonce)
+		}
+	}
+}
+
+// TestNonceAggVectors checks nonce aggregation against the BIP327 vectors.
+func TestNonceAggVectors(t *testing.T) {
+	var vectors struct {
+		PNonces    []string `json:"pnonces"`
+		ValidCases []struct {
+			PNonceIndices []int  `json:"pnonce_indices"`
+			Expected      string `json:"expected"`
+		} `json:"valid_test_cases"`
+		ErrorCases []struct {
+			PNonceIndices []int `json:"pnonce_indices"`
+			Error         struct {
+				Signer int `json:"signer"`
+			} `json:"error"`
+		} `json:"error_test_cases"`
+	}
+	loadVectors(t, "nonce_agg_vectors.json", &vectors)
+
+	nonces := func(indices []int) []*PublicNonce {
+		out := make([]*PublicNonce, len(indices))
+		for i, idx := range indices {
+			out[i] = new(PublicNonce)
+			copy(out[i][:], mustDecodeHex(t, vectors.PNonces[idx]))
+		}
+		return out
+	}
+
+	for i, tc := range vectors.ValidCases {
+		aggNonce, err := AggregateNonces(nonces(tc.PNonceIndices))
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+		if got := hex.EncodeToString(aggNonce[:]); !strings.EqualFold(got, tc.Expected) {
+			t.Fatalf("Case %d: aggnonce mismatch\n got: %s\nwant: %s", i, got, tc.Expected)
+		}
+	}
+
+	for i, tc := range vectors.ErrorCases {
+		_, err := AggregateNonces(nonces(tc.PNonceIndices))
+		contribErr, ok := err.(*InvalidContributionError)
+		if !ok || contribErr.Signer != tc.Error.Signer {
+			t.Fatalf("Case %d: expected invalid nonce from signer %d, got %v", i, tc.Error.Signer, err)
+		}
+	}
+}
+
+// signVectorCase signs one BIP327 sign or tweak vector case and returns the
+// partial signature.
+func signVectorCase(t *testing.T, ctx *KeyAggContext, aggNonce, secNonceHex, skHex string, msg []byte) *secp.ModNScalar {
+	t.Helper()
+
+	var agg AggregateNonce
+	copy(agg[:], mustDecodeHex(t, aggNonce))
+	session, err := NewSession(ctx, &agg, msg, nil)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	var secNonce SecretNonce
+	copy(secNonce[:], mustDecodeHex(t, secNonceHex))
+	privKey, _ := secp.PrivKeyFromBytes(mustDecodeHex(t, skHex))
+
+	psig, err := session.Sign(&secNonce, privKey)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if !isZero(secNonce[:64]) {
+		t.Fatalf("Secret nonce was not zeroed")
+	}
+
+	return psig
+}
+
+// TestSignVerifyVectors checks partial signing against the BIP327 vectors.
+func TestSignVerifyVectors(t *testing.T) {
+	var vectors struct {
+		SK         string   `json:"sk"`
+		PubKeys    []string `json:"pubkeys"`
+		SecNonces  []string `json:"secnonces"`
+		PNonces    []string `json:"pnonces"`
+		AggNonces  []string `json:"aggnonces"`
+		Msgs       []string `json:"msgs"`
+		ValidCases []struct {
+			KeyIndices    []int  `json:"key_indices"`
+			NonceIndices  []int  `json:"nonce_indices"`
+			AggNonceIndex int    `json:"aggnonce_index"`
+			MsgIndex      int    `json:"msg_index"`
+			SignerIndex   int    `json:"signer_index"`
+			Expected      string `json:"expected"`
+		} `json:"valid_test_cases"`
+	}
+	loadVectors(t, "sign_verify_vectors.json", &vectors)
+
+	for i, tc := range vectors.ValidCases {
+		keys, bad := parseKeys(t, vectors.PubKeys, tc.KeyIndices)
+		if bad >= 0 {
+			t.Fatalf("Case %d: invalid key %d", i, bad)
+		}
+		ctx, err := AggregateKeys(keys)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+
+		msg := mustDecodeHex(t, vectors.Msgs[tc.MsgIndex])
+		psig := signVectorCase(t, ctx, vectors.AggNonces[tc.AggNonceIndex], vectors.SecNonces[0], vectors.SK, msg)
+
+		var got [32]byte
+		psig.PutBytes(&got)
+		if !strings.EqualFold(hex.EncodeToString(got[:]), tc.Expected) {
+			t.Fatalf("Case %d: partial signature mismatch\n got: %x\nwant: %s", i, got, tc.Expected)
+		}
+	}
+}
+
+// TestTweakVectors checks signing with tweaked keys against the BIP327 vectors.
+func TestTweakVectors(t *testing.T) {
+	var vectors struct {
+		SK         string   `json:"sk"`
+		PubKeys    []string `json:"pubkeys"`
+		SecNonce   string   `json:"secnonce"`
+		AggNonce   string   `json:"aggnonce"`
+		Tweaks     []string `json:"tweaks"`
+		Msg        string   `json:"msg"`
+		ValidCases []struct {
+			KeyIndices   []int  `json:"key_indices"`
+			TweakIndices []int  `json:"tweak_indices"`
+			IsXOnly      []bool `json:"is_xonly"`
+			Expected     string `json:"expected"`
+		} `json:"valid_test_cases"`
+	}
+	loadVectors(t, "tweak_vectors.json", &vectors)
+
+	for i, tc := range vectors.ValidCases {
+		keys, bad := parseKeys(t, vectors.PubKeys, tc.KeyIndices)
+		if bad >= 0 {
+			t.Fatalf("Case %d: invalid key %d", i, bad)
+		}
+		ctx, err := AggregateKeys(keys)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+		ctx, err = applyTweaks(t, ctx, vectors.Tweaks, tc.TweakIndices, tc.IsXOnly)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+
+		psig := signVectorCase(t, ctx, vectors.AggNonce, vectors.SecNonce, vectors.SK, mustDecodeHex(t, vectors.Msg))
+
+		var got [32]byte
+		psig.PutBytes(&got)
+		if !strings.EqualFold(hex.EncodeToString(got[:]), tc.Expected) {
+			t.Fatalf("Case %d: partial signature mismatch\n got: %x\nwant: %s", i, got, tc.Expected)
+		}
+	}
+}
+
+// TestSigAggVectors checks partial signature aggregation against the BIP327 vectors.
+func TestSigAggVectors(t *testing.T) {
+	var vectors struct {
+		PubKeys    []string `json:"pubkeys"`
+		Tweaks     []string `json:"tweaks"`
+		PSigs      []string `json:"psigs"`
+		Msg        string   `json:"msg"`
+		ValidCases []struct {
+			AggNonce     string `json:"aggnonce"`
+			KeyIndices   []int  `json:"key_indices"`
+			TweakIndices []int  `json:"tweak_indices"`
+			IsXOnly      []bool `json:"is_xonly"`
+			PSigIndices  []int  `json:"psig_indices"`
+			Expected     string `json:"expected"`
+		} `json:"valid_test_cases"`
+	}
+	loadVectors(t, "sig_agg_vectors.json", &vectors)
+
+	for i, tc := range vectors.ValidCases {
+		keys, bad := parseKeys(t, vectors.PubKeys, tc.KeyIndices)
+		if bad >= 0 {
+			t.Fatalf("Case %d: invalid key %d", i, bad)
+		}
+		ctx, err := AggregateKeys(keys)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+		ctx, err = applyTweaks(t, ctx, vectors.Tweaks, tc.TweakIndices, tc.IsXOnly)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+
+		var aggNonce AggregateNonce
+		copy(aggNonce[:], mustDecodeHex(t, tc.AggNonce))
+		msg := mustDecodeHex(t, vectors.Msg)
+		session, err := NewSession(ctx, &aggNonce, msg, nil)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+
+		psigs := make([]*secp.ModNScalar, len(tc.PSigIndices))
+		for j, idx := range tc.PSigIndices {
+			psigs[j] = new(secp.ModNScalar)
+			psigs[j].SetByteSlice(mustDecodeHex(t, vectors.PSigs[idx]))
+		}
+
+		sig, err := session.Aggregate(psigs)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+		if got := hex.EncodeToString(sig); !strings.EqualFold(got, tc.Expected) {
+			t.Fatalf("Case %d: signature mismatch\n got: %s\nwant: %s", i, got, tc.Expected)
+		}
+
+		pubKey, err := schnorr.ParsePubKey(ctx.XOnlyKey())
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+		parsed, err := schnorr.ParseSignature(sig)
+		if err != nil || !parsed.Verify(msg, pubKey) {
+			t.Fatalf("Case %d: aggregated signature does not verify", i)
+		}
+	}
+}
+
+// twoPartySign runs a full two-party signing round on a taproot tweaked key
+// and returns the session, the partial signatures and the tweaked context.
+func twoPartySign(t *testing.T, adaptorPoint *secp.PublicKey) (*Session, []*secp.ModNScalar, *KeyAggContext) {
+	t.Helper()
+
+	alice, _ := secp.NewPrivateKey()
+	bob, _ := secp.NewPrivateKey()
+
+	ctx, err := AggregateKeys(SortKeys([]*secp.PublicKey{alice.PubKey(), bob.PubKey()}))
+	if err != nil {
+		t.Fatalf("Failed to aggregate keys: %v", err)
+	}
+	ctx, err = ctx.TaprootTweak(nil)
+	if err != nil {
+		t.Fatalf("Failed to tweak key: %v", err)
+	}
+
+	msg := chainhash.HashB([]byte("musig2 adaptor test"))
+
+	aliceSec, alicePub, err := GenerateNonce(alice.PubKey(), WithNonceSecretKey(alice), WithNonceMessage(msg))
+	if err != nil {
+		t.Fatalf("Failed to generate nonce: %v", err)
+	}
+	bobSec, bobPub, err := GenerateNonce(bob.PubKey())
+	if err != nil {
+		t.Fatalf("Failed to generate nonce: %v", err)
+	}
+
+	aggNonce, err := AggregateNonces([]*PublicNonce{alicePub, bobPub})
+	if err != nil {
+		t.Fatalf("Failed to aggregate nonces: %v", err)
+	}
+
+	session, err := NewSession(ctx, aggNonce, msg, adaptorPoint)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	alicePsig, err := session.Sign(aliceSec, alice)
+	if err != nil {
+		t.Fatalf("Alice failed to sign: %v", err)
+	}
+	bobPsig, err := session.Sign(bobSec, bob)
+	if err != nil {
+		t.Fatalf("Bob failed to sign: %v", err)
+	}
+
+	if !session.VerifyPartial(alicePsig, alicePub, alice.PubKey()) {
+		t.Fatalf("Alice's partial signature does not verify")
+	}
+	if session.VerifyPartial(alicePsig, bobPub, bob.PubKey()) {
+		t.Fatalf("Partial signature verified against the wrong signer")
+	}
+
+	if _, err := session.Sign(aliceSec, alice); err == nil {
+		t.Fatalf("Expected error when reusing a secret nonce")
+	}
+
+	return session, []*secp.ModNScalar{alicePsig, bobPsig}, ctx
+}
+
+// TestAdaptorSession runs two-party adaptor signing many times so that every
+// combination of nonce and key parity is exercised.
+func TestAdaptorSession(t *testing.T) {
+	for i := 0; i < 32; i++ {
+		secretKey, _ := secp.NewPrivateKey()
+		secret := &secretKey.Key
+
+		session, psigs, ctx := twoPartySign(t, secretKey.PubKey())
+
+		preSig, err := session.AggregateAdaptor(psigs)
+		if err != nil {
+			t.Fatalf("Run %d: %v", i, err)
+		}
+
+		pubKey, err := schnorr.ParsePubKey(ctx.XOnlyKey())
+		if err != nil {
+			t.Fatalf("Run %d: %v", i, err)
+		}
+
+		// The pre-signature on its own must not be a valid signature
+		if parsed, err := schnorr.ParseSignature(preSig.Complete(new(secp.ModNScalar))); err == nil && parsed.Verify(session.msg, pubKey) {
+			t.Fatalf("Run %d: pre-signature verifies without the secret", i)
+		}
+
+		sig := preSig.Complete(secret)
+		parsed, err := schnorr.ParseSignature(sig)
+		if err != nil || !parsed.Verify(session.msg, pubKey) {
+			t.Fatalf("Run %d: completed signature does not verify", i)
+		}
+
+		extracted, err := preSig.ExtractSecret(sig)
+		if err != nil {
+			t.Fatalf("Run %d: %v", i, err)
+		}
+		if !extracted.Equals(secret) {
+			t.Fatalf("Run %d: extracted secret mismatch", i)
+		}
+	}
+}
+
+// TestPlainSession checks that a session without adaptor produces a valid
+// signature for the tweaked aggregate key.
+func TestPlainSession(t *testing.T) {
+	session, psigs, ctx := twoPartySign(t, nil)
+
+	if _, err := session.AggregateAdaptor(psigs); err == nil {
+		t.Fatalf("Expected error aggregating a plain session as adaptor")
+	}
+
+	sig, err := session.Aggregate(psigs)
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+
+	pubKey, _ := schnorr.ParsePubKey(ctx.XOnlyKey())
+	parsed, err := schnorr.ParseSignature(sig)
+	if err != nil || !parsed.Verify(session.msg, pubKey) {
+		t.Fatalf("Aggregated signature does not verify")
+	}
+}
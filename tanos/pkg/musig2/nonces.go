@@ -0,0 +1,238 @@
+package musig2
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// PublicNonceSize is the size of a serialized public nonce: two
+	// compressed points.
+	PublicNonceSize = 2 * secp.PubKeyBytesLenCompressed
+
+	// SecretNonceSize is the size of a secret nonce: two scalars followed by
+	// the compressed public key of the signer.
+	SecretNonceSize = 2*32 + secp.PubKeyBytesLenCompressed
+)
+
+// PublicNonce is the pair of nonce points R1, R2 a signer shares before signing.
+type PublicNonce [PublicNonceSize]byte
+
+// AggregateNonce is the sum of all signers' public nonces. Either half may
+// encode the point at infinity as 33 zero bytes.
+type AggregateNonce [PublicNonceSize]byte
+
+// SecretNonce holds the nonce scalars k1, k2 of a signer. It must only be
+// used for a single signature; Session.Sign zeroes it after use.
+type SecretNonce [SecretNonceSize]byte
+
+// InvalidContributionError identifies the signer who sent an invalid value.
+type InvalidContributionError struct {
+	Signer       int    // Index of the offending signer
+	Contribution string // "pubkey", "pubnonce" or "psig"
+}
+
+// Error implements the error interface.
+func (e *InvalidContributionError) Error() string {
+	return fmt.Sprintf("invalid %s from signer %d", e.Contribution, e.Signer)
+}
+
+// nonceOptions holds the optional inputs of nonce generation.
+type nonceOptions struct {
+	secretKey    []byte
+	aggregateKey []byte
+	message      []byte
+	extraInput   []byte
+}
+
+// NonceOption adds optional data to nonce generation. None of it is needed
+// for security, but every piece makes nonce reuse less likely should the
+// random number generator fail.
+type NonceOption func(*nonceOptions)
+
+// WithNonceSecretKey mixes the signer's secret key into the nonce.
+func WithNonceSecretKey(privKey *secp.PrivateKey) NonceOption {
+	return func(o *nonceOptions) {
+		o.secretKey = privKey.Serialize()
+	}
+}
+
+// WithNonceAggregateKey mixes the x-only aggregate key into the nonce.
+func WithNonceAggregateKey(xOnlyKey []byte) NonceOption {
+	return func(o *nonceOptions) {
+		o.aggregateKey = xOnlyKey
+	}
+}
+
+// WithNonceMessage mixes the message to be signed into the nonce.
+func WithNonceMessage(msg []byte) NonceOption {
+	return func(o *nonceOptions) {
+		o.message = msg
+	}
+}
+
+// WithNonceExtraInput mixes arbitrary auxiliary data into the nonce.
+func WithNonceExtraInput(extra []byte) NonceOption {
+	return func(o *nonceOptions) {
+		o.extraInput = extra
+	}
+}
+
+// GenerateNonce creates a fresh secret and public nonce for the signer with
+// the given public key, following BIP327 NonceGen.
+func GenerateNonce(pubKey *secp.PublicKey, opts ...NonceOption) (*SecretNonce, *PublicNonce, error) {
+	var randBytes [32]byte
+	if _, err := rand.Read(randBytes[:]); err != nil {
+		return nil, nil, fmt.Errorf("failed to read randomness: %v", err)
+	}
+
+	o := &nonceOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	// The secret key is a copy made by WithNonceSecretKey
+	defer zeroBytes(o.secretKey)
+
+	return nonceGen(randBytes[:], pubKey.SerializeCompressed(), o)
+}
+
+// nonceGen derives the nonce pair from the given randomness and options.
+func nonceGen(randBytes []byte, pubKey []byte, o *nonceOptions) (*SecretNonce, *PublicNonce, error) {
+	if o.secretKey != nil && len(o.secretKey) != 32 {
+		return nil, nil, fmt.Errorf("the secret key must have length 32")
+	}
+	if o.aggregateKey != nil && len(o.aggregateKey) != 32 {
+		return nil, nil, fmt.Errorf("the aggregate key must have length 32")
+	}
+
+	// rand = sk XOR H_aux(rand') when a secret key is provided
+	seed := make([]byte, 32)
+	defer zeroBytes(seed)
+	copy(seed, randBytes)
+	if o.secretKey != nil {
+		aux := chainhash.TaggedHash(tagNonceAux, randBytes)
+		for i := range seed {
+			seed[i] = o.secretKey[i] ^ aux[i]
+		}
+	}
+
+	var msgPrefixed []byte
+	if o.message == nil {
+		msgPrefixed = []byte{0x00}
+	} else {
+		msgPrefixed = make([]byte, 9, 9+len(o.message))
+		msgPrefixed[0] = 0x01
+		binary.BigEndian.PutUint64(msgPrefixed[1:], uint64(len(o.message)))
+		msgPrefixed = append(msgPrefixed, o.message...)
+	}
+
+	var extraLen [4]byte
+	binary.BigEndian.PutUint32(extraLen[:], uint32(len(o.extraInput)))
+
+	var secNonce SecretNonce
+	var pubNonce PublicNonce
+	for i := 0; i < 2; i++ {
+		hash := chainhash.TaggedHash(
+			tagNonce,
+			seed,
+			[]byte{byte(len(pubKey))}, pubKey,
+			[]byte{byte(len(o.aggregateKey))}, o.aggregateKey,
+			msgPrefixed,
+			extraLen[:], o.extraInput,
+			[]byte{byte(i)},
+		)
+
+		var k secp.ModNScalar
+		k.SetBytes((*[32]byte)(hash))
+		if k.IsZero() {
+			return nil, nil, fmt.Errorf("generated nonce is zero")
+		}
+
+		var r secp.JacobianPoint
+		secp.ScalarBaseMultNonConst(&k, &r)
+		r.ToAffine()
+
+		k.PutBytesUnchecked(secNonce[i*32 : (i+1)*32])
+		copy(pubNonce[i*33:(i+1)*33], secp.NewPublicKey(&r.X, &r.Y).SerializeCompressed())
+		k.Zero()
+	}
+	copy(secNonce[64:], pubKey)
+
+	return &secNonce, &pubNonce, nil
+}
+
+// Zero wipes the secret nonce, for a signer that abandons the session.
+func (n *SecretNonce) Zero() {
+	zeroBytes(n[:64])
+}
+
+// zeroBytes overwrites b with zeros.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// parseNoncePoint decodes a compressed nonce point. With allowInfinity, 33
+// zero bytes decode to the point at infinity.
+func parseNoncePoint(b []byte, allowInfinity bool, p *secp.JacobianPoint) error {
+	if allowInfinity && isZero(b) {
+		*p = secp.JacobianPoint{}
+		return nil
+	}
+
+	if len(b) != secp.PubKeyBytesLenCompressed {
+		return fmt.Errorf("invalid nonce point length")
+	}
+
+	pubKey, err := secp.ParsePubKey(b)
+	if err != nil {
+		return err
+	}
+	pubKey.AsJacobian(p)
+
+	return nil
+}
+
+// AggregateNonces sums the public nonces of all signers.
+func AggregateNonces(pubNonces []*PublicNonce) (*AggregateNonce, error) {
+	if len(pubNonces) == 0 {
+		return nil, fmt.Errorf("no public nonces to aggregate")
+	}
+
+	var aggNonce AggregateNonce
+	for j := 0; j < 2; j++ {
+		var sum secp.JacobianPoint
+		for i, pubNonce := range pubNonces {
+			var r, next secp.JacobianPoint
+			if err := parseNoncePoint(pubNonce[j*33:(j+1)*33], false, &r); err != nil {
+				return nil, &InvalidContributionError{Signer: i, Contribution: "pubnonce"}
+			}
+
+			secp.AddNonConst(&sum, &r, &next)
+			sum.Set(&next)
+		}
+
+		if !isInfinity(&sum) {
+			sum.ToAffine()
+			copy(aggNonce[j*33:(j+1)*33], secp.NewPublicKey(&sum.X, &sum.Y).SerializeCompressed())
+		}
+	}
+
+	return &aggNonce, nil
+}
+
+// isZero reports whether every byte of b is zero.
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+
+	return true
+}
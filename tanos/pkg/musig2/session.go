@@ -0,0 +1,310 @@
+package musig2
+
+import (
+	"bytes"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Session holds the values shared by all signers when signing one message
+// with an aggregate nonce. When created with an adaptor point T, the final
+// nonce is R = R1 + b*R2 + T and the aggregated result is a pre-signature
+// that needs the discrete logarithm of T to become a valid signature.
+type Session struct {
+	keyCtx   *KeyAggContext
+	aggNonce AggregateNonce
+	msg      []byte
+	adaptor  *secp.PublicKey
+
+	b secp.ModNScalar    // Nonce coefficient
+	r secp.JacobianPoint // Final nonce, in affine coordinates
+	e secp.ModNScalar    // BIP340 challenge
+}
+
+// NewSession creates a signing session for msg. adaptorPoint may be nil for a
+// plain MuSig2 signature.
+func NewSession(keyCtx *KeyAggContext, aggNonce *AggregateNonce, msg []byte, adaptorPoint *secp.PublicKey) (*Session, error) {
+	s := &Session{
+		keyCtx:   keyCtx,
+		aggNonce: *aggNonce,
+		msg:      msg,
+		adaptor:  adaptorPoint,
+	}
+
+	// b = H_noncecoef(aggnonce || xonly(Q) || m)
+	bHash := chainhash.TaggedHash(tagNonceCoef, aggNonce[:], keyCtx.XOnlyKey(), msg)
+	s.b.SetBytes((*[32]byte)(bHash))
+
+	var r1, r2, br2, r secp.JacobianPoint
+	if err := parseNoncePoint(aggNonce[:33], true, &r1); err != nil {
+		return nil, fmt.Errorf("invalid aggregate nonce: %v", err)
+	}
+	if err := parseNoncePoint(aggNonce[33:], true, &r2); err != nil {
+		return nil, fmt.Errorf("invalid aggregate nonce: %v", err)
+	}
+
+	// R = R1 + b*R2 (+ T), falling back to G if the sum is infinity
+	secp.ScalarMultNonConst(&s.b, &r2, &br2)
+	secp.AddNonConst(&r1, &br2, &r)
+	if adaptorPoint != nil {
+		var t, sum secp.JacobianPoint
+		adaptorPoint.AsJacobian(&t)
+		secp.AddNonConst(&r, &t, &sum)
+		r.Set(&sum)
+	}
+	if isInfinity(&r) {
+		var one secp.ModNScalar
+		one.SetInt(1)
+		secp.ScalarBaseMultNonConst(&one, &r)
+	}
+	r.ToAffine()
+	s.r.Set(&r)
+
+	// e = H_challenge(xonly(R) || xonly(Q) || m)
+	eHash := chainhash.TaggedHash(chainhash.TagBIP0340Challenge, fieldBytes(&s.r.X), keyCtx.XOnlyKey(), msg)
+	s.e.SetBytes((*[32]byte)(eHash))
+
+	return s, nil
+}
+
+// Sign creates the partial signature of the signer owning privKey. The
+// secret nonce is zeroed so that it can never be used twice.
+func (s *Session) Sign(secNonce *SecretNonce, privKey *secp.PrivateKey) (*secp.ModNScalar, error) {
+	var k1, k2 secp.ModNScalar
+	overflow1 := k1.SetByteSlice(secNonce[:32])
+	overflow2 := k2.SetByteSlice(secNonce[32:64])
+	noncePubKey := make([]byte, secp.PubKeyBytesLenCompressed)
+	copy(noncePubKey, secNonce[64:])
+
+	// Prevent nonce reuse before anything else can fail
+	secNonce.Zero()
+
+	if overflow1 || k1.IsZero() {
+		return nil, fmt.Errorf("first secnonce value is out of range")
+	}
+	if overflow2 || k2.IsZero() {
+		return nil, fmt.Errorf("second secnonce value is out of range")
+	}
+
+	var r1, r2 secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(&k1, &r1)
+	secp.ScalarBaseMultNonConst(&k2, &r2)
+	r1.ToAffine()
+	r2.ToAffine()
+	var pubNonce PublicNonce
+	copy(pubNonce[:33], secp.NewPublicKey(&r1.X, &r1.Y).SerializeCompressed())
+	copy(pubNonce[33:], secp.NewPublicKey(&r2.X, &r2.Y).SerializeCompressed())
+
+	if s.r.Y.IsOdd() {
+		k1.Negate()
+		k2.Negate()
+	}
+
+	pubKey := privKey.PubKey()
+	pk := pubKey.SerializeCompressed()
+	if !bytes.Equal(pk, noncePubKey) {
+		return nil, fmt.Errorf("public key does not match the nonce")
+	}
+	if !s.keyCtx.hasKey(pk) {
+		return nil, fmt.Errorf("the signer's pubkey must be included in the list of pubkeys")
+	}
+
+	// d = g * gacc * d'
+	var d secp.ModNScalar
+	d.Set(&privKey.Key)
+	if s.keyCtx.q.Y.IsOdd() {
+		d.Negate()
+	}
+	d.Mul(&s.keyCtx.gacc)
+
+	// s = k1 + b*k2 + e*a*d
+	a := s.keyCtx.coefficient(pk)
+	psig := new(secp.ModNScalar)
+	psig.Mul2(&s.e, a).Mul(&d)
+	psig.Add(k2.Mul(&s.b)).Add(&k1)
+
+	k1.Zero()
+	k2.Zero()
+	d.Zero()
+
+	// Sanity check that the partial signature verifies
+	if !s.VerifyPartial(psig, &pubNonce, pubKey) {
+		return nil, fmt.Errorf("partial signature failed verification")
+	}
+
+	return psig, nil
+}
+
+// VerifyPartial checks a signer's partial signature against its public nonce
+// and public key.
+func (s *Session) VerifyPartial(psig *secp.ModNScalar, pubNonce *PublicNonce, pubKey *secp.PublicKey) bool {
+	pk := pubKey.SerializeCompressed()
+	if !s.keyCtx.hasKey(pk) {
+		return false
+	}
+
+	var r1, r2, br2, re secp.JacobianPoint
+	if err := parseNoncePoint(pubNonce[:33], false, &r1); err != nil {
+		return false
+	}
+	if err := parseNoncePoint(pubNonce[33:], false, &r2); err != nil {
+		return false
+	}
+
+	// Re = R1 + b*R2, negated if the final nonce has an odd Y
+	secp.ScalarMultNonConst(&s.b, &r2, &br2)
+	secp.AddNonConst(&r1, &br2, &re)
+	if s.r.Y.IsOdd() {
+		re.ToAffine()
+		re.Y.Negate(1).Normalize()
+	}
+
+	// g' = g * gacc
+	var g secp.ModNScalar
+	g.Set(&s.keyCtx.gacc)
+	if s.keyCtx.q.Y.IsOdd() {
+		g.Negate()
+	}
+
+	// s*G == Re + (e*a*g')*P
+	var eag secp.ModNScalar
+	eag.Mul2(&s.e, s.keyCtx.coefficient(pk)).Mul(&g)
+
+	var p, eap, rhs, lhs secp.JacobianPoint
+	pubKey.AsJacobian(&p)
+	secp.ScalarMultNonConst(&eag, &p, &eap)
+	secp.AddNonConst(&re, &eap, &rhs)
+	secp.ScalarBaseMultNonConst(psig, &lhs)
+
+	lhs.ToAffine()
+	rhs.ToAffine()
+
+	return lhs.X.Equals(&rhs.X) && lhs.Y.Equals(&rhs.Y)
+}
+
+// aggregateS sums the partial signatures and the accumulated tweak term.
+func (s *Session) aggregateS(psigs []*secp.ModNScalar) *secp.ModNScalar {
+	sum := new(secp.ModNScalar)
+	for _, psig := range psigs {
+		sum.Add(psig)
+	}
+
+	// s += e * g * tacc
+	var etg secp.ModNScalar
+	etg.Mul2(&s.e, &s.keyCtx.tacc)
+	if s.keyCtx.q.Y.IsOdd() {
+		etg.Negate()
+	}
+
+	return sum.Add(&etg)
+}
+
+// Aggregate combines the partial signatures of a plain session into a BIP340
+// signature valid for the (tweaked) aggregate key.
+func (s *Session) Aggregate(psigs []*secp.ModNScalar) ([]byte, error) {
+	if s.adaptor != nil {
+		return nil, fmt.Errorf("adaptor sessions produce a pre-signature, use AggregateAdaptor")
+	}
+
+	return serializeSignature(&s.r, s.aggregateS(psigs)), nil
+}
+
+// AggregateAdaptor combines the partial signatures of an adaptor session into
+// a pre-signature.
+func (s *Session) AggregateAdaptor(psigs []*secp.ModNScalar) (*PreSignature, error) {
+	if s.adaptor == nil {
+		return nil, fmt.Errorf("session has no adaptor point, use Aggregate")
+	}
+
+	var nonce secp.JacobianPoint
+	nonce.Set(&s.r)
+
+	return &PreSignature{
+		NoncePoint:   secp.NewPublicKey(&nonce.X, &nonce.Y),
+		S:            s.aggregateS(psigs),
+		AdaptorPoint: s.adaptor,
+	}, nil
+}
+
+// PreSignature is an aggregated MuSig2 signature whose nonce includes an
+// adaptor point T. Adding t = log(T) yields a valid BIP340 signature, and
+// anyone holding the pre-signature can extract t from that signature.
+type PreSignature struct {
+	NoncePoint   *secp.PublicKey  // R = R1 + b*R2 + T
+	S            *secp.ModNScalar // Aggregated s, missing the adaptor secret
+	AdaptorPoint *secp.PublicKey  // T
+}
+
+// Complete adds the adaptor secret and returns the final 64-byte signature.
+// The secret is negated when R has an odd Y, mirroring the signers' nonces.
+func (p *PreSignature) Complete(secret *secp.ModNScalar) []byte {
+	var t secp.ModNScalar
+	t.Set(secret)
+	if p.NoncePoint.Y().Bit(0) == 1 {
+		t.Negate()
+	}
+
+	var sFinal secp.ModNScalar
+	sFinal.Add2(p.S, &t)
+	t.Zero()
+
+	var r secp.JacobianPoint
+	p.NoncePoint.AsJacobian(&r)
+
+	return serializeSignature(&r, &sFinal)
+}
+
+// ExtractSecret recovers the adaptor secret from the final signature that
+// completed this pre-signature.
+func (p *PreSignature) ExtractSecret(sig []byte) (*secp.ModNScalar, error) {
+	if len(sig) != 64 {
+		return nil, fmt.Errorf("signature must be 64 bytes, got %d", len(sig))
+	}
+
+	var r secp.JacobianPoint
+	p.NoncePoint.AsJacobian(&r)
+	if !bytes.Equal(sig[:32], fieldBytes(&r.X)) {
+		return nil, fmt.Errorf("signature nonce does not match the pre-signature")
+	}
+
+	var sFinal secp.ModNScalar
+	if overflow := sFinal.SetByteSlice(sig[32:]); overflow {
+		return nil, fmt.Errorf("signature scalar overflow")
+	}
+
+	// t = s' - s, negated back when R has an odd Y
+	negS := new(secp.ModNScalar).Set(p.S)
+	t := new(secp.ModNScalar).Add2(&sFinal, negS.Negate())
+	if r.Y.IsOdd() {
+		t.Negate()
+	}
+
+	// Make sure the secret really belongs to the adaptor point
+	var tG secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(t, &tG)
+	tG.ToAffine()
+	var adaptor secp.JacobianPoint
+	p.AdaptorPoint.AsJacobian(&adaptor)
+	if !tG.X.Equals(&adaptor.X) || !tG.Y.Equals(&adaptor.Y) {
+		return nil, fmt.Errorf("extracted secret does not match the adaptor point")
+	}
+
+	return t, nil
+}
+
+// serializeSignature encodes a BIP340 signature xonly(R) || s.
+func serializeSignature(r *secp.JacobianPoint, s *secp.ModNScalar) []byte {
+	sig := make([]byte, 64)
+	copy(sig, fieldBytes(&r.X))
+	s.PutBytesUnchecked(sig[32:])
+	return sig
+}
+
+// fieldBytes returns the 32-byte big endian encoding of a normalized field value.
+func fieldBytes(f *secp.FieldVal) []byte {
+	var b [32]byte
+	f.PutBytes(&b)
+	return b[:]
+}
@@ -0,0 +1,412 @@
+package negotiation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/wire"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+	"tanos/pkg/nostr"
+	"tanos/pkg/tanos"
+)
+
+// CancelError is returned when the peer cancelled the swap.
+type CancelError struct {
+	SwapID string
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *CancelError) Error() string {
+	return fmt.Sprintf("swap %s cancelled by peer: %s", e.SwapID, e.Reason)
+}
+
+// messageSigner signs and encrypts negotiation messages.
+type messageSigner interface {
+	nostr.EventSigner
+	nostr.Encrypter
+}
+
+// Client sends and receives negotiation messages for one Nostr identity.
+type Client struct {
+	relay  Relay
+	signer messageSigner
+	pubKey string
+	since  nostrlib.Timestamp // Messages older than the client are ignored
+
+	// PollInterval is how often Sell checks the locking transaction for
+	// confirmations.
+	PollInterval time.Duration
+}
+
+// NewClient creates a client for the Nostr key held by signer, talking
+// through relay. Messages are signed and NIP-44 encrypted by the signer, so
+// it must also be a nostr.Encrypter, as nostr.LocalSigner and
+// nip46.BunkerSigner are. The client never sees the private key.
+func NewClient(relay Relay, signer nostr.EventSigner) (*Client, error) {
+	if signer == nil || signer.PubKey() == nil {
+		return nil, fmt.Errorf("client needs a signer")
+	}
+	msgSigner, ok := signer.(messageSigner)
+	if !ok {
+		return nil, fmt.Errorf("signer cannot encrypt messages")
+	}
+
+	return &Client{
+		relay:  relay,
+		signer: msgSigner,
+		pubKey: crypto.HexEncode(schnorr.SerializePubKey(signer.PubKey())),
+		since:  nostrlib.Timestamp(time.Now().Unix()),
+
+		PollInterval: bitcoin.DefaultPollInterval,
+	}, nil
+}
+
+// PublicKey returns the client's Nostr public key in hex.
+func (c *Client) PublicKey() string {
+	return c.pubKey
+}
+
+// Send encrypts a message for the recipient and publishes it.
+func (c *Client) Send(ctx context.Context, recipient string, msg *Message) error {
+	msg.Version = ProtocolVersion
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	ev, err := seal(c.signer, recipient, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := c.relay.Publish(ctx, ev); err != nil {
+		return fmt.Errorf("failed to publish %s message: %v", msg.Type, err)
+	}
+
+	return nil
+}
+
+// Cancel tells the peer that the swap is abandoned.
+func (c *Client) Cancel(ctx context.Context, peer, swapID, reason string) error {
+	return c.Send(ctx, peer, &Message{Type: TypeCancel, SwapID: swapID, Reason: reason})
+}
+
+// session receives the messages of one swap from one peer.
+type session struct {
+	client  *Client
+	peer    string
+	swapID  string // Empty until the offer is known
+	events  <-chan *nostrlib.Event
+	pending []*Message // Received ahead of the step waiting for them
+	cancel  context.CancelFunc
+}
+
+// listen subscribes to the messages the peer sends to the client.
+func (c *Client) listen(ctx context.Context, peer, swapID string) (*session, error) {
+	subCtx, cancel := context.WithCancel(ctx)
+
+	events, err := c.relay.Subscribe(subCtx, nostrlib.Filters{{
+		Kinds:   []int{KindSwapMessage},
+		Authors: []string{peer},
+		Tags:    nostrlib.TagMap{"p": []string{c.pubKey}},
+		Since:   &c.since,
+	}})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to subscribe: %v", err)
+	}
+
+	return &session{
+		client: c,
+		peer:   peer,
+		swapID: swapID,
+		events: events,
+		cancel: cancel,
+	}, nil
+}
+
+// await returns the next message of the given type for the swap. A cancel
+// message from the peer ends the wait with a CancelError. Relays may deliver
+// events out of order, so messages for later steps are kept for later.
+func (s *session) await(ctx context.Context, typ MessageType) (*Message, error) {
+	for {
+		for i, msg := range s.pending {
+			if msg.Type == typ || msg.Type == TypeCancel {
+				s.pending = append(s.pending[:i], s.pending[i+1:]...)
+				return s.deliver(msg)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case ev, ok := <-s.events:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, fmt.Errorf("relay subscription closed")
+			}
+
+			msg, err := open(s.client.signer, ev)
+			if err != nil {
+				// Not a message we can read, it cannot be for us
+				continue
+			}
+
+			// Until the swap is known, only an offer can start it
+			if s.swapID == "" && msg.Type != TypeOffer {
+				continue
+			}
+			if s.swapID != "" && msg.SwapID != s.swapID {
+				continue
+			}
+
+			s.pending = append(s.pending, msg)
+		}
+	}
+}
+
+// deliver returns the awaited message, or a CancelError for a cancel.
+func (s *session) deliver(msg *Message) (*Message, error) {
+	if msg.Type == TypeCancel {
+		return nil, &CancelError{SwapID: msg.SwapID, Reason: msg.Reason}
+	}
+	if s.swapID == "" {
+		s.swapID = msg.SwapID
+	}
+
+	return msg, nil
+}
+
+// close ends the subscription.
+func (s *session) close() {
+	s.cancel()
+}
+
+// abort cancels the swap with the peer because of err, and returns err.
+func (s *session) abort(ctx context.Context, err error) error {
+	// Nothing to tell a peer who cancelled, or that cannot be reached
+	var cancelled *CancelError
+	if errors.As(err, &cancelled) || ctx.Err() != nil || s.swapID == "" {
+		return err
+	}
+
+	if cancelErr := s.client.Cancel(ctx, s.peer, s.swapID, err.Error()); cancelErr != nil {
+		return fmt.Errorf("%v (and failed to notify peer: %v)", err, cancelErr)
+	}
+
+	return err
+}
+
+// SaleTerms are what the seller requires of the buyer's funding and how it
+// claims the locked funds.
+type SaleTerms struct {
+	Amount        int64           // Minimum value of the lock output, in satoshis
+	Confirmations int32           // Confirmations the locking transaction needs, at least 1
+	DestScript    []byte          // Script the claim pays to
+	FeeRate       bitcoin.FeeRate // Fee rate of the claim transaction
+}
+
+// Sell offers the seller swap to the buyer and drives it until the claim is
+// broadcast through backend, which reveals the Nostr signature to the buyer.
+// The claim is only signed once backend shows the lock output unspent and
+// confirmed, paying the swap output at least the amount of terms. The claim
+// transaction is returned, along with the error if broadcasting it failed.
+// The swap must be a new seller swap; hooks attached to it can veto a step,
+// which cancels the swap with the buyer.
+func (c *Client) Sell(ctx context.Context, swap *tanos.Swap, buyer string, backend bitcoin.ChainBackend, terms SaleTerms) (*wire.MsgTx, error) {
+	if swap.Role != tanos.RoleSeller || swap.Phase != tanos.PhaseOffered {
+		return nil, fmt.Errorf("can only sell a seller swap in phase %s", tanos.PhaseOffered)
+	}
+
+	s, err := c.listen(ctx, buyer, swap.Offer.EventID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+
+	offer := swap.Offer
+	if err := c.Send(ctx, buyer, &Message{Type: TypeOffer, SwapID: swap.Offer.EventID, Offer: &offer}); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.await(ctx, TypeAccept); err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	if err := swap.Commit(); err != nil {
+		return nil, s.abort(ctx, err)
+	}
+
+	msg, err := s.await(ctx, TypeFundingProof)
+	if err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	if err := swap.ObserveFunding(msg.Funding); err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	buyerNonce, err := msg.claimNonce()
+	if err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	if err := c.awaitFunding(ctx, swap, backend, terms); err != nil {
+		return nil, s.abort(ctx, err)
+	}
+
+	if _, err := swap.ClaimNonce(); err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	proposal, err := swap.ProposeClaim(terms.DestScript, terms.FeeRate, buyerNonce)
+	if err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	if err := c.Send(ctx, buyer, &Message{Type: TypeClaimSig, SwapID: swap.Offer.EventID, Claim: proposal}); err != nil {
+		return nil, err
+	}
+
+	msg, err = s.await(ctx, TypeAdaptorSig)
+	if err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	partial, err := msg.partial()
+	if err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	if err := swap.AcceptAdaptor(partial); err != nil {
+		return nil, s.abort(ctx, err)
+	}
+
+	claimTx, err := swap.CompleteClaim()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := backend.Broadcast(ctx, claimTx); err != nil {
+		return claimTx, fmt.Errorf("failed to broadcast claim: %v", err)
+	}
+
+	return claimTx, nil
+}
+
+// awaitFunding polls backend until the swap's funding is verified with the
+// confirmations of terms.
+func (c *Client) awaitFunding(ctx context.Context, swap *tanos.Swap, backend bitcoin.ChainBackend, terms SaleTerms) error {
+	confirmations := terms.Confirmations
+	if confirmations < 1 {
+		confirmations = 1
+	}
+
+	ticker := time.NewTicker(c.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := swap.VerifyFunding(ctx, backend, terms.Amount, confirmations)
+		if !errors.Is(err, tanos.ErrFundingUnconfirmed) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Buy waits for an offer from the seller and drives the buyer side of the
+// swap: it broadcasts the locking transaction through backend, signs the
+// seller's claim and waits for the claim on chain, which reveals the Nostr
+// signature. Once the locking transaction is broadcast the swap is returned
+// even with an error, so that the caller can refund it.
+//
+// accept, which may be nil, is called with the new swap before committing
+// to it: it can inspect the offer, attach hooks or persistence, and decline
+// the offer by returning an error. fund creates the locking transaction for
+// the offer, as for Swap.Fund.
+func (c *Client) Buy(
+	ctx context.Context,
+	buyer *tanos.SwapBuyer,
+	seller string,
+	backend bitcoin.ChainBackend,
+	accept func(swap *tanos.Swap) error,
+	fund func(buyer *tanos.SwapBuyer, offer *tanos.Offer) error,
+) (*tanos.Swap, error) {
+	s, err := c.listen(ctx, seller, "")
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+
+	msg, err := s.await(ctx, TypeOffer)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Offer.NostrPubKey != seller {
+		return nil, s.abort(ctx, fmt.Errorf("offer is for the key %s, not the seller's", msg.Offer.NostrPubKey))
+	}
+
+	swap, err := tanos.NewBuyerSwap(buyer, *msg.Offer)
+	if err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	if accept != nil {
+		if err := accept(swap); err != nil {
+			return nil, s.abort(ctx, fmt.Errorf("offer declined: %v", err))
+		}
+	}
+
+	if err := swap.Commit(); err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	if err := c.Send(ctx, seller, &Message{Type: TypeAccept, SwapID: swap.Offer.EventID}); err != nil {
+		return nil, err
+	}
+
+	if err := swap.Fund(fund); err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	notice, err := swap.FundingNotice()
+	if err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	nonce, err := swap.ClaimNonce()
+	if err != nil {
+		return nil, s.abort(ctx, err)
+	}
+	heightHint, err := backend.GetTipHeight(ctx)
+	if err != nil {
+		return nil, s.abort(ctx, fmt.Errorf("failed to get tip height: %v", err))
+	}
+	if _, err := backend.Broadcast(ctx, swap.LockingTx); err != nil {
+		return nil, s.abort(ctx, fmt.Errorf("failed to broadcast locking transaction: %v", err))
+	}
+	funding := &Message{Type: TypeFundingProof, SwapID: swap.Offer.EventID, Funding: notice, Nonce: crypto.HexEncode(nonce[:])}
+	if err := c.Send(ctx, seller, funding); err != nil {
+		return swap, err
+	}
+
+	msg, err = s.await(ctx, TypeClaimSig)
+	if err != nil {
+		return swap, s.abort(ctx, err)
+	}
+	partial, err := swap.SignClaim(msg.Claim)
+	if err != nil {
+		return swap, s.abort(ctx, err)
+	}
+	signed := &Message{Type: TypeAdaptorSig, SwapID: swap.Offer.EventID, Partial: crypto.HexEncode(crypto.SerializeModNScalar(partial))}
+	if err := c.Send(ctx, seller, signed); err != nil {
+		return swap, err
+	}
+
+	if _, err := swap.WatchClaim(ctx, backend, heightHint); err != nil {
+		return swap, err
+	}
+
+	return swap, nil
+}
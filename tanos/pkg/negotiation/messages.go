@@ -0,0 +1,179 @@
+// Package negotiation carries the TANOS swap protocol over Nostr relays.
+// The buyer and the seller exchange NIP-44 encrypted events, addressed to
+// each other with a "p" tag, that move a tanos.Swap from offer to claim.
+package negotiation
+
+import (
+	"encoding/json"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/crypto"
+	"tanos/pkg/musig2"
+	"tanos/pkg/nostr"
+	"tanos/pkg/tanos"
+)
+
+// KindSwapMessage is the event kind of TANOS negotiation messages. It is a
+// regular kind, so relays store messages sent before the peer subscribed.
+const KindSwapMessage = 4333
+
+// ProtocolVersion is the version of the negotiation messages.
+const ProtocolVersion = 1
+
+// MessageType identifies a step of the negotiation.
+type MessageType string
+
+const (
+	// TypeOffer is sent by the seller with the offer for its event.
+	TypeOffer MessageType = "offer"
+	// TypeAccept is sent by the buyer to take the offer.
+	TypeAccept MessageType = "accept"
+	// TypeFundingProof is sent by the buyer once the swap is funded, with
+	// its MuSig2 nonce for the claim.
+	TypeFundingProof MessageType = "funding-proof"
+	// TypeClaimSig is sent by the seller with its claim proposal.
+	TypeClaimSig MessageType = "claim-sig"
+	// TypeAdaptorSig is sent by the buyer with its partial signature of the
+	// claim, which completes the adaptor pre-signature.
+	TypeAdaptorSig MessageType = "adaptor-sig"
+	// TypeCancel is sent by either side to abandon the swap.
+	TypeCancel MessageType = "cancel"
+)
+
+// Message is the encrypted payload of a negotiation event. Only the fields
+// matching its type are set. The Nostr signature being sold never travels
+// in a message: the buyer learns it from the claim published on chain.
+type Message struct {
+	Version int                  `json:"version"`
+	Type    MessageType          `json:"type"`
+	SwapID  string               `json:"swap_id"`
+	Offer   *tanos.Offer         `json:"offer,omitempty"`
+	Funding *tanos.FundingNotice `json:"funding,omitempty"`
+	Nonce   string               `json:"nonce,omitempty"` // Buyer's claim nonce in hex
+	Claim   *tanos.ClaimProposal `json:"claim,omitempty"`
+	Partial string               `json:"partial,omitempty"` // Buyer's partial claim signature in hex
+	Reason  string               `json:"reason,omitempty"`  // Why the swap was cancelled
+}
+
+// validate checks that the message carries what its type requires.
+func (m *Message) validate() error {
+	if m.Version != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", m.Version)
+	}
+	if m.SwapID == "" {
+		return fmt.Errorf("message has no swap ID")
+	}
+
+	switch m.Type {
+	case TypeOffer:
+		if m.Offer == nil || m.Offer.EventID != m.SwapID {
+			return fmt.Errorf("offer message without a matching offer")
+		}
+	case TypeFundingProof:
+		if m.Funding == nil || m.Funding.EventID != m.SwapID {
+			return fmt.Errorf("funding-proof message without a matching funding notice")
+		}
+		if _, err := m.claimNonce(); err != nil {
+			return fmt.Errorf("funding-proof message without a claim nonce: %v", err)
+		}
+	case TypeClaimSig:
+		if m.Claim == nil {
+			return fmt.Errorf("claim-sig message without a claim proposal")
+		}
+	case TypeAdaptorSig:
+		if _, err := m.partial(); err != nil {
+			return fmt.Errorf("adaptor-sig message without a partial signature: %v", err)
+		}
+	case TypeAccept, TypeCancel:
+	default:
+		return fmt.Errorf("unknown message type %q", m.Type)
+	}
+
+	return nil
+}
+
+// claimNonce decodes the buyer's claim nonce.
+func (m *Message) claimNonce() (*musig2.PublicNonce, error) {
+	b, err := crypto.DecodeHexStrict(m.Nonce, musig2.PublicNonceSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce musig2.PublicNonce
+	copy(nonce[:], b)
+
+	return &nonce, nil
+}
+
+// partial decodes the buyer's partial signature of the claim.
+func (m *Message) partial() (*secp.ModNScalar, error) {
+	b, err := crypto.DecodeHexStrict(m.Partial, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	partial := new(secp.ModNScalar)
+	if overflow := partial.SetByteSlice(b); overflow {
+		return nil, fmt.Errorf("partial signature overflows the group order")
+	}
+
+	return partial, nil
+}
+
+// seal encrypts the message for the recipient and wraps it in an event
+// signed by signer.
+func seal(signer messageSigner, recipient string, msg *Message) (nostrlib.Event, error) {
+	plaintext, err := json.Marshal(msg)
+	if err != nil {
+		return nostrlib.Event{}, fmt.Errorf("failed to encode %s message: %v", msg.Type, err)
+	}
+
+	content, err := signer.Encrypt(recipient, string(plaintext))
+	if err != nil {
+		return nostrlib.Event{}, fmt.Errorf("failed to encrypt %s message: %v", msg.Type, err)
+	}
+
+	pending, err := nostr.PrepareEvent(signer, nostr.EventTemplate{
+		Kind:    KindSwapMessage,
+		Tags:    nostrlib.Tags{{"p", recipient}},
+		Content: content,
+	})
+	if err != nil {
+		return nostrlib.Event{}, fmt.Errorf("failed to sign %s message: %v", msg.Type, err)
+	}
+	ev, err := pending.Sign()
+	if err != nil {
+		return nostrlib.Event{}, fmt.Errorf("failed to sign %s message: %v", msg.Type, err)
+	}
+
+	return ev, nil
+}
+
+// open checks a negotiation event addressed to the holder of the key of
+// dec and decrypts it.
+func open(dec nostr.Encrypter, ev *nostrlib.Event) (*Message, error) {
+	if ev.Kind != KindSwapMessage {
+		return nil, fmt.Errorf("unexpected event kind %d", ev.Kind)
+	}
+	if ok, err := ev.CheckSignature(); !ok {
+		return nil, fmt.Errorf("invalid event signature: %v", err)
+	}
+
+	plaintext, err := dec.Decrypt(ev.PubKey, ev.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt message: %v", err)
+	}
+
+	var msg Message
+	if err := json.Unmarshal([]byte(plaintext), &msg); err != nil {
+		return nil, fmt.Errorf("failed to decode message: %v", err)
+	}
+	if err := msg.validate(); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
@@ -0,0 +1,323 @@
+package negotiation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+	"tanos/pkg/nostr"
+	"tanos/pkg/tanos"
+)
+
+// memRelay is an in-process relay stand-in that stores every event and
+// forwards it to matching subscriptions.
+type memRelay struct {
+	mu     sync.Mutex
+	events []*nostrlib.Event
+	subs   map[*memSub]struct{}
+}
+
+type memSub struct {
+	filters nostrlib.Filters
+	ch      chan *nostrlib.Event
+}
+
+func newMemRelay() *memRelay {
+	return &memRelay{subs: make(map[*memSub]struct{})}
+}
+
+func (r *memRelay) Publish(_ context.Context, event nostrlib.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ev := event
+	r.events = append(r.events, &ev)
+	for sub := range r.subs {
+		if sub.filters.Match(&ev) {
+			sub.ch <- &ev
+		}
+	}
+
+	return nil
+}
+
+func (r *memRelay) Subscribe(ctx context.Context, filters nostrlib.Filters) (<-chan *nostrlib.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub := &memSub{filters: filters, ch: make(chan *nostrlib.Event, 64)}
+	for _, ev := range r.events {
+		if filters.Match(ev) {
+			sub.ch <- ev
+		}
+	}
+	r.subs[sub] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		delete(r.subs, sub)
+		close(sub.ch)
+		r.mu.Unlock()
+	}()
+
+	return sub.ch, nil
+}
+
+// fundOn returns a funding function that pays a coin on chain into the
+// offer's MuSig2 lock output.
+func fundOn(chain *bitcoin.SimChain, buyer *tanos.SwapBuyer) (func(*tanos.SwapBuyer, *tanos.Offer) error, []byte, error) {
+	params := &chaincfg.RegressionNetParams
+	_, prevScript, err := bitcoin.CreateP2TRAddress(buyer.PublicKey, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	prevTx := chain.Fund(prevScript, 110000)
+
+	return func(b *tanos.SwapBuyer, offer *tanos.Offer) error {
+		err := b.CreateMuSig2LockingTransaction(
+			100000, prevTx.TxHash().String(), 0, 110000, prevScript,
+			offer.ClaimKey, bitcoin.RelativeBlocks(144), params,
+		)
+		if err != nil {
+			return err
+		}
+		return b.SignLockingTransaction()
+	}, prevScript, nil
+}
+
+// mine mines a block every few milliseconds until ctx is done.
+func mine(ctx context.Context, chain *bitcoin.SimChain) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			chain.Mine(1)
+		}
+	}
+}
+
+// newSigner returns a local signer for a fresh Nostr key.
+func newSigner(t *testing.T) *nostr.LocalSigner {
+	t.Helper()
+
+	key, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return nostr.NewLocalSigner(key)
+}
+
+// newParties creates a seller with a signed event and a buyer, each with a
+// negotiation client on the relay.
+func newParties(t *testing.T, relay Relay) (*tanos.Swap, *Client, *tanos.SwapBuyer, *Client) {
+	sellerSigner := newSigner(t)
+	seller, err := tanos.NewSeller(sellerSigner)
+	if err != nil {
+		t.Fatalf("Failed to create seller: %v", err)
+	}
+	if err := seller.CreateEvent("negotiated over a relay"); err != nil {
+		t.Fatalf("Failed to create event: %v", err)
+	}
+	sellerSwap, err := tanos.NewSellerSwap(seller)
+	if err != nil {
+		t.Fatalf("Failed to create seller swap: %v", err)
+	}
+	sellerClient, err := NewClient(relay, sellerSigner)
+	if err != nil {
+		t.Fatalf("Failed to create seller client: %v", err)
+	}
+	sellerClient.PollInterval = 10 * time.Millisecond
+
+	buyerKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate buyer key: %v", err)
+	}
+	buyer, err := tanos.NewBuyer(buyerKey)
+	if err != nil {
+		t.Fatalf("Failed to create buyer: %v", err)
+	}
+	buyerClient, err := NewClient(relay, newSigner(t))
+	if err != nil {
+		t.Fatalf("Failed to create buyer client: %v", err)
+	}
+
+	return sellerSwap, sellerClient, buyer, buyerClient
+}
+
+// TestSwapOverRelay runs a complete swap between two clients and checks
+// that nothing readable went through the relay.
+func TestSwapOverRelay(t *testing.T) {
+	relay := newMemRelay()
+	sellerSwap, sellerClient, buyer, buyerClient := newParties(t, relay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chain := bitcoin.NewSimChain()
+	go mine(ctx, chain)
+	fund, destScript, err := fundOn(chain, buyer)
+	if err != nil {
+		t.Fatalf("Failed to fund buyer: %v", err)
+	}
+
+	type sold struct {
+		claimTx *wire.MsgTx
+		err     error
+	}
+	sellDone := make(chan sold, 1)
+	go func() {
+		terms := SaleTerms{Amount: 100000, Confirmations: 2, DestScript: destScript, FeeRate: bitcoin.FeeRatePerVByte(5)}
+		claimTx, err := sellerClient.Sell(ctx, sellerSwap, buyerClient.PublicKey(), chain, terms)
+		sellDone <- sold{claimTx, err}
+	}()
+
+	buyerSwap, err := buyerClient.Buy(ctx, buyer, sellerClient.PublicKey(), chain, nil, fund)
+	if err != nil {
+		t.Fatalf("Buyer failed: %v", err)
+	}
+	res := <-sellDone
+	if res.err != nil {
+		t.Fatalf("Seller failed: %v", res.err)
+	}
+	if buyerSwap.Phase != tanos.PhaseClaimed || sellerSwap.Phase != tanos.PhaseClaimed {
+		t.Fatalf("Swaps ended in phases %s and %s", buyerSwap.Phase, sellerSwap.Phase)
+	}
+
+	// The buyer learned the signature from the claim on chain
+	if buyerSwap.NostrSig != sellerSwap.Seller.Event.Sig || buyerSwap.ClaimTx.TxHash() != res.claimTx.TxHash() {
+		t.Fatalf("Buyer did not recover the Nostr signature from the claim")
+	}
+
+	// Offer, accept, funding-proof, claim-sig and adaptor-sig
+	if len(relay.events) != 5 {
+		t.Fatalf("Expected 5 events on the relay, got %d", len(relay.events))
+	}
+	for _, ev := range relay.events {
+		if strings.Contains(ev.Content, sellerSwap.Seller.Event.Sig) || strings.Contains(ev.Content, sellerSwap.Offer.EventID) {
+			t.Fatalf("Relay event leaks swap data in plaintext")
+		}
+	}
+}
+
+// TestSellRejectsUnderfundedLock checks that the seller verifies the lock
+// output on chain and cancels a swap paying less than its terms, leaving the
+// buyer with its funded swap to refund.
+func TestSellRejectsUnderfundedLock(t *testing.T) {
+	relay := newMemRelay()
+	sellerSwap, sellerClient, buyer, buyerClient := newParties(t, relay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chain := bitcoin.NewSimChain()
+	go mine(ctx, chain)
+	fund, destScript, err := fundOn(chain, buyer)
+	if err != nil {
+		t.Fatalf("Failed to fund buyer: %v", err)
+	}
+
+	sellErr := make(chan error, 1)
+	go func() {
+		terms := SaleTerms{Amount: 200000, Confirmations: 1, DestScript: destScript, FeeRate: bitcoin.FeeRatePerVByte(5)}
+		_, err := sellerClient.Sell(ctx, sellerSwap, buyerClient.PublicKey(), chain, terms)
+		sellErr <- err
+	}()
+
+	buyerSwap, err := buyerClient.Buy(ctx, buyer, sellerClient.PublicKey(), chain, nil, fund)
+	var cancelled *CancelError
+	if !errors.As(err, &cancelled) {
+		t.Fatalf("Expected a CancelError, got %v", err)
+	}
+	if buyerSwap == nil || buyerSwap.Phase != tanos.PhaseClaimNonce {
+		t.Fatalf("Buyer did not get its funded swap back")
+	}
+	if err := <-sellErr; err == nil || !strings.Contains(err.Error(), "less than") {
+		t.Fatalf("Expected the seller to reject the lock output, got %v", err)
+	}
+	if sellerSwap.Phase != tanos.PhaseFunded {
+		t.Fatalf("Seller swap moved to %s", sellerSwap.Phase)
+	}
+}
+
+// TestDeclinedOfferCancelsSwap checks that a declined offer reaches the
+// seller as a CancelError.
+func TestDeclinedOfferCancelsSwap(t *testing.T) {
+	relay := newMemRelay()
+	sellerSwap, sellerClient, buyer, buyerClient := newParties(t, relay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chain := bitcoin.NewSimChain()
+	fund, destScript, err := fundOn(chain, buyer)
+	if err != nil {
+		t.Fatalf("Failed to fund buyer: %v", err)
+	}
+
+	sellErr := make(chan error, 1)
+	go func() {
+		terms := SaleTerms{Amount: 100000, Confirmations: 1, DestScript: destScript, FeeRate: bitcoin.FeeRatePerVByte(5)}
+		_, err := sellerClient.Sell(ctx, sellerSwap, buyerClient.PublicKey(), chain, terms)
+		sellErr <- err
+	}()
+
+	decline := func(*tanos.Swap) error { return fmt.Errorf("price too high") }
+	if _, err := buyerClient.Buy(ctx, buyer, sellerClient.PublicKey(), chain, decline, fund); err == nil {
+		t.Fatalf("Expected the buyer to decline")
+	}
+
+	var cancelled *CancelError
+	if err := <-sellErr; !errors.As(err, &cancelled) {
+		t.Fatalf("Expected a CancelError, got %v", err)
+	}
+	if !strings.Contains(cancelled.Reason, "price too high") {
+		t.Fatalf("Unexpected cancel reason: %s", cancelled.Reason)
+	}
+	if sellerSwap.Phase != tanos.PhaseOffered {
+		t.Fatalf("Declined swap moved to %s", sellerSwap.Phase)
+	}
+}
+
+// TestMessagesOnlyOpenForRecipient checks that a third party cannot read a
+// message and that a tampered event is rejected.
+func TestMessagesOnlyOpenForRecipient(t *testing.T) {
+	sender := newSigner(t)
+	senderPub := crypto.HexEncode(schnorr.SerializePubKey(sender.PubKey()))
+	recipient := newSigner(t)
+	recipientPub := crypto.HexEncode(schnorr.SerializePubKey(recipient.PubKey()))
+
+	msg := &Message{Version: ProtocolVersion, Type: TypeCancel, SwapID: "swap", Reason: "test"}
+	ev, err := seal(sender, recipientPub, msg)
+	if err != nil {
+		t.Fatalf("Failed to seal message: %v", err)
+	}
+
+	if _, err := open(recipient, &ev); err != nil {
+		t.Fatalf("Recipient failed to open message: %v", err)
+	}
+	if _, err := open(newSigner(t), &ev); err == nil {
+		t.Fatalf("Third party opened the message")
+	}
+
+	tampered := ev
+	tampered.Tags = nostrlib.Tags{{"p", senderPub}}
+	if _, err := open(recipient, &tampered); err == nil {
+		t.Fatalf("Tampered event was accepted")
+	}
+}
@@ -0,0 +1,40 @@
+package negotiation
+
+import (
+	"context"
+
+	nostrlib "github.com/nbd-wtf/go-nostr"
+)
+
+// Relay is the connection to a Nostr relay that negotiation messages travel
+// through. Events of a subscription are delivered on the returned channel,
+// which is closed once ctx is done.
+type Relay interface {
+	Publish(ctx context.Context, event nostrlib.Event) error
+	Subscribe(ctx context.Context, filters nostrlib.Filters) (<-chan *nostrlib.Event, error)
+}
+
+// nostrRelay adapts a go-nostr relay connection to the Relay interface.
+type nostrRelay struct {
+	relay *nostrlib.Relay
+}
+
+// NewRelay wraps a connected go-nostr relay.
+func NewRelay(relay *nostrlib.Relay) Relay {
+	return &nostrRelay{relay: relay}
+}
+
+// Publish sends an event and waits for the relay to accept it.
+func (r *nostrRelay) Publish(ctx context.Context, event nostrlib.Event) error {
+	return r.relay.Publish(ctx, event)
+}
+
+// Subscribe opens a subscription that ends when ctx is done.
+func (r *nostrRelay) Subscribe(ctx context.Context, filters nostrlib.Filters) (<-chan *nostrlib.Event, error) {
+	sub, err := r.relay.Subscribe(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return sub.Events, nil
+}
@@ -0,0 +1,216 @@
+package nip46
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/crypto"
+	"tanos/pkg/nostr"
+)
+
+// Bunker answers the requests of BunkerSigner clients with an event signer
+// it holds, typically a nostr.LocalSigner run on the seller's own machine.
+// Clients must connect with the secret of the bunker URL before anything
+// else is answered.
+type Bunker struct {
+	relay  Relay
+	signer nostr.EventSigner
+	key    string // Key of the bunker itself, in hex
+	pubKey string
+	secret string
+
+	mu      sync.Mutex
+	clients map[string]bool // Authorized client keys
+}
+
+// NewBunker creates a bunker for signer that talks through relay. An empty
+// secret lets any client connect.
+func NewBunker(relay Relay, signer nostr.EventSigner, secret string) (*Bunker, error) {
+	key := nostr.GeneratePrivateKey()
+	pubKey, err := nostr.GetPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bunker{
+		relay:   relay,
+		signer:  signer,
+		key:     key,
+		pubKey:  pubKey,
+		secret:  secret,
+		clients: make(map[string]bool),
+	}, nil
+}
+
+// URL returns the bunker:// URL clients connect with.
+func (b *Bunker) URL(relays ...string) string {
+	u := &BunkerURL{PubKey: b.pubKey, Relays: relays, Secret: b.secret}
+	return u.String()
+}
+
+// Start subscribes to the requests of clients and answers them in the
+// background until ctx is done. Requests sent before Start returns are
+// missed, as connect events are not stored by relays.
+func (b *Bunker) Start(ctx context.Context) error {
+	since := nostrlib.Timestamp(time.Now().Unix())
+	events, err := b.relay.Subscribe(ctx, nostrlib.Filters{{
+		Kinds: []int{nostrlib.KindNostrConnect},
+		Tags:  nostrlib.TagMap{"p": []string{b.pubKey}},
+		Since: &since,
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe: %v", err)
+	}
+	go b.serve(ctx, events)
+
+	return nil
+}
+
+// serve answers the requests until the subscription ends.
+func (b *Bunker) serve(ctx context.Context, events <-chan *nostrlib.Event) {
+	for ev := range events {
+		var req Request
+		if err := open(b.key, ev, &req); err != nil {
+			continue
+		}
+
+		resp := &Response{ID: req.ID}
+		if result, err := b.handle(ev.PubKey, &req); err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Result = result
+		}
+
+		reply, err := seal(b.key, b.pubKey, ev.PubKey, resp)
+		if err != nil {
+			continue
+		}
+		// The client times out if the response is lost
+		_ = b.relay.Publish(ctx, reply)
+	}
+}
+
+// handle answers one request of the client.
+func (b *Bunker) handle(client string, req *Request) (string, error) {
+	if req.Method == MethodConnect {
+		return b.connect(client, req.Params)
+	}
+
+	b.mu.Lock()
+	authorized := b.clients[client]
+	b.mu.Unlock()
+	if !authorized {
+		return "", fmt.Errorf("client is not connected")
+	}
+
+	switch req.Method {
+	case MethodPing:
+		return "pong", nil
+
+	case MethodGetPublicKey:
+		return crypto.HexEncode(schnorr.SerializePubKey(b.signer.PubKey())), nil
+
+	case MethodNIP44Encrypt, MethodNIP44Decrypt:
+		if len(req.Params) != 2 {
+			return "", fmt.Errorf("%s takes a public key and a payload", req.Method)
+		}
+		enc, ok := b.signer.(nostr.Encrypter)
+		if !ok {
+			return "", fmt.Errorf("signer cannot encrypt")
+		}
+		if req.Method == MethodNIP44Encrypt {
+			return enc.Encrypt(req.Params[0], req.Params[1])
+		}
+		return enc.Decrypt(req.Params[0], req.Params[1])
+
+	case MethodCommitNonce:
+		if len(req.Params) != 1 {
+			return "", fmt.Errorf("%s takes an event", req.Method)
+		}
+		var event nostrlib.Event
+		if err := json.Unmarshal([]byte(req.Params[0]), &event); err != nil {
+			return "", fmt.Errorf("invalid event: %v", err)
+		}
+		template := nostr.EventTemplate{
+			Kind:      event.Kind,
+			Tags:      event.Tags,
+			CreatedAt: event.CreatedAt,
+			Content:   event.Content,
+		}
+		if err := template.Validate(); err != nil {
+			return "", fmt.Errorf("invalid event: %v", err)
+		}
+		nonce, err := b.signer.CommitNonce(event)
+		if err != nil {
+			return "", err
+		}
+		return crypto.HexEncode(schnorr.SerializePubKey(nonce)), nil
+
+	case MethodCommitProofNonce:
+		if len(req.Params) != 1 {
+			return "", fmt.Errorf("%s takes an event ID", req.Method)
+		}
+		A, err := b.signer.CommitProofNonce(req.Params[0])
+		if err != nil {
+			return "", err
+		}
+		return crypto.HexEncode(A.SerializeCompressed()), nil
+
+	case MethodProveNonce:
+		if len(req.Params) != 2 {
+			return "", fmt.Errorf("%s takes an event ID and a challenge", req.Method)
+		}
+		e, err := parseScalar(req.Params[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid challenge: %v", err)
+		}
+		s, err := b.signer.ProveNonce(req.Params[0], e)
+		if err != nil {
+			return "", err
+		}
+		return crypto.HexEncode(crypto.SerializeModNScalar(s)), nil
+
+	case MethodSign:
+		if len(req.Params) != 1 {
+			return "", fmt.Errorf("%s takes an event ID", req.Method)
+		}
+		s, err := b.signer.Sign(req.Params[0])
+		if err != nil {
+			return "", err
+		}
+		defer s.Zero()
+		return crypto.HexEncode(crypto.SerializeModNScalar(s)), nil
+
+	case MethodForget:
+		if len(req.Params) != 1 {
+			return "", fmt.Errorf("%s takes an event ID", req.Method)
+		}
+		b.signer.Forget(req.Params[0])
+		return ack, nil
+
+	default:
+		return "", fmt.Errorf("unsupported method %q", req.Method)
+	}
+}
+
+// connect authorizes the client if it knows the bunker's secret.
+func (b *Bunker) connect(client string, params []string) (string, error) {
+	if len(params) == 0 || params[0] != b.pubKey {
+		return "", fmt.Errorf("connect is for another bunker")
+	}
+	if b.secret != "" && (len(params) < 2 || params[1] != b.secret) {
+		return "", fmt.Errorf("invalid secret")
+	}
+
+	b.mu.Lock()
+	b.clients[client] = true
+	b.mu.Unlock()
+
+	return ack, nil
+}
@@ -0,0 +1,112 @@
+// Package nip46 signs the seller's Nostr events remotely, through a
+// NIP-46 (Nostr Connect) bunker, so the seller's private key never enters
+// the process running the swap. Requests and responses are NIP-44 encrypted
+// kind 24133 events between a throwaway client key and the bunker.
+//
+// Besides the standard connect, get_public_key and ping methods, the bunker
+// answers the TANOS methods that split a BIP340 signature in two steps: a
+// nonce commitment, published with the offer, and the final s, revealed
+// when the seller claims.
+package nip46
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/nostr"
+)
+
+// Methods answered by the bunker.
+const (
+	MethodConnect      = "connect"
+	MethodGetPublicKey = "get_public_key"
+	MethodPing         = "ping"
+	// MethodNIP44Encrypt takes a peer's public key and a plaintext and
+	// returns the NIP-44 payload for the peer.
+	MethodNIP44Encrypt = "nip44_encrypt"
+	// MethodNIP44Decrypt takes a peer's public key and a NIP-44 payload
+	// from the peer and returns the plaintext.
+	MethodNIP44Decrypt = "nip44_decrypt"
+
+	// MethodCommitNonce takes an unsigned event in JSON and returns the
+	// x-only nonce R the bunker will sign it with.
+	MethodCommitNonce = "tanos_commit_nonce"
+	// MethodCommitProofNonce takes an event ID and returns the compressed
+	// point A of a fresh proof of knowledge of the nonce.
+	MethodCommitProofNonce = "tanos_commit_proof_nonce"
+	// MethodProveNonce takes an event ID and a challenge e and returns
+	// a + e*k.
+	MethodProveNonce = "tanos_prove_nonce"
+	// MethodSign takes an event ID and returns the signature scalar s.
+	MethodSign = "tanos_sign"
+	// MethodForget takes an event ID and has the bunker zero its nonce.
+	MethodForget = "tanos_forget"
+)
+
+// ack is the result of methods that return nothing.
+const ack = "ack"
+
+// Request is the encrypted payload of a request event.
+type Request struct {
+	ID     string   `json:"id"`
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+}
+
+// Response is the encrypted payload of a response event.
+type Response struct {
+	ID     string `json:"id"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// seal encrypts the payload for the recipient and wraps it in a signed
+// kind 24133 event.
+func seal(privKey, senderPubKey, recipient string, payload any) (nostrlib.Event, error) {
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return nostrlib.Event{}, fmt.Errorf("failed to encode message: %v", err)
+	}
+
+	content, err := nostr.Encrypt(privKey, recipient, string(plaintext))
+	if err != nil {
+		return nostrlib.Event{}, err
+	}
+
+	ev := nostrlib.Event{
+		PubKey:    senderPubKey,
+		CreatedAt: nostrlib.Timestamp(time.Now().Unix()),
+		Kind:      nostrlib.KindNostrConnect,
+		Tags:      nostrlib.Tags{{"p", recipient}},
+		Content:   content,
+	}
+	if err := ev.Sign(privKey); err != nil {
+		return nostrlib.Event{}, fmt.Errorf("failed to sign message: %v", err)
+	}
+
+	return ev, nil
+}
+
+// open checks and decrypts an event addressed to the holder of privKey into
+// payload.
+func open(privKey string, ev *nostrlib.Event, payload any) error {
+	if ev.Kind != nostrlib.KindNostrConnect {
+		return fmt.Errorf("unexpected event kind %d", ev.Kind)
+	}
+	if ok, err := ev.CheckSignature(); !ok {
+		return fmt.Errorf("invalid event signature: %v", err)
+	}
+
+	plaintext, err := nostr.Decrypt(privKey, ev.PubKey, ev.Content)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt message: %v", err)
+	}
+	if err := json.Unmarshal([]byte(plaintext), payload); err != nil {
+		return fmt.Errorf("failed to decode message: %v", err)
+	}
+
+	return nil
+}
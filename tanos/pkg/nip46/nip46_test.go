@@ -0,0 +1,336 @@
+package nip46
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+	"tanos/pkg/nostr"
+	"tanos/pkg/relay"
+	"tanos/pkg/tanos"
+)
+
+// startBunker runs a bunker for a fresh key on the relay and returns it
+// with its local signer, which stands in for the seller's machine.
+func startBunker(t *testing.T, ctx context.Context, r Relay, secret string) (*Bunker, *nostr.LocalSigner) {
+	t.Helper()
+
+	key, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	local := nostr.NewLocalSigner(key)
+	bunker, err := NewBunker(r, local, secret)
+	if err != nil {
+		t.Fatalf("Failed to create bunker: %v", err)
+	}
+	if err := bunker.Start(ctx); err != nil {
+		t.Fatalf("Failed to start bunker: %v", err)
+	}
+
+	return bunker, local
+}
+
+// TestSellerWithBunker runs the seller side of a swap with the Nostr key in
+// a bunker: the offer, a restore from the swap record, and the signature.
+func TestSellerWithBunker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := relay.New()
+	defer r.Close()
+
+	bunker, local := startBunker(t, ctx, r, "s3cret")
+	signer, err := Connect(ctx, r, bunker.URL("ws://127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Failed to connect to bunker: %v", err)
+	}
+	if !bytes.Equal(schnorr.SerializePubKey(signer.PubKey()), schnorr.SerializePubKey(local.PubKey())) {
+		t.Fatalf("Bunker returned another public key")
+	}
+
+	// The bunker only signs events, so the claim needs a local key
+	keyless, err := tanos.NewSeller(signer)
+	if err != nil {
+		t.Fatalf("Failed to create seller: %v", err)
+	}
+	if err := keyless.CreateEvent("signed in a bunker"); err == nil {
+		t.Fatalf("Bunker seller without a claim key created an event")
+	}
+	claimKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate claim key: %v", err)
+	}
+	seller, err := tanos.NewSellerWithClaimKey(signer, claimKey)
+	if err != nil {
+		t.Fatalf("Failed to create seller: %v", err)
+	}
+	if err := seller.CreateEvent("signed in a bunker"); err != nil {
+		t.Fatalf("Failed to create event: %v", err)
+	}
+	sellerSwap, err := tanos.NewSellerSwap(seller)
+	if err != nil {
+		t.Fatalf("Failed to create seller swap: %v", err)
+	}
+	buyerKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate buyer key: %v", err)
+	}
+	buyer, err := tanos.NewBuyer(buyerKey)
+	if err != nil {
+		t.Fatalf("Failed to create buyer: %v", err)
+	}
+	if _, err := tanos.NewBuyerSwap(buyer, sellerSwap.Offer); err != nil {
+		t.Fatalf("Buyer rejected the offer: %v", err)
+	}
+	if _, err := seller.SealEvent(); err != nil {
+		t.Fatalf("Failed to seal event: %v", err)
+	}
+
+	// The key stays in the bunker, so restoring needs the signer back
+	record, err := sellerSwap.Record()
+	if err != nil {
+		t.Fatalf("Failed to record swap: %v", err)
+	}
+	if _, err := tanos.RestoreSwap(record, tanos.SwapKeys{}); err == nil {
+		t.Fatalf("Restored a bunker seller without its signer")
+	}
+	if _, err := tanos.RestoreSwap(record, tanos.SwapKeys{Sellers: []nostr.EventSigner{signer}}); err == nil {
+		t.Fatalf("Restored a bunker seller without its claim key")
+	}
+	restored, err := tanos.RestoreSwap(record, tanos.SwapKeys{
+		Sellers: []nostr.EventSigner{signer},
+		Claims:  []crypto.Signer{claimKey},
+	})
+	if err != nil {
+		t.Fatalf("Failed to restore swap: %v", err)
+	}
+	if !restored.Seller.Commitment.IsEqual(seller.Commitment) || !restored.Offer.ClaimKey.IsEqual(claimKey.PubKey()) {
+		t.Fatalf("Restored seller has a different commitment or claim key")
+	}
+
+	sig, err := seller.SignEvent()
+	if err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+	if ok, err := seller.Event.CheckSignature(); !ok {
+		t.Fatalf("Bunker signature does not verify: %v", err)
+	}
+	secret, err := nostr.ExtractSecretFromSignature(sig)
+	if err != nil {
+		t.Fatalf("Failed to extract secret: %v", err)
+	}
+	var T secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(secret, &T)
+	T.ToAffine()
+	if !secp.NewPublicKey(&T.X, &T.Y).IsEqual(sellerSwap.Offer.Commitment) {
+		t.Fatalf("Signature does not match the offered commitment")
+	}
+
+	// The bunker forgot the nonce once the event was signed
+	if _, err := signer.Sign(seller.Event.ID); err == nil {
+		t.Fatalf("Bunker signed again after forgetting the nonce")
+	}
+}
+
+// TestSwapWithBunker runs a swap to PhaseClaimed on the simulated chain
+// with the seller's Nostr key in a bunker and a local claim key, and has
+// the buyer recover the signature from the claim.
+func TestSwapWithBunker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := relay.New()
+	defer r.Close()
+	chain := bitcoin.NewSimChain()
+	params := &chaincfg.RegressionNetParams
+
+	bunker, _ := startBunker(t, ctx, r, "")
+	signer, err := Connect(ctx, r, bunker.URL("ws://127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Failed to connect to bunker: %v", err)
+	}
+	claimKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate claim key: %v", err)
+	}
+	seller, err := tanos.NewSellerWithClaimKey(signer, claimKey)
+	if err != nil {
+		t.Fatalf("Failed to create seller: %v", err)
+	}
+	if err := seller.CreateEvent("sold from a bunker"); err != nil {
+		t.Fatalf("Failed to create event: %v", err)
+	}
+	sellerSwap, err := tanos.NewSellerSwap(seller)
+	if err != nil {
+		t.Fatalf("Failed to create seller swap: %v", err)
+	}
+
+	buyerKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate buyer key: %v", err)
+	}
+	buyer, err := tanos.NewBuyer(buyerKey)
+	if err != nil {
+		t.Fatalf("Failed to create buyer: %v", err)
+	}
+	buyerSwap, err := tanos.NewBuyerSwap(buyer, sellerSwap.Offer)
+	if err != nil {
+		t.Fatalf("Buyer rejected the offer: %v", err)
+	}
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+
+	_, fundScript, err := bitcoin.CreateP2TRAddress(buyer.PublicKey, params)
+	if err != nil {
+		t.Fatalf("Failed to create funding script: %v", err)
+	}
+	fundTx := chain.Fund(fundScript, 110000)
+	err = buyerSwap.Fund(func(b *tanos.SwapBuyer, offer *tanos.Offer) error {
+		err := b.CreateMuSig2LockingTransaction(
+			100000, fundTx.TxHash().String(), 0, fundTx.TxOut[0].Value, fundScript,
+			offer.ClaimKey, bitcoin.RelativeBlocks(144), params,
+		)
+		if err != nil {
+			return err
+		}
+		return b.SignLockingTransaction()
+	})
+	if err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	chain.Mine(1)
+
+	notice, err := buyerSwap.FundingNotice()
+	if err != nil {
+		t.Fatalf("Buyer failed to create funding notice: %v", err)
+	}
+	if err := sellerSwap.ObserveFunding(notice); err != nil {
+		t.Fatalf("Seller failed to observe funding: %v", err)
+	}
+	buyerNonce, err := buyerSwap.ClaimNonce()
+	if err != nil {
+		t.Fatalf("Buyer failed to create claim nonce: %v", err)
+	}
+	if _, err := sellerSwap.ClaimNonce(); err != nil {
+		t.Fatalf("Seller failed to create claim nonce: %v", err)
+	}
+	_, destScript, err := bitcoin.CreateP2TRAddress(claimKey.PubKey(), params)
+	if err != nil {
+		t.Fatalf("Failed to create claim script: %v", err)
+	}
+	proposal, err := sellerSwap.ProposeClaim(destScript, bitcoin.FeeRatePerVByte(2), buyerNonce)
+	if err != nil {
+		t.Fatalf("Seller failed to propose claim: %v", err)
+	}
+	partial, err := buyerSwap.SignClaim(proposal)
+	if err != nil {
+		t.Fatalf("Buyer failed to sign claim: %v", err)
+	}
+	if err := sellerSwap.AcceptAdaptor(partial); err != nil {
+		t.Fatalf("Seller rejected the buyer's claim signature: %v", err)
+	}
+	claimTx, err := sellerSwap.CompleteClaim()
+	if err != nil {
+		t.Fatalf("Seller failed to complete claim: %v", err)
+	}
+	if sellerSwap.Phase != tanos.PhaseClaimed {
+		t.Fatalf("Seller swap is in %s", sellerSwap.Phase)
+	}
+	if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+		t.Fatalf("Claim transaction rejected: %v", err)
+	}
+
+	reveal, err := buyerSwap.WatchClaim(ctx, chain, 0)
+	if err != nil {
+		t.Fatalf("Buyer failed to watch the claim: %v", err)
+	}
+	if buyerSwap.Phase != tanos.PhaseClaimed || reveal.NostrSig != sellerSwap.Seller.Event.Sig {
+		t.Fatalf("Buyer did not recover the bunker's signature")
+	}
+	if ok, err := sellerSwap.Seller.Event.CheckSignature(); !ok {
+		t.Fatalf("Bunker signature does not verify: %v", err)
+	}
+}
+
+// TestBunkerEncrypts checks that NIP-44 payloads encrypted through the
+// bunker open with the user's key and the other way around.
+func TestBunkerEncrypts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := relay.New()
+	defer r.Close()
+
+	bunker, local := startBunker(t, ctx, r, "")
+	signer, err := Connect(ctx, r, bunker.URL("ws://127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Failed to connect to bunker: %v", err)
+	}
+	peerKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	peer := nostr.NewLocalSigner(peerKey)
+	peerPub := crypto.HexEncode(schnorr.SerializePubKey(peer.PubKey()))
+	userPub := crypto.HexEncode(schnorr.SerializePubKey(local.PubKey()))
+
+	ciphertext, err := signer.Encrypt(peerPub, "from the bunker")
+	if err != nil {
+		t.Fatalf("Bunker failed to encrypt: %v", err)
+	}
+	if plaintext, err := peer.Decrypt(userPub, ciphertext); err != nil || plaintext != "from the bunker" {
+		t.Fatalf("Peer failed to decrypt: %v", err)
+	}
+
+	ciphertext, err = peer.Encrypt(userPub, "to the bunker")
+	if err != nil {
+		t.Fatalf("Peer failed to encrypt: %v", err)
+	}
+	if plaintext, err := signer.Decrypt(peerPub, ciphertext); err != nil || plaintext != "to the bunker" {
+		t.Fatalf("Bunker failed to decrypt: %v", err)
+	}
+}
+
+// TestBunkerRequiresSecret checks that clients without the secret are
+// refused, and that requests are only answered after connecting.
+func TestBunkerRequiresSecret(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := relay.New()
+	defer r.Close()
+
+	bunker, _ := startBunker(t, ctx, r, "s3cret")
+	target, err := ParseBunkerURL(bunker.URL("ws://127.0.0.1"))
+	if err != nil {
+		t.Fatalf("Failed to parse bunker URL: %v", err)
+	}
+	if target.Secret != "s3cret" || len(target.Relays) != 1 {
+		t.Fatalf("Bunker URL lost its secret or relay: %+v", target)
+	}
+
+	target.Secret = "wrong"
+	if _, err := Connect(ctx, r, target.String()); err == nil {
+		t.Fatalf("Connected with a wrong secret")
+	}
+
+	target.Secret = ""
+	if _, err := Connect(ctx, r, target.String()); err == nil {
+		t.Fatalf("Connected without the secret")
+	}
+
+	if _, err := ParseBunkerURL("nostrconnect://" + target.PubKey); err == nil {
+		t.Fatalf("Parsed a URL with the wrong scheme")
+	}
+}
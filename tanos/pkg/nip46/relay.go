@@ -0,0 +1,16 @@
+package nip46
+
+import (
+	"context"
+
+	nostrlib "github.com/nbd-wtf/go-nostr"
+)
+
+// Relay is the connection to a Nostr relay that requests and responses
+// travel through. It has the shape of negotiation.Relay, so the same
+// relays serve both. Events of a subscription are delivered on the
+// returned channel, which is closed once ctx is done.
+type Relay interface {
+	Publish(ctx context.Context, event nostrlib.Event) error
+	Subscribe(ctx context.Context, filters nostrlib.Filters) (<-chan *nostrlib.Event, error)
+}
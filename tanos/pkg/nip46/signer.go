@@ -0,0 +1,239 @@
+package nip46
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/crypto"
+	"tanos/pkg/nostr"
+)
+
+// DefaultTimeout is how long a BunkerSigner waits for each response.
+const DefaultTimeout = 30 * time.Second
+
+// BunkerSigner is a nostr.EventSigner and nostr.Encrypter whose key is held
+// by a remote bunker.
+// Its methods block until the bunker answers or Timeout passes.
+type BunkerSigner struct {
+	Timeout time.Duration
+
+	ctx       context.Context
+	relay     Relay
+	clientKey string // Throwaway key of this connection, in hex
+	clientPub string
+	bunker    string // Public key of the bunker, in hex
+	pubKey    *secp.PublicKey
+
+	mu      sync.Mutex
+	serial  uint64
+	waiting map[string]chan *Response
+}
+
+// Connect connects to the bunker of the bunker:// URL through relay and
+// fetches the user's public key. The connection lasts until ctx is done.
+func Connect(ctx context.Context, relay Relay, bunkerURL string) (*BunkerSigner, error) {
+	target, err := ParseBunkerURL(bunkerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	clientKey := nostr.GeneratePrivateKey()
+	clientPub, err := nostr.GetPublicKey(clientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BunkerSigner{
+		Timeout:   DefaultTimeout,
+		ctx:       ctx,
+		relay:     relay,
+		clientKey: clientKey,
+		clientPub: clientPub,
+		bunker:    target.PubKey,
+		waiting:   make(map[string]chan *Response),
+	}
+
+	since := nostrlib.Timestamp(time.Now().Unix())
+	events, err := relay.Subscribe(ctx, nostrlib.Filters{{
+		Kinds:   []int{nostrlib.KindNostrConnect},
+		Authors: []string{target.PubKey},
+		Tags:    nostrlib.TagMap{"p": []string{clientPub}},
+		Since:   &since,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe: %v", err)
+	}
+	go s.receive(events)
+
+	if _, err := s.call(MethodConnect, target.PubKey, target.Secret); err != nil {
+		return nil, fmt.Errorf("bunker refused the connection: %v", err)
+	}
+
+	pubHex, err := s.call(MethodGetPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	pubBytes, err := crypto.DecodeHexStrict(pubHex, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bunker returned an invalid public key: %v", err)
+	}
+	if s.pubKey, err = schnorr.ParsePubKey(pubBytes); err != nil {
+		return nil, fmt.Errorf("bunker returned an invalid public key: %v", err)
+	}
+
+	return s, nil
+}
+
+// receive hands the responses of the bunker to the calls waiting for them.
+func (s *BunkerSigner) receive(events <-chan *nostrlib.Event) {
+	for ev := range events {
+		var resp Response
+		if err := open(s.clientKey, ev, &resp); err != nil {
+			// Not a response we can read, it cannot be for us
+			continue
+		}
+
+		s.mu.Lock()
+		ch, ok := s.waiting[resp.ID]
+		delete(s.waiting, resp.ID)
+		s.mu.Unlock()
+		if ok {
+			ch <- &resp
+		}
+	}
+}
+
+// call sends a request to the bunker and waits for its result.
+func (s *BunkerSigner) call(method string, params ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.Timeout)
+	defer cancel()
+
+	s.mu.Lock()
+	s.serial++
+	id := s.clientPub[:8] + "-" + strconv.FormatUint(s.serial, 10)
+	ch := make(chan *Response, 1)
+	s.waiting[id] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.waiting, id)
+		s.mu.Unlock()
+	}()
+
+	req := &Request{ID: id, Method: method, Params: params}
+	ev, err := seal(s.clientKey, s.clientPub, s.bunker, req)
+	if err != nil {
+		return "", err
+	}
+	if err := s.relay.Publish(ctx, ev); err != nil {
+		return "", fmt.Errorf("failed to publish %s request: %v", method, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("no response to %s: %v", method, ctx.Err())
+	case resp := <-ch:
+		if resp.Error != "" {
+			return "", fmt.Errorf("bunker failed %s: %s", method, resp.Error)
+		}
+		return resp.Result, nil
+	}
+}
+
+// PubKey returns the user's public key held by the bunker.
+func (s *BunkerSigner) PubKey() *secp.PublicKey {
+	return s.pubKey
+}
+
+// Ping checks that the bunker answers.
+func (s *BunkerSigner) Ping() error {
+	_, err := s.call(MethodPing)
+	return err
+}
+
+// Encrypt has the bunker encrypt plaintext for the peer with NIP-44.
+func (s *BunkerSigner) Encrypt(peer, plaintext string) (string, error) {
+	return s.call(MethodNIP44Encrypt, peer, plaintext)
+}
+
+// Decrypt has the bunker decrypt a NIP-44 payload from the peer.
+func (s *BunkerSigner) Decrypt(peer, ciphertext string) (string, error) {
+	return s.call(MethodNIP44Decrypt, peer, ciphertext)
+}
+
+// CommitNonce has the bunker commit to the nonce for signing the event.
+func (s *BunkerSigner) CommitNonce(event nostrlib.Event) (*secp.PublicKey, error) {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %v", err)
+	}
+
+	result, err := s.call(MethodCommitNonce, string(eventJSON))
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := crypto.DecodeHexStrict(result, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bunker returned an invalid nonce: %v", err)
+	}
+
+	return schnorr.ParsePubKey(nonce)
+}
+
+// CommitProofNonce has the bunker start a proof of knowledge of the nonce.
+func (s *BunkerSigner) CommitProofNonce(eventID string) (*secp.PublicKey, error) {
+	result, err := s.call(MethodCommitProofNonce, eventID)
+	if err != nil {
+		return nil, err
+	}
+	point, err := crypto.DecodeHexStrict(result, secp.PubKeyBytesLenCompressed)
+	if err != nil {
+		return nil, fmt.Errorf("bunker returned an invalid proof nonce: %v", err)
+	}
+
+	return crypto.ParseCompressedPubKey(point)
+}
+
+// ProveNonce has the bunker answer the challenge e of the proof.
+func (s *BunkerSigner) ProveNonce(eventID string, e *secp.ModNScalar) (*secp.ModNScalar, error) {
+	result, err := s.call(MethodProveNonce, eventID, crypto.HexEncode(crypto.SerializeModNScalar(e)))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseScalar(result)
+}
+
+// Sign has the bunker compute the signature scalar s of the event.
+func (s *BunkerSigner) Sign(eventID string) (*secp.ModNScalar, error) {
+	result, err := s.call(MethodSign, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseScalar(result)
+}
+
+// Forget has the bunker zero the nonce of the event. An unreachable bunker
+// keeps the nonce, but only ever signs the event with it.
+func (s *BunkerSigner) Forget(eventID string) {
+	_, _ = s.call(MethodForget, eventID)
+}
+
+// parseScalar decodes a scalar returned by the bunker.
+func parseScalar(result string) (*secp.ModNScalar, error) {
+	b, err := crypto.DecodeHexStrict(result, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bunker returned an invalid scalar: %v", err)
+	}
+
+	return crypto.ParseScalar(b)
+}
@@ -0,0 +1,51 @@
+package nip46
+
+import (
+	"fmt"
+	"net/url"
+
+	nostrlib "github.com/nbd-wtf/go-nostr"
+)
+
+// BunkerURL is the connection string of a bunker:
+// bunker://<bunker pubkey>?relay=<url>&secret=<secret>.
+type BunkerURL struct {
+	PubKey string   // Public key of the bunker in hex, not the user's key
+	Relays []string // Relays the bunker listens on
+	Secret string   // Optional secret authorizing the client on connect
+}
+
+// ParseBunkerURL decodes a bunker:// connection string.
+func ParseBunkerURL(s string) (*BunkerURL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bunker URL: %v", err)
+	}
+	if u.Scheme != "bunker" {
+		return nil, fmt.Errorf("bunker URL must start with bunker://, got %q", u.Scheme)
+	}
+	if !nostrlib.IsValidPublicKey(u.Host) {
+		return nil, fmt.Errorf("invalid bunker public key %q", u.Host)
+	}
+
+	query := u.Query()
+	return &BunkerURL{
+		PubKey: u.Host,
+		Relays: query["relay"],
+		Secret: query.Get("secret"),
+	}, nil
+}
+
+// String encodes the connection string.
+func (b *BunkerURL) String() string {
+	query := url.Values{}
+	for _, relay := range b.Relays {
+		query.Add("relay", relay)
+	}
+	if b.Secret != "" {
+		query.Set("secret", b.Secret)
+	}
+
+	u := url.URL{Scheme: "bunker", Host: b.PubKey, RawQuery: query.Encode()}
+	return u.String()
+}
@@ -0,0 +1,74 @@
+package nostr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/nbd-wtf/go-nostr/nip44"
+
+	"tanos/pkg/crypto"
+)
+
+// Encrypt encrypts plaintext for the holder of recipientPubKey with NIP-44,
+// using the sender's private key. Both keys are in hex.
+func Encrypt(privKeyHex, recipientPubKey, plaintext string) (string, error) {
+	key, err := nip44.GenerateConversationKey(recipientPubKey, privKeyHex)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive conversation key: %v", err)
+	}
+
+	return nip44.Encrypt(plaintext, key)
+}
+
+// Decrypt decrypts a NIP-44 payload sent by the holder of senderPubKey,
+// using the recipient's private key. Both keys are in hex.
+func Decrypt(privKeyHex, senderPubKey, ciphertext string) (string, error) {
+	key, err := nip44.GenerateConversationKey(senderPubKey, privKeyHex)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive conversation key: %v", err)
+	}
+
+	return nip44.Decrypt(ciphertext, key)
+}
+
+// Encrypter encrypts and decrypts NIP-44 payloads with a Nostr key it
+// holds, so that the key can stay in a remote signer. Peers are x-only
+// public keys in hex.
+type Encrypter interface {
+	// Encrypt encrypts plaintext for the holder of the peer's key.
+	Encrypt(peer, plaintext string) (string, error)
+
+	// Decrypt decrypts a payload sent by the holder of the peer's key.
+	Decrypt(peer, ciphertext string) (string, error)
+}
+
+// conversationKey derives the NIP-44 conversation key of privKey and the
+// peer's key: the HKDF extract of the x coordinate of their ECDH point.
+func conversationKey(privKey *secp.PrivateKey, peer string) ([32]byte, error) {
+	var key [32]byte
+	peerBytes, err := crypto.DecodeHexStrict(peer, 32)
+	if err != nil {
+		return key, fmt.Errorf("invalid peer key: %v", err)
+	}
+	peerPub, err := schnorr.ParsePubKey(peerBytes)
+	if err != nil {
+		return key, fmt.Errorf("invalid peer key: %v", err)
+	}
+
+	var point, shared secp.JacobianPoint
+	peerPub.AsJacobian(&point)
+	secp.ScalarMultNonConst(&privKey.Key, &point, &shared)
+	shared.ToAffine()
+
+	var x [32]byte
+	shared.X.PutBytesUnchecked(x[:])
+	mac := hmac.New(sha256.New, []byte("nip44-v2"))
+	mac.Write(x[:])
+	copy(key[:], mac.Sum(nil))
+	zeroBytes(x[:])
+
+	return key, nil
+}
@@ -4,7 +4,6 @@ package nostr
 
 import (
 	"fmt"
-	"time"
 
 	secp "github.com/btcsuite/btcd/btcec/v2"
 	nostrlib "github.com/nbd-wtf/go-nostr"
@@ -22,28 +21,10 @@ func GetPublicKey(privateKey string) (string, error) {
 	return nostrlib.GetPublicKey(privateKey)
 }
 
-// CreateSignedEvent constructs and signs a Nostr event using a given private key.
+// CreateSignedEvent constructs and signs a kind 1 text note using a given
+// private key. SignTemplate signs events of other kinds.
 func CreateSignedEvent(privKeyHex, content string) (nostrlib.Event, error) {
-	ev := nostrlib.Event{
-		CreatedAt: nostrlib.Timestamp(time.Now().Unix()),
-		Kind:      1, // Regular note
-		Tags:      []nostrlib.Tag{},
-		Content:   content,
-	}
-
-	if privKeyHex != "" {
-		pub, err := nostrlib.GetPublicKey(privKeyHex)
-		if err != nil {
-			return nostrlib.Event{}, err
-		}
-		ev.PubKey = pub
-	}
-
-	if err := ev.Sign(privKeyHex); err != nil {
-		return nostrlib.Event{}, err
-	}
-
-	return ev, nil
+	return SignTemplate(privKeyHex, NoteTemplate(content))
 }
 
 // ExtractSecretFromSignature extracts the secret (s value) from a Nostr signature.
@@ -0,0 +1,304 @@
+package nostr
+
+import (
+	"fmt"
+	"sync"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip44"
+
+	"tanos/pkg/crypto"
+)
+
+// LocalSigner is an EventSigner for a key held in this process. It is also
+// a crypto.Signer, so the same key can sign Bitcoin transactions, and an
+// Encrypter.
+//
+// Its nonces are derived deterministically from the key and the event ID,
+// so after a restart a new signer for the same key commits to the same
+// nonce for a pending event, and nothing needs to be saved.
+type LocalSigner struct {
+	key crypto.Signer
+
+	mu     sync.Mutex
+	nonces map[string]*localNonce // By event ID
+}
+
+// localNonce is the nonce committed to for one event.
+type localNonce struct {
+	k     secp.ModNScalar  // Nonce, negated for an even R
+	R     *secp.PublicKey  // k*G
+	proof *secp.ModNScalar // Proof nonce a, until it answers a challenge
+}
+
+// zero clears the nonce and the proof nonce.
+func (n *localNonce) zero() {
+	n.k.Zero()
+	if n.proof != nil {
+		n.proof.Zero()
+		n.proof = nil
+	}
+}
+
+// NewLocalSigner creates an event signer for key, such as a
+// crypto.SecretKey.
+func NewLocalSigner(key crypto.Signer) *LocalSigner {
+	return &LocalSigner{
+		key:    key,
+		nonces: make(map[string]*localNonce),
+	}
+}
+
+// PubKey returns the public key of the signer.
+func (l *LocalSigner) PubKey() *secp.PublicKey {
+	return l.key.PubKey()
+}
+
+// WithPrivateKey calls fn with the private key.
+func (l *LocalSigner) WithPrivateKey(fn func(priv *secp.PrivateKey) error) error {
+	return l.key.WithPrivateKey(fn)
+}
+
+// CommitNonce derives the nonce as BIP340 does, from the key and the event
+// ID, with zero auxiliary randomness so that the same event always gets the
+// same nonce.
+func (l *LocalSigner) CommitNonce(event nostrlib.Event) (*secp.PublicKey, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n, ok := l.nonces[event.ID]; ok {
+		return n.R, nil
+	}
+	eventID, err := l.checkEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	var auxRand [32]byte
+
+	n := &localNonce{}
+	err = l.key.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		var x secp.ModNScalar
+		x.Set(&privKey.Key)
+		defer x.Zero()
+		if l.PubKey().SerializeCompressed()[0] == 0x03 {
+			x.Negate()
+		}
+
+		// BIP340 nonce: k = H_nonce(x XOR H_aux(a) || P.x || m)
+		xBytes := x.Bytes()
+		aux := chainhash.TaggedHash(chainhash.TagBIP0340Aux, auxRand[:])
+		for i := range xBytes {
+			xBytes[i] ^= aux[i]
+		}
+		hashInput := append(xBytes[:], schnorr.SerializePubKey(l.PubKey())...)
+		hashInput = append(hashInput, eventID...)
+		hash := chainhash.TaggedHash(chainhash.TagBIP0340Nonce, hashInput)
+		for i := range hashInput {
+			hashInput[i] = 0
+		}
+		for i := range xBytes {
+			xBytes[i] = 0
+		}
+		n.k.SetBytes((*[32]byte)(hash))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n.k.IsZero() {
+		return nil, fmt.Errorf("derived nonce is zero")
+	}
+
+	return l.commit(event.ID, n), nil
+}
+
+// checkEvent checks that the event is by the signer and returns its ID.
+func (l *LocalSigner) checkEvent(event nostrlib.Event) ([]byte, error) {
+	if crypto.HexEncode(schnorr.SerializePubKey(l.PubKey())) != event.PubKey {
+		return nil, fmt.Errorf("event is not by the private key's owner")
+	}
+	if !event.CheckID() {
+		return nil, fmt.Errorf("event ID does not match the event")
+	}
+
+	eventID, err := crypto.DecodeHexStrict(event.ID, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event ID: %v", err)
+	}
+
+	return eventID, nil
+}
+
+// commit computes R for the nonce, negating k for an even R, and keeps it
+// for the event.
+func (l *LocalSigner) commit(eventID string, n *localNonce) *secp.PublicKey {
+	var R secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(&n.k, &R)
+	R.ToAffine()
+	if R.Y.IsOdd() {
+		n.k.Negate()
+		R.Y.Negate(1).Normalize()
+	}
+	n.R = secp.NewPublicKey(&R.X, &R.Y)
+	l.nonces[eventID] = n
+
+	return n.R
+}
+
+// nonce returns the nonce committed to for the event. The caller holds mu.
+func (l *LocalSigner) nonce(eventID string) (*localNonce, error) {
+	n, ok := l.nonces[eventID]
+	if !ok {
+		return nil, fmt.Errorf("no nonce committed to for event %s", eventID)
+	}
+
+	return n, nil
+}
+
+// CommitProofNonce picks a random proof nonce a and returns A = a*G.
+func (l *LocalSigner) CommitProofNonce(eventID string) (*secp.PublicKey, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n, err := l.nonce(eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := secp.NewPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate proof nonce: %v", err)
+	}
+	defer a.Zero()
+
+	if n.proof != nil {
+		n.proof.Zero()
+	}
+	n.proof = new(secp.ModNScalar).Set(&a.Key)
+
+	return a.PubKey(), nil
+}
+
+// ProveNonce returns a + e*k and forgets a.
+func (l *LocalSigner) ProveNonce(eventID string, e *secp.ModNScalar) (*secp.ModNScalar, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n, err := l.nonce(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if n.proof == nil {
+		return nil, fmt.Errorf("no proof nonce committed to for event %s", eventID)
+	}
+
+	s := new(secp.ModNScalar).Mul2(e, &n.k).Add(n.proof)
+	n.proof.Zero()
+	n.proof = nil
+
+	return s, nil
+}
+
+// Sign returns s = k + e*x for the nonce committed to for the event.
+func (l *LocalSigner) Sign(eventID string) (*secp.ModNScalar, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n, err := l.nonce(eventID)
+	if err != nil {
+		return nil, err
+	}
+	e, err := challenge(n.R, l.PubKey(), eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(secp.ModNScalar)
+	err = l.key.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		var x secp.ModNScalar
+		x.Set(&privKey.Key)
+		defer x.Zero()
+		if l.PubKey().SerializeCompressed()[0] == 0x03 {
+			x.Negate()
+		}
+
+		s.Mul2(e, &x).Add(&n.k)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Encrypt encrypts plaintext for the peer with NIP-44.
+func (l *LocalSigner) Encrypt(peer, plaintext string) (string, error) {
+	var ciphertext string
+	err := l.key.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		key, err := conversationKey(privKey, peer)
+		if err != nil {
+			return err
+		}
+		defer zeroBytes(key[:])
+
+		ciphertext, err = nip44.Encrypt(plaintext, key)
+		return err
+	})
+
+	return ciphertext, err
+}
+
+// Decrypt decrypts a NIP-44 payload from the peer.
+func (l *LocalSigner) Decrypt(peer, ciphertext string) (string, error) {
+	var plaintext string
+	err := l.key.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		key, err := conversationKey(privKey, peer)
+		if err != nil {
+			return err
+		}
+		defer zeroBytes(key[:])
+
+		plaintext, err = nip44.Decrypt(ciphertext, key)
+		return err
+	})
+
+	return plaintext, err
+}
+
+// zeroBytes overwrites b with zeros.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// Forget zeroes the nonce of the event.
+func (l *LocalSigner) Forget(eventID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n, ok := l.nonces[eventID]; ok {
+		n.zero()
+		delete(l.nonces, eventID)
+	}
+}
+
+// Zero forgets every nonce and zeroes the key, when it supports it.
+func (l *LocalSigner) Zero() {
+	l.mu.Lock()
+	for id, n := range l.nonces {
+		n.zero()
+		delete(l.nonces, id)
+	}
+	l.mu.Unlock()
+
+	if z, ok := l.key.(interface{ Zero() }); ok {
+		z.Zero()
+	}
+}
@@ -0,0 +1,51 @@
+package nostr
+
+import (
+	"context"
+	"fmt"
+
+	nostrlib "github.com/nbd-wtf/go-nostr"
+)
+
+// ConnectRelay opens a websocket connection to the relay at url. The
+// connection is closed once ctx is done.
+func ConnectRelay(ctx context.Context, url string) (*nostrlib.Relay, error) {
+	relay := nostrlib.NewRelay(ctx, url)
+	if err := relay.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to relay %s: %v", url, err)
+	}
+
+	return relay, nil
+}
+
+// PublishEvent sends a signed event to the relay and waits for the relay
+// to accept it.
+func PublishEvent(ctx context.Context, relay *nostrlib.Relay, ev nostrlib.Event) error {
+	if err := relay.Publish(ctx, ev); err != nil {
+		return fmt.Errorf("relay %s rejected event %s: %v", relay.URL, ev.ID, err)
+	}
+
+	return nil
+}
+
+// FetchEvent retrieves the event with the given ID from the relay and
+// checks its signature.
+func FetchEvent(ctx context.Context, relay *nostrlib.Relay, id string) (*nostrlib.Event, error) {
+	events, err := relay.QuerySync(ctx, nostrlib.Filter{IDs: []string{id}, Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query relay %s: %v", relay.URL, err)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("event %s not found on relay %s", id, relay.URL)
+	}
+
+	ev := events[0]
+	if ev.ID != id || !ev.CheckID() {
+		return nil, fmt.Errorf("relay %s returned a different event for %s", relay.URL, id)
+	}
+	if ok, err := ev.CheckSignature(); !ok {
+		return nil, fmt.Errorf("event %s has an invalid signature: %v", id, err)
+	}
+
+	return ev, nil
+}
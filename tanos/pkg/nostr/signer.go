@@ -0,0 +1,285 @@
+package nostr
+
+import (
+	"fmt"
+	"time"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/crypto"
+)
+
+// EventSigner holds a Nostr key and signs events in two steps: it commits
+// to the nonce R of a signature first, and only computes the signature
+// scalar s = k + e*x when asked to. Neither the key nor the nonce k leave
+// the signer, which may run in another process, such as a NIP-46 bunker.
+//
+// Nonces are identified by the ID of the event they sign, and a signer
+// must never use a nonce for any other event.
+type EventSigner interface {
+	// PubKey returns the public key of the signer.
+	PubKey() *secp.PublicKey
+
+	// CommitNonce picks the nonce for signing the unsigned event and returns
+	// R, with even Y. Asking again for the same event returns the same R.
+	CommitNonce(event nostrlib.Event) (*secp.PublicKey, error)
+
+	// CommitProofNonce starts a proof of knowledge of the nonce of the event:
+	// it picks a fresh random a and returns A = a*G.
+	CommitProofNonce(eventID string) (*secp.PublicKey, error)
+
+	// ProveNonce finishes the proof for the challenge e and returns
+	// a + e*k. The proof nonce a is forgotten, so each A answers only one
+	// challenge.
+	ProveNonce(eventID string, e *secp.ModNScalar) (*secp.ModNScalar, error)
+
+	// Sign returns the signature scalar s of the event for its committed
+	// nonce. The nonce is kept until Forget, so s can be asked for again.
+	Sign(eventID string) (*secp.ModNScalar, error)
+
+	// Forget zeroes the nonce of the event, signed or not.
+	Forget(eventID string)
+}
+
+// PendingEvent is an event whose BIP340 signature is started but not
+// finished. The nonce R and the commitment point T = s*G of the future
+// signature are known, so they can be published, while the signature scalar
+// s = k + e*x is only computed by the signer when Sign is called.
+//
+// The signer forgets the nonce once the event is signed or discarded.
+type PendingEvent struct {
+	Event      nostrlib.Event  // The event, with its ID but no signature
+	Nonce      *secp.PublicKey // R, with even Y
+	Commitment *secp.PublicKey // T = R + e*P
+
+	signer EventSigner
+	active bool
+}
+
+// PrepareEvent validates the template and starts signing it: the signer
+// commits to a nonce, and R and T are computed without computing s.
+func PrepareEvent(signer EventSigner, template EventTemplate) (*PendingEvent, error) {
+	if err := template.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid event template: %v", err)
+	}
+
+	ev := newEvent(signer.PubKey(), template)
+	nonce, err := signer.CommitNonce(ev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit to a nonce: %v", err)
+	}
+
+	return newPendingEvent(signer, ev, nonce)
+}
+
+// ResumeEvent restores a pending event from the unsigned event after a
+// restart, asking the signer to commit to the nonce of the event again. The
+// signer must return the nonce it committed to before, as a LocalSigner does
+// by deriving it deterministically and a bunker does by keeping it.
+func ResumeEvent(signer EventSigner, event nostrlib.Event) (*PendingEvent, error) {
+	if event.Sig != "" {
+		return nil, fmt.Errorf("event is already signed")
+	}
+	if !event.CheckID() {
+		return nil, fmt.Errorf("event ID does not match the event")
+	}
+
+	nonce, err := signer.CommitNonce(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore the nonce: %v", err)
+	}
+
+	return newPendingEvent(signer, event, nonce)
+}
+
+// newEvent builds the unsigned event of the template by pubKey, with its ID.
+func newEvent(pubKey *secp.PublicKey, template EventTemplate) nostrlib.Event {
+	createdAt := template.CreatedAt
+	if createdAt == 0 {
+		createdAt = nostrlib.Timestamp(time.Now().Unix())
+	}
+	tags := template.Tags
+	if tags == nil {
+		tags = nostrlib.Tags{}
+	}
+
+	ev := nostrlib.Event{
+		PubKey:    crypto.HexEncode(schnorr.SerializePubKey(pubKey)),
+		CreatedAt: createdAt,
+		Kind:      template.Kind,
+		Tags:      tags,
+		Content:   template.Content,
+	}
+	ev.ID = ev.GetID()
+
+	return ev
+}
+
+// newPendingEvent computes the commitment T = R + e*P of the event signed
+// with the nonce R.
+func newPendingEvent(signer EventSigner, event nostrlib.Event, nonce *secp.PublicKey) (*PendingEvent, error) {
+	pubKey := signer.PubKey()
+	if crypto.HexEncode(schnorr.SerializePubKey(pubKey)) != event.PubKey {
+		signer.Forget(event.ID)
+		return nil, fmt.Errorf("event is not by the signer's key")
+	}
+	if nonce.SerializeCompressed()[0] != 0x02 {
+		signer.Forget(event.ID)
+		return nil, fmt.Errorf("nonce must have an even Y coordinate")
+	}
+	e, err := challenge(nonce, pubKey, event.ID)
+	if err != nil {
+		signer.Forget(event.ID)
+		return nil, err
+	}
+
+	// T = R + e*P for the even P, which is s*G without computing s
+	var R, P, eP, T secp.JacobianPoint
+	nonce.AsJacobian(&R)
+	evenPub, _ := schnorr.ParsePubKey(schnorr.SerializePubKey(pubKey))
+	evenPub.AsJacobian(&P)
+	secp.ScalarMultNonConst(e, &P, &eP)
+	secp.AddNonConst(&R, &eP, &T)
+	T.ToAffine()
+
+	return &PendingEvent{
+		Event:      event,
+		Nonce:      nonce,
+		Commitment: secp.NewPublicKey(&T.X, &T.Y),
+		signer:     signer,
+		active:     true,
+	}, nil
+}
+
+// challenge computes the BIP340 challenge e = H_challenge(R.x || P.x || m)
+// for the event ID m.
+func challenge(nonce, pubKey *secp.PublicKey, eventID string) (*secp.ModNScalar, error) {
+	id, err := crypto.DecodeHexStrict(eventID, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event ID: %v", err)
+	}
+
+	hashInput := make([]byte, 0, 96)
+	hashInput = append(hashInput, schnorr.SerializePubKey(nonce)...)
+	hashInput = append(hashInput, schnorr.SerializePubKey(pubKey)...)
+	hashInput = append(hashInput, id...)
+
+	e := new(secp.ModNScalar)
+	e.SetBytes((*[32]byte)(chainhash.TaggedHash(chainhash.TagBIP0340Challenge, hashInput)))
+	return e, nil
+}
+
+// ProveNonce creates a Schnorr proof of knowledge of k for R = k*G: the
+// signer picks a random a, challenge gives e for A = a*G and the signer
+// answers s = a + e*k. The answer is checked before it is returned.
+func (p *PendingEvent) ProveNonce(challenge func(A *secp.PublicKey) *secp.ModNScalar) (*secp.ModNScalar, *secp.ModNScalar, error) {
+	if !p.active {
+		return nil, nil, fmt.Errorf("event is no longer pending")
+	}
+
+	A, err := p.signer.CommitProofNonce(p.Event.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to commit to a proof nonce: %v", err)
+	}
+	e := challenge(A)
+	s, err := p.signer.ProveNonce(p.Event.ID, e)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prove knowledge of the nonce: %v", err)
+	}
+
+	// s*G must equal A + e*R
+	var sG, R, eR, expected secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(s, &sG)
+	p.Nonce.AsJacobian(&R)
+	secp.ScalarMultNonConst(e, &R, &eR)
+	A.AsJacobian(&expected)
+	secp.AddNonConst(&expected, &eR, &expected)
+	sG.ToAffine()
+	expected.ToAffine()
+	if !sG.X.Equals(&expected.X) || !sG.Y.Equals(&expected.Y) {
+		return nil, nil, fmt.Errorf("signer returned an invalid nonce proof")
+	}
+
+	return e, s, nil
+}
+
+// WithSecret gets the signature scalar s from the signer, checks it
+// against the commitment, passes it to fn and zeroes it again, for deriving
+// keys from s before the signature is released.
+func (p *PendingEvent) WithSecret(fn func(s *secp.ModNScalar) error) error {
+	s, err := p.secret()
+	if err != nil {
+		return err
+	}
+	defer s.Zero()
+
+	return fn(s)
+}
+
+// secret asks the signer for s and checks that s*G = T.
+func (p *PendingEvent) secret() (*secp.ModNScalar, error) {
+	if !p.active {
+		return nil, fmt.Errorf("event is no longer pending")
+	}
+
+	s, err := p.signer.Sign(p.Event.ID)
+	if err != nil {
+		return nil, fmt.Errorf("signer failed to sign: %v", err)
+	}
+
+	var T secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(s, &T)
+	T.ToAffine()
+	if !secp.NewPublicKey(&T.X, &T.Y).IsEqual(p.Commitment) {
+		s.Zero()
+		return nil, fmt.Errorf("signer returned a signature that does not match the commitment")
+	}
+
+	return s, nil
+}
+
+// Sign completes the signature, has the signer forget the nonce and
+// returns the signed event. It can only be called once.
+func (p *PendingEvent) Sign() (nostrlib.Event, error) {
+	ev, err := p.Signed()
+	if err != nil {
+		return nostrlib.Event{}, err
+	}
+	p.Discard()
+
+	return ev, nil
+}
+
+// Signed completes the signature and returns the signed event, keeping the
+// nonce so that the event stays pending until Sign or Discard. It lets the
+// caller record the signature before giving up the nonce.
+func (p *PendingEvent) Signed() (nostrlib.Event, error) {
+	s, err := p.secret()
+	if err != nil {
+		return nostrlib.Event{}, err
+	}
+	defer s.Zero()
+
+	sig := make([]byte, 64)
+	copy(sig, schnorr.SerializePubKey(p.Nonce))
+	s.PutBytesUnchecked(sig[32:])
+
+	ev := p.Event
+	ev.Sig = crypto.HexEncode(sig)
+	if ok, err := ev.CheckSignature(); !ok {
+		return nostrlib.Event{}, fmt.Errorf("completed signature does not verify: %v", err)
+	}
+
+	return ev, nil
+}
+
+// Discard has the signer forget the nonce without signing.
+func (p *PendingEvent) Discard() {
+	if p.active {
+		p.signer.Forget(p.Event.ID)
+		p.active = false
+	}
+}
@@ -0,0 +1,111 @@
+package nostr
+
+import (
+	"testing"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+
+	"tanos/pkg/crypto"
+)
+
+// TestPendingEvent checks that the published nonce and commitment match the
+// signature made later, and that the secrets are gone once it is made.
+func TestPendingEvent(t *testing.T) {
+	key, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer := NewLocalSigner(key)
+	pending, err := PrepareEvent(signer, NoteTemplate("two-step signing"))
+	if err != nil {
+		t.Fatalf("Failed to prepare event: %v", err)
+	}
+	if pending.Event.Sig != "" || !pending.Event.CheckID() {
+		t.Fatalf("Pending event must have an ID and no signature")
+	}
+
+	// A new signer for the same key stands in for a restarted process
+	resumed, err := ResumeEvent(NewLocalSigner(key), pending.Event)
+	if err != nil {
+		t.Fatalf("Failed to resume event: %v", err)
+	}
+	if !resumed.Nonce.IsEqual(pending.Nonce) || !resumed.Commitment.IsEqual(pending.Commitment) {
+		t.Fatalf("Resumed event has a different commitment")
+	}
+	other, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if _, err := ResumeEvent(NewLocalSigner(other), pending.Event); err == nil {
+		t.Fatalf("Resumed the event with another key")
+	}
+
+	ev, err := pending.Sign()
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	secret, err := ExtractSecretFromSignature(ev.Sig)
+	if err != nil {
+		t.Fatalf("Failed to extract secret: %v", err)
+	}
+	var T secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(secret, &T)
+	T.ToAffine()
+	if !secp.NewPublicKey(&T.X, &T.Y).IsEqual(pending.Commitment) {
+		t.Fatalf("Signature does not match the commitment")
+	}
+
+	if _, err := pending.Sign(); err == nil {
+		t.Fatalf("Signed twice")
+	}
+	if len(signer.nonces) != 0 {
+		t.Fatalf("Signer kept the nonce after signing")
+	}
+
+	resumedEv, err := resumed.Sign()
+	if err != nil || resumedEv.Sig != ev.Sig {
+		t.Fatalf("Resumed event signed differently: %v", err)
+	}
+
+	discarded, err := PrepareEvent(signer, NoteTemplate("abandoned"))
+	if err != nil {
+		t.Fatalf("Failed to prepare event: %v", err)
+	}
+	discarded.Discard()
+	if _, err := discarded.Sign(); err == nil {
+		t.Fatalf("Signed a discarded event")
+	}
+}
+
+// TestLocalSignerEncrypt checks that the signer's NIP-44 payloads open
+// with the peer's private key and the other way around.
+func TestLocalSignerEncrypt(t *testing.T) {
+	key, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer := NewLocalSigner(key)
+	signerPub := crypto.HexEncode(schnorr.SerializePubKey(signer.PubKey()))
+	peerKey := GeneratePrivateKey()
+	peerPub, _ := GetPublicKey(peerKey)
+
+	ciphertext, err := signer.Encrypt(peerPub, "to the peer")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if plaintext, err := Decrypt(peerKey, signerPub, ciphertext); err != nil || plaintext != "to the peer" {
+		t.Fatalf("Peer failed to decrypt: %v", err)
+	}
+
+	ciphertext, err = Encrypt(peerKey, signerPub, "to the signer")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if plaintext, err := signer.Decrypt(peerPub, ciphertext); err != nil || plaintext != "to the signer" {
+		t.Fatalf("Signer failed to decrypt: %v", err)
+	}
+	if _, err := signer.Decrypt(signerPub, ciphertext); err == nil {
+		t.Fatalf("Decrypted a payload from another peer")
+	}
+}
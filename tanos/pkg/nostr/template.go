@@ -0,0 +1,139 @@
+package nostr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/crypto"
+)
+
+// EventTemplate holds everything the author chooses about an event before
+// signing it. A zero CreatedAt is replaced with the current time.
+type EventTemplate struct {
+	Kind      int
+	Tags      nostrlib.Tags
+	CreatedAt nostrlib.Timestamp
+	Content   string
+}
+
+// NoteTemplate returns the template of a kind 1 text note.
+func NoteTemplate(content string) EventTemplate {
+	return EventTemplate{
+		Kind:    nostrlib.KindTextNote,
+		Tags:    nostrlib.Tags{},
+		Content: content,
+	}
+}
+
+// kindRule checks what a kind requires of an event beyond the generic rules.
+type kindRule func(t *EventTemplate) error
+
+// kindRules holds the checks of the kinds with required tags or content.
+var kindRules = map[int]kindRule{
+	nostrlib.KindProfileMetadata: func(t *EventTemplate) error {
+		var metadata map[string]any
+		if err := json.Unmarshal([]byte(t.Content), &metadata); err != nil {
+			return fmt.Errorf("profile metadata content must be a JSON object: %v", err)
+		}
+		return nil
+	},
+	nostrlib.KindBadgeAward: func(t *EventTemplate) error {
+		a := t.Tags.Find("a")
+		if a == nil || !strings.HasPrefix(a[1], fmt.Sprintf("%d:", nostrlib.KindBadgeDefinition)) {
+			return fmt.Errorf("badge award needs an \"a\" tag for a badge definition")
+		}
+		return requireTags(t, "p")
+	},
+	nostrlib.KindFileMetadata: func(t *EventTemplate) error {
+		if err := requireTags(t, "url", "m", "x"); err != nil {
+			return err
+		}
+		if !nostrlib.IsValid32ByteHex(t.Tags.Find("x")[1]) {
+			return fmt.Errorf("file metadata \"x\" tag must be a SHA-256 hash in hex")
+		}
+		return nil
+	},
+	nostrlib.KindZap: func(t *EventTemplate) error {
+		if err := requireTags(t, "p", "bolt11", "description"); err != nil {
+			return err
+		}
+		var request nostrlib.Event
+		if err := json.Unmarshal([]byte(t.Tags.Find("description")[1]), &request); err != nil || request.Kind != nostrlib.KindZapRequest {
+			return fmt.Errorf("zap receipt \"description\" tag must hold a zap request")
+		}
+		return nil
+	},
+	nostrlib.KindArticle: func(t *EventTemplate) error {
+		if strings.TrimSpace(t.Content) == "" {
+			return fmt.Errorf("long-form article has no content")
+		}
+		return nil
+	},
+}
+
+// requireTags checks that the template has a tag with a value for every name.
+func requireTags(t *EventTemplate, names ...string) error {
+	for _, name := range names {
+		if t.Tags.Find(name) == nil {
+			return fmt.Errorf("kind %d needs a %q tag", t.Kind, name)
+		}
+	}
+	return nil
+}
+
+// Validate checks the template before it is signed. Every kind must be in
+// range and not ephemeral, since relays do not store ephemeral events and
+// there would be nothing to sell. Tags must have a name, "e" and "p" tags
+// must reference a 32-byte hex ID or key, and addressable kinds need a "d"
+// tag. Kinds with their own requirements, such as profile metadata, badge
+// awards, NIP-94 file metadata, zap receipts and long-form articles, are
+// checked against them.
+func (t *EventTemplate) Validate() error {
+	if t.Kind < 0 || t.Kind > 65535 {
+		return fmt.Errorf("kind %d is out of range", t.Kind)
+	}
+	if nostrlib.IsEphemeralKind(t.Kind) {
+		return fmt.Errorf("kind %d is ephemeral", t.Kind)
+	}
+
+	for i, tag := range t.Tags {
+		if len(tag) == 0 || tag[0] == "" {
+			return fmt.Errorf("tag %d has no name", i)
+		}
+		switch tag[0] {
+		case "e", "p":
+			if len(tag) < 2 || !nostrlib.IsValid32ByteHex(tag[1]) {
+				return fmt.Errorf("%q tag %d must reference a 32-byte hex value", tag[0], i)
+			}
+		}
+	}
+
+	if nostrlib.IsAddressableKind(t.Kind) && t.Tags.Find("d") == nil {
+		return fmt.Errorf("addressable kind %d needs a \"d\" tag", t.Kind)
+	}
+	if rule, ok := kindRules[t.Kind]; ok {
+		return rule(t)
+	}
+
+	return nil
+}
+
+// SignTemplate validates the template and turns it into an event signed
+// with the given private key.
+func SignTemplate(privKeyHex string, template EventTemplate) (nostrlib.Event, error) {
+	key, err := crypto.SecretKeyFromHex(privKeyHex)
+	if err != nil {
+		return nostrlib.Event{}, err
+	}
+	defer key.Zero()
+
+	pending, err := PrepareEvent(NewLocalSigner(key), template)
+	if err != nil {
+		return nostrlib.Event{}, err
+	}
+
+	return pending.Sign()
+}
@@ -0,0 +1,73 @@
+package nostr
+
+import (
+	"strings"
+	"testing"
+
+	nostrlib "github.com/nbd-wtf/go-nostr"
+)
+
+// TestValidateTemplate checks the generic and per-kind template rules.
+func TestValidateTemplate(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	zapRequest := `{"kind":9734,"content":"","tags":[],"created_at":1,"pubkey":"` + hash + `"}`
+
+	valid := map[string]EventTemplate{
+		"note":          NoteTemplate("hello"),
+		"metadata":      {Kind: nostrlib.KindProfileMetadata, Content: `{"name":"tanos"}`},
+		"article":       {Kind: nostrlib.KindArticle, Tags: nostrlib.Tags{{"d", "swap"}}, Content: "# Title"},
+		"replaceable":   {Kind: 10002, Tags: nostrlib.Tags{{"r", "wss://relay.example"}}},
+		"badge award":   {Kind: nostrlib.KindBadgeAward, Tags: nostrlib.Tags{{"a", "30009:" + hash + ":b"}, {"p", hash}}},
+		"file metadata": {Kind: nostrlib.KindFileMetadata, Tags: nostrlib.Tags{{"url", "https://f"}, {"m", "image/png"}, {"x", hash}}},
+		"zap receipt":   {Kind: nostrlib.KindZap, Tags: nostrlib.Tags{{"p", hash}, {"bolt11", "lnbc1"}, {"description", zapRequest}}},
+	}
+	for name, template := range valid {
+		if err := template.Validate(); err != nil {
+			t.Fatalf("Valid %s template rejected: %v", name, err)
+		}
+	}
+
+	invalid := map[string]EventTemplate{
+		"negative kind":       {Kind: -1},
+		"ephemeral":           {Kind: 20001},
+		"unnamed tag":         {Kind: 1, Tags: nostrlib.Tags{{""}}},
+		"bad p tag":           {Kind: 1, Tags: nostrlib.Tags{{"p", "npub"}}},
+		"metadata not JSON":   {Kind: nostrlib.KindProfileMetadata, Content: "name"},
+		"article without d":   {Kind: nostrlib.KindArticle, Content: "# Title"},
+		"empty article":       {Kind: nostrlib.KindArticle, Tags: nostrlib.Tags{{"d", "swap"}}},
+		"award without badge": {Kind: nostrlib.KindBadgeAward, Tags: nostrlib.Tags{{"a", "30023:" + hash + ":b"}, {"p", hash}}},
+		"file without hash":   {Kind: nostrlib.KindFileMetadata, Tags: nostrlib.Tags{{"url", "https://f"}, {"m", "image/png"}}},
+		"zap without request": {Kind: nostrlib.KindZap, Tags: nostrlib.Tags{{"p", hash}, {"bolt11", "lnbc1"}, {"description", "{}"}}},
+	}
+	for name, template := range invalid {
+		if err := template.Validate(); err == nil {
+			t.Fatalf("Invalid %s template accepted", name)
+		}
+	}
+}
+
+// TestSignTemplate checks that signed events keep the template's fields.
+func TestSignTemplate(t *testing.T) {
+	template := EventTemplate{
+		Kind:      nostrlib.KindArticle,
+		Tags:      nostrlib.Tags{{"d", "swap"}, {"title", "Sold"}},
+		CreatedAt: 1700000000,
+		Content:   "# Sold over TANOS",
+	}
+
+	ev, err := SignTemplate(GeneratePrivateKey(), template)
+	if err != nil {
+		t.Fatalf("Failed to sign template: %v", err)
+	}
+	if ev.Kind != template.Kind || ev.CreatedAt != template.CreatedAt ||
+		ev.Content != template.Content || len(ev.Tags) != len(template.Tags) {
+		t.Fatalf("Signed event differs from the template")
+	}
+	if ok, err := ev.CheckSignature(); !ok {
+		t.Fatalf("Signed event does not verify: %v", err)
+	}
+
+	if _, err := SignTemplate(GeneratePrivateKey(), EventTemplate{Kind: 20001}); err == nil {
+		t.Fatalf("Signed an ephemeral event")
+	}
+}
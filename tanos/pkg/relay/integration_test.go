@@ -0,0 +1,210 @@
+package relay_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+	"tanos/pkg/negotiation"
+	"tanos/pkg/nostr"
+	"tanos/pkg/relay"
+	"tanos/pkg/tanos"
+)
+
+// startRelay serves a fresh relay on a random local port.
+func startRelay(t *testing.T) *relay.Server {
+	server, err := relay.Listen(relay.New(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start relay: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	return server
+}
+
+// connect opens a client connection to the relay, closed with ctx.
+func connect(t *testing.T, ctx context.Context, url string) *nostrlib.Relay {
+	conn, err := nostr.ConnectRelay(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	return conn
+}
+
+// TestWebsocketSubscription checks REQ, EOSE and CLOSE handling.
+func TestWebsocketSubscription(t *testing.T) {
+	server := startRelay(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn := connect(t, ctx, server.URL())
+
+	key := nostr.GeneratePrivateKey()
+	stored, err := nostr.CreateSignedEvent(key, "stored")
+	if err != nil {
+		t.Fatalf("Failed to create event: %v", err)
+	}
+	if err := nostr.PublishEvent(ctx, conn, stored); err != nil {
+		t.Fatalf("Failed to publish event: %v", err)
+	}
+
+	sub, err := conn.Subscribe(ctx, nostrlib.Filters{{Authors: []string{stored.PubKey}}})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if ev := <-sub.Events; ev.ID != stored.ID {
+		t.Fatalf("Expected the stored event first")
+	}
+	select {
+	case <-sub.EndOfStoredEvents:
+	case <-ctx.Done():
+		t.Fatalf("No EOSE received")
+	}
+
+	live, _ := nostr.CreateSignedEvent(key, "live")
+	if err := nostr.PublishEvent(ctx, conn, live); err != nil {
+		t.Fatalf("Failed to publish event: %v", err)
+	}
+	if ev := <-sub.Events; ev.ID != live.ID {
+		t.Fatalf("Expected the live event")
+	}
+	sub.Unsub()
+
+	bad := live
+	bad.Content = "tampered"
+	if err := nostr.PublishEvent(ctx, conn, bad); err == nil {
+		t.Fatalf("Relay accepted a tampered event")
+	}
+
+	// Closing a subscription leaves the connection open
+	after, _ := nostr.CreateSignedEvent(key, "after close")
+	if err := nostr.PublishEvent(ctx, conn, after); err != nil {
+		t.Fatalf("Failed to publish after closing a subscription: %v", err)
+	}
+	sub, err = conn.Subscribe(ctx, nostrlib.Filters{{IDs: []string{after.ID}}})
+	if err != nil {
+		t.Fatalf("Failed to subscribe again: %v", err)
+	}
+	if ev := <-sub.Events; ev.ID != after.ID {
+		t.Fatalf("Expected the event published after closing")
+	}
+}
+
+// TestSwapOverWebsocketRelay runs two parties of a swap through the relay,
+// then has the seller publish the sold event and the buyer fetch it.
+func TestSwapOverWebsocketRelay(t *testing.T) {
+	server := startRelay(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	sellerKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate seller key: %v", err)
+	}
+	sellerSigner := nostr.NewLocalSigner(sellerKey)
+	seller, err := tanos.NewSeller(sellerSigner)
+	if err != nil {
+		t.Fatalf("Failed to create seller: %v", err)
+	}
+	if err := seller.CreateEvent("sold over a local relay"); err != nil {
+		t.Fatalf("Failed to create event: %v", err)
+	}
+	sellerSwap, err := tanos.NewSellerSwap(seller)
+	if err != nil {
+		t.Fatalf("Failed to create seller swap: %v", err)
+	}
+	sellerConn := connect(t, ctx, server.URL())
+	sellerClient, err := negotiation.NewClient(negotiation.NewRelay(sellerConn), sellerSigner)
+	if err != nil {
+		t.Fatalf("Failed to create seller client: %v", err)
+	}
+
+	buyerKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate buyer key: %v", err)
+	}
+	buyer, err := tanos.NewBuyer(buyerKey)
+	if err != nil {
+		t.Fatalf("Failed to create buyer: %v", err)
+	}
+	buyerConn := connect(t, ctx, server.URL())
+	buyerNostrKey, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate buyer Nostr key: %v", err)
+	}
+	buyerClient, err := negotiation.NewClient(negotiation.NewRelay(buyerConn), nostr.NewLocalSigner(buyerNostrKey))
+	if err != nil {
+		t.Fatalf("Failed to create buyer client: %v", err)
+	}
+
+	params := &chaincfg.RegressionNetParams
+	chain := bitcoin.NewSimChain()
+	_, prevScript, err := bitcoin.CreateP2TRAddress(buyer.PublicKey, params)
+	if err != nil {
+		t.Fatalf("Failed to create funding script: %v", err)
+	}
+	prevTx := chain.Fund(prevScript, 110000)
+
+	go func() {
+		for ctx.Err() == nil {
+			chain.Mine(1)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	sellerClient.PollInterval = 10 * time.Millisecond
+
+	type sold struct {
+		claimTx *wire.MsgTx
+		err     error
+	}
+	sellDone := make(chan sold, 1)
+	go func() {
+		terms := negotiation.SaleTerms{Amount: 100000, Confirmations: 1, DestScript: prevScript, FeeRate: bitcoin.FeeRatePerVByte(5)}
+		claimTx, err := sellerClient.Sell(ctx, sellerSwap, buyerClient.PublicKey(), chain, terms)
+		sellDone <- sold{claimTx, err}
+	}()
+
+	fund := func(b *tanos.SwapBuyer, offer *tanos.Offer) error {
+		err := b.CreateMuSig2LockingTransaction(
+			100000, prevTx.TxHash().String(), 0, 110000, prevScript,
+			offer.ClaimKey, bitcoin.RelativeBlocks(144), params,
+		)
+		if err != nil {
+			return err
+		}
+		return b.SignLockingTransaction()
+	}
+	buyerSwap, err := buyerClient.Buy(ctx, buyer, sellerClient.PublicKey(), chain, nil, fund)
+	if err != nil {
+		t.Fatalf("Buyer failed: %v", err)
+	}
+	res := <-sellDone
+	if res.err != nil {
+		t.Fatalf("Seller failed: %v", res.err)
+	}
+	if buyerSwap.Phase != tanos.PhaseClaimed || sellerSwap.Phase != tanos.PhaseClaimed {
+		t.Fatalf("Swaps ended in phases %s and %s", buyerSwap.Phase, sellerSwap.Phase)
+	}
+	if buyerSwap.ClaimTx.TxHash() != res.claimTx.TxHash() {
+		t.Fatalf("Buyer saw another claim than the seller's")
+	}
+
+	// The seller publishes the event it sold, and the buyer finds it with
+	// the signature it paid for
+	if err := nostr.PublishEvent(ctx, sellerConn, seller.Event); err != nil {
+		t.Fatalf("Failed to publish sold event: %v", err)
+	}
+	ev, err := nostr.FetchEvent(ctx, buyerConn, buyerSwap.Offer.EventID)
+	if err != nil {
+		t.Fatalf("Failed to fetch sold event: %v", err)
+	}
+	if ev.Sig != seller.Event.Sig || ev.Sig != buyerSwap.NostrSig {
+		t.Fatalf("Fetched event carries a different signature")
+	}
+}
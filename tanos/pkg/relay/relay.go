@@ -0,0 +1,271 @@
+// Package relay implements a minimal NIP-01 Nostr relay that keeps its
+// events in memory. It can be used in-process, through Publish and
+// Subscribe, or served to Nostr clients over websocket, which makes it a
+// stand-in for public relays in tests and local swaps.
+package relay
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	nostrlib "github.com/nbd-wtf/go-nostr"
+)
+
+// Relay stores events and delivers them to matching subscriptions.
+type Relay struct {
+	mu     sync.Mutex
+	events []*nostrlib.Event   // Stored events, in arrival order
+	ids    map[string]struct{} // Stored events and ephemeral events seen
+	subs   map[*subscription]struct{}
+	closed bool
+}
+
+// New creates an empty relay.
+func New() *Relay {
+	return &Relay{
+		ids:  make(map[string]struct{}),
+		subs: make(map[*subscription]struct{}),
+	}
+}
+
+// Publish checks and stores an event, then delivers it to the matching
+// subscriptions. Duplicates are accepted without being delivered again.
+// Ephemeral events are delivered but not stored, although their IDs are
+// kept so that duplicates are dropped alike, and replaceable events
+// replace the older version from the same author.
+func (r *Relay) Publish(_ context.Context, event nostrlib.Event) error {
+	if !event.CheckID() {
+		return fmt.Errorf("invalid: event ID does not match its content")
+	}
+	if ok, err := event.CheckSignature(); !ok {
+		return fmt.Errorf("invalid: bad event signature: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return fmt.Errorf("relay is closed")
+	}
+	if _, ok := r.ids[event.ID]; ok {
+		return nil
+	}
+
+	ev := &event
+	if !nostrlib.IsEphemeralKind(ev.Kind) {
+		if !r.replace(ev) {
+			// An older version of a replaceable event is dropped
+			return nil
+		}
+		r.events = append(r.events, ev)
+	}
+	r.ids[ev.ID] = struct{}{}
+
+	for sub := range r.subs {
+		if sub.filters.Match(ev) {
+			sub.push(ev)
+		}
+	}
+
+	return nil
+}
+
+// replace removes the stored version that ev replaces, if any. It returns
+// false when the stored version is newer and ev should be dropped.
+func (r *Relay) replace(ev *nostrlib.Event) bool {
+	if !nostrlib.IsReplaceableKind(ev.Kind) && !nostrlib.IsAddressableKind(ev.Kind) {
+		return true
+	}
+
+	for i, old := range r.events {
+		if old.PubKey != ev.PubKey || old.Kind != ev.Kind {
+			continue
+		}
+		if nostrlib.IsAddressableKind(ev.Kind) && old.Tags.GetD() != ev.Tags.GetD() {
+			continue
+		}
+
+		// Ties keep the event with the lowest ID
+		if old.CreatedAt > ev.CreatedAt || (old.CreatedAt == ev.CreatedAt && old.ID < ev.ID) {
+			return false
+		}
+
+		r.events = append(r.events[:i], r.events[i+1:]...)
+		delete(r.ids, old.ID)
+		return true
+	}
+
+	return true
+}
+
+// Query returns the stored events matching the filters, newest first. The
+// limit of each filter keeps only its newest matches.
+func (r *Relay) Query(filters nostrlib.Filters) []*nostrlib.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.query(filters)
+}
+
+func (r *Relay) query(filters nostrlib.Filters) []*nostrlib.Event {
+	seen := make(map[string]struct{})
+	var result []*nostrlib.Event
+
+	for _, filter := range filters {
+		if filter.LimitZero {
+			continue
+		}
+
+		var matches []*nostrlib.Event
+		for _, ev := range r.events {
+			if filter.Matches(ev) {
+				matches = append(matches, ev)
+			}
+		}
+		sortNewestFirst(matches)
+		if filter.Limit > 0 && len(matches) > filter.Limit {
+			matches = matches[:filter.Limit]
+		}
+
+		for _, ev := range matches {
+			if _, ok := seen[ev.ID]; !ok {
+				seen[ev.ID] = struct{}{}
+				result = append(result, ev)
+			}
+		}
+	}
+
+	sortNewestFirst(result)
+	return result
+}
+
+// sortNewestFirst orders events by creation time, newest first, keeping
+// arrival order among events created in the same second.
+func sortNewestFirst(events []*nostrlib.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].CreatedAt > events[j].CreatedAt
+	})
+}
+
+// Subscribe returns the stored events matching the filters, followed by the
+// matching events published afterwards. The channel is closed once ctx is
+// done or the relay is closed.
+func (r *Relay) Subscribe(ctx context.Context, filters nostrlib.Filters) (<-chan *nostrlib.Event, error) {
+	stored, live, err := r.subscribe(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *nostrlib.Event)
+	go func() {
+		defer close(out)
+
+		for _, ev := range stored {
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for ev := range live {
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// subscribe registers a subscription and returns the stored events it
+// matches along with the channel of events published from now on.
+func (r *Relay) subscribe(ctx context.Context, filters nostrlib.Filters) ([]*nostrlib.Event, <-chan *nostrlib.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, nil, fmt.Errorf("relay is closed")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &subscription{
+		filters: filters,
+		notify:  make(chan struct{}, 1),
+		cancel:  cancel,
+	}
+	r.subs[sub] = struct{}{}
+
+	live := make(chan *nostrlib.Event)
+	go func() {
+		sub.run(ctx, live)
+
+		r.mu.Lock()
+		delete(r.subs, sub)
+		r.mu.Unlock()
+	}()
+
+	return r.query(filters), live, nil
+}
+
+// Close ends every subscription and rejects further events.
+func (r *Relay) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	for sub := range r.subs {
+		sub.cancel()
+	}
+}
+
+// subscription queues the live events of one subscriber, so that a slow
+// subscriber never holds up Publish.
+type subscription struct {
+	filters nostrlib.Filters
+	mu      sync.Mutex
+	queue   []*nostrlib.Event
+	notify  chan struct{}
+	cancel  context.CancelFunc
+}
+
+// push queues an event for the subscriber.
+func (s *subscription) push(ev *nostrlib.Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, ev)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued events on out until ctx is done, then closes out.
+func (s *subscription) run(ctx context.Context, out chan<- *nostrlib.Event) {
+	defer close(out)
+
+	for {
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, ev := range queue {
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-s.notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package relay
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	nostrlib "github.com/nbd-wtf/go-nostr"
+)
+
+// signed creates an event of the given kind and age signed with key.
+func signed(t *testing.T, key string, kind int, age time.Duration, tags nostrlib.Tags, content string) nostrlib.Event {
+	pub, err := nostrlib.GetPublicKey(key)
+	if err != nil {
+		t.Fatalf("Failed to derive public key: %v", err)
+	}
+
+	ev := nostrlib.Event{
+		PubKey:    pub,
+		CreatedAt: nostrlib.Timestamp(time.Now().Add(-age).Unix()),
+		Kind:      kind,
+		Tags:      tags,
+		Content:   content,
+	}
+	if err := ev.Sign(key); err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+
+	return ev
+}
+
+// TestQueryFilters checks filtering by kind, author, tag, since and limit.
+func TestQueryFilters(t *testing.T) {
+	r := New()
+	ctx := context.Background()
+	alice := nostrlib.GeneratePrivateKey()
+	bob := nostrlib.GeneratePrivateKey()
+	bobPub, _ := nostrlib.GetPublicKey(bob)
+
+	old := signed(t, alice, 1, time.Hour, nil, "old")
+	note := signed(t, alice, 1, time.Minute, nostrlib.Tags{{"p", bobPub}}, "to bob")
+	other := signed(t, bob, 7, 0, nil, "+")
+	for _, ev := range []nostrlib.Event{old, note, other} {
+		if err := r.Publish(ctx, ev); err != nil {
+			t.Fatalf("Failed to publish event: %v", err)
+		}
+	}
+
+	since := nostrlib.Timestamp(time.Now().Add(-10 * time.Minute).Unix())
+	tests := []struct {
+		name   string
+		filter nostrlib.Filter
+		want   []string
+	}{
+		{"kind", nostrlib.Filter{Kinds: []int{7}}, []string{other.ID}},
+		{"author", nostrlib.Filter{Authors: []string{old.PubKey}}, []string{note.ID, old.ID}},
+		{"tag", nostrlib.Filter{Tags: nostrlib.TagMap{"p": []string{bobPub}}}, []string{note.ID}},
+		{"since", nostrlib.Filter{Kinds: []int{1}, Since: &since}, []string{note.ID}},
+		{"limit", nostrlib.Filter{Limit: 2}, []string{other.ID, note.ID}},
+		{"limit zero", nostrlib.Filter{LimitZero: true}, nil},
+	}
+	for _, test := range tests {
+		got := r.Query(nostrlib.Filters{test.filter})
+		if len(got) != len(test.want) {
+			t.Fatalf("%s: expected %d events, got %d", test.name, len(test.want), len(got))
+		}
+		for i, ev := range got {
+			if ev.ID != test.want[i] {
+				t.Fatalf("%s: unexpected event at position %d", test.name, i)
+			}
+		}
+	}
+}
+
+// TestPublishRules checks that invalid events are rejected, replaceable
+// events replaced and ephemeral events not stored.
+func TestPublishRules(t *testing.T) {
+	r := New()
+	ctx := context.Background()
+	key := nostrlib.GeneratePrivateKey()
+
+	forged := signed(t, key, 1, 0, nil, "hello")
+	forged.Content = "goodbye"
+	if err := r.Publish(ctx, forged); err == nil {
+		t.Fatalf("Accepted an event whose ID does not match")
+	}
+	forged = signed(t, key, 1, 0, nil, "hello")
+	forged.Sig = signed(t, key, 1, 0, nil, "other").Sig
+	if err := r.Publish(ctx, forged); err == nil {
+		t.Fatalf("Accepted an event with a bad signature")
+	}
+
+	older := signed(t, key, 0, time.Hour, nil, `{"name":"old"}`)
+	newer := signed(t, key, 0, 0, nil, `{"name":"new"}`)
+	for _, ev := range []nostrlib.Event{newer, older} {
+		if err := r.Publish(ctx, ev); err != nil {
+			t.Fatalf("Failed to publish metadata: %v", err)
+		}
+	}
+	got := r.Query(nostrlib.Filters{{Kinds: []int{0}}})
+	if len(got) != 1 || got[0].ID != newer.ID {
+		t.Fatalf("Expected only the newest metadata to be kept")
+	}
+
+	live, err := r.Subscribe(ctx, nostrlib.Filters{{Kinds: []int{20001}}})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	ephemeral := signed(t, key, 20001, 0, nil, "")
+	for i := 0; i < 2; i++ {
+		if err := r.Publish(ctx, ephemeral); err != nil {
+			t.Fatalf("Failed to publish ephemeral event: %v", err)
+		}
+	}
+	if got := r.Query(nostrlib.Filters{{Kinds: []int{20001}}}); len(got) != 0 {
+		t.Fatalf("Ephemeral event was stored")
+	}
+	if ev := <-live; ev.ID != ephemeral.ID {
+		t.Fatalf("Ephemeral event was not delivered")
+	}
+	select {
+	case <-live:
+		t.Fatalf("Duplicate ephemeral event was delivered again")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestSubscribeDeliversStoredThenLive checks in-process subscriptions and
+// that closing the relay ends them.
+func TestSubscribeDeliversStoredThenLive(t *testing.T) {
+	r := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key := nostrlib.GeneratePrivateKey()
+
+	stored := signed(t, key, 1, time.Minute, nil, "stored")
+	if err := r.Publish(ctx, stored); err != nil {
+		t.Fatalf("Failed to publish event: %v", err)
+	}
+
+	events, err := r.Subscribe(ctx, nostrlib.Filters{{Kinds: []int{1}}})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	live := signed(t, key, 1, 0, nil, "live")
+	if err := r.Publish(ctx, live); err != nil {
+		t.Fatalf("Failed to publish event: %v", err)
+	}
+	if err := r.Publish(ctx, signed(t, key, 7, 0, nil, "+")); err != nil {
+		t.Fatalf("Failed to publish event: %v", err)
+	}
+
+	for _, want := range []string{stored.ID, live.ID} {
+		if ev := <-events; ev == nil || ev.ID != want {
+			t.Fatalf("Unexpected event delivered")
+		}
+	}
+
+	r.Close()
+	if _, ok := <-events; ok {
+		t.Fatalf("Subscription stayed open after the relay closed")
+	}
+	if err := r.Publish(ctx, signed(t, key, 1, 0, nil, "late")); err == nil {
+		t.Fatalf("Closed relay accepted an event")
+	}
+}
@@ -0,0 +1,206 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/coder/websocket"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+)
+
+// MaxMessageSize is the largest websocket message a client may send.
+const MaxMessageSize = 512 * 1024
+
+// ServeHTTP serves the relay to a Nostr client over websocket.
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	conn, err := websocket.Accept(w, req, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(MaxMessageSize)
+
+	c := &client{
+		relay: r,
+		conn:  conn,
+		subs:  make(map[string]context.CancelFunc),
+	}
+	c.serve(req.Context())
+}
+
+// client is one websocket connection to the relay.
+type client struct {
+	relay *Relay
+	conn  *websocket.Conn
+
+	mu   sync.Mutex
+	subs map[string]context.CancelFunc
+}
+
+// serve handles the client's messages until the connection ends.
+func (c *client) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parser := nostrlib.NewMessageParser()
+	for {
+		typ, data, err := c.conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		if typ != websocket.MessageText {
+			c.send(ctx, nostrlib.NoticeEnvelope("error: expected a text message"))
+			continue
+		}
+
+		env, err := parser.ParseMessage(string(data))
+		if err != nil {
+			c.send(ctx, nostrlib.NoticeEnvelope(fmt.Sprintf("error: invalid message: %v", err)))
+			continue
+		}
+
+		switch env := env.(type) {
+		case *nostrlib.EventEnvelope:
+			ok := nostrlib.OKEnvelope{EventID: env.Event.ID, OK: true}
+			if err := c.relay.Publish(ctx, env.Event); err != nil {
+				ok.OK = false
+				ok.Reason = err.Error()
+			}
+			c.send(ctx, ok)
+
+		case *nostrlib.ReqEnvelope:
+			c.subscribe(ctx, env.SubscriptionID, env.Filters)
+
+		case *nostrlib.CloseEnvelope:
+			c.unsubscribe(string(*env))
+
+		default:
+			c.send(ctx, nostrlib.NoticeEnvelope(fmt.Sprintf("error: unsupported message %s", env.Label())))
+		}
+	}
+}
+
+// subscribe answers a REQ with the stored events and EOSE, then forwards
+// live events until the subscription is closed. A REQ reusing an open
+// subscription ID replaces it.
+func (c *client) subscribe(ctx context.Context, id string, filters nostrlib.Filters) {
+	c.unsubscribe(id)
+
+	subCtx, cancel := context.WithCancel(ctx)
+	stored, live, err := c.relay.subscribe(subCtx, filters)
+	if err != nil {
+		cancel()
+		c.send(ctx, nostrlib.ClosedEnvelope{SubscriptionID: id, Reason: "error: " + err.Error()})
+		return
+	}
+
+	c.mu.Lock()
+	c.subs[id] = cancel
+	c.mu.Unlock()
+
+	// Writes use the connection's context, since the websocket closes the
+	// whole connection when a write's context is cancelled
+	for _, ev := range stored {
+		if subCtx.Err() != nil {
+			return
+		}
+		c.send(ctx, nostrlib.EventEnvelope{SubscriptionID: &id, Event: *ev})
+	}
+	c.send(ctx, nostrlib.EOSEEnvelope(id))
+
+	go func() {
+		for {
+			select {
+			case <-subCtx.Done():
+				return
+			case ev, ok := <-live:
+				if ok {
+					c.send(ctx, nostrlib.EventEnvelope{SubscriptionID: &id, Event: *ev})
+					continue
+				}
+
+				// Still wanted by the client, so the relay was closed
+				if subCtx.Err() == nil {
+					c.unsubscribe(id)
+					c.send(ctx, nostrlib.ClosedEnvelope{SubscriptionID: id, Reason: "error: relay is closed"})
+				}
+				return
+			}
+		}
+	}()
+}
+
+// unsubscribe ends the subscription with the given ID, if open.
+func (c *client) unsubscribe(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cancel, ok := c.subs[id]; ok {
+		cancel()
+		delete(c.subs, id)
+	}
+}
+
+// send writes a message to the client. Write errors end the connection on
+// the next read, so they are not reported here.
+func (c *client) send(ctx context.Context, env json.Marshaler) {
+	data, err := env.MarshalJSON()
+	if err != nil {
+		return
+	}
+	_ = c.conn.Write(ctx, websocket.MessageText, data)
+}
+
+// Server serves a relay over websocket on a local address.
+type Server struct {
+	listener net.Listener
+	http     *http.Server
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Listen starts serving the relay on addr, such as "127.0.0.1:0" for a
+// random local port.
+func Listen(relay *Relay, addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	// Websocket connections outlive http.Server.Close, so they are tied to
+	// a context that Close cancels
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		listener: listener,
+		http: &http.Server{
+			Handler:     relay,
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		_ = s.http.Serve(listener)
+	}()
+
+	return s, nil
+}
+
+// URL returns the websocket URL clients connect to.
+func (s *Server) URL() string {
+	return "ws://" + s.listener.Addr().String()
+}
+
+// Close stops the server and drops its connections. The relay itself is
+// left open.
+func (s *Server) Close() error {
+	s.cancel()
+	err := s.http.Close()
+	<-s.done
+	return err
+}
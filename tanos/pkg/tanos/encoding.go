@@ -0,0 +1,490 @@
+package tanos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+	"tanos/pkg/musig2"
+)
+
+// EncodingVersion is the version of the Offer, FundingNotice and
+// ClaimProposal encodings.
+const EncodingVersion = 1
+
+// ErrUnsupportedVersion is returned when decoding an encoding of an
+// unknown version.
+var ErrUnsupportedVersion = errors.New("unsupported encoding version")
+
+// nonceProofSize is the size of a binary encoded NonceProof.
+const nonceProofSize = 64
+
+// offerSize is the size of a binary encoded Offer.
+const offerSize = 1 + 32 + 32 + 3*secp.PubKeyBytesLenCompressed + nonceProofSize
+
+// MarshalBinary encodes the offer as
+//
+//	version (1) || event ID (32) || x-only Nostr key (32) || R compressed (33) ||
+//	T compressed (33) || claim key compressed (33) || proof e (32) || proof s (32)
+func (o *Offer) MarshalBinary() ([]byte, error) {
+	eventID, err := crypto.DecodeHexStrict(o.EventID, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event ID: %v", err)
+	}
+	nostrPubKey, err := crypto.DecodeHexStrict(o.NostrPubKey, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Nostr public key: %v", err)
+	}
+	if o.Nonce == nil || o.Commitment == nil {
+		return nil, fmt.Errorf("offer is missing the nonce or commitment point")
+	}
+	if o.ClaimKey == nil {
+		return nil, fmt.Errorf("offer is missing the claim key")
+	}
+	if o.NonceProof == nil || o.NonceProof.E == nil || o.NonceProof.S == nil {
+		return nil, fmt.Errorf("offer is missing the nonce proof")
+	}
+
+	buf := make([]byte, 0, offerSize)
+	buf = append(buf, EncodingVersion)
+	buf = append(buf, eventID...)
+	buf = append(buf, nostrPubKey...)
+	buf = append(buf, o.Nonce.SerializeCompressed()...)
+	buf = append(buf, o.Commitment.SerializeCompressed()...)
+	buf = append(buf, o.ClaimKey.SerializeCompressed()...)
+	e, s := o.NonceProof.E.Bytes(), o.NonceProof.S.Bytes()
+	buf = append(buf, e[:]...)
+	buf = append(buf, s[:]...)
+
+	return buf, nil
+}
+
+// UnmarshalBinary decodes an offer encoded by MarshalBinary. The Nostr key
+// must be a valid x-only key, the nonce a BIP340 nonce with even Y, the
+// commitment and claim key compressed points on the curve and the proof scalars must be
+// below the group order. The proof itself is checked by NewBuyerSwap.
+func (o *Offer) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty offer encoding")
+	}
+	if data[0] != EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[0])
+	}
+	if len(data) != offerSize {
+		return fmt.Errorf("offer encoding must be %d bytes, got %d", offerSize, len(data))
+	}
+
+	eventID := data[1:33]
+	nostrPubKey := data[33:65]
+	if _, err := schnorr.ParsePubKey(nostrPubKey); err != nil {
+		return fmt.Errorf("invalid Nostr public key: %v", err)
+	}
+
+	nonceBytes := data[65:98]
+	if nonceBytes[0] != 0x02 {
+		return fmt.Errorf("offer nonce must have an even Y coordinate")
+	}
+	nonce, err := crypto.ParseCompressedPubKey(nonceBytes)
+	if err != nil {
+		return fmt.Errorf("invalid nonce: %v", err)
+	}
+	commitment, err := crypto.ParseCompressedPubKey(data[98:131])
+	if err != nil {
+		return fmt.Errorf("invalid commitment: %v", err)
+	}
+	claimKey, err := crypto.ParseCompressedPubKey(data[131:164])
+	if err != nil {
+		return fmt.Errorf("invalid claim key: %v", err)
+	}
+	proof := &NonceProof{E: new(secp.ModNScalar), S: new(secp.ModNScalar)}
+	if overflow := proof.E.SetByteSlice(data[164:196]); overflow {
+		return fmt.Errorf("nonce proof challenge overflows the group order")
+	}
+	if overflow := proof.S.SetByteSlice(data[196:]); overflow {
+		return fmt.Errorf("nonce proof scalar overflows the group order")
+	}
+
+	*o = Offer{
+		EventID:     crypto.HexEncode(eventID),
+		NostrPubKey: crypto.HexEncode(nostrPubKey),
+		Nonce:       nonce,
+		Commitment:  commitment,
+		ClaimKey:    claimKey,
+		NonceProof:  proof,
+	}
+
+	return nil
+}
+
+// offerJSON is the JSON form of an Offer, with hex encoded fields.
+type offerJSON struct {
+	Version     int    `json:"version"`
+	EventID     string `json:"event_id"`
+	NostrPubKey string `json:"nostr_pubkey"`
+	Nonce       string `json:"nonce"`
+	Commitment  string `json:"commitment"`
+	ClaimKey    string `json:"claim_key"`
+	NonceProof  string `json:"nonce_proof"`
+}
+
+// MarshalJSON encodes the offer as a versioned JSON object with lowercase
+// hex fields.
+func (o Offer) MarshalJSON() ([]byte, error) {
+	if _, err := o.MarshalBinary(); err != nil {
+		return nil, err
+	}
+
+	e, s := o.NonceProof.E.Bytes(), o.NonceProof.S.Bytes()
+
+	return json.Marshal(offerJSON{
+		Version:     EncodingVersion,
+		EventID:     o.EventID,
+		NostrPubKey: o.NostrPubKey,
+		Nonce:       crypto.HexEncode(o.Nonce.SerializeCompressed()),
+		Commitment:  crypto.HexEncode(o.Commitment.SerializeCompressed()),
+		ClaimKey:    crypto.HexEncode(o.ClaimKey.SerializeCompressed()),
+		NonceProof:  crypto.HexEncode(append(e[:], s[:]...)),
+	})
+}
+
+// UnmarshalJSON decodes an offer encoded by MarshalJSON, with the same
+// checks as UnmarshalBinary. Unknown fields are rejected.
+func (o *Offer) UnmarshalJSON(data []byte) error {
+	var v offerJSON
+	if err := decodeStrictJSON(data, &v); err != nil {
+		return fmt.Errorf("invalid offer JSON: %v", err)
+	}
+	if v.Version != EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, v.Version)
+	}
+
+	raw := []byte{EncodingVersion}
+	for _, field := range []struct {
+		name  string
+		value string
+		size  int
+	}{
+		{"event_id", v.EventID, 32},
+		{"nostr_pubkey", v.NostrPubKey, 32},
+		{"nonce", v.Nonce, secp.PubKeyBytesLenCompressed},
+		{"commitment", v.Commitment, secp.PubKeyBytesLenCompressed},
+		{"claim_key", v.ClaimKey, secp.PubKeyBytesLenCompressed},
+		{"nonce_proof", v.NonceProof, nonceProofSize},
+	} {
+		b, err := crypto.DecodeHexStrict(field.value, field.size)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", field.name, err)
+		}
+		raw = append(raw, b...)
+	}
+
+	return o.UnmarshalBinary(raw)
+}
+
+// FundingNotice tells the seller that the buyer funded the swap, with
+// everything needed to find and check the lock output.
+type FundingNotice struct {
+	EventID     string           // ID of the event the swap is for
+	BuyerPubKey *secp.PublicKey  // Buyer's key, for the refund and MuSig2 paths
+	RefundLock  bitcoin.Timelock // Refund timelock, zero if there is no refund leaf
+	OutputIndex uint32           // Index of the lock output in LockingTx
+	LockingTx   *wire.MsgTx      // Transaction locking the buyer's funds
+}
+
+// fundingNoticeHeaderSize is the size of the fixed fields of a binary
+// encoded FundingNotice.
+const fundingNoticeHeaderSize = 1 + 32 + secp.PubKeyBytesLenCompressed + 1 + 4 + 4
+
+// MaxLockingTxSize bounds the locking transaction of a decoded notice.
+const MaxLockingTxSize = 100000
+
+// MarshalBinary encodes the notice as
+//
+//	version (1) || event ID (32) || buyer key compressed (33) || timelock type (1) ||
+//	timelock value (4) || output index (4) || varint len(tx) || tx
+//
+// with integers in big endian.
+func (n *FundingNotice) MarshalBinary() ([]byte, error) {
+	if err := n.validate(); err != nil {
+		return nil, err
+	}
+
+	eventID, err := crypto.DecodeHexStrict(n.EventID, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event ID: %v", err)
+	}
+
+	var tx bytes.Buffer
+	if err := n.LockingTx.Serialize(&tx); err != nil {
+		return nil, fmt.Errorf("failed to serialize locking transaction: %v", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(EncodingVersion)
+	buf.Write(eventID)
+	buf.Write(n.BuyerPubKey.SerializeCompressed())
+	buf.WriteByte(byte(n.RefundLock.Type))
+	binary.Write(&buf, binary.BigEndian, n.RefundLock.Value)
+	binary.Write(&buf, binary.BigEndian, n.OutputIndex)
+	if err := wire.WriteVarBytes(&buf, 0, tx.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a notice encoded by MarshalBinary. The transaction
+// must decode exactly, the output index must exist and a non-zero timelock
+// must be enforceable.
+func (n *FundingNotice) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty funding notice encoding")
+	}
+	if data[0] != EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[0])
+	}
+	if len(data) < fundingNoticeHeaderSize {
+		return fmt.Errorf("truncated funding notice encoding")
+	}
+
+	buyerPubKey, err := crypto.ParseCompressedPubKey(data[33:66])
+	if err != nil {
+		return fmt.Errorf("invalid buyer public key: %v", err)
+	}
+
+	notice := FundingNotice{
+		EventID:     crypto.HexEncode(data[1:33]),
+		BuyerPubKey: buyerPubKey,
+		RefundLock: bitcoin.Timelock{
+			Type:  bitcoin.TimelockType(data[66]),
+			Value: binary.BigEndian.Uint32(data[67:71]),
+		},
+		OutputIndex: binary.BigEndian.Uint32(data[71:75]),
+	}
+
+	r := bytes.NewReader(data[fundingNoticeHeaderSize:])
+	rawTx, err := wire.ReadVarBytes(r, 0, MaxLockingTxSize, "locking transaction")
+	if err != nil {
+		return fmt.Errorf("invalid locking transaction: %v", err)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d trailing bytes after funding notice", r.Len())
+	}
+
+	notice.LockingTx = wire.NewMsgTx(2)
+	txReader := bytes.NewReader(rawTx)
+	if err := notice.LockingTx.Deserialize(txReader); err != nil {
+		return fmt.Errorf("invalid locking transaction: %v", err)
+	}
+	if txReader.Len() != 0 {
+		return fmt.Errorf("%d trailing bytes after locking transaction", txReader.Len())
+	}
+
+	if err := notice.validate(); err != nil {
+		return err
+	}
+
+	*n = notice
+
+	return nil
+}
+
+// validate checks the fields of the notice against each other.
+func (n *FundingNotice) validate() error {
+	if n.BuyerPubKey == nil || n.LockingTx == nil {
+		return fmt.Errorf("funding notice is missing the buyer key or locking transaction")
+	}
+	if int(n.OutputIndex) >= len(n.LockingTx.TxOut) {
+		return fmt.Errorf("locking transaction has no output %d", n.OutputIndex)
+	}
+	if n.RefundLock != (bitcoin.Timelock{}) {
+		if err := n.RefundLock.Validate(); err != nil {
+			return fmt.Errorf("invalid refund timelock: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// LockOutput returns the output of the locking transaction holding the funds.
+func (n *FundingNotice) LockOutput() *wire.TxOut {
+	return n.LockingTx.TxOut[n.OutputIndex]
+}
+
+// fundingNoticeJSON is the JSON form of a FundingNotice.
+type fundingNoticeJSON struct {
+	Version     int    `json:"version"`
+	EventID     string `json:"event_id"`
+	BuyerPubKey string `json:"buyer_pubkey"`
+	LockType    uint8  `json:"lock_type"`
+	LockValue   uint32 `json:"lock_value"`
+	OutputIndex uint32 `json:"output_index"`
+	LockingTx   string `json:"locking_tx"`
+}
+
+// MarshalJSON encodes the notice as a versioned JSON object, with the
+// transaction in hex.
+func (n *FundingNotice) MarshalJSON() ([]byte, error) {
+	if err := n.validate(); err != nil {
+		return nil, err
+	}
+
+	var tx bytes.Buffer
+	if err := n.LockingTx.Serialize(&tx); err != nil {
+		return nil, fmt.Errorf("failed to serialize locking transaction: %v", err)
+	}
+
+	return json.Marshal(fundingNoticeJSON{
+		Version:     EncodingVersion,
+		EventID:     n.EventID,
+		BuyerPubKey: crypto.HexEncode(n.BuyerPubKey.SerializeCompressed()),
+		LockType:    uint8(n.RefundLock.Type),
+		LockValue:   n.RefundLock.Value,
+		OutputIndex: n.OutputIndex,
+		LockingTx:   crypto.HexEncode(tx.Bytes()),
+	})
+}
+
+// UnmarshalJSON decodes a notice encoded by MarshalJSON, with the same
+// checks as UnmarshalBinary. Unknown fields are rejected.
+func (n *FundingNotice) UnmarshalJSON(data []byte) error {
+	var v fundingNoticeJSON
+	if err := decodeStrictJSON(data, &v); err != nil {
+		return fmt.Errorf("invalid funding notice JSON: %v", err)
+	}
+	if v.Version != EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, v.Version)
+	}
+
+	eventID, err := crypto.DecodeHexStrict(v.EventID, 32)
+	if err != nil {
+		return fmt.Errorf("invalid event_id: %v", err)
+	}
+	buyerPubKey, err := crypto.DecodeHexStrict(v.BuyerPubKey, secp.PubKeyBytesLenCompressed)
+	if err != nil {
+		return fmt.Errorf("invalid buyer_pubkey: %v", err)
+	}
+	rawTx, err := crypto.DecodeHexStrict(v.LockingTx, 0)
+	if err != nil {
+		return fmt.Errorf("invalid locking_tx: %v", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(EncodingVersion)
+	buf.Write(eventID)
+	buf.Write(buyerPubKey)
+	buf.WriteByte(v.LockType)
+	binary.Write(&buf, binary.BigEndian, v.LockValue)
+	binary.Write(&buf, binary.BigEndian, v.OutputIndex)
+	if err := wire.WriteVarBytes(&buf, 0, rawTx); err != nil {
+		return err
+	}
+
+	return n.UnmarshalBinary(buf.Bytes())
+}
+
+// decodeStrictJSON decodes a single JSON value, rejecting unknown fields and
+// trailing data.
+func decodeStrictJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("trailing data after JSON value")
+	}
+
+	return nil
+}
+
+// ClaimProposal is the seller's half of the MuSig2 claim: the claim
+// transaction, the seller's nonce and its partial signature of the claim,
+// made with the commitment point as adaptor point.
+type ClaimProposal struct {
+	ClaimTx *wire.MsgTx
+	Nonce   *musig2.PublicNonce
+	Partial *secp.ModNScalar
+}
+
+// claimProposalJSON is the JSON form of a ClaimProposal.
+type claimProposalJSON struct {
+	Version int    `json:"version"`
+	ClaimTx string `json:"claim_tx"`
+	Nonce   string `json:"nonce"`
+	Partial string `json:"partial"`
+}
+
+// MarshalJSON encodes the proposal as a versioned JSON object with hex fields.
+func (p *ClaimProposal) MarshalJSON() ([]byte, error) {
+	if p.ClaimTx == nil || p.Nonce == nil || p.Partial == nil {
+		return nil, fmt.Errorf("incomplete claim proposal")
+	}
+
+	var tx bytes.Buffer
+	if err := p.ClaimTx.Serialize(&tx); err != nil {
+		return nil, fmt.Errorf("failed to serialize claim transaction: %v", err)
+	}
+
+	return json.Marshal(claimProposalJSON{
+		Version: EncodingVersion,
+		ClaimTx: crypto.HexEncode(tx.Bytes()),
+		Nonce:   crypto.HexEncode(p.Nonce[:]),
+		Partial: crypto.HexEncode(crypto.SerializeModNScalar(p.Partial)),
+	})
+}
+
+// UnmarshalJSON decodes a proposal encoded by MarshalJSON. The transaction
+// must decode exactly and the partial signature must be below the group
+// order. Unknown fields are rejected.
+func (p *ClaimProposal) UnmarshalJSON(data []byte) error {
+	var v claimProposalJSON
+	if err := decodeStrictJSON(data, &v); err != nil {
+		return fmt.Errorf("invalid claim proposal JSON: %v", err)
+	}
+	if v.Version != EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, v.Version)
+	}
+
+	rawTx, err := crypto.DecodeHexStrict(v.ClaimTx, 0)
+	if err != nil {
+		return fmt.Errorf("invalid claim_tx: %v", err)
+	}
+	claimTx := wire.NewMsgTx(2)
+	txReader := bytes.NewReader(rawTx)
+	if err := claimTx.Deserialize(txReader); err != nil {
+		return fmt.Errorf("invalid claim transaction: %v", err)
+	}
+	if txReader.Len() != 0 {
+		return fmt.Errorf("%d trailing bytes after claim transaction", txReader.Len())
+	}
+
+	nonceBytes, err := crypto.DecodeHexStrict(v.Nonce, musig2.PublicNonceSize)
+	if err != nil {
+		return fmt.Errorf("invalid nonce: %v", err)
+	}
+	var nonce musig2.PublicNonce
+	copy(nonce[:], nonceBytes)
+
+	partialBytes, err := crypto.DecodeHexStrict(v.Partial, 32)
+	if err != nil {
+		return fmt.Errorf("invalid partial: %v", err)
+	}
+	partial := new(secp.ModNScalar)
+	if overflow := partial.SetByteSlice(partialBytes); overflow {
+		return fmt.Errorf("partial signature overflows the group order")
+	}
+
+	*p = ClaimProposal{ClaimTx: claimTx, Nonce: &nonce, Partial: partial}
+
+	return nil
+}
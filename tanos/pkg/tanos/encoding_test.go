@@ -0,0 +1,132 @@
+package tanos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"tanos/pkg/bitcoin"
+)
+
+// TestOfferEncoding round trips an offer through both encodings and checks
+// that an odd nonce, a bad Nostr key and an overflowing proof are rejected.
+func TestOfferEncoding(t *testing.T) {
+	sellerSwap, _ := newTestSwaps(t)
+	offer := sellerSwap.Offer
+
+	raw, err := offer.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode offer: %v", err)
+	}
+	var fromBinary Offer
+	if err := fromBinary.UnmarshalBinary(raw); err != nil {
+		t.Fatalf("Failed to decode offer: %v", err)
+	}
+
+	js, err := json.Marshal(offer)
+	if err != nil {
+		t.Fatalf("Failed to encode offer as JSON: %v", err)
+	}
+	var fromJSON Offer
+	if err := json.Unmarshal(js, &fromJSON); err != nil {
+		t.Fatalf("Failed to decode offer JSON: %v", err)
+	}
+
+	for _, decoded := range []Offer{fromBinary, fromJSON} {
+		if decoded.EventID != offer.EventID || decoded.NostrPubKey != offer.NostrPubKey ||
+			!decoded.Nonce.IsEqual(offer.Nonce) || !decoded.Commitment.IsEqual(offer.Commitment) ||
+			!decoded.ClaimKey.IsEqual(offer.ClaimKey) ||
+			!decoded.NonceProof.E.Equals(offer.NonceProof.E) || !decoded.NonceProof.S.Equals(offer.NonceProof.S) {
+			t.Fatalf("Decoded offer differs from the original")
+		}
+	}
+
+	oddNonce := append([]byte(nil), raw...)
+	oddNonce[65] = 0x03
+	if err := fromBinary.UnmarshalBinary(oddNonce); err == nil {
+		t.Fatalf("Expected an odd nonce to be rejected")
+	}
+
+	// An x-coordinate of zero is not on the curve
+	badKey := append([]byte(nil), raw...)
+	copy(badKey[33:65], make([]byte, 32))
+	if err := fromBinary.UnmarshalBinary(badKey); err == nil {
+		t.Fatalf("Expected an invalid Nostr key to be rejected")
+	}
+
+	overflow := append([]byte(nil), raw...)
+	copy(overflow[len(raw)-32:], bytes.Repeat([]byte{0xff}, 32))
+	if err := fromBinary.UnmarshalBinary(overflow); err == nil {
+		t.Fatalf("Expected an overflowing proof scalar to be rejected")
+	}
+
+	if err := fromBinary.UnmarshalBinary(raw[:len(raw)-1]); err == nil {
+		t.Fatalf("Expected a truncated offer to be rejected")
+	}
+
+	future := append([]byte(nil), raw...)
+	future[0] = EncodingVersion + 1
+	if err := fromBinary.UnmarshalBinary(future); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+// TestFundingNoticeEncoding round trips a funding notice and checks that
+// inconsistent notices are rejected.
+func TestFundingNoticeEncoding(t *testing.T) {
+	_, buyerSwap := newTestSwaps(t)
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := buyerSwap.Fund(fundWithRefund); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+
+	notice, err := buyerSwap.FundingNotice()
+	if err != nil {
+		t.Fatalf("Failed to create funding notice: %v", err)
+	}
+
+	raw, err := notice.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode notice: %v", err)
+	}
+	var fromBinary FundingNotice
+	if err := fromBinary.UnmarshalBinary(raw); err != nil {
+		t.Fatalf("Failed to decode notice: %v", err)
+	}
+
+	js, err := json.Marshal(notice)
+	if err != nil {
+		t.Fatalf("Failed to encode notice as JSON: %v", err)
+	}
+	var fromJSON FundingNotice
+	if err := json.Unmarshal(js, &fromJSON); err != nil {
+		t.Fatalf("Failed to decode notice JSON: %v", err)
+	}
+
+	for _, decoded := range []FundingNotice{fromBinary, fromJSON} {
+		if decoded.EventID != notice.EventID || !decoded.BuyerPubKey.IsEqual(notice.BuyerPubKey) ||
+			decoded.RefundLock != notice.RefundLock || decoded.OutputIndex != notice.OutputIndex ||
+			decoded.LockingTx.TxHash() != notice.LockingTx.TxHash() {
+			t.Fatalf("Decoded notice differs from the original")
+		}
+	}
+
+	badIndex := *notice
+	badIndex.OutputIndex = 1
+	if _, err := badIndex.MarshalBinary(); err == nil {
+		t.Fatalf("Expected a missing lock output to be rejected")
+	}
+
+	badLock := append([]byte(nil), raw...)
+	badLock[66] = byte(bitcoin.AbsoluteTimelock) + 1
+	if err := fromBinary.UnmarshalBinary(badLock); err == nil {
+		t.Fatalf("Expected an unknown timelock type to be rejected")
+	}
+
+	if err := fromBinary.UnmarshalBinary(append(raw, 0)); err == nil {
+		t.Fatalf("Expected trailing bytes to be rejected")
+	}
+}
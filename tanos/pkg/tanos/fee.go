@@ -0,0 +1,162 @@
+package tanos
+
+import (
+	"bytes"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+)
+
+// RefundFee returns the fee the refund transaction to destScript pays at
+// rate, for BuildRefundTransaction.
+func (b *SwapBuyer) RefundFee(destScript []byte, rate bitcoin.FeeRate) (int64, error) {
+	if b.LockOutput == nil {
+		return 0, fmt.Errorf("no refundable locking transaction")
+	}
+
+	return bitcoin.RefundFee(rate, b.LockOutput, b.RefundLock, b.PublicKey, destScript)
+}
+
+// BumpRefund replaces the refund transaction with one paying at least rate
+// and enough more than the one it replaces for nodes to take it, which the
+// refund allows since it signals RBF. It is only possible until the refund
+// is seen, in PhaseRefundPending.
+func (sw *Swap) BumpRefund(rate bitcoin.FeeRate) (*wire.MsgTx, error) {
+	if sw.Role != RoleBuyer {
+		return nil, &RoleError{Role: sw.Role, Action: "bumping the refund"}
+	}
+	if sw.Phase != PhaseRefundPending || sw.RefundTx == nil {
+		return nil, fmt.Errorf("no refund is pending")
+	}
+
+	oldFee, err := bitcoin.TxFee(sw.RefundTx, []*wire.TxOut{sw.LockingTx.TxOut[0]})
+	if err != nil {
+		return nil, err
+	}
+	fee := bitcoin.ReplacementFee(oldFee, bitcoin.TxVSize(sw.RefundTx), rate)
+
+	refundTx, err := sw.Buyer.BuildRefundTransaction(sw.RefundTx.TxOut[0].PkScript, fee)
+	if err != nil {
+		return nil, err
+	}
+	sw.RefundTx = refundTx
+
+	return refundTx, nil
+}
+
+// BumpLocking creates a signed child of the unconfirmed locking transaction
+// spending its change back to the buyer, paying for both to reach rate. The
+// locking transaction cannot be replaced instead, since the seller and the
+// claim signatures are bound to its ID.
+func (sw *Swap) BumpLocking(rate bitcoin.FeeRate) (*wire.MsgTx, error) {
+	if sw.Role != RoleBuyer {
+		return nil, &RoleError{Role: sw.Role, Action: "bumping the locking transaction"}
+	}
+	switch sw.Phase {
+	case PhaseFunded, PhaseClaimNonce, PhaseAdaptorSigned:
+	default:
+		return nil, fmt.Errorf("cannot bump the locking transaction of a %s swap", sw.Phase)
+	}
+
+	buyer := sw.Buyer
+	keyScript, err := buyer.keyPathScript()
+	if err != nil {
+		return nil, err
+	}
+	change := -1
+	for i := 1; i < len(buyer.LockingTx.TxOut); i++ {
+		if bytes.Equal(buyer.LockingTx.TxOut[i].PkScript, keyScript) {
+			change = i
+			break
+		}
+	}
+	if change < 0 {
+		return nil, fmt.Errorf("locking transaction has no change to the buyer")
+	}
+
+	parentFee, err := bitcoin.TxFee(buyer.LockingTx, buyer.FundingOutputs)
+	if err != nil {
+		return nil, err
+	}
+	childTx, _, err := bitcoin.CreateCPFPTransaction(buyer.LockingTx, uint32(change), parentFee, keyScript, rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create child transaction: %v", err)
+	}
+	if err := signKeyPathChild(buyer.signer, childTx, buyer.LockingTx.TxOut[change]); err != nil {
+		return nil, err
+	}
+
+	return childTx, nil
+}
+
+// BumpClaim creates a signed child of the unconfirmed claim transaction
+// spending its output back to the same script, paying for both to reach
+// rate. The claim must pay to the key path output of the offer's claim key,
+// as bitcoin.CreateP2TRAddress gives it. The claim cannot be replaced
+// instead without the buyer signing it again.
+func (sw *Swap) BumpClaim(rate bitcoin.FeeRate) (*wire.MsgTx, error) {
+	if sw.Role != RoleSeller {
+		return nil, &RoleError{Role: sw.Role, Action: "bumping the claim"}
+	}
+	if sw.Phase != PhaseClaimed || sw.ClaimTx == nil {
+		return nil, fmt.Errorf("no claim has been completed")
+	}
+
+	keySigner, err := sw.Seller.keySigner()
+	if err != nil {
+		return nil, err
+	}
+	// Only the script of the output is used, so the network is moot
+	keyOutput, err := bitcoin.NewTaprootOutput(keySigner.PubKey(), nil, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(sw.ClaimTx.TxOut[0].PkScript, keyOutput.PkScript) {
+		return nil, fmt.Errorf("claim does not pay to the seller's claim key")
+	}
+
+	parentFee, err := bitcoin.TxFee(sw.ClaimTx, []*wire.TxOut{sw.Funding.LockOutput()})
+	if err != nil {
+		return nil, err
+	}
+	childTx, _, err := bitcoin.CreateCPFPTransaction(sw.ClaimTx, 0, parentFee, keyOutput.PkScript, rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create child transaction: %v", err)
+	}
+	if err := signKeyPathChild(keySigner, childTx, sw.ClaimTx.TxOut[0]); err != nil {
+		return nil, err
+	}
+
+	return childTx, nil
+}
+
+// signKeyPathChild signs the only input of childTx, which spends prevOut,
+// the BIP86 key path output of signer's key.
+func signKeyPathChild(signer crypto.Signer, childTx *wire.MsgTx, prevOut *wire.TxOut) error {
+	sigHash, err := bitcoin.KeyPathSighash(childTx, prevOut)
+	if err != nil {
+		return err
+	}
+	var sig *schnorr.Signature
+	err = signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		tweakedPrivKey := txscript.TweakTaprootPrivKey(*privKey, nil)
+		defer tweakedPrivKey.Zero()
+
+		var err error
+		sig, err = schnorr.Sign(tweakedPrivKey, sigHash)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign child transaction: %v", err)
+	}
+	childTx.TxIn[0].Witness = wire.TxWitness{sig.Serialize()}
+
+	return nil
+}
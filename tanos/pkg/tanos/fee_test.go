@@ -0,0 +1,197 @@
+package tanos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+)
+
+// TestBumpRefund refunds an expired swap at a low rate and replaces the
+// refund with one paying more, which the chain accepts in its place and
+// which completes the swap.
+func TestBumpRefund(t *testing.T) {
+	ctx := context.Background()
+	chain := bitcoin.NewSimChain()
+
+	_, buyerSwap := newTestSwaps(t)
+	buyer := buyerSwap.Buyer
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(10))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	chain.Mine(10)
+
+	if _, err := buyerSwap.BumpRefund(bitcoin.FeeRatePerVByte(5)); err == nil {
+		t.Fatalf("Bumped a refund that does not exist")
+	}
+	fee, err := buyer.RefundFee(fundScript, bitcoin.FeeRatePerVByte(1))
+	if err != nil {
+		t.Fatalf("Failed to estimate refund fee: %v", err)
+	}
+	refundTx, err := buyerSwap.Refund(fundScript, fee)
+	if err != nil {
+		t.Fatalf("Buyer failed to refund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, refundTx); err != nil {
+		t.Fatalf("Refund rejected: %v", err)
+	}
+
+	// The bump survives a restart
+	record, err := buyerSwap.Record()
+	if err != nil {
+		t.Fatalf("Failed to record swap: %v", err)
+	}
+	restored, err := RestoreSwap(record, swapKeys(buyerSwap))
+	if err != nil {
+		t.Fatalf("Failed to restore swap: %v", err)
+	}
+	bumped, err := restored.BumpRefund(bitcoin.FeeRatePerVByte(5))
+	if err != nil {
+		t.Fatalf("Failed to bump refund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, bumped); err != nil {
+		t.Fatalf("Bumped refund rejected: %v", err)
+	}
+	mempool := chain.Mempool()
+	if len(mempool) != 1 || mempool[0].TxHash() != bumped.TxHash() {
+		t.Fatalf("Bumped refund did not replace the refund")
+	}
+	bumpedFee := refundTx.TxOut[0].Value - bumped.TxOut[0].Value + fee
+	if bumpedFee < int64(bitcoin.FeeRatePerVByte(5).FeeForVSize(bitcoin.TxVSize(bumped))) {
+		t.Fatalf("Bumped refund pays %d, below the rate", bumpedFee)
+	}
+	if restored.RefundTx != bumped || restored.Phase != PhaseRefundPending {
+		t.Fatalf("Swap does not hold the bumped refund")
+	}
+
+	// The swap is refunded once the bumped refund is seen
+	if _, err := restored.WatchRefund(ctx, chain, 0); err != nil {
+		t.Fatalf("Failed to watch refund: %v", err)
+	}
+	if restored.Phase != PhaseRefunded || restored.RefundTx.TxHash() != bumped.TxHash() {
+		t.Fatalf("Swap not refunded by the bumped refund, phase %s", restored.Phase)
+	}
+	if _, err := restored.BumpRefund(bitcoin.FeeRatePerVByte(10)); err == nil {
+		t.Fatalf("Bumped a refund already seen")
+	}
+}
+
+// TestBumpLocking pays for a stuck locking transaction with a child
+// spending its change.
+func TestBumpLocking(t *testing.T) {
+	ctx := context.Background()
+	chain := bitcoin.NewSimChain()
+
+	_, buyerSwap := newTestSwaps(t)
+	buyer := buyerSwap.Buyer
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyer)
+	builder := &bitcoin.FundingBuilder{
+		UTXOs:        []*bitcoin.UTXO{{OutPoint: wire.OutPoint{Hash: fundTx.TxHash()}, Output: fundTx.TxOut[0]}},
+		FeeRate:      bitcoin.FeeRatePerVByte(1),
+		ChangeScript: fundScript,
+	}
+	err := buyerSwap.Fund(func(b *SwapBuyer, offer *Offer) error {
+		if err := fundWithRefund(b, offer); err != nil {
+			return err
+		}
+		b.LockingTx.TxOut[0].Value = 50000
+		if _, err := b.FundLockingTransaction(builder); err != nil {
+			return err
+		}
+		return b.SignLockingTransaction()
+	})
+	if err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+
+	rate := bitcoin.FeeRatePerVByte(10)
+	childTx, err := buyerSwap.BumpLocking(rate)
+	if err != nil {
+		t.Fatalf("Failed to bump locking transaction: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, childTx); err != nil {
+		t.Fatalf("Child rejected: %v", err)
+	}
+
+	parentFee, _ := bitcoin.TxFee(buyer.LockingTx, buyer.FundingOutputs)
+	childFee := buyer.LockingTx.TxOut[1].Value - childTx.TxOut[0].Value
+	packageVSize := bitcoin.TxVSize(buyer.LockingTx) + bitcoin.TxVSize(childTx)
+	if parentFee+childFee < int64(rate.FeeForVSize(packageVSize)) {
+		t.Fatalf("Package pays %d for %d vbytes, below the rate", parentFee+childFee, packageVSize)
+	}
+}
+
+// TestBumpClaim pays for a stuck claim with a child spending its output,
+// which pays to the seller's claim key.
+func TestBumpClaim(t *testing.T) {
+	ctx := context.Background()
+	chain := bitcoin.NewSimChain()
+
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyerSwap.Buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(10))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	chain.Mine(1)
+	signSwapClaim(t, sellerSwap, buyerSwap)
+
+	if _, err := sellerSwap.BumpClaim(bitcoin.FeeRatePerVByte(10)); err == nil {
+		t.Fatalf("Bumped a claim that is not completed")
+	}
+	claimTx, err := sellerSwap.CompleteClaim()
+	if err != nil {
+		t.Fatalf("Seller failed to complete claim: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+		t.Fatalf("Claim transaction rejected: %v", err)
+	}
+	claimFee, err := bitcoin.TxFee(claimTx, []*wire.TxOut{sellerSwap.Funding.LockOutput()})
+	if err != nil {
+		t.Fatalf("Failed to compute claim fee: %v", err)
+	}
+	if want := bitcoin.ClaimFee(bitcoin.FeeRatePerVByte(5), claimTx.TxOut[0].PkScript); claimFee != want {
+		t.Fatalf("Claim pays %d, expected %d at the proposed rate", claimFee, want)
+	}
+
+	rate := bitcoin.FeeRatePerVByte(20)
+	childTx, err := sellerSwap.BumpClaim(rate)
+	if err != nil {
+		t.Fatalf("Failed to bump claim: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, childTx); err != nil {
+		t.Fatalf("Child rejected: %v", err)
+	}
+	childFee := claimTx.TxOut[0].Value - childTx.TxOut[0].Value
+	packageVSize := bitcoin.TxVSize(claimTx) + bitcoin.TxVSize(childTx)
+	if claimFee+childFee < int64(rate.FeeForVSize(packageVSize)) {
+		t.Fatalf("Package pays %d for %d vbytes, below the rate", claimFee+childFee, packageVSize)
+	}
+
+	if _, err := buyerSwap.BumpClaim(rate); err == nil {
+		t.Fatalf("Buyer bumped the claim")
+	}
+}
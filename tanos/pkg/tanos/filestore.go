@@ -0,0 +1,223 @@
+package tanos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// journalExt is the file extension of swap journals.
+const journalExt = ".journal"
+
+// FileStore is a SwapStore keeping one append-only JSON journal per swap in
+// a directory. Every Save appends a record as a single line and syncs it to
+// disk. A crash in the middle of a write leaves at most an incomplete last
+// line, which is ignored when loading and cut off by the next Save, so the
+// latest complete record always survives.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileStore opens a file store in dir, creating the directory if needed.
+// Journals hold no keys, but they reveal the swaps and their transactions,
+// so they are only readable by their owner.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %v", err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// path returns the journal path of a swap, rejecting IDs that are not safe
+// to use as file names.
+func (f *FileStore) path(id string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("empty swap ID")
+	}
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '_') {
+			return "", fmt.Errorf("invalid swap ID %q", id)
+		}
+	}
+
+	return filepath.Join(f.dir, id+journalExt), nil
+}
+
+// Save appends the record to the swap's journal.
+func (f *FileStore) Save(record *SwapRecord) error {
+	path, err := f.path(record.ID)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode swap record: %v", err)
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, statErr := os.Stat(path)
+	isNew := os.IsNotExist(statErr)
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open swap journal: %v", err)
+	}
+	defer file.Close()
+
+	end, err := completeLength(file)
+	if err != nil {
+		return err
+	}
+
+	// Drop a record torn by an earlier crash before appending
+	if err := file.Truncate(end); err != nil {
+		return fmt.Errorf("failed to truncate swap journal: %v", err)
+	}
+	if _, err := file.WriteAt(line, end); err != nil {
+		return fmt.Errorf("failed to write swap journal: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync swap journal: %v", err)
+	}
+
+	// A new journal is only durable once its directory entry is
+	if isNew {
+		if err := syncDir(f.dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// completeLength returns the length of the journal up to and including its
+// last newline, i.e. without a trailing incomplete record.
+func completeLength(file *os.File) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to read swap journal: %v", err)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read swap journal: %v", err)
+	}
+
+	return int64(bytes.LastIndexByte(data, '\n') + 1), nil
+}
+
+// syncDir flushes a directory so that newly created files survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open store directory: %v", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync store directory: %v", err)
+	}
+
+	return nil
+}
+
+// Load returns the last complete record of the swap's journal.
+func (f *FileStore) Load(id string) (*SwapRecord, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return readJournal(path)
+}
+
+// readJournal decodes the last complete record of a journal. Only the final
+// line may be damaged; anything else means the journal is corrupt.
+func readJournal(path string) (*SwapRecord, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrSwapNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read swap journal: %v", err)
+	}
+
+	// Ignore an incomplete record left by a crash during Save
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'})
+	last := lines[len(lines)-1]
+	if len(last) == 0 {
+		return nil, ErrSwapNotFound
+	}
+
+	var record SwapRecord
+	if err := json.Unmarshal(last, &record); err != nil {
+		return nil, fmt.Errorf("corrupt swap journal %s: %v", filepath.Base(path), err)
+	}
+
+	return &record, nil
+}
+
+// List returns the last record of every journal in the store.
+func (f *FileStore) List() ([]*SwapRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store directory: %v", err)
+	}
+
+	var records []*SwapRecord
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), journalExt) {
+			continue
+		}
+
+		record, err := readJournal(filepath.Join(f.dir, entry.Name()))
+		if err == ErrSwapNotFound {
+			// Only a torn first record was written
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Delete removes the swap's journal.
+func (f *FileStore) Delete(id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrSwapNotFound
+		}
+		return fmt.Errorf("failed to delete swap journal: %v", err)
+	}
+
+	return syncDir(f.dir)
+}
@@ -0,0 +1,43 @@
+package tanos
+
+import (
+	"fmt"
+
+	"tanos/pkg/bitcoin"
+)
+
+// FundLockingTransaction pays for the swap output of the locking transaction
+// with coins chosen by builder, replacing the funding input given when the
+// transaction was created. The swap output stays at index 0 with the same
+// value, and change, if any, follows it. It must be called before the
+// adaptor or claim signatures are created, since they commit to the
+// transaction.
+func (b *SwapBuyer) FundLockingTransaction(builder *bitcoin.FundingBuilder) (*bitcoin.Funding, error) {
+	if b.LockingTx == nil || len(b.LockingTx.TxOut) == 0 {
+		return nil, fmt.Errorf("no locking transaction")
+	}
+	if b.AdaptorSig != nil || b.claim.session != nil {
+		return nil, fmt.Errorf("locking transaction already has an adaptor signature")
+	}
+
+	funding, err := builder.Build(b.LockingTx.TxOut[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to fund locking transaction: %v", err)
+	}
+
+	prevOuts := funding.PrevOuts()
+	fetcher, err := bitcoin.NewPrevOutputFetcher(funding.Tx, prevOuts)
+	if err != nil {
+		return nil, err
+	}
+	sigHash, err := bitcoin.CalculateSighash(funding.Tx, 0, fetcher, bitcoin.SigHashDefault)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate signature hash: %v", err)
+	}
+
+	b.LockingTx = funding.Tx
+	b.FundingOutputs = prevOuts
+	b.SigHash = sigHash
+
+	return funding, nil
+}
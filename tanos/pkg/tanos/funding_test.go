@@ -0,0 +1,168 @@
+package tanos
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+)
+
+// TestFundLockingTransaction funds the swap output from several of the
+// buyer's coins, with change back to the buyer, and broadcasts it.
+func TestFundLockingTransaction(t *testing.T) {
+	ctx := context.Background()
+	chain := bitcoin.NewSimChain()
+
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	buyer := buyerSwap.Buyer
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+
+	var coins []*bitcoin.UTXO
+	var fundScript []byte
+	for i := 0; i < 3; i++ {
+		var fundTx *wire.MsgTx
+		fundTx, fundScript = fundOnChain(t, chain, buyer)
+		coins = append(coins, &bitcoin.UTXO{
+			OutPoint: wire.OutPoint{Hash: fundTx.TxHash()},
+			Output:   fundTx.TxOut[0],
+		})
+	}
+	builder := &bitcoin.FundingBuilder{
+		UTXOs:        coins,
+		FeeRate:      bitcoin.FeeRatePerVByte(3),
+		ChangeScript: fundScript,
+	}
+
+	var funding *bitcoin.Funding
+	err := buyerSwap.Fund(func(b *SwapBuyer, offer *Offer) error {
+		if err := fundWithRefund(b, offer); err != nil {
+			return err
+		}
+		// Raise the swap output above any single coin
+		b.LockingTx.TxOut[0].Value = 200000
+
+		var err error
+		if funding, err = b.FundLockingTransaction(builder); err != nil {
+			return err
+		}
+		return b.SignLockingTransaction()
+	})
+	if err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if len(buyer.LockingTx.TxIn) != 2 || funding.ChangeIndex != 1 {
+		t.Fatalf("Expected two coins and change, got %d inputs", len(buyer.LockingTx.TxIn))
+	}
+	if !bytes.Equal(buyer.LockingTx.TxOut[0].PkScript, buyer.LockOutput.PkScript) || buyer.LockingTx.TxOut[0].Value != 200000 {
+		t.Fatalf("Swap output was not kept at index 0")
+	}
+	if vsize := mempool.GetTxVirtualSize(btcutil.NewTx(buyer.LockingTx)); vsize != funding.VSize {
+		t.Fatalf("Locking transaction has %d vbytes, estimated %d", vsize, funding.VSize)
+	}
+	if _, err := chain.Broadcast(ctx, buyer.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+
+	// The claim signatures commit to the funded transaction
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	signSwapClaim(t, sellerSwap, buyerSwap)
+	if _, err := buyer.FundLockingTransaction(builder); err == nil {
+		t.Fatalf("Funded the locking transaction again after signing the claim")
+	}
+
+	// All the funding outputs survive a restart
+	record, err := buyerSwap.Record()
+	if err != nil {
+		t.Fatalf("Failed to record swap: %v", err)
+	}
+	restored, err := RestoreSwap(record, swapKeys(buyerSwap))
+	if err != nil {
+		t.Fatalf("Failed to restore swap: %v", err)
+	}
+	packet, err := restored.Buyer.LockingPSBT()
+	if err != nil {
+		t.Fatalf("Failed to export locking PSBT: %v", err)
+	}
+	for i, input := range packet.Inputs {
+		if len(input.TaprootKeySpendSig) == 0 {
+			t.Fatalf("PSBT input %d lacks its signature", i)
+		}
+	}
+	if len(packet.Outputs[1].TaprootInternalKey) == 0 {
+		t.Fatalf("Change output lacks the buyer's internal key")
+	}
+}
+
+// TestSignLockingTransactionSkipsForeignInputs checks that inputs spending
+// other scripts are left unsigned, the first input included, so that their
+// wallet can sign them through the PSBT.
+func TestSignLockingTransactionSkipsForeignInputs(t *testing.T) {
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	buyer := buyerSwap.Buyer
+	other, _ := newTestSwaps(t)
+
+	_, foreignScript, err := bitcoin.CreateP2TRAddress(other.Offer.ClaimKey, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to create foreign script: %v", err)
+	}
+	_, ownScript, err := bitcoin.CreateP2TRAddress(buyer.PublicKey, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to create buyer script: %v", err)
+	}
+	builder := &bitcoin.FundingBuilder{
+		UTXOs: []*bitcoin.UTXO{
+			{OutPoint: wire.OutPoint{Index: 1}, Output: wire.NewTxOut(150000, foreignScript)},
+			{OutPoint: wire.OutPoint{Index: 2}, Output: wire.NewTxOut(150000, ownScript)},
+		},
+		FeeRate:      bitcoin.FeeRatePerVByte(3),
+		ChangeScript: ownScript,
+	}
+
+	if err := fundWithRefund(buyer, &sellerSwap.Offer); err != nil {
+		t.Fatalf("Failed to create locking transaction: %v", err)
+	}
+	buyer.LockingTx.TxOut[0].Value = 200000
+	if _, err := buyer.FundLockingTransaction(builder); err != nil {
+		t.Fatalf("Failed to fund locking transaction: %v", err)
+	}
+	if err := buyer.SignLockingTransaction(); err != nil {
+		t.Fatalf("Failed to sign locking transaction: %v", err)
+	}
+
+	if !bytes.Equal(buyer.FundingOutputs[0].PkScript, foreignScript) {
+		t.Fatalf("Expected the foreign coin as the first input")
+	}
+	var signed int
+	for i, txIn := range buyer.LockingTx.TxIn {
+		own := bytes.Equal(buyer.FundingOutputs[i].PkScript, ownScript)
+		if own != (len(txIn.Witness) == 1) {
+			t.Fatalf("Input %d spending own output %v has witness %x", i, own, txIn.Witness)
+		}
+		if own {
+			signed++
+		}
+	}
+	if len(buyer.LockingTx.TxIn) != 2 || signed != 1 {
+		t.Fatalf("Expected one of two inputs signed, got %d of %d", signed, len(buyer.LockingTx.TxIn))
+	}
+
+	packet, err := buyer.LockingPSBT()
+	if err != nil {
+		t.Fatalf("Failed to export locking PSBT: %v", err)
+	}
+	for i, input := range packet.Inputs {
+		if bytes.Equal(buyer.FundingOutputs[i].PkScript, foreignScript) && len(input.TaprootKeySpendSig) != 0 {
+			t.Fatalf("Foreign PSBT input %d was signed", i)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package tanos
+
+import (
+	"bytes"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+	"tanos/pkg/musig2"
+	"tanos/pkg/nostr"
+)
+
+// claimState holds one party's view of the MuSig2 signing of the claim
+// transaction, which spends the 2-of-2 key path of the swap output.
+type claimState struct {
+	keyAgg   *musig2.KeyAggContext // Buyer+seller key, tweaked for the output
+	nonce    *musig2.PublicNonce   // Our public nonce for the claim
+	secNonce *musig2.SecretNonce   // Our secret nonce, zeroed once used
+	session  *musig2.Session       // Adaptor signing session for the claim
+	partial  *secp.ModNScalar      // Our partial signature
+	preSig   *musig2.PreSignature  // Aggregated pre-signature, missing the secret
+
+	peerNonce *musig2.PublicNonce // Other party's public nonce for the claim
+}
+
+// swapLockOutput derives the MuSig2 lock output of a swap from the buyer's
+// key, the seller's claim key and the refund timelock. Outputs are only
+// compared by script, so the network of the address does not matter.
+func swapLockOutput(buyerPubKey, claimKey *secp.PublicKey, refundLock bitcoin.Timelock) (*bitcoin.TaprootOutput, *musig2.KeyAggContext, error) {
+	lockOutput, keyAgg, err := bitcoin.CreateMuSig2LockOutput(buyerPubKey, claimKey, refundLock, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create MuSig2 lock output: %v", err)
+	}
+
+	return lockOutput, keyAgg, nil
+}
+
+// newNonce generates the claim nonce for the signer, dropping any earlier
+// signing attempt. A claim whose pre-signature was aggregated is final.
+func (c *claimState) newNonce(signer crypto.Signer) (*musig2.PublicNonce, error) {
+	if c.preSig != nil {
+		return nil, fmt.Errorf("claim has already been signed")
+	}
+	var secNonce *musig2.SecretNonce
+	var pubNonce *musig2.PublicNonce
+	err := signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		var err error
+		secNonce, pubNonce, err = musig2.GenerateNonce(
+			privKey.PubKey(),
+			musig2.WithNonceSecretKey(privKey),
+			musig2.WithNonceAggregateKey(c.keyAgg.XOnlyKey()),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate claim nonce: %v", err)
+	}
+
+	c.zero()
+	*c = claimState{keyAgg: c.keyAgg, nonce: pubNonce, secNonce: secNonce}
+
+	return pubNonce, nil
+}
+
+// sign creates our partial signature with the secret nonce, which is zeroed.
+func (c *claimState) sign(signer crypto.Signer) (*secp.ModNScalar, error) {
+	if c.secNonce == nil {
+		return nil, fmt.Errorf("claim nonce has not been generated")
+	}
+
+	var partial *secp.ModNScalar
+	err := signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		var err error
+		partial, err = c.session.Sign(c.secNonce, privKey)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign claim transaction: %v", err)
+	}
+	c.partial = partial
+
+	return partial, nil
+}
+
+// zero wipes the secret nonce, if it has not been used yet.
+func (c *claimState) zero() {
+	if c.secNonce != nil {
+		c.secNonce.Zero()
+	}
+}
+
+// startSession creates the adaptor signing session for the claim transaction
+// with the other party's nonce.
+func (c *claimState) startSession(
+	claimTx *wire.MsgTx,
+	lockOutput *bitcoin.TaprootOutput,
+	lockValue int64,
+	otherNonce *musig2.PublicNonce,
+	commitment *secp.PublicKey,
+) error {
+	if c.secNonce == nil {
+		return fmt.Errorf("claim nonce has not been generated")
+	}
+	c.peerNonce = otherNonce
+
+	return c.openSession(claimTx, lockOutput, lockValue, commitment)
+}
+
+// openSession creates the adaptor signing session for the claim transaction
+// from both public nonces. Without the secret nonce, as after a restart, the
+// session can still verify and aggregate partial signatures.
+func (c *claimState) openSession(
+	claimTx *wire.MsgTx,
+	lockOutput *bitcoin.TaprootOutput,
+	lockValue int64,
+	commitment *secp.PublicKey,
+) error {
+	if len(claimTx.TxIn) != 1 {
+		return fmt.Errorf("claim transaction must have exactly one input")
+	}
+
+	sigHash, err := bitcoin.KeyPathSighash(claimTx, wire.NewTxOut(lockValue, lockOutput.PkScript))
+	if err != nil {
+		return err
+	}
+
+	aggNonce, err := musig2.AggregateNonces([]*musig2.PublicNonce{c.nonce, c.peerNonce})
+	if err != nil {
+		return fmt.Errorf("failed to aggregate claim nonces: %v", err)
+	}
+
+	c.session, err = musig2.NewSession(c.keyAgg, aggNonce, sigHash, commitment)
+	if err != nil {
+		return fmt.Errorf("failed to create claim signing session: %v", err)
+	}
+
+	return nil
+}
+
+// CreateMuSig2LockingTransaction creates a Bitcoin transaction that locks funds
+// in a Pay-to-Taproot output whose key path is a MuSig2 2-of-2 between the
+// buyer and the seller. The seller can only spend it cooperatively, and the
+// signature it publishes when doing so reveals the adaptor secret to the
+// buyer. A refund leaf lets the buyer reclaim the funds once refundLock expires.
+func (b *SwapBuyer) CreateMuSig2LockingTransaction(
+	amount int64,
+	prevTxID string,
+	prevOutputIndex uint32,
+	prevOutputValue int64,
+	prevOutputScript []byte,
+	sellerPubKey *secp.PublicKey,
+	refundLock bitcoin.Timelock,
+	network *chaincfg.Params,
+) error {
+	lockOutput, keyAgg, err := bitcoin.CreateMuSig2LockOutput(b.PublicKey, sellerPubKey, refundLock, network)
+	if err != nil {
+		return fmt.Errorf("failed to create MuSig2 lock output: %v", err)
+	}
+
+	prevHash, err := chainhash.NewHashFromStr(prevTxID)
+	if err != nil {
+		return fmt.Errorf("invalid previous transaction ID: %v", err)
+	}
+
+	lockTx := wire.NewMsgTx(2) // Version 2 for taproot support
+	lockTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(prevHash, prevOutputIndex), nil, nil))
+	lockTx.AddTxOut(wire.NewTxOut(amount, lockOutput.PkScript))
+
+	sigHash, err := bitcoin.KeyPathSighash(lockTx, wire.NewTxOut(prevOutputValue, prevOutputScript))
+	if err != nil {
+		return err
+	}
+
+	b.LockingTx = lockTx
+	b.FundingOutputs = []*wire.TxOut{wire.NewTxOut(prevOutputValue, prevOutputScript)}
+	b.SigHash = sigHash
+	b.LockOutput = lockOutput
+	b.RefundLock = refundLock
+	b.claim = claimState{keyAgg: keyAgg}
+
+	return nil
+}
+
+// ClaimNonce generates the buyer's MuSig2 nonce for the claim transaction.
+// It must be sent to the seller before either party signs.
+func (b *SwapBuyer) ClaimNonce() (*musig2.PublicNonce, error) {
+	if b.claim.keyAgg == nil {
+		return nil, fmt.Errorf("no MuSig2 locking transaction")
+	}
+
+	return b.claim.newNonce(b.signer)
+}
+
+// SignClaim verifies the seller's partial signature over the claim
+// transaction and returns the buyer's own partial signature, both made with
+// the commitment as adaptor point. The buyer keeps the resulting
+// pre-signature so it can extract the secret once the claim is published.
+func (b *SwapBuyer) SignClaim(
+	claimTx *wire.MsgTx,
+	sellerPubKey *secp.PublicKey,
+	sellerNonce *musig2.PublicNonce,
+	sellerPartial *secp.ModNScalar,
+	commitment *secp.PublicKey,
+) (*secp.ModNScalar, error) {
+	if b.LockingTx == nil || b.LockOutput == nil {
+		return nil, fmt.Errorf("no MuSig2 locking transaction")
+	}
+
+	lockHash := b.LockingTx.TxHash()
+	if len(claimTx.TxIn) != 1 || claimTx.TxIn[0].PreviousOutPoint != *wire.NewOutPoint(&lockHash, 0) {
+		return nil, fmt.Errorf("claim transaction does not spend the lock output")
+	}
+
+	err := b.claim.startSession(claimTx, b.LockOutput, b.LockingTx.TxOut[0].Value, sellerNonce, commitment)
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.claim.session.VerifyPartial(sellerPartial, sellerNonce, sellerPubKey) {
+		return nil, fmt.Errorf("invalid seller partial signature")
+	}
+
+	partial, err := b.claim.sign(b.signer)
+	if err != nil {
+		return nil, err
+	}
+
+	b.claim.preSig, err = b.claim.session.AggregateAdaptor([]*secp.ModNScalar{sellerPartial, partial})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate claim pre-signature: %v", err)
+	}
+
+	return partial, nil
+}
+
+// ExtractSecretFromClaim recovers the adaptor secret, i.e. the s value of the
+// seller's Nostr signature, from the witness of the published claim transaction.
+func (b *SwapBuyer) ExtractSecretFromClaim(claimTx *wire.MsgTx) (*secp.ModNScalar, error) {
+	if b.claim.preSig == nil {
+		return nil, fmt.Errorf("claim has not been signed")
+	}
+	if len(claimTx.TxIn) != 1 || len(claimTx.TxIn[0].Witness) == 0 {
+		return nil, fmt.Errorf("claim transaction has no key path witness")
+	}
+
+	return b.claim.preSig.ExtractSecret(claimTx.TxIn[0].Witness[0])
+}
+
+// keySigner returns the signer of the seller's claim key, for MuSig2
+// signing.
+func (s *SwapSeller) keySigner() (crypto.Signer, error) {
+	if s.claimSigner == nil {
+		return nil, fmt.Errorf("seller has no claim key to sign MuSig2 claims with")
+	}
+
+	return s.claimSigner, nil
+}
+
+// PrepareClaim derives the MuSig2 swap output from the buyer's key, the
+// seller's claim key and the agreed refund timelock, and generates the
+// seller's claim nonce.
+func (s *SwapSeller) PrepareClaim(
+	buyerPubKey *secp.PublicKey,
+	refundLock bitcoin.Timelock,
+	network *chaincfg.Params,
+) (*musig2.PublicNonce, error) {
+	if _, err := s.keySigner(); err != nil {
+		return nil, err
+	}
+
+	lockOutput, keyAgg, err := bitcoin.CreateMuSig2LockOutput(buyerPubKey, s.ClaimKey, refundLock, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MuSig2 lock output: %v", err)
+	}
+
+	s.claim.zero()
+	s.LockOutput = lockOutput
+	s.claim = claimState{keyAgg: keyAgg}
+
+	return s.ClaimNonce()
+}
+
+// observeLock checks that the lock output of the buyer's funding notice is
+// the MuSig2 output of the buyer's key and the seller's claim key, and
+// prepares the claim of it.
+func (s *SwapSeller) observeLock(notice *FundingNotice) error {
+	if _, err := s.keySigner(); err != nil {
+		return err
+	}
+
+	lockOutput, keyAgg, err := swapLockOutput(notice.BuyerPubKey, s.ClaimKey, notice.RefundLock)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(notice.LockOutput().PkScript, lockOutput.PkScript) {
+		return fmt.Errorf("lock output is not the MuSig2 output of the buyer's key and the claim key")
+	}
+
+	s.claim.zero()
+	s.LockOutput = lockOutput
+	s.claim = claimState{keyAgg: keyAgg}
+
+	return nil
+}
+
+// ClaimNonce generates the seller's MuSig2 nonce for the claim of the lock
+// output set up by PrepareClaim.
+func (s *SwapSeller) ClaimNonce() (*musig2.PublicNonce, error) {
+	if s.claim.keyAgg == nil {
+		return nil, fmt.Errorf("claim has not been prepared")
+	}
+	keySigner, err := s.keySigner()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.claim.newNonce(keySigner)
+}
+
+// SignClaim returns the seller's partial signature over the claim
+// transaction, using its commitment as adaptor point. lockValue is the value
+// of the swap output being spent.
+func (s *SwapSeller) SignClaim(
+	claimTx *wire.MsgTx,
+	lockValue int64,
+	buyerNonce *musig2.PublicNonce,
+) (*secp.ModNScalar, error) {
+	if s.LockOutput == nil {
+		return nil, fmt.Errorf("claim has not been prepared")
+	}
+	if s.Commitment == nil {
+		return nil, fmt.Errorf("no commitment point")
+	}
+
+	if err := s.claim.startSession(claimTx, s.LockOutput, lockValue, buyerNonce, s.Commitment); err != nil {
+		return nil, err
+	}
+
+	keySigner, err := s.keySigner()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.claim.sign(keySigner)
+}
+
+// CompleteClaim verifies the buyer's partial signature, completes the claim
+// pre-signature with the Nostr signature secret and places the final key path
+// signature in the claim transaction's witness. Publishing the claim reveals
+// the secret to the buyer.
+func (s *SwapSeller) CompleteClaim(
+	claimTx *wire.MsgTx,
+	buyerPubKey *secp.PublicKey,
+	buyerNonce *musig2.PublicNonce,
+	buyerPartial *secp.ModNScalar,
+) error {
+	if err := s.acceptClaim(buyerPubKey, buyerNonce, buyerPartial); err != nil {
+		return err
+	}
+	if err := s.finishClaim(claimTx); err != nil {
+		return err
+	}
+
+	// The event is signed for good
+	s.Discard()
+	return nil
+}
+
+// acceptClaim verifies the buyer's partial signature over the claim and
+// aggregates the pre-signature.
+func (s *SwapSeller) acceptClaim(
+	buyerPubKey *secp.PublicKey,
+	buyerNonce *musig2.PublicNonce,
+	buyerPartial *secp.ModNScalar,
+) error {
+	if s.claim.session == nil || s.claim.partial == nil {
+		return fmt.Errorf("claim has not been signed")
+	}
+
+	if !s.claim.session.VerifyPartial(buyerPartial, buyerNonce, buyerPubKey) {
+		return fmt.Errorf("invalid buyer partial signature")
+	}
+
+	preSig, err := s.claim.session.AggregateAdaptor([]*secp.ModNScalar{s.claim.partial, buyerPartial})
+	if err != nil {
+		return fmt.Errorf("failed to aggregate claim pre-signature: %v", err)
+	}
+	s.claim.preSig = preSig
+
+	return nil
+}
+
+// finishClaim signs the event and completes the pre-signature of the claim
+// transaction with its secret. The pending event keeps its nonce, so the
+// caller can still undo the signature; Discard gives the nonce up.
+func (s *SwapSeller) finishClaim(claimTx *wire.MsgTx) error {
+	if s.claim.preSig == nil {
+		return fmt.Errorf("claim pre-signature has not been aggregated")
+	}
+
+	event, secret, err := s.signedEvent()
+	if err != nil {
+		return err
+	}
+
+	claimTx.TxIn[0].Witness = wire.TxWitness{s.claim.preSig.Complete(secret)}
+	s.Event = event
+
+	return nil
+}
+
+// signedEvent returns the event signed, without giving up the nonce of a
+// pending signature, and the secret of its signature.
+func (s *SwapSeller) signedEvent() (nostrlib.Event, *secp.ModNScalar, error) {
+	event := s.Event
+	if event.Sig == "" {
+		if s.pending == nil {
+			return event, nil, fmt.Errorf("no event to sign")
+		}
+		var err error
+		if event, err = s.pending.Signed(); err != nil {
+			return event, nil, fmt.Errorf("failed to sign event: %v", err)
+		}
+	}
+	secret, err := nostr.ExtractSecretFromSignature(event.Sig)
+	if err != nil {
+		return event, nil, fmt.Errorf("failed to extract secret from Nostr signature: %v", err)
+	}
+
+	return event, secret, nil
+}
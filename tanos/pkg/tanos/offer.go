@@ -0,0 +1,184 @@
+package tanos
+
+import (
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/crypto"
+)
+
+// tagNonceProof is the tag of the challenge hash of nonce proofs.
+var tagNonceProof = []byte("TANOS/offer/nonce")
+
+// NonceProof is a Schnorr proof of knowledge of the discrete logarithm k of
+// the offer nonce R = k*G. It is bound to the event ID, the Nostr key, the
+// commitment point and the seller's claim key, so it cannot be replayed in
+// another offer, nor the claim key swapped for another.
+//
+// Only someone who signed the event with the nonce R can know k, which keeps
+// a seller from offering a commitment for a nonce it cannot sign with.
+type NonceProof struct {
+	E *secp.ModNScalar // e = H(a*G || R.x || P.x || event ID || T || claim key)
+	S *secp.ModNScalar // s = a + e*k
+}
+
+// nonceProofChallenge computes the challenge e of a nonce proof for the
+// commitment A = a*G.
+func nonceProofChallenge(A *secp.PublicKey, eventID []byte, nostrPubKey, nonce, commitment, claimKey *secp.PublicKey) *secp.ModNScalar {
+	hashInput := make([]byte, 0, 33+32+32+32+33+33)
+	hashInput = append(hashInput, A.SerializeCompressed()...)
+	hashInput = append(hashInput, schnorr.SerializePubKey(nonce)...)
+	hashInput = append(hashInput, schnorr.SerializePubKey(nostrPubKey)...)
+	hashInput = append(hashInput, eventID...)
+	hashInput = append(hashInput, commitment.SerializeCompressed()...)
+	hashInput = append(hashInput, claimKey.SerializeCompressed()...)
+	hash := chainhash.TaggedHash(tagNonceProof, hashInput)
+
+	e := new(secp.ModNScalar)
+	e.SetBytes((*[32]byte)(hash))
+	return e
+}
+
+// Verify checks the proof for the nonce of an offer, by recomputing the
+// commitment a*G = s*G - e*R and the challenge.
+func (p *NonceProof) Verify(eventID string, nostrPubKey, nonce, commitment, claimKey *secp.PublicKey) bool {
+	if p == nil || p.E == nil || p.S == nil || nostrPubKey == nil || nonce == nil || commitment == nil || claimKey == nil {
+		return false
+	}
+	id, err := crypto.DecodeHexStrict(eventID, 32)
+	if err != nil {
+		return false
+	}
+
+	var R, sG, eR, A secp.JacobianPoint
+	nonce.AsJacobian(&R)
+	secp.ScalarBaseMultNonConst(p.S, &sG)
+	secp.ScalarMultNonConst(new(secp.ModNScalar).NegateVal(p.E), &R, &eR)
+	secp.AddNonConst(&sG, &eR, &A)
+	if (A.X.IsZero() && A.Y.IsZero()) || A.Z.IsZero() {
+		return false
+	}
+	A.ToAffine()
+
+	e := nonceProofChallenge(secp.NewPublicKey(&A.X, &A.Y), id, nostrPubKey, nonce, commitment, claimKey)
+	return e.Equals(p.E)
+}
+
+// commitmentPoint computes T = R + e*P for the even nonce R, the seller key
+// P lifted to even Y and the BIP340 challenge e = H(R.x || P.x || event ID).
+// T = s*G for the s value of the event signature.
+func commitmentPoint(eventID []byte, nostrPubKey, nonce *secp.PublicKey) (*secp.PublicKey, error) {
+	evenPub, err := schnorr.ParsePubKey(schnorr.SerializePubKey(nostrPubKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid seller public key: %v", err)
+	}
+	e := challengeScalar(eventID, nostrPubKey, nonce)
+
+	var R, P, eP, T secp.JacobianPoint
+	nonce.AsJacobian(&R)
+	evenPub.AsJacobian(&P)
+	secp.ScalarMultNonConst(e, &P, &eP)
+	secp.AddNonConst(&R, &eP, &T)
+	if (T.X.IsZero() && T.Y.IsZero()) || T.Z.IsZero() {
+		return nil, fmt.Errorf("commitment is the point at infinity")
+	}
+	T.ToAffine()
+
+	return secp.NewPublicKey(&T.X, &T.Y), nil
+}
+
+// challengeScalar computes the BIP340 challenge e = H(R.x || P.x || event ID).
+func challengeScalar(eventID []byte, nostrPubKey, nonce *secp.PublicKey) *secp.ModNScalar {
+	hashInput := make([]byte, 0, 96)
+	hashInput = append(hashInput, schnorr.SerializePubKey(nonce)...)
+	hashInput = append(hashInput, schnorr.SerializePubKey(nostrPubKey)...)
+	hashInput = append(hashInput, eventID...)
+	hash := chainhash.TaggedHash(chainhash.TagBIP0340Challenge, hashInput)
+
+	e := new(secp.ModNScalar)
+	e.SetBytes((*[32]byte)(hash))
+	return e
+}
+
+// VerifyOffer checks that an offer was derived from the event template and
+// the seller's Nostr key: the template must be by nostrPubKey, the
+// commitment must be R + e*P for the BIP340 challenge e of the template's
+// ID, and the proof must show knowledge of the nonce and bind the claim
+// key the seller signs the MuSig2 claim with. A buyer that locks
+// funds against a verified offer is paid back with a signature of exactly
+// that event.
+//
+// The template may omit its ID and signature. If it has an ID, the ID must
+// match the template's content.
+func VerifyOffer(eventTemplate nostrlib.Event, nostrPubKey string, nonce, commitment, claimKey *secp.PublicKey, proof *NonceProof) error {
+	if eventTemplate.PubKey != nostrPubKey {
+		return fmt.Errorf("event is by %s, not %s", eventTemplate.PubKey, nostrPubKey)
+	}
+	eventID := eventTemplate.GetID()
+	if eventTemplate.ID != "" && eventTemplate.ID != eventID {
+		return fmt.Errorf("event ID %s does not match the event content", eventTemplate.ID)
+	}
+
+	offer := Offer{
+		EventID:     eventID,
+		NostrPubKey: nostrPubKey,
+		Nonce:       nonce,
+		Commitment:  commitment,
+		ClaimKey:    claimKey,
+		NonceProof:  proof,
+	}
+	return offer.verify()
+}
+
+// Verify checks the offer against the template of the event it sells, as
+// VerifyOffer does.
+func (o *Offer) Verify(eventTemplate nostrlib.Event) error {
+	if eventTemplate.GetID() != o.EventID {
+		return fmt.Errorf("offer is for event %s, not the template's", o.EventID)
+	}
+
+	return VerifyOffer(eventTemplate, o.NostrPubKey, o.Nonce, o.Commitment, o.ClaimKey, o.NonceProof)
+}
+
+// verify checks the commitment point and the nonce proof of the offer
+// against its event ID.
+func (o *Offer) verify() error {
+	if o.Nonce == nil || o.Commitment == nil {
+		return fmt.Errorf("offer is missing the nonce or commitment point")
+	}
+	if o.ClaimKey == nil {
+		return fmt.Errorf("offer is missing the claim key")
+	}
+	if o.Nonce.SerializeCompressed()[0] != 0x02 {
+		return fmt.Errorf("offer nonce must have an even Y coordinate")
+	}
+	eventID, err := crypto.DecodeHexStrict(o.EventID, 32)
+	if err != nil {
+		return fmt.Errorf("invalid event ID: %v", err)
+	}
+	pubKeyBytes, err := crypto.DecodeHexStrict(o.NostrPubKey, 32)
+	if err != nil {
+		return fmt.Errorf("invalid Nostr public key: %v", err)
+	}
+	nostrPubKey, err := schnorr.ParsePubKey(pubKeyBytes)
+	if err != nil {
+		return fmt.Errorf("invalid Nostr public key: %v", err)
+	}
+
+	commitment, err := commitmentPoint(eventID, nostrPubKey, o.Nonce)
+	if err != nil {
+		return err
+	}
+	if !commitment.IsEqual(o.Commitment) {
+		return fmt.Errorf("commitment is not bound to the event and the seller's key")
+	}
+	if !o.NonceProof.Verify(o.EventID, nostrPubKey, o.Nonce, o.Commitment, o.ClaimKey) {
+		return fmt.Errorf("invalid proof of knowledge of the nonce")
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package tanos
+
+import (
+	"testing"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/crypto"
+	"tanos/pkg/nostr"
+)
+
+// TestVerifyOffer checks that an honest offer verifies against its event
+// template, and that offers for other events, keys, commitments or nonces
+// are rejected.
+func TestVerifyOffer(t *testing.T) {
+	sellerSwap, _ := newTestSwaps(t)
+	otherSwap, _ := newTestSwaps(t)
+	offer := sellerSwap.Offer
+
+	template := sellerSwap.Seller.Event
+	template.ID, template.Sig = "", ""
+	if err := offer.Verify(template); err != nil {
+		t.Fatalf("Honest offer failed verification: %v", err)
+	}
+
+	edited := template
+	edited.Content = "something else"
+	if err := offer.Verify(edited); err == nil {
+		t.Fatalf("Offer verified against another event")
+	}
+	if err := VerifyOffer(template, otherSwap.Offer.NostrPubKey, offer.Nonce, offer.Commitment, offer.ClaimKey, offer.NonceProof); err == nil {
+		t.Fatalf("Offer verified for another seller")
+	}
+	mislabeled := template
+	mislabeled.ID = otherSwap.Offer.EventID
+	if err := VerifyOffer(mislabeled, offer.NostrPubKey, offer.Nonce, offer.Commitment, offer.ClaimKey, offer.NonceProof); err == nil {
+		t.Fatalf("Offer verified with an ID that does not match the event")
+	}
+
+	// An arbitrary commitment point is not bound to the event
+	bogus := offer
+	bogus.Commitment = otherSwap.Offer.Commitment
+	if err := bogus.Verify(template); err == nil {
+		t.Fatalf("Offer verified with a bogus commitment")
+	}
+	// Nor can the claim key be swapped for another once proven
+	rekeyed := offer
+	rekeyed.ClaimKey = otherSwap.Offer.ClaimKey
+	if err := rekeyed.Verify(template); err == nil {
+		t.Fatalf("Offer verified with another claim key")
+	}
+	buyer, err := NewBuyer(newTestKey(t))
+	if err != nil {
+		t.Fatalf("Failed to create buyer: %v", err)
+	}
+	if _, err := NewBuyerSwap(buyer, bogus); err == nil {
+		t.Fatalf("Buyer swap accepted a bogus commitment")
+	}
+
+	// A nonce the seller cannot sign with gives a well-formed commitment,
+	// but no proof for it can be made
+	k, err := secp.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate nonce: %v", err)
+	}
+	nonce, err := schnorr.ParsePubKey(schnorr.SerializePubKey(k.PubKey()))
+	if err != nil {
+		t.Fatalf("Failed to lift nonce: %v", err)
+	}
+	eventID, _ := crypto.HexDecode(offer.EventID)
+	commitment, err := commitmentPoint(eventID, sellerSwap.Seller.PublicKey, nonce)
+	if err != nil {
+		t.Fatalf("Failed to compute commitment: %v", err)
+	}
+	unproven := offer
+	unproven.Nonce, unproven.Commitment = nonce, commitment
+	if err := unproven.Verify(template); err == nil {
+		t.Fatalf("Offer verified with a proof for another nonce")
+	}
+	unproven.NonceProof = nil
+	if err := unproven.Verify(template); err == nil {
+		t.Fatalf("Offer verified without a proof")
+	}
+
+	// Proofs are bound to their offer
+	replayed := otherSwap.Offer
+	replayed.NonceProof = offer.NonceProof
+	if _, err := NewBuyerSwap(buyer, replayed); err == nil {
+		t.Fatalf("Buyer swap accepted a replayed proof")
+	}
+}
+
+// TestOfferForTemplate checks that events of other kinds are offered with a
+// commitment buyers can verify against the template.
+func TestOfferForTemplate(t *testing.T) {
+	seller, err := NewSeller(nostr.NewLocalSigner(newTestKey(t)))
+	if err != nil {
+		t.Fatalf("Failed to create seller: %v", err)
+	}
+
+	template := nostr.EventTemplate{
+		Kind:      nostrlib.KindArticle,
+		Tags:      nostrlib.Tags{{"d", "tanos"}},
+		CreatedAt: 1700000000,
+		Content:   "# An article sold over TANOS",
+	}
+	if err := seller.CreateEventFromTemplate(template); err != nil {
+		t.Fatalf("Failed to create article: %v", err)
+	}
+	if seller.Event.Kind != nostrlib.KindArticle {
+		t.Fatalf("Created event has kind %d", seller.Event.Kind)
+	}
+
+	offer, err := seller.Offer()
+	if err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	unsigned := nostrlib.Event{
+		PubKey:    seller.NostrPubKey,
+		CreatedAt: template.CreatedAt,
+		Kind:      template.Kind,
+		Tags:      template.Tags,
+		Content:   template.Content,
+	}
+	if err := offer.Verify(unsigned); err != nil {
+		t.Fatalf("Article offer failed verification: %v", err)
+	}
+
+	template.Tags = nil
+	if err := seller.CreateEventFromTemplate(template); err == nil {
+		t.Fatalf("Created an article without a \"d\" tag")
+	}
+}
@@ -0,0 +1,138 @@
+package tanos
+
+import (
+	"bytes"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+)
+
+// LockingPSBT returns the locking transaction as a PSBT, for an external
+// wallet to fund and sign. The swap output carries its BIP371 internal key
+// and script tree, and funding inputs from the buyer's own key path output
+// carry its internal key, and their signature once SignLockingTransaction
+// was called. So does change paid back to that output.
+func (b *SwapBuyer) LockingPSBT() (*psbt.Packet, error) {
+	if b.LockingTx == nil || len(b.FundingOutputs) == 0 {
+		return nil, fmt.Errorf("no locking transaction")
+	}
+
+	packet, err := bitcoin.NewPSBT(b.LockingTx, b.FundingOutputs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the script of the output is compared, so the network is moot
+	keyOutput, err := bitcoin.NewTaprootOutput(b.PublicKey, nil, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	for i, funding := range b.FundingOutputs {
+		if !bytes.Equal(funding.PkScript, keyOutput.PkScript) {
+			continue
+		}
+		if err := bitcoin.AddTaprootInput(packet, i, keyOutput); err != nil {
+			return nil, err
+		}
+		if witness := b.LockingTx.TxIn[i].Witness; len(witness) == 1 {
+			packet.Inputs[i].TaprootKeySpendSig = witness[0]
+		}
+	}
+
+	if b.LockOutput != nil {
+		if err := bitcoin.AddTaprootOutput(packet, 0, b.LockOutput); err != nil {
+			return nil, err
+		}
+	}
+	for i := 1; i < len(b.LockingTx.TxOut); i++ {
+		if bytes.Equal(b.LockingTx.TxOut[i].PkScript, keyOutput.PkScript) {
+			if err := bitcoin.AddTaprootOutput(packet, i, keyOutput); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return packet, nil
+}
+
+// ImportLockingPSBT takes back the locking transaction signed by an external
+// wallet as a base64 PSBT. The PSBT must be for the same transaction, and
+// its signatures must spend the funding outputs; they are then copied into
+// LockingTx, whose ID does not change.
+func (b *SwapBuyer) ImportLockingPSBT(encoded string) error {
+	if b.LockingTx == nil || len(b.FundingOutputs) == 0 {
+		return fmt.Errorf("no locking transaction")
+	}
+
+	signed, err := bitcoin.ImportPSBT(encoded, b.LockingTx, b.FundingOutputs)
+	if err != nil {
+		return fmt.Errorf("failed to import locking transaction: %v", err)
+	}
+
+	for i, txIn := range signed.TxIn {
+		b.LockingTx.TxIn[i].SignatureScript = txIn.SignatureScript
+		b.LockingTx.TxIn[i].Witness = txIn.Witness
+	}
+
+	return nil
+}
+
+// RefundPSBT returns the refund transaction of BuildRefundTransaction as a
+// PSBT carrying the refund leaf, its control block and the buyer's script
+// path signature, ready for any wallet to finalize and broadcast once the
+// refund timelock has expired.
+func (b *SwapBuyer) RefundPSBT(destScript []byte, fee int64) (*psbt.Packet, error) {
+	if b.LockingTx == nil || b.LockOutput == nil {
+		return nil, fmt.Errorf("no refundable locking transaction")
+	}
+
+	packet, err := bitcoin.NewRefundPSBT(b.LockingTx, 0, b.LockOutput, b.RefundLock, b.PublicKey, destScript, fee)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund PSBT: %v", err)
+	}
+
+	refundScript, err := bitcoin.CreateRefundScript(b.PublicKey, b.RefundLock)
+	if err != nil {
+		return nil, err
+	}
+	err = b.signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		return bitcoin.SignPSBTLeaf(packet, 0, refundScript, privKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign refund PSBT: %v", err)
+	}
+
+	return packet, nil
+}
+
+// ClaimPSBT returns the MuSig2 claim transaction as a PSBT spending the
+// swap output, with its internal key, merkle root and refund leaf. Once
+// CompleteClaim placed the key path signature in the witness, it is
+// included as the tap key signature. lockValue is the value of the swap
+// output being spent.
+func (s *SwapSeller) ClaimPSBT(claimTx *wire.MsgTx, lockValue int64) (*psbt.Packet, error) {
+	if s.LockOutput == nil {
+		return nil, fmt.Errorf("claim has not been prepared")
+	}
+	if len(claimTx.TxIn) != 1 {
+		return nil, fmt.Errorf("claim transaction must have exactly one input")
+	}
+
+	packet, err := bitcoin.NewPSBT(claimTx, []*wire.TxOut{wire.NewTxOut(lockValue, s.LockOutput.PkScript)})
+	if err != nil {
+		return nil, err
+	}
+	if err := bitcoin.AddTaprootInput(packet, 0, s.LockOutput); err != nil {
+		return nil, err
+	}
+	if witness := claimTx.TxIn[0].Witness; len(witness) == 1 {
+		packet.Inputs[0].TaprootKeySpendSig = witness[0]
+	}
+
+	return packet, nil
+}
@@ -0,0 +1,135 @@
+package tanos
+
+import (
+	"bytes"
+	"testing"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+)
+
+// signKeyPath plays an external wallet signing the key path input of a
+// PSBT with the BIP86 tweak of key.
+func signKeyPath(t *testing.T, packet *psbt.Packet, key *secp.PrivateKey) {
+	t.Helper()
+
+	prevOuts := []*wire.TxOut{packet.Inputs[0].WitnessUtxo}
+	fetcher, err := bitcoin.NewPrevOutputFetcher(packet.UnsignedTx, prevOuts)
+	if err != nil {
+		t.Fatalf("Failed to create fetcher: %v", err)
+	}
+	sigHash, err := bitcoin.CalculateSighash(packet.UnsignedTx, 0, fetcher, bitcoin.SigHashDefault)
+	if err != nil {
+		t.Fatalf("Failed to calculate sighash: %v", err)
+	}
+	sig, err := schnorr.Sign(txscript.TweakTaprootPrivKey(*key, nil), sigHash)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	packet.Inputs[0].TaprootKeySpendSig = sig.Serialize()
+}
+
+// TestLockingPSBTExternalSigner exports the locking transaction, has it
+// signed as an external wallet would and imports it back.
+func TestLockingPSBTExternalSigner(t *testing.T) {
+	_, buyerSwap := newTestSwaps(t)
+	buyer := buyerSwap.Buyer
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := buyerSwap.Fund(fundWithRefund); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	txid := buyerSwap.LockingTx.TxHash()
+
+	packet, err := buyer.LockingPSBT()
+	if err != nil {
+		t.Fatalf("Failed to export locking PSBT: %v", err)
+	}
+	if !bytes.Equal(packet.Inputs[0].TaprootInternalKey, schnorr.SerializePubKey(buyer.PublicKey)) {
+		t.Fatalf("Funding input lacks the buyer's internal key")
+	}
+	if len(packet.Outputs[0].TaprootTapTree) == 0 {
+		t.Fatalf("Swap output lacks its script tree")
+	}
+
+	// The wallet holds the buyer's key here, as a hardware wallet would
+	err = buyer.signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		signKeyPath(t, packet, privKey)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to get buyer key: %v", err)
+	}
+	encoded, err := bitcoin.EncodePSBT(packet)
+	if err != nil {
+		t.Fatalf("Failed to encode PSBT: %v", err)
+	}
+
+	if err := buyer.ImportLockingPSBT(encoded); err != nil {
+		t.Fatalf("Failed to import signed PSBT: %v", err)
+	}
+	if buyerSwap.LockingTx.TxHash() != txid || len(buyerSwap.LockingTx.TxIn[0].Witness) != 1 {
+		t.Fatalf("Import did not sign the swap's locking transaction in place")
+	}
+	if err := bitcoin.VerifyTransaction(buyerSwap.LockingTx, buyer.FundingOutputs); err != nil {
+		t.Fatalf("Imported locking transaction is invalid: %v", err)
+	}
+
+	// The funding output survives a restart, so the PSBT can be exported again
+	record, err := buyerSwap.Record()
+	if err != nil {
+		t.Fatalf("Failed to record swap: %v", err)
+	}
+	restored, err := RestoreSwap(record, swapKeys(buyerSwap))
+	if err != nil {
+		t.Fatalf("Failed to restore swap: %v", err)
+	}
+	again, err := restored.Buyer.LockingPSBT()
+	if err != nil {
+		t.Fatalf("Failed to export restored locking PSBT: %v", err)
+	}
+	if !bytes.Equal(again.Inputs[0].TaprootKeySpendSig, buyerSwap.LockingTx.TxIn[0].Witness[0]) {
+		t.Fatalf("Restored PSBT lacks the key path signature")
+	}
+}
+
+// TestRefundPSBTMatchesRefund checks that the signed refund PSBT finalizes
+// to the refund transaction built directly.
+func TestRefundPSBTMatchesRefund(t *testing.T) {
+	_, buyerSwap := newTestSwaps(t)
+	buyer := buyerSwap.Buyer
+	if err := fundWithRefund(buyer, &buyerSwap.Offer); err != nil {
+		t.Fatalf("Failed to fund: %v", err)
+	}
+	destScript := buyer.FundingOutputs[0].PkScript
+
+	packet, err := buyer.RefundPSBT(destScript, 1000)
+	if err != nil {
+		t.Fatalf("Failed to export refund PSBT: %v", err)
+	}
+	if len(packet.Inputs[0].TaprootScriptSpendSig) != 1 {
+		t.Fatalf("Refund PSBT is not signed")
+	}
+	encoded, err := bitcoin.EncodePSBT(packet)
+	if err != nil {
+		t.Fatalf("Failed to encode PSBT: %v", err)
+	}
+
+	refundTx, err := buyer.BuildRefundTransaction(destScript, 1000)
+	if err != nil {
+		t.Fatalf("Failed to build refund: %v", err)
+	}
+	imported, err := bitcoin.ImportPSBT(encoded, refundTx, []*wire.TxOut{buyer.LockingTx.TxOut[0]})
+	if err != nil {
+		t.Fatalf("Failed to finalize refund PSBT: %v", err)
+	}
+	if imported.WitnessHash() != refundTx.WitnessHash() {
+		t.Fatalf("Refund PSBT finalized to another transaction")
+	}
+}
@@ -0,0 +1,233 @@
+package tanos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/crypto"
+	"tanos/pkg/nostr"
+)
+
+// tagContentKey is the tag of the hash deriving content keys.
+var tagContentKey = []byte("TANOS/content/key")
+
+// SealedEventVersion is the version of the SealedEvent JSON encoding.
+const SealedEventVersion = 1
+
+// sealNonceSize is the size of the AES-GCM nonce of a sealed event.
+const sealNonceSize = 12
+
+// SealedEvent lets a seller offer an event without giving its content
+// away. It holds the event without its content and signature, the SHA-256
+// hash of the content, and the content encrypted with a key derived from
+// the signature scalar s. The buyer learns s when the swap completes, and
+// only then can open the event.
+//
+// The event ID is a hash of the content too, and the offer's commitment is
+// bound to the ID, so the content a buyer opens is the one it paid for.
+type SealedEvent struct {
+	Template    nostrlib.Event // The event with its content and signature removed
+	ContentHash []byte         // SHA-256 hash of the content
+	Nonce       []byte         // AES-GCM nonce
+	Ciphertext  []byte         // Content encrypted with the key derived from s
+}
+
+// contentKey derives the AES-256 key H(s || event ID) of a sealed event.
+func contentKey(secret *secp.ModNScalar, eventID []byte) []byte {
+	sBytes := secret.Bytes()
+	hashInput := append(sBytes[:], eventID...)
+	key := chainhash.TaggedHash(tagContentKey, hashInput)
+	for i := range hashInput {
+		hashInput[i] = 0
+	}
+
+	return key[:]
+}
+
+// newContentCipher returns the AES-GCM cipher for a content key.
+func newContentCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealAD returns the associated data of the content encryption, which binds
+// the ciphertext to the event ID and the content hash.
+func sealAD(eventID, contentHash []byte) []byte {
+	return append(append([]byte(nil), eventID...), contentHash...)
+}
+
+// SealEvent seals the seller's event, for offering it without revealing the
+// content. The event does not need to be signed yet. Only the returned
+// SealedEvent and the Offer should be sent to buyers.
+func (s *SwapSeller) SealEvent() (*SealedEvent, error) {
+	eventID, err := crypto.DecodeHexStrict(s.Event.ID, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event ID: %v", err)
+	}
+
+	var aead cipher.AEAD
+	err = s.withSecret(func(secret *secp.ModNScalar) error {
+		key := contentKey(secret, eventID)
+		defer func() {
+			for i := range key {
+				key[i] = 0
+			}
+		}()
+
+		var err error
+		aead, err = newContentCipher(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, sealNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to read randomness: %v", err)
+	}
+	contentHash := sha256.Sum256([]byte(s.Event.Content))
+
+	template := s.Event
+	template.Content = ""
+	template.Sig = ""
+
+	return &SealedEvent{
+		Template:    template,
+		ContentHash: contentHash[:],
+		Nonce:       nonce,
+		Ciphertext:  aead.Seal(nil, nonce, []byte(s.Event.Content), sealAD(eventID, contentHash[:])),
+	}, nil
+}
+
+// Verify checks that the sealed event is the event sold by the offer: the
+// same ID, by the same key, with no content or signature left in the clear.
+func (se *SealedEvent) Verify(offer *Offer) error {
+	if se.Template.ID != offer.EventID {
+		return fmt.Errorf("sealed event %s is not the offered event %s", se.Template.ID, offer.EventID)
+	}
+	if se.Template.PubKey != offer.NostrPubKey {
+		return fmt.Errorf("sealed event is by %s, not the seller %s", se.Template.PubKey, offer.NostrPubKey)
+	}
+	if se.Template.Content != "" || se.Template.Sig != "" {
+		return fmt.Errorf("sealed event reveals its content or signature")
+	}
+	if len(se.ContentHash) != sha256.Size || len(se.Nonce) != sealNonceSize {
+		return fmt.Errorf("sealed event has a malformed content hash or nonce")
+	}
+
+	return nil
+}
+
+// Open decrypts the content with the signature revealed by the swap and
+// returns the complete signed event. The content must match the content
+// hash and the event ID, and the signature must verify.
+func (se *SealedEvent) Open(nostrSig string) (nostrlib.Event, error) {
+	eventID, err := crypto.DecodeHexStrict(se.Template.ID, 32)
+	if err != nil {
+		return nostrlib.Event{}, fmt.Errorf("invalid event ID: %v", err)
+	}
+	if len(se.Nonce) != sealNonceSize {
+		return nostrlib.Event{}, fmt.Errorf("sealed event nonce must be %d bytes", sealNonceSize)
+	}
+	secret, err := nostr.ExtractSecretFromSignature(nostrSig)
+	if err != nil {
+		return nostrlib.Event{}, err
+	}
+
+	key := contentKey(secret, eventID)
+	aead, err := newContentCipher(key)
+	for i := range key {
+		key[i] = 0
+	}
+	if err != nil {
+		return nostrlib.Event{}, err
+	}
+
+	content, err := aead.Open(nil, se.Nonce, se.Ciphertext, sealAD(eventID, se.ContentHash))
+	if err != nil {
+		return nostrlib.Event{}, fmt.Errorf("failed to decrypt content: %v", err)
+	}
+	if contentHash := sha256.Sum256(content); string(contentHash[:]) != string(se.ContentHash) {
+		return nostrlib.Event{}, fmt.Errorf("content does not match the content hash")
+	}
+
+	ev := se.Template
+	ev.Content = string(content)
+	ev.Sig = nostrSig
+	if ev.GetID() != se.Template.ID {
+		return nostrlib.Event{}, fmt.Errorf("content does not match the event ID")
+	}
+	if ok, err := ev.CheckSignature(); !ok {
+		return nostrlib.Event{}, fmt.Errorf("invalid event signature: %v", err)
+	}
+
+	return ev, nil
+}
+
+// sealedEventJSON is the JSON form of a SealedEvent, with hex encoded fields.
+type sealedEventJSON struct {
+	Version     int            `json:"version"`
+	Event       nostrlib.Event `json:"event"`
+	ContentHash string         `json:"content_hash"`
+	Nonce       string         `json:"nonce"`
+	Ciphertext  string         `json:"ciphertext"`
+}
+
+// MarshalJSON encodes the sealed event as a versioned JSON object with
+// lowercase hex fields.
+func (se SealedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sealedEventJSON{
+		Version:     SealedEventVersion,
+		Event:       se.Template,
+		ContentHash: crypto.HexEncode(se.ContentHash),
+		Nonce:       crypto.HexEncode(se.Nonce),
+		Ciphertext:  crypto.HexEncode(se.Ciphertext),
+	})
+}
+
+// UnmarshalJSON decodes a sealed event encoded by MarshalJSON. Unknown
+// fields are rejected.
+func (se *SealedEvent) UnmarshalJSON(data []byte) error {
+	var v sealedEventJSON
+	if err := decodeStrictJSON(data, &v); err != nil {
+		return fmt.Errorf("invalid sealed event JSON: %v", err)
+	}
+	if v.Version != SealedEventVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, v.Version)
+	}
+
+	contentHash, err := crypto.DecodeHexStrict(v.ContentHash, sha256.Size)
+	if err != nil {
+		return fmt.Errorf("invalid content_hash: %v", err)
+	}
+	nonce, err := crypto.DecodeHexStrict(v.Nonce, sealNonceSize)
+	if err != nil {
+		return fmt.Errorf("invalid nonce: %v", err)
+	}
+	ciphertext, err := crypto.HexDecode(v.Ciphertext)
+	if err != nil {
+		return fmt.Errorf("invalid ciphertext: %v", err)
+	}
+
+	*se = SealedEvent{
+		Template:    v.Event,
+		ContentHash: contentHash,
+		Nonce:       nonce,
+		Ciphertext:  ciphertext,
+	}
+
+	return nil
+}
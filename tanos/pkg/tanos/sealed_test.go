@@ -0,0 +1,62 @@
+package tanos
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestSealedEvent checks that a sealed event hides its content until the
+// swap reveals the signature, and only opens with that signature.
+func TestSealedEvent(t *testing.T) {
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	otherSwap, _ := newTestSwaps(t)
+	seller := sellerSwap.Seller
+
+	sealed, err := seller.SealEvent()
+	if err != nil {
+		t.Fatalf("Failed to seal event: %v", err)
+	}
+	js, err := json.Marshal(sealed)
+	if err != nil {
+		t.Fatalf("Failed to encode sealed event: %v", err)
+	}
+	var received SealedEvent
+	if err := json.Unmarshal(js, &received); err != nil {
+		t.Fatalf("Failed to decode sealed event: %v", err)
+	}
+
+	if err := received.Verify(&buyerSwap.Offer); err != nil {
+		t.Fatalf("Sealed event does not match the offer: %v", err)
+	}
+	if err := received.Verify(&otherSwap.Offer); err == nil {
+		t.Fatalf("Sealed event matched another offer")
+	}
+	leaky := received
+	leaky.Template.Content = seller.Event.Content
+	if err := leaky.Verify(&buyerSwap.Offer); err == nil {
+		t.Fatalf("Sealed event with content in the clear verified")
+	}
+
+	// The event was sealed before its signature existed
+	if seller.Event.Sig != "" {
+		t.Fatalf("Sealing signed the event")
+	}
+	if _, err := received.Open(signedEvent(t, otherSwap.Seller)); err == nil {
+		t.Fatalf("Sealed event opened with another signature")
+	}
+
+	ev, err := received.Open(signedEvent(t, seller))
+	if err != nil {
+		t.Fatalf("Failed to open sealed event: %v", err)
+	}
+	if ev.ID != seller.Event.ID || ev.Content != seller.Event.Content || ev.Sig != seller.Event.Sig {
+		t.Fatalf("Opened event differs from the seller's")
+	}
+
+	tampered := received
+	tampered.Ciphertext = append([]byte(nil), received.Ciphertext...)
+	tampered.Ciphertext[0] ^= 1
+	if _, err := tampered.Open(seller.Event.Sig); err == nil {
+		t.Fatalf("Tampered ciphertext opened")
+	}
+}
@@ -0,0 +1,216 @@
+package tanos
+
+import (
+	"bytes"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/adaptor"
+	"tanos/pkg/bitcoin"
+)
+
+// CreateSegwitLockingTransaction creates a Bitcoin transaction that locks
+// funds in a P2WSH output claimed with both the buyer's and the seller's
+// ECDSA signatures, for parties that cannot sign MuSig2. The buyer's claim
+// signature is an ECDSA adaptor signature, whose completion on chain reveals
+// the adaptor secret. The buyer can reclaim the funds alone once refundLock
+// expires.
+func (b *SwapBuyer) CreateSegwitLockingTransaction(
+	amount int64,
+	prevTxID string,
+	prevOutputIndex uint32,
+	prevOutputValue int64,
+	prevOutputScript []byte,
+	sellerPubKey *secp.PublicKey,
+	refundLock bitcoin.Timelock,
+	network *chaincfg.Params,
+) error {
+	lockOutput, err := bitcoin.CreateSegwitLockOutput(b.PublicKey, sellerPubKey, refundLock, network)
+	if err != nil {
+		return fmt.Errorf("failed to create segwit lock output: %v", err)
+	}
+
+	prevHash, err := chainhash.NewHashFromStr(prevTxID)
+	if err != nil {
+		return fmt.Errorf("invalid previous transaction ID: %v", err)
+	}
+
+	lockTx := wire.NewMsgTx(2)
+	lockTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(prevHash, prevOutputIndex), nil, nil))
+	lockTx.AddTxOut(wire.NewTxOut(amount, lockOutput.PkScript))
+
+	sigHash, err := bitcoin.KeyPathSighash(lockTx, wire.NewTxOut(prevOutputValue, prevOutputScript))
+	if err != nil {
+		return err
+	}
+
+	b.claim.zero()
+	b.LockingTx = lockTx
+	b.FundingOutputs = []*wire.TxOut{wire.NewTxOut(prevOutputValue, prevOutputScript)}
+	b.SigHash = sigHash
+	b.LockOutput = nil
+	b.SegwitLock = lockOutput
+	b.SegwitClaimSig = nil
+	b.RefundLock = refundLock
+	b.claim = claimState{}
+
+	return nil
+}
+
+// SignSegwitClaim returns the buyer's ECDSA adaptor signature of the claim
+// of the P2WSH lock output, with the commitment as adaptor point. The buyer
+// keeps it to extract the secret once the claim is published.
+func (b *SwapBuyer) SignSegwitClaim(claimTx *wire.MsgTx, commitment *secp.PublicKey) (*adaptor.ECDSASignature, error) {
+	if b.LockingTx == nil || b.SegwitLock == nil {
+		return nil, fmt.Errorf("no segwit locking transaction")
+	}
+
+	lockHash := b.LockingTx.TxHash()
+	if len(claimTx.TxIn) != 1 || claimTx.TxIn[0].PreviousOutPoint != *wire.NewOutPoint(&lockHash, 0) {
+		return nil, fmt.Errorf("claim transaction does not spend the lock output")
+	}
+	sigHash, err := b.SegwitLock.SigHash(claimTx, 0, b.LockingTx.TxOut[0].Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var preSig *adaptor.ECDSASignature
+	err = b.signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		var err error
+		preSig, err = adaptor.NewECDSA(privKey, commitment, sigHash)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign claim transaction: %v", err)
+	}
+	b.SegwitClaimSig = preSig
+
+	return preSig, nil
+}
+
+// ExtractSecretFromSegwitClaim recovers the adaptor secret, i.e. the s value
+// of the seller's Nostr signature, from the witness of the published claim
+// of the P2WSH lock output.
+func (b *SwapBuyer) ExtractSecretFromSegwitClaim(claimTx *wire.MsgTx) (*secp.ModNScalar, error) {
+	if b.SegwitClaimSig == nil || b.SegwitLock == nil {
+		return nil, fmt.Errorf("claim has not been signed")
+	}
+	if len(claimTx.TxIn) != 1 {
+		return nil, fmt.Errorf("claim transaction must have exactly one input")
+	}
+
+	return segwitSecret(b.SegwitClaimSig, b.SegwitLock)(claimTx.TxIn[0].Witness)
+}
+
+// BuildSegwitRefundTransaction creates a signed transaction that returns the
+// funds locked in the P2WSH output to destScript. Like
+// BuildRefundTransaction, it is only valid once the refund timelock has
+// expired.
+func (b *SwapBuyer) BuildSegwitRefundTransaction(destScript []byte, fee int64) (*wire.MsgTx, error) {
+	if b.LockingTx == nil || b.SegwitLock == nil {
+		return nil, fmt.Errorf("no segwit locking transaction")
+	}
+
+	var refundTx *wire.MsgTx
+	err := b.signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		var err error
+		refundTx, err = bitcoin.CreateSegwitRefundTransaction(
+			b.LockingTx,
+			0,
+			b.SegwitLock,
+			b.RefundLock,
+			privKey,
+			destScript,
+			fee,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund transaction: %v", err)
+	}
+
+	return refundTx, nil
+}
+
+// PrepareSegwitClaim derives the P2WSH swap output from the buyer's key, the
+// seller's claim key and the agreed refund timelock.
+func (s *SwapSeller) PrepareSegwitClaim(
+	buyerPubKey *secp.PublicKey,
+	refundLock bitcoin.Timelock,
+	network *chaincfg.Params,
+) error {
+	if _, err := s.keySigner(); err != nil {
+		return err
+	}
+
+	lockOutput, err := bitcoin.CreateSegwitLockOutput(buyerPubKey, s.ClaimKey, refundLock, network)
+	if err != nil {
+		return fmt.Errorf("failed to create segwit lock output: %v", err)
+	}
+	s.SegwitLock = lockOutput
+
+	return nil
+}
+
+// CompleteSegwitClaim verifies the buyer's ECDSA adaptor signature of the
+// claim, completes it with the Nostr signature secret and places it, with
+// the seller's own signature, in the claim transaction's witness. lockValue
+// is the value of the P2WSH output being spent. Publishing the claim
+// reveals the secret to the buyer.
+func (s *SwapSeller) CompleteSegwitClaim(
+	claimTx *wire.MsgTx,
+	lockValue int64,
+	buyerPubKey *secp.PublicKey,
+	buyerSig *adaptor.ECDSASignature,
+) error {
+	if s.SegwitLock == nil {
+		return fmt.Errorf("claim has not been prepared")
+	}
+	if s.Commitment == nil {
+		return fmt.Errorf("no commitment point")
+	}
+	keySigner, err := s.keySigner()
+	if err != nil {
+		return err
+	}
+	if len(claimTx.TxIn) != 1 {
+		return fmt.Errorf("claim transaction must have exactly one input")
+	}
+
+	sigHash, err := s.SegwitLock.SigHash(claimTx, 0, lockValue)
+	if err != nil {
+		return err
+	}
+	if !buyerSig.PubKey.IsEqual(buyerPubKey) || !bytes.Equal(buyerSig.Message, sigHash) {
+		return fmt.Errorf("buyer adaptor signature does not sign the claim")
+	}
+	if !buyerSig.Verify(s.Commitment) {
+		return fmt.Errorf("invalid buyer adaptor signature")
+	}
+
+	var sellerSig []byte
+	err = keySigner.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		sellerSig = ecdsa.Sign(privKey, sigHash).Serialize()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign claim transaction: %v", err)
+	}
+
+	event, secret, err := s.signedEvent()
+	if err != nil {
+		return err
+	}
+	completed := buyerSig.Complete(secret)
+	claimTx.TxIn[0].Witness = bitcoin.SegwitClaimWitness(s.SegwitLock, sellerSig, buyerSig.GenerateFinalSignature(completed))
+	s.Event = event
+
+	// The event is signed for good
+	s.Discard()
+	return nil
+}
@@ -0,0 +1,143 @@
+package tanos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+)
+
+// lockSegwit locks the coin of fundTx to the P2WSH output of the buyer's
+// key and the seller's claim key on chain, and prepares the seller's claim
+// of it.
+func lockSegwit(t *testing.T, chain *bitcoin.SimChain, sellerSwap, buyerSwap *Swap, lock bitcoin.Timelock) []byte {
+	t.Helper()
+	ctx := context.Background()
+	params := &chaincfg.RegressionNetParams
+	seller, buyer := sellerSwap.Seller, buyerSwap.Buyer
+
+	fundTx, fundScript := fundOnChain(t, chain, buyer)
+	err := buyer.CreateSegwitLockingTransaction(
+		100000, fundTx.TxHash().String(), 0, fundTx.TxOut[0].Value, fundScript,
+		buyerSwap.Offer.ClaimKey, lock, params,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create locking transaction: %v", err)
+	}
+	if err := buyer.SignLockingTransaction(); err != nil {
+		t.Fatalf("Failed to sign locking transaction: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyer.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	chain.Mine(1)
+
+	if err := seller.PrepareSegwitClaim(buyer.PublicKey, lock, params); err != nil {
+		t.Fatalf("Seller failed to prepare claim: %v", err)
+	}
+
+	return fundScript
+}
+
+// TestSegwitSwap runs swaps locked to P2WSH outputs on the simulated chain:
+// the seller claims with the completed ECDSA adaptor signature and the
+// buyer's watcher recovers the Nostr signature from the claim.
+func TestSegwitSwap(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chain := bitcoin.NewSimChain()
+
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	seller, buyer := sellerSwap.Seller, buyerSwap.Buyer
+
+	// Enough runs to cover both signs of the completed s value
+	for i := 0; i < 8; i++ {
+		destScript := lockSegwit(t, chain, sellerSwap, buyerSwap, bitcoin.RelativeBlocks(10))
+		fee := bitcoin.SegwitClaimFee(bitcoin.FeeRatePerVByte(5), seller.SegwitLock, destScript)
+		claimTx, _, err := bitcoin.CreateSegwitClaimTransaction(buyer.LockingTx, 0, seller.SegwitLock, destScript, fee)
+		if err != nil {
+			t.Fatalf("Failed to create claim: %v", err)
+		}
+
+		// An adaptor signature for another point is refused
+		wrongSig, err := buyer.SignSegwitClaim(claimTx, buyer.PublicKey)
+		if err != nil {
+			t.Fatalf("Buyer failed to sign claim: %v", err)
+		}
+		if err := seller.CompleteSegwitClaim(claimTx, 100000, buyer.PublicKey, wrongSig); err == nil {
+			t.Fatalf("Seller accepted an adaptor signature for another point")
+		}
+
+		preSig, err := buyer.SignSegwitClaim(claimTx, buyerSwap.Offer.Commitment)
+		if err != nil {
+			t.Fatalf("Buyer failed to sign claim: %v", err)
+		}
+		if err := seller.CompleteSegwitClaim(claimTx, 100000, buyer.PublicKey, preSig); err != nil {
+			t.Fatalf("Seller failed to complete claim: %v", err)
+		}
+		if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+			t.Fatalf("Run %d: claim rejected: %v", i, err)
+		}
+
+		outpoint := wire.OutPoint{Hash: buyer.LockingTx.TxHash(), Index: 0}
+		reveal, err := WatchSegwitClaim(ctx, chain, outpoint, 0, buyer.SegwitClaimSig, buyer.SegwitLock, &buyerSwap.Offer)
+		if err != nil {
+			t.Fatalf("Run %d: watcher failed: %v", i, err)
+		}
+		if reveal.NostrSig != seller.Event.Sig {
+			t.Fatalf("Run %d: watcher rebuilt the wrong Nostr signature", i)
+		}
+
+		secret, err := buyer.ExtractSecretFromSegwitClaim(claimTx)
+		if err != nil {
+			t.Fatalf("Failed to extract secret: %v", err)
+		}
+		if !secret.Equals(reveal.Secret) {
+			t.Fatalf("Run %d: extracted secret differs from the watcher's", i)
+		}
+	}
+}
+
+// TestWatchSegwitClaimReportsRefund checks that a refund of a P2WSH lock
+// output is reported as ErrLockRefunded.
+func TestWatchSegwitClaimReportsRefund(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chain := bitcoin.NewSimChain()
+
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	buyer := buyerSwap.Buyer
+
+	destScript := lockSegwit(t, chain, sellerSwap, buyerSwap, bitcoin.RelativeBlocks(10))
+	claimTx, _, err := bitcoin.CreateSegwitClaimTransaction(buyer.LockingTx, 0, buyer.SegwitLock, destScript, 1000)
+	if err != nil {
+		t.Fatalf("Failed to create claim: %v", err)
+	}
+	if _, err := buyer.SignSegwitClaim(claimTx, buyerSwap.Offer.Commitment); err != nil {
+		t.Fatalf("Buyer failed to sign claim: %v", err)
+	}
+
+	fee := bitcoin.SegwitRefundFee(bitcoin.FeeRatePerVByte(5), buyer.SegwitLock, destScript)
+	refundTx, err := buyer.BuildSegwitRefundTransaction(destScript, fee)
+	if err != nil {
+		t.Fatalf("Failed to build refund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, refundTx); err == nil {
+		t.Fatalf("Refund accepted before its timelock")
+	}
+	chain.Mine(9)
+	if _, err := chain.Broadcast(ctx, refundTx); err != nil {
+		t.Fatalf("Refund rejected: %v", err)
+	}
+
+	outpoint := wire.OutPoint{Hash: buyer.LockingTx.TxHash(), Index: 0}
+	_, err = WatchSegwitClaim(ctx, chain, outpoint, 0, buyer.SegwitClaimSig, buyer.SegwitLock, &buyerSwap.Offer)
+	if !errors.Is(err, ErrLockRefunded) {
+		t.Fatalf("Expected ErrLockRefunded, got %v", err)
+	}
+}
@@ -0,0 +1,578 @@
+package tanos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/musig2"
+)
+
+// ErrFundingUnconfirmed is returned by Swap.VerifyFunding while the locking
+// transaction lacks confirmations.
+var ErrFundingUnconfirmed = errors.New("locking transaction is not confirmed enough")
+
+// Phase is the stage a swap has reached.
+type Phase int
+
+const (
+	// PhaseOffered means the seller has published the nonce and commitment
+	// point of a signed, but still secret, Nostr event.
+	PhaseOffered Phase = iota
+	// PhaseCommitted means the buyer has accepted the offer and the
+	// commitment point the swap is built on.
+	PhaseCommitted
+	// PhaseFunded means the locking transaction has been created.
+	PhaseFunded
+	// PhaseClaimNonce means the party generated its MuSig2 nonce for the
+	// claim transaction.
+	PhaseClaimNonce
+	// PhaseClaimSigned means the seller built the claim transaction and
+	// partially signed it. Only the seller goes through this phase.
+	PhaseClaimSigned
+	// PhaseAdaptorSigned means both partial signatures of the claim were
+	// verified and aggregated into a pre-signature, with the commitment
+	// point as adaptor point.
+	PhaseAdaptorSigned
+	// PhaseClaimed means the seller completed the claim with the Nostr
+	// signature, or the buyer extracted the signature from the claim.
+	PhaseClaimed
+	// PhaseRefunded means the refund of the locked funds was seen on chain.
+	PhaseRefunded
+	// PhaseExpired means the refund timelock passed before the swap was
+	// claimed.
+	PhaseExpired
+	// PhaseRefundPending means the buyer built the refund transaction but
+	// has not seen it spend the lock output yet.
+	PhaseRefundPending
+)
+
+// String returns the name of the phase.
+func (p Phase) String() string {
+	switch p {
+	case PhaseOffered:
+		return "offered"
+	case PhaseCommitted:
+		return "committed"
+	case PhaseFunded:
+		return "funded"
+	case PhaseClaimNonce:
+		return "claim-nonce"
+	case PhaseClaimSigned:
+		return "claim-signed"
+	case PhaseAdaptorSigned:
+		return "adaptor-signed"
+	case PhaseClaimed:
+		return "claimed"
+	case PhaseRefunded:
+		return "refunded"
+	case PhaseExpired:
+		return "expired"
+	case PhaseRefundPending:
+		return "refund-pending"
+	default:
+		return fmt.Sprintf("phase(%d)", int(p))
+	}
+}
+
+// Terminal reports whether no further transition is possible from the phase.
+func (p Phase) Terminal() bool {
+	return p == PhaseClaimed || p == PhaseRefunded
+}
+
+// transitions lists the phases reachable from each phase. An expired swap
+// can still be claimed, since the seller may win the race against the
+// refund, or refunded by the buyer. The seller moves to PhaseRefunded when it
+// sees the refund, the buyer goes through PhaseRefundPending until then.
+// Claim signing starts over with fresh nonces until the pre-signature is
+// aggregated, since a restarted process no longer has its secret nonce.
+var transitions = map[Phase][]Phase{
+	PhaseOffered:       {PhaseCommitted, PhaseExpired},
+	PhaseCommitted:     {PhaseFunded, PhaseExpired},
+	PhaseFunded:        {PhaseClaimNonce, PhaseRefundPending, PhaseRefunded, PhaseExpired},
+	PhaseClaimNonce:    {PhaseClaimNonce, PhaseClaimSigned, PhaseAdaptorSigned, PhaseRefundPending, PhaseRefunded, PhaseExpired},
+	PhaseClaimSigned:   {PhaseClaimNonce, PhaseAdaptorSigned, PhaseRefundPending, PhaseRefunded, PhaseExpired},
+	PhaseAdaptorSigned: {PhaseClaimed, PhaseRefundPending, PhaseRefunded, PhaseExpired},
+	PhaseExpired:       {PhaseClaimed, PhaseRefundPending, PhaseRefunded},
+	PhaseRefundPending: {PhaseClaimed, PhaseRefunded},
+}
+
+// CanTransition reports whether a swap may move from one phase to another.
+func CanTransition(from, to Phase) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Role is the side of the swap a participant is on.
+type Role int
+
+const (
+	// RoleSeller sells the signature of a Nostr event.
+	RoleSeller Role = iota
+	// RoleBuyer pays Bitcoin for the signature.
+	RoleBuyer
+)
+
+// String returns the name of the role.
+func (r Role) String() string {
+	switch r {
+	case RoleSeller:
+		return "seller"
+	case RoleBuyer:
+		return "buyer"
+	default:
+		return fmt.Sprintf("role(%d)", int(r))
+	}
+}
+
+// TransitionError is returned when an action would move a swap to a phase
+// that cannot follow its current phase.
+type TransitionError struct {
+	From Phase
+	To   Phase
+}
+
+// Error implements the error interface.
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("illegal swap transition from %s to %s", e.From, e.To)
+}
+
+// RoleError is returned when an action is attempted by the wrong side of
+// the swap.
+type RoleError struct {
+	Role   Role   // Role of the swap the action was attempted on
+	Action string // Name of the action
+}
+
+// Error implements the error interface.
+func (e *RoleError) Error() string {
+	return fmt.Sprintf("%s cannot be performed by the %s", e.Action, e.Role)
+}
+
+// Hook is called after a swap moved to a new phase. Returning an error
+// reverts the swap to its previous phase and fails the transition.
+type Hook func(swap *Swap, from, to Phase) error
+
+// Offer is what the seller publishes to start a swap: the event ID and
+// public key the signature is for, with the nonce and commitment point of
+// that signature, the key the seller signs the MuSig2 claim with and a
+// proof that the seller knows the nonce.
+type Offer struct {
+	EventID     string          // ID of the Nostr event being sold
+	NostrPubKey string          // Seller's Nostr public key in hex
+	Nonce       *secp.PublicKey // Nonce R of the event signature
+	Commitment  *secp.PublicKey // Commitment point T = R + e*P
+	ClaimKey    *secp.PublicKey // Seller's key in the MuSig2 lock output
+	NonceProof  *NonceProof     // Proof of knowledge of the nonce
+}
+
+// Swap drives one atomic swap through its phases for either role. Every
+// action checks that it is legal in the current phase and for the role of
+// the swap before touching the underlying SwapSeller or SwapBuyer.
+type Swap struct {
+	ID     string // Role and ID of the event being sold, see SwapID
+	Role   Role
+	Phase  Phase
+	Offer  Offer
+	Seller *SwapSeller // Set for RoleSeller
+	Buyer  *SwapBuyer  // Set for RoleBuyer
+
+	LockingTx *wire.MsgTx    // Transaction locking the buyer's funds
+	Funding   *FundingNotice // Buyer's funding notice, for RoleSeller
+	ClaimTx   *wire.MsgTx    // Claim transaction, completed once claimed
+	NostrSig  string         // Nostr signature of the event, once claimed
+	RefundTx  *wire.MsgTx    // Buyer's latest refund transaction, once refunded
+
+	hooks []Hook
+}
+
+// Offer returns the offer for the seller's signed event, naming the key the
+// seller claims with.
+func (s *SwapSeller) Offer() (*Offer, error) {
+	if s.Nonce == nil || s.Commitment == nil || s.NonceProof == nil {
+		return nil, fmt.Errorf("no signed event to offer")
+	}
+
+	return &Offer{
+		EventID:     s.Event.ID,
+		NostrPubKey: s.NostrPubKey,
+		Nonce:       s.Nonce,
+		Commitment:  s.Commitment,
+		ClaimKey:    s.ClaimKey,
+		NonceProof:  s.NonceProof,
+	}, nil
+}
+
+// SwapID returns the ID of the swap of the event for a role. A process may
+// buy and sell the same event, so the event ID alone does not name a swap.
+func SwapID(role Role, eventID string) string {
+	return role.String() + "-" + eventID
+}
+
+// NewSellerSwap starts a swap on the seller side for the seller's signed event.
+func NewSellerSwap(seller *SwapSeller) (*Swap, error) {
+	offer, err := seller.Offer()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Swap{
+		ID:     SwapID(RoleSeller, offer.EventID),
+		Role:   RoleSeller,
+		Phase:  PhaseOffered,
+		Offer:  *offer,
+		Seller: seller,
+	}, nil
+}
+
+// NewBuyerSwap starts a swap on the buyer side for a received offer. The
+// commitment point must be bound to the event ID and the seller's key, and
+// the nonce proof must verify. Checking that the event ID is the event the
+// buyer wants is left to Offer.Verify.
+func NewBuyerSwap(buyer *SwapBuyer, offer Offer) (*Swap, error) {
+	if err := offer.verify(); err != nil {
+		return nil, fmt.Errorf("invalid offer: %v", err)
+	}
+
+	return &Swap{
+		ID:    SwapID(RoleBuyer, offer.EventID),
+		Role:  RoleBuyer,
+		Phase: PhaseOffered,
+		Offer: offer,
+		Buyer: buyer,
+	}, nil
+}
+
+// OnTransition registers a hook called after every phase change.
+func (sw *Swap) OnTransition(hook Hook) {
+	sw.hooks = append(sw.hooks, hook)
+}
+
+// check returns an error if the swap cannot move to the given phase, or if
+// the action is reserved for another role.
+func (sw *Swap) check(to Phase, role Role, action string) error {
+	if sw.Role != role {
+		return &RoleError{Role: sw.Role, Action: action}
+	}
+	if !CanTransition(sw.Phase, to) {
+		return &TransitionError{From: sw.Phase, To: to}
+	}
+
+	return nil
+}
+
+// transition moves the swap to a new phase and runs the hooks.
+func (sw *Swap) transition(to Phase) error {
+	if !CanTransition(sw.Phase, to) {
+		return &TransitionError{From: sw.Phase, To: to}
+	}
+
+	from := sw.Phase
+	sw.Phase = to
+
+	for _, hook := range sw.hooks {
+		if err := hook(sw, from, to); err != nil {
+			sw.Phase = from
+			return fmt.Errorf("swap hook failed on transition to %s: %v", to, err)
+		}
+	}
+
+	return nil
+}
+
+// Commit records that the buyer accepted the offer. Both roles call it: the
+// buyer when deciding to go ahead, the seller when told so.
+func (sw *Swap) Commit() error {
+	return sw.transition(PhaseCommitted)
+}
+
+// Fund creates the buyer's locking transaction with create, which should
+// call CreateMuSig2LockingTransaction with the offer's claim key, and moves
+// the swap to PhaseFunded. The lock output must be the MuSig2 output of the
+// buyer's key and the claim key, since the swap is claimed through it.
+func (sw *Swap) Fund(create func(buyer *SwapBuyer, offer *Offer) error) error {
+	if err := sw.check(PhaseFunded, RoleBuyer, "funding"); err != nil {
+		return err
+	}
+
+	if err := create(sw.Buyer, &sw.Offer); err != nil {
+		return err
+	}
+	if sw.Buyer.LockingTx == nil || sw.Buyer.SigHash == nil {
+		return fmt.Errorf("no locking transaction was created")
+	}
+	lockOutput, _, err := swapLockOutput(sw.Buyer.PublicKey, sw.Offer.ClaimKey, sw.Buyer.RefundLock)
+	if err != nil {
+		return err
+	}
+	if sw.Buyer.claim.keyAgg == nil || !bytes.Equal(sw.Buyer.LockingTx.TxOut[0].PkScript, lockOutput.PkScript) {
+		return fmt.Errorf("locking transaction does not pay the MuSig2 output of the offer's claim key")
+	}
+
+	sw.LockingTx = sw.Buyer.LockingTx
+
+	return sw.transition(PhaseFunded)
+}
+
+// FundingNotice returns the notice telling the seller that the buyer
+// funded the swap.
+func (sw *Swap) FundingNotice() (*FundingNotice, error) {
+	if sw.Role != RoleBuyer {
+		return nil, &RoleError{Role: sw.Role, Action: "announcing funding"}
+	}
+	if sw.LockingTx == nil {
+		return nil, fmt.Errorf("swap has not been funded")
+	}
+
+	return &FundingNotice{
+		EventID:     sw.Offer.EventID,
+		BuyerPubKey: sw.Buyer.PublicKey,
+		RefundLock:  sw.Buyer.RefundLock,
+		OutputIndex: 0,
+		LockingTx:   sw.LockingTx,
+	}, nil
+}
+
+// ObserveFunding records the buyer's funding notice on the seller side. The
+// lock output must be the MuSig2 output of the buyer's key and the offer's
+// claim key, with the refund timelock of the notice. Whether the locking
+// transaction confirmed is left to the caller.
+func (sw *Swap) ObserveFunding(notice *FundingNotice) error {
+	if err := sw.check(PhaseFunded, RoleSeller, "observing funding"); err != nil {
+		return err
+	}
+	if notice.EventID != sw.Offer.EventID {
+		return fmt.Errorf("funding notice is for event %s, not %s", notice.EventID, sw.Offer.EventID)
+	}
+	if err := notice.validate(); err != nil {
+		return err
+	}
+	if err := sw.Seller.observeLock(notice); err != nil {
+		return err
+	}
+
+	sw.LockingTx = notice.LockingTx
+	sw.Funding = notice
+
+	return sw.transition(PhaseFunded)
+}
+
+// VerifyFunding checks through backend that the lock output of the buyer's
+// funding notice is unspent, pays the swap's MuSig2 output the value of the
+// notice, at least amount, and has at least confirmations confirmations. It
+// returns ErrFundingUnconfirmed while the locking transaction has fewer. The
+// seller must verify the funding before signing the claim.
+func (sw *Swap) VerifyFunding(ctx context.Context, backend bitcoin.ChainBackend, amount int64, confirmations int32) error {
+	if sw.Role != RoleSeller {
+		return &RoleError{Role: sw.Role, Action: "verifying funding"}
+	}
+	if sw.Funding == nil || sw.Seller.LockOutput == nil {
+		return fmt.Errorf("swap has not been funded")
+	}
+
+	lockOutput := sw.Funding.LockOutput()
+	if lockOutput.Value < amount {
+		return fmt.Errorf("lock output pays %d, less than %d", lockOutput.Value, amount)
+	}
+
+	outpoint := wire.OutPoint{Hash: sw.Funding.LockingTx.TxHash(), Index: sw.Funding.OutputIndex}
+	utxo, err := backend.GetUTXO(ctx, outpoint)
+	if err != nil {
+		return fmt.Errorf("failed to look up lock output %s: %v", outpoint, err)
+	}
+	if !bytes.Equal(utxo.Output.PkScript, sw.Seller.LockOutput.PkScript) || utxo.Output.Value != lockOutput.Value {
+		return fmt.Errorf("lock output %s on chain is not the funded swap output", outpoint)
+	}
+
+	if utxo.Height == 0 {
+		return ErrFundingUnconfirmed
+	}
+	tip, err := backend.GetTipHeight(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get tip height: %v", err)
+	}
+	if tip-utxo.Height+1 < confirmations {
+		return ErrFundingUnconfirmed
+	}
+
+	return nil
+}
+
+// ClaimNonce generates the MuSig2 nonce of either party for the claim
+// transaction and moves to PhaseClaimNonce. The buyer sends its nonce to
+// the seller with the funding notice; the seller's travels in its claim
+// proposal. Calling it again restarts the claim signing.
+func (sw *Swap) ClaimNonce() (*musig2.PublicNonce, error) {
+	if !CanTransition(sw.Phase, PhaseClaimNonce) {
+		return nil, &TransitionError{From: sw.Phase, To: PhaseClaimNonce}
+	}
+
+	var nonce *musig2.PublicNonce
+	var err error
+	switch sw.Role {
+	case RoleBuyer:
+		nonce, err = sw.Buyer.ClaimNonce()
+	default:
+		nonce, err = sw.Seller.ClaimNonce()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sw.transition(PhaseClaimNonce); err != nil {
+		return nil, err
+	}
+
+	return nonce, nil
+}
+
+// ProposeClaim builds the seller's claim of the lock output, paying its
+// value minus the fee at feeRate to destScript, and partially signs it for
+// the buyer's nonce. The proposal is sent to the buyer, and the swap moves
+// to PhaseClaimSigned. A claim paying to the key path output of the offer's
+// claim key can be bumped with BumpClaim.
+func (sw *Swap) ProposeClaim(destScript []byte, feeRate bitcoin.FeeRate, buyerNonce *musig2.PublicNonce) (*ClaimProposal, error) {
+	if err := sw.check(PhaseClaimSigned, RoleSeller, "proposing the claim"); err != nil {
+		return nil, err
+	}
+	if buyerNonce == nil {
+		return nil, fmt.Errorf("no buyer nonce")
+	}
+
+	fee := bitcoin.ClaimFee(feeRate, destScript)
+	claimTx, _, err := bitcoin.CreateClaimTransaction(sw.LockingTx, sw.Funding.OutputIndex, destScript, fee)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create claim transaction: %v", err)
+	}
+	partial, err := sw.Seller.SignClaim(claimTx, sw.Funding.LockOutput().Value, buyerNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	sw.ClaimTx = claimTx
+	if err := sw.transition(PhaseClaimSigned); err != nil {
+		sw.ClaimTx = nil
+		return nil, err
+	}
+
+	return &ClaimProposal{ClaimTx: claimTx, Nonce: sw.Seller.claim.nonce, Partial: partial}, nil
+}
+
+// SignClaim verifies the seller's claim proposal against the offer's claim
+// key and returns the buyer's partial signature of the claim. The buyer
+// keeps the aggregated pre-signature, which extracts the secret from the
+// published claim, and the swap moves to PhaseAdaptorSigned.
+func (sw *Swap) SignClaim(proposal *ClaimProposal) (*secp.ModNScalar, error) {
+	if err := sw.check(PhaseAdaptorSigned, RoleBuyer, "signing the claim"); err != nil {
+		return nil, err
+	}
+	if proposal == nil || proposal.ClaimTx == nil || proposal.Nonce == nil || proposal.Partial == nil {
+		return nil, fmt.Errorf("incomplete claim proposal")
+	}
+
+	partial, err := sw.Buyer.SignClaim(proposal.ClaimTx, sw.Offer.ClaimKey, proposal.Nonce, proposal.Partial, sw.Offer.Commitment)
+	if err != nil {
+		return nil, err
+	}
+
+	sw.ClaimTx = proposal.ClaimTx
+	if err := sw.transition(PhaseAdaptorSigned); err != nil {
+		sw.ClaimTx = nil
+		return nil, err
+	}
+
+	return partial, nil
+}
+
+// AcceptAdaptor verifies the buyer's partial signature of the claim against
+// the buyer's key from the funding notice and the signature hash of the
+// claim transaction, and aggregates the pre-signature. The swap moves to
+// PhaseAdaptorSigned.
+func (sw *Swap) AcceptAdaptor(buyerPartial *secp.ModNScalar) error {
+	if err := sw.check(PhaseAdaptorSigned, RoleSeller, "accepting the buyer's claim signature"); err != nil {
+		return err
+	}
+	if buyerPartial == nil {
+		return fmt.Errorf("no buyer partial signature")
+	}
+
+	if err := sw.Seller.acceptClaim(sw.Funding.BuyerPubKey, sw.Seller.claim.peerNonce, buyerPartial); err != nil {
+		return err
+	}
+
+	return sw.transition(PhaseAdaptorSigned)
+}
+
+// CompleteClaim signs the seller's event and completes the claim
+// transaction with the signature's secret, returning the transaction to
+// broadcast. Publishing it reveals the Nostr signature to the buyer. The
+// swap moves to PhaseClaimed. If a hook fails, the signature and the
+// witness are undone and the event stays pending.
+func (sw *Swap) CompleteClaim() (*wire.MsgTx, error) {
+	if err := sw.check(PhaseClaimed, RoleSeller, "completing the claim"); err != nil {
+		return nil, err
+	}
+
+	event, witness := sw.Seller.Event, sw.ClaimTx.TxIn[0].Witness
+	if err := sw.Seller.finishClaim(sw.ClaimTx); err != nil {
+		return nil, err
+	}
+
+	sw.NostrSig = sw.Seller.Event.Sig
+	if err := sw.transition(PhaseClaimed); err != nil {
+		sw.Seller.Event, sw.ClaimTx.TxIn[0].Witness, sw.NostrSig = event, witness, ""
+		return nil, err
+	}
+
+	// The claim is recorded, so the event is signed for good
+	sw.Seller.Discard()
+	return sw.ClaimTx, nil
+}
+
+// Expire records that the refund timelock passed before the swap was claimed.
+func (sw *Swap) Expire() error {
+	return sw.transition(PhaseExpired)
+}
+
+// Refund builds the buyer's refund transaction and moves to
+// PhaseRefundPending. The transaction is only valid once the refund timelock
+// has expired. Its fee for a given rate is given by SwapBuyer.RefundFee, and
+// BumpRefund replaces it with one paying more. WatchRefund completes the swap
+// once the refund is seen.
+func (sw *Swap) Refund(destScript []byte, fee int64) (*wire.MsgTx, error) {
+	if err := sw.check(PhaseRefundPending, RoleBuyer, "refunding"); err != nil {
+		return nil, err
+	}
+
+	refundTx, err := sw.Buyer.BuildRefundTransaction(destScript, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	sw.RefundTx = refundTx
+	if err := sw.transition(PhaseRefundPending); err != nil {
+		sw.RefundTx = nil
+		return nil, err
+	}
+
+	return refundTx, nil
+}
+
+// ObserveRefund records on the seller side that the buyer refunded the swap.
+func (sw *Swap) ObserveRefund() error {
+	if err := sw.check(PhaseRefunded, RoleSeller, "observing the refund"); err != nil {
+		return err
+	}
+
+	return sw.transition(PhaseRefunded)
+}
@@ -0,0 +1,403 @@
+package tanos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+	"tanos/pkg/nostr"
+)
+
+// newTestKey generates the private key of a test party.
+func newTestKey(t *testing.T) *crypto.SecretKey {
+	t.Helper()
+
+	key, err := crypto.GenerateSecretKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key
+}
+
+// newTestSwaps creates a seller with a signed event and the matching seller
+// and buyer swaps.
+func newTestSwaps(t *testing.T) (*Swap, *Swap) {
+	seller, err := NewSeller(nostr.NewLocalSigner(newTestKey(t)))
+	if err != nil {
+		t.Fatalf("Failed to create seller: %v", err)
+	}
+	if err := seller.CreateEvent("swap state test"); err != nil {
+		t.Fatalf("Failed to create event: %v", err)
+	}
+	buyer, err := NewBuyer(newTestKey(t))
+	if err != nil {
+		t.Fatalf("Failed to create buyer: %v", err)
+	}
+
+	sellerSwap, err := NewSellerSwap(seller)
+	if err != nil {
+		t.Fatalf("Failed to create seller swap: %v", err)
+	}
+	buyerSwap, err := NewBuyerSwap(buyer, sellerSwap.Offer)
+	if err != nil {
+		t.Fatalf("Failed to create buyer swap: %v", err)
+	}
+
+	return sellerSwap, buyerSwap
+}
+
+// signedEvent signs the seller's event and returns the signature.
+func signedEvent(t *testing.T, seller *SwapSeller) string {
+	t.Helper()
+
+	sig, err := seller.SignEvent()
+	if err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+	return sig
+}
+
+// fundWithRefund creates a MuSig2 locking transaction for the offer, with
+// a refund leaf, spending a made up coin.
+func fundWithRefund(buyer *SwapBuyer, offer *Offer) error {
+	params := &chaincfg.RegressionNetParams
+	_, prevScript, err := bitcoin.CreateP2TRAddress(buyer.PublicKey, params)
+	if err != nil {
+		return err
+	}
+
+	return buyer.CreateMuSig2LockingTransaction(
+		100000,
+		"0000000000000000000000000000000000000000000000000000000000000001",
+		0,
+		110000,
+		prevScript,
+		offer.ClaimKey,
+		bitcoin.RelativeBlocks(144),
+		params,
+	)
+}
+
+// signSwapClaim takes a funded buyer swap and its committed seller swap
+// through the MuSig2 claim signing, to PhaseAdaptorSigned.
+func signSwapClaim(t *testing.T, sellerSwap, buyerSwap *Swap) {
+	t.Helper()
+
+	notice, err := buyerSwap.FundingNotice()
+	if err != nil {
+		t.Fatalf("Buyer failed to create funding notice: %v", err)
+	}
+	if err := sellerSwap.ObserveFunding(notice); err != nil {
+		t.Fatalf("Seller failed to observe funding: %v", err)
+	}
+	buyerNonce, err := buyerSwap.ClaimNonce()
+	if err != nil {
+		t.Fatalf("Buyer failed to create claim nonce: %v", err)
+	}
+	if _, err := sellerSwap.ClaimNonce(); err != nil {
+		t.Fatalf("Seller failed to create claim nonce: %v", err)
+	}
+
+	_, destScript, _ := bitcoin.CreateP2TRAddress(sellerSwap.Offer.ClaimKey, &chaincfg.RegressionNetParams)
+	proposal, err := sellerSwap.ProposeClaim(destScript, bitcoin.FeeRatePerVByte(5), buyerNonce)
+	if err != nil {
+		t.Fatalf("Seller failed to propose claim: %v", err)
+	}
+	partial, err := buyerSwap.SignClaim(proposal)
+	if err != nil {
+		t.Fatalf("Buyer failed to sign claim: %v", err)
+	}
+	if err := sellerSwap.AcceptAdaptor(partial); err != nil {
+		t.Fatalf("Seller rejected the buyer's claim signature: %v", err)
+	}
+}
+
+// TestSwapHappyPath runs both roles through a complete swap on the
+// simulated chain.
+func TestSwapHappyPath(t *testing.T) {
+	ctx := context.Background()
+	chain := bitcoin.NewSimChain()
+	sellerSwap, buyerSwap := newTestSwaps(t)
+
+	var buyerPhases, sellerPhases []Phase
+	buyerSwap.OnTransition(func(_ *Swap, _, to Phase) error {
+		buyerPhases = append(buyerPhases, to)
+		return nil
+	})
+	sellerSwap.OnTransition(func(_ *Swap, _, to Phase) error {
+		sellerPhases = append(sellerPhases, to)
+		return nil
+	})
+
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyerSwap.Buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(144))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	chain.Mine(1)
+
+	signSwapClaim(t, sellerSwap, buyerSwap)
+	claimTx, err := sellerSwap.CompleteClaim()
+	if err != nil {
+		t.Fatalf("Seller failed to complete claim: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+		t.Fatalf("Claim transaction rejected: %v", err)
+	}
+	if _, err := buyerSwap.WatchClaim(ctx, chain, 0); err != nil {
+		t.Fatalf("Buyer failed to watch the claim: %v", err)
+	}
+	if buyerSwap.NostrSig != sellerSwap.Seller.Event.Sig {
+		t.Fatalf("Buyer learned the wrong Nostr signature")
+	}
+
+	want := []Phase{PhaseCommitted, PhaseFunded, PhaseClaimNonce, PhaseAdaptorSigned, PhaseClaimed}
+	if fmt.Sprint(buyerPhases) != fmt.Sprint(want) {
+		t.Fatalf("Unexpected buyer phases: got %v, want %v", buyerPhases, want)
+	}
+	want = []Phase{PhaseCommitted, PhaseFunded, PhaseClaimNonce, PhaseClaimSigned, PhaseAdaptorSigned, PhaseClaimed}
+	if fmt.Sprint(sellerPhases) != fmt.Sprint(want) {
+		t.Fatalf("Unexpected seller phases: got %v, want %v", sellerPhases, want)
+	}
+	if !sellerSwap.Phase.Terminal() || !buyerSwap.Phase.Terminal() {
+		t.Fatalf("Swaps did not end in a terminal phase")
+	}
+}
+
+// TestSwapRejectsIllegalTransitions checks that out of order and wrong-role
+// actions fail with typed errors instead of panicking.
+func TestSwapRejectsIllegalTransitions(t *testing.T) {
+	sellerSwap, buyerSwap := newTestSwaps(t)
+
+	// Watching for a claim before anything was signed
+	_, err := buyerSwap.WatchClaim(context.Background(), nil, 0)
+	var transitionErr *TransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("Expected a TransitionError, got %v", err)
+	}
+	if transitionErr.From != PhaseOffered || transitionErr.To != PhaseClaimed {
+		t.Fatalf("Unexpected transition in error: %v", transitionErr)
+	}
+
+	var roleErr *RoleError
+	if _, err := sellerSwap.SignClaim(nil); !errors.As(err, &roleErr) {
+		t.Fatalf("Expected a RoleError, got %v", err)
+	}
+
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := buyerSwap.Commit(); !errors.As(err, &transitionErr) {
+		t.Fatalf("Expected committing twice to fail, got %v", err)
+	}
+
+	if buyerSwap.Phase != PhaseCommitted {
+		t.Fatalf("Failed actions changed the phase to %s", buyerSwap.Phase)
+	}
+}
+
+// TestSwapHookFailureReverts checks that a failing hook leaves the swap in
+// its previous phase.
+func TestSwapHookFailureReverts(t *testing.T) {
+	_, buyerSwap := newTestSwaps(t)
+
+	buyerSwap.OnTransition(func(_ *Swap, _, _ Phase) error {
+		return fmt.Errorf("disk full")
+	})
+
+	if err := buyerSwap.Commit(); err == nil {
+		t.Fatalf("Expected the hook error to fail the transition")
+	}
+	if buyerSwap.Phase != PhaseOffered {
+		t.Fatalf("Phase changed to %s despite the hook failure", buyerSwap.Phase)
+	}
+}
+
+// TestCompleteClaimHookFailureReverts checks that a failing hook on the
+// claim undoes the event signature and the claim witness, and that the
+// claim can be completed again afterwards.
+func TestCompleteClaimHookFailureReverts(t *testing.T) {
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	if err := buyerSwap.Fund(fundWithRefund); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	signSwapClaim(t, sellerSwap, buyerSwap)
+
+	fail := true
+	sellerSwap.OnTransition(func(_ *Swap, _, _ Phase) error {
+		if fail {
+			return fmt.Errorf("disk full")
+		}
+		return nil
+	})
+	if _, err := sellerSwap.CompleteClaim(); err == nil {
+		t.Fatalf("Expected the hook error to fail the claim")
+	}
+	if sellerSwap.Phase != PhaseAdaptorSigned {
+		t.Fatalf("Phase changed to %s despite the hook failure", sellerSwap.Phase)
+	}
+	if sellerSwap.Seller.Event.Sig != "" || sellerSwap.NostrSig != "" || len(sellerSwap.ClaimTx.TxIn[0].Witness) != 0 {
+		t.Fatalf("Claim signatures were kept despite the hook failure")
+	}
+
+	fail = false
+	claimTx, err := sellerSwap.CompleteClaim()
+	if err != nil {
+		t.Fatalf("Seller failed to complete claim again: %v", err)
+	}
+	if sellerSwap.Phase != PhaseClaimed || sellerSwap.NostrSig == "" || len(claimTx.TxIn[0].Witness) != 1 {
+		t.Fatalf("Claim was not completed")
+	}
+	if ok, err := sellerSwap.Seller.Event.CheckSignature(); !ok {
+		t.Fatalf("Event signature does not verify: %v", err)
+	}
+}
+
+// TestSwapRejectsBogusClaim checks that a lock output for another claim key
+// and bogus partial signatures from either side are rejected without
+// changing the phase, and that the buyer can refund after expiry.
+func TestSwapRejectsBogusClaim(t *testing.T) {
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	otherSeller, otherBuyer := newTestSwaps(t)
+
+	for _, sw := range []*Swap{sellerSwap, buyerSwap, otherSeller, otherBuyer} {
+		if err := sw.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+	err := buyerSwap.Fund(func(b *SwapBuyer, _ *Offer) error {
+		return fundWithRefund(b, &otherSeller.Offer)
+	})
+	if err == nil {
+		t.Fatalf("Funded a lock output for another claim key")
+	}
+	if err := buyerSwap.Fund(fundWithRefund); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	notice, err := buyerSwap.FundingNotice()
+	if err != nil {
+		t.Fatalf("Buyer failed to create funding notice: %v", err)
+	}
+	forged := *notice
+	forged.BuyerPubKey = otherBuyer.Buyer.PublicKey
+	if err := sellerSwap.ObserveFunding(&forged); err == nil {
+		t.Fatalf("Seller observed a lock output without the buyer's key")
+	}
+
+	// The other pair is stopped by bogus partial signatures
+	if err := otherBuyer.Fund(fundWithRefund); err != nil {
+		t.Fatalf("Other buyer failed to fund: %v", err)
+	}
+	signSwapClaim(t, sellerSwap, buyerSwap)
+	otherNotice, _ := otherBuyer.FundingNotice()
+	if err := otherSeller.ObserveFunding(otherNotice); err != nil {
+		t.Fatalf("Other seller failed to observe funding: %v", err)
+	}
+	if _, err := otherSeller.ClaimNonce(); err != nil {
+		t.Fatalf("Other seller failed to create claim nonce: %v", err)
+	}
+	otherNonce, err := otherBuyer.ClaimNonce()
+	if err != nil {
+		t.Fatalf("Other buyer failed to create claim nonce: %v", err)
+	}
+	_, destScript, _ := bitcoin.CreateP2TRAddress(otherSeller.Offer.ClaimKey, &chaincfg.RegressionNetParams)
+	proposal, err := otherSeller.ProposeClaim(destScript, bitcoin.FeeRatePerVByte(5), otherNonce)
+	if err != nil {
+		t.Fatalf("Other seller failed to propose claim: %v", err)
+	}
+	bogus := *proposal
+	bogus.Partial = new(secp.ModNScalar).Add2(proposal.Partial, new(secp.ModNScalar).SetInt(1))
+	if _, err := otherBuyer.SignClaim(&bogus); err == nil {
+		t.Fatalf("Buyer signed a claim with a bogus seller partial signature")
+	}
+	if otherBuyer.Phase != PhaseClaimNonce {
+		t.Fatalf("Bogus proposal changed the phase to %s", otherBuyer.Phase)
+	}
+	if err := otherSeller.AcceptAdaptor(new(secp.ModNScalar).SetInt(1)); err == nil {
+		t.Fatalf("Seller accepted a bogus buyer partial signature")
+	}
+	if otherSeller.Phase != PhaseClaimSigned {
+		t.Fatalf("Bogus partial signature changed the phase to %s", otherSeller.Phase)
+	}
+
+	if err := buyerSwap.Expire(); err != nil {
+		t.Fatalf("Failed to expire: %v", err)
+	}
+	_, destScript, _ = bitcoin.CreateP2TRAddress(buyerSwap.Buyer.PublicKey, &chaincfg.RegressionNetParams)
+	if _, err := buyerSwap.Refund(destScript, 1000); err != nil {
+		t.Fatalf("Failed to refund: %v", err)
+	}
+	if buyerSwap.Phase != PhaseRefundPending || buyerSwap.Phase.Terminal() {
+		t.Fatalf("Unexpected phase after refund: %s", buyerSwap.Phase)
+	}
+}
+
+// TestVerifyFunding checks the seller's on-chain checks of the lock output
+// before it signs the claim.
+func TestVerifyFunding(t *testing.T) {
+	ctx := context.Background()
+	chain := bitcoin.NewSimChain()
+	sellerSwap, buyerSwap := newTestSwaps(t)
+
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyerSwap.Buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(144))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	notice, err := buyerSwap.FundingNotice()
+	if err != nil {
+		t.Fatalf("Buyer failed to create funding notice: %v", err)
+	}
+	if err := sellerSwap.ObserveFunding(notice); err != nil {
+		t.Fatalf("Seller failed to observe funding: %v", err)
+	}
+
+	if err := sellerSwap.VerifyFunding(ctx, chain, 100000, 1); err == nil {
+		t.Fatalf("Verified funding that is not on chain")
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	if err := sellerSwap.VerifyFunding(ctx, chain, 100000, 1); !errors.Is(err, ErrFundingUnconfirmed) {
+		t.Fatalf("Expected ErrFundingUnconfirmed in the mempool, got %v", err)
+	}
+	chain.Mine(1)
+	if err := sellerSwap.VerifyFunding(ctx, chain, 100000, 2); !errors.Is(err, ErrFundingUnconfirmed) {
+		t.Fatalf("Expected ErrFundingUnconfirmed with one confirmation, got %v", err)
+	}
+	chain.Mine(1)
+	if err := sellerSwap.VerifyFunding(ctx, chain, 100000, 2); err != nil {
+		t.Fatalf("Failed to verify confirmed funding: %v", err)
+	}
+	if err := sellerSwap.VerifyFunding(ctx, chain, 100001, 2); err == nil {
+		t.Fatalf("Verified funding below the agreed amount")
+	}
+	if err := buyerSwap.VerifyFunding(ctx, chain, 100000, 1); err == nil {
+		t.Fatalf("Buyer verified its own funding")
+	}
+}
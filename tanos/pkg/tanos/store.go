@@ -0,0 +1,685 @@
+package tanos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	nostrlib "github.com/nbd-wtf/go-nostr"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+	"tanos/pkg/musig2"
+	"tanos/pkg/nostr"
+	"tanos/pkg/wallet"
+)
+
+// RecordVersion is the version of the SwapRecord layout written by this package.
+const RecordVersion = 1
+
+// ErrSwapNotFound is returned by a SwapStore when no swap has the given ID.
+var ErrSwapNotFound = errors.New("swap not found")
+
+// SwapStore persists swap records so that a restarted process can resume
+// swaps that were in flight. Save must be atomic: after a crash, Load
+// returns either the previous or the new record, never a mix of both.
+type SwapStore interface {
+	// Save stores the record, replacing any previous record of the swap.
+	Save(record *SwapRecord) error
+	// Load returns the latest record of a swap, or ErrSwapNotFound.
+	Load(id string) (*SwapRecord, error)
+	// List returns the latest record of every stored swap.
+	List() ([]*SwapRecord, error)
+	// Delete removes a swap and all its records.
+	Delete(id string) error
+}
+
+// SwapRecord is the serializable state of a swap at one phase. It holds no
+// private keys or nonces: the seller's Nostr key and the buyer's Bitcoin key
+// are recorded by public key, or by index for a buyer key from an HD wallet,
+// and are given back to RestoreSwap in SwapKeys. A pending event is resumed
+// by the seller's signer, which commits to the same nonce again.
+//
+// The MuSig2 claim is recorded without its secret nonce, which must never be
+// reused. A restarted process still verifies and aggregates partial
+// signatures and keeps the pre-signature, but signing again starts the claim
+// over with a fresh nonce.
+type SwapRecord struct {
+	Version   int    `json:"version"`
+	ID        string `json:"id"`
+	Role      Role   `json:"role"`
+	Phase     Phase  `json:"phase"`
+	UpdatedAt int64  `json:"updated_at"`
+
+	Offer Offer `json:"offer"`
+
+	SellerPub string          `json:"seller_pub,omitempty"` // Nostr public key in hex
+	Event     *nostrlib.Event `json:"event,omitempty"`      // Seller's event, signed once revealed
+
+	BuyerPub   string            `json:"buyer_pub,omitempty"` // Bitcoin public key in hex, compressed
+	KeyIndex   *uint32           `json:"key_index,omitempty"` // Index of the buyer key in its HD wallet
+	SigHash    string            `json:"sighash,omitempty"`
+	Funding    []FundingRecord   `json:"funding,omitempty"` // Outputs spent by the locking transaction
+	LockOutput *LockOutputRecord `json:"lock_output,omitempty"`
+	RefundLock *bitcoin.Timelock `json:"refund_lock,omitempty"`
+	LockingTx  string            `json:"locking_tx,omitempty"`
+	RefundTx   string            `json:"refund_tx,omitempty"`
+	Notice     *FundingNotice    `json:"notice,omitempty"`   // Buyer's funding notice, on the seller side
+	ClaimTx    string            `json:"claim_tx,omitempty"` // Claim transaction, completed once claimed
+	Claim      *ClaimRecord      `json:"claim,omitempty"`
+	NostrSig   string            `json:"nostr_sig,omitempty"`
+}
+
+// ClaimRecord holds the public parts of the MuSig2 claim signing.
+type ClaimRecord struct {
+	Nonce     string        `json:"nonce"`                // Our public nonce in hex
+	PeerNonce string        `json:"peer_nonce,omitempty"` // Other party's public nonce in hex
+	Partial   string        `json:"partial,omitempty"`    // Our partial signature in hex
+	PreSig    *PreSigRecord `json:"pre_sig,omitempty"`
+}
+
+// PreSigRecord is the aggregated pre-signature of the claim.
+type PreSigRecord struct {
+	NoncePoint   string `json:"nonce_point"`   // R' in hex, compressed
+	S            string `json:"s"`             // In hex
+	AdaptorPoint string `json:"adaptor_point"` // T in hex, compressed
+}
+
+// FundingRecord is an output spent by the locking transaction.
+type FundingRecord struct {
+	Value  int64  `json:"value"`
+	Script string `json:"script"` // In hex
+}
+
+// LockOutputRecord is enough to rebuild the TaprootOutput of the swap.
+type LockOutputRecord struct {
+	InternalKey string   `json:"internal_key"` // x-only
+	Scripts     []string `json:"scripts"`      // Leaf scripts, in depth-first order
+	PkScript    string   `json:"pk_script"`
+	Address     string   `json:"address"`
+}
+
+// Record returns the current state of the swap as a SwapRecord.
+func (sw *Swap) Record() (*SwapRecord, error) {
+	record := &SwapRecord{
+		Version:   RecordVersion,
+		ID:        sw.ID,
+		Role:      sw.Role,
+		Phase:     sw.Phase,
+		UpdatedAt: time.Now().Unix(),
+		Offer:     sw.Offer,
+		Notice:    sw.Funding,
+		NostrSig:  sw.NostrSig,
+	}
+
+	if sw.Seller != nil {
+		record.Claim = newClaimRecord(&sw.Seller.claim)
+		event := sw.Seller.Event
+		record.SellerPub = sw.Seller.NostrPubKey
+		record.Event = &event
+	}
+
+	if sw.Buyer != nil {
+		record.Claim = newClaimRecord(&sw.Buyer.claim)
+		if sw.Buyer.KeyIndex != nil {
+			index := *sw.Buyer.KeyIndex
+			record.KeyIndex = &index
+		}
+		record.BuyerPub = crypto.HexEncode(sw.Buyer.PublicKey.SerializeCompressed())
+		record.SigHash = crypto.HexEncode(sw.Buyer.SigHash)
+		for _, out := range sw.Buyer.FundingOutputs {
+			record.Funding = append(record.Funding, FundingRecord{
+				Value:  out.Value,
+				Script: crypto.HexEncode(out.PkScript),
+			})
+		}
+		if sw.Buyer.LockOutput != nil {
+			record.LockOutput = newLockOutputRecord(sw.Buyer.LockOutput)
+			lock := sw.Buyer.RefundLock
+			record.RefundLock = &lock
+		}
+	}
+
+	var err error
+	if record.LockingTx, err = encodeTx(sw.LockingTx); err != nil {
+		return nil, fmt.Errorf("failed to serialize locking transaction: %v", err)
+	}
+	if record.RefundTx, err = encodeTx(sw.RefundTx); err != nil {
+		return nil, fmt.Errorf("failed to serialize refund transaction: %v", err)
+	}
+	if record.ClaimTx, err = encodeTx(sw.ClaimTx); err != nil {
+		return nil, fmt.Errorf("failed to serialize claim transaction: %v", err)
+	}
+
+	return record, nil
+}
+
+// encodeTx serializes tx in hex, or returns "" for no transaction.
+func encodeTx(tx *wire.MsgTx) (string, error) {
+	if tx == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+
+	return crypto.HexEncode(buf.Bytes()), nil
+}
+
+// decodeTx parses a transaction serialized by encodeTx.
+func decodeTx(txHex string) (*wire.MsgTx, error) {
+	if txHex == "" {
+		return nil, nil
+	}
+
+	raw, err := crypto.HexDecode(txHex)
+	if err != nil {
+		return nil, err
+	}
+	tx := wire.NewMsgTx(2)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// newLockOutputRecord records the internal key and leaf scripts of an output.
+func newLockOutputRecord(output *bitcoin.TaprootOutput) *LockOutputRecord {
+	record := &LockOutputRecord{
+		InternalKey: crypto.HexEncode(schnorr.SerializePubKey(output.InternalKey)),
+		Scripts:     make([]string, len(output.Leaves)),
+		PkScript:    crypto.HexEncode(output.PkScript),
+		Address:     output.Address,
+	}
+	for i, leaf := range output.Leaves {
+		record.Scripts[i] = crypto.HexEncode(leaf.Script)
+	}
+
+	return record
+}
+
+// newClaimRecord records the public parts of the claim signing, or returns
+// nil if no nonce was generated.
+func newClaimRecord(c *claimState) *ClaimRecord {
+	if c.nonce == nil {
+		return nil
+	}
+
+	record := &ClaimRecord{Nonce: crypto.HexEncode(c.nonce[:])}
+	if c.peerNonce != nil {
+		record.PeerNonce = crypto.HexEncode(c.peerNonce[:])
+	}
+	if c.partial != nil {
+		record.Partial = crypto.HexEncode(crypto.SerializeModNScalar(c.partial))
+	}
+	if c.preSig != nil {
+		record.PreSig = &PreSigRecord{
+			NoncePoint:   crypto.HexEncode(c.preSig.NoncePoint.SerializeCompressed()),
+			S:            crypto.HexEncode(crypto.SerializeModNScalar(c.preSig.S)),
+			AdaptorPoint: crypto.HexEncode(c.preSig.AdaptorPoint.SerializeCompressed()),
+		}
+	}
+
+	return record
+}
+
+// restore sets the recorded claim signing on c, whose key aggregation is
+// already set up, and reopens the signing session for claimTx. The
+// pre-signature must be for the commitment.
+func (r *ClaimRecord) restore(
+	c *claimState,
+	claimTx *wire.MsgTx,
+	lockOutput *bitcoin.TaprootOutput,
+	lockValue int64,
+	commitment *secp.PublicKey,
+) error {
+	var err error
+	if c.nonce, err = decodeNonce(r.Nonce); err != nil {
+		return fmt.Errorf("invalid claim nonce: %v", err)
+	}
+	if r.PeerNonce != "" {
+		if c.peerNonce, err = decodeNonce(r.PeerNonce); err != nil {
+			return fmt.Errorf("invalid peer claim nonce: %v", err)
+		}
+	}
+	if r.Partial != "" {
+		if c.partial, err = decodeScalar(r.Partial); err != nil {
+			return fmt.Errorf("invalid partial signature: %v", err)
+		}
+	}
+	if r.PreSig != nil {
+		if c.preSig, err = r.PreSig.preSignature(); err != nil {
+			return err
+		}
+		if !c.preSig.AdaptorPoint.IsEqual(commitment) {
+			return fmt.Errorf("claim pre-signature is not for the offer's commitment")
+		}
+	}
+
+	if c.peerNonce != nil && claimTx != nil && lockOutput != nil {
+		return c.openSession(claimTx, lockOutput, lockValue, commitment)
+	}
+
+	return nil
+}
+
+// preSignature parses the recorded pre-signature.
+func (r *PreSigRecord) preSignature() (*musig2.PreSignature, error) {
+	noncePoint, err := decodePoint(r.NoncePoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pre-signature nonce point: %v", err)
+	}
+	sValue, err := decodeScalar(r.S)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pre-signature s value: %v", err)
+	}
+	adaptorPoint, err := decodePoint(r.AdaptorPoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pre-signature adaptor point: %v", err)
+	}
+
+	return &musig2.PreSignature{NoncePoint: noncePoint, S: sValue, AdaptorPoint: adaptorPoint}, nil
+}
+
+// decodeNonce parses a public nonce in hex.
+func decodeNonce(nonceHex string) (*musig2.PublicNonce, error) {
+	b, err := crypto.DecodeHexStrict(nonceHex, musig2.PublicNonceSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce musig2.PublicNonce
+	copy(nonce[:], b)
+
+	return &nonce, nil
+}
+
+// decodeScalar parses a scalar in hex, rejecting values above the order.
+func decodeScalar(scalarHex string) (*secp.ModNScalar, error) {
+	b, err := crypto.DecodeHexStrict(scalarHex, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	scalar := new(secp.ModNScalar)
+	if overflow := scalar.SetByteSlice(b); overflow {
+		return nil, fmt.Errorf("scalar overflows the group order")
+	}
+
+	return scalar, nil
+}
+
+// decodePoint parses a compressed point in hex.
+func decodePoint(pointHex string) (*secp.PublicKey, error) {
+	b, err := crypto.DecodeHexStrict(pointHex, 33)
+	if err != nil {
+		return nil, err
+	}
+
+	return secp.ParsePubKey(b)
+}
+
+// SwapKeys are the keys that restored swaps sign with, matched to records
+// by public key. Restored swaps share them and don't zero them, so the
+// caller zeroes them once no swap needs them.
+type SwapKeys struct {
+	Sellers []nostr.EventSigner // Nostr keys of seller swaps
+	Claims  []crypto.Signer     // Claim keys of sellers whose Nostr signer cannot sign claims
+	Buyers  []crypto.Signer     // Bitcoin keys of buyer swaps
+	Wallet  *wallet.Wallet      // HD wallet of buyer keys recorded by index
+}
+
+// RestoreSwap rebuilds a swap from its record, with its key from keys. A
+// buyer key recorded by index is derived from the wallet of keys, and the
+// index is marked used. Hooks are not restored; use ResumeSwaps or Persist
+// to keep recording the restored swap.
+func RestoreSwap(record *SwapRecord, keys SwapKeys) (*Swap, error) {
+	if record.Version != RecordVersion {
+		return nil, fmt.Errorf("unsupported swap record version %d", record.Version)
+	}
+
+	offer := record.Offer
+	if offer.Nonce == nil || offer.Commitment == nil {
+		return nil, fmt.Errorf("swap record has no offer")
+	}
+
+	sw := &Swap{
+		ID:       record.ID,
+		Role:     record.Role,
+		Phase:    record.Phase,
+		Offer:    offer,
+		Funding:  record.Notice,
+		NostrSig: record.NostrSig,
+	}
+	var err error
+
+	if sw.LockingTx, err = decodeTx(record.LockingTx); err != nil {
+		return nil, fmt.Errorf("invalid locking transaction: %v", err)
+	}
+	if sw.RefundTx, err = decodeTx(record.RefundTx); err != nil {
+		return nil, fmt.Errorf("invalid refund transaction: %v", err)
+	}
+	if sw.ClaimTx, err = decodeTx(record.ClaimTx); err != nil {
+		return nil, fmt.Errorf("invalid claim transaction: %v", err)
+	}
+
+	switch record.Role {
+	case RoleSeller:
+		if record.Event == nil {
+			return nil, fmt.Errorf("seller record has no event")
+		}
+		if sw.Seller, err = restoreSeller(record, keys); err != nil {
+			return nil, err
+		}
+		if sw.Funding != nil {
+			if err := sw.Seller.observeLock(sw.Funding); err != nil {
+				sw.Seller.Zero()
+				return nil, err
+			}
+			if record.Claim != nil {
+				lockValue := sw.Funding.LockOutput().Value
+				err := record.Claim.restore(&sw.Seller.claim, sw.ClaimTx, sw.Seller.LockOutput, lockValue, offer.Commitment)
+				if err != nil {
+					sw.Seller.Zero()
+					return nil, err
+				}
+			}
+		}
+
+	case RoleBuyer:
+		if sw.Buyer, err = restoreBuyer(record, keys); err != nil {
+			return nil, err
+		}
+		sw.Buyer.LockingTx = sw.LockingTx
+		if sw.Buyer.LockOutput != nil {
+			_, keyAgg, err := swapLockOutput(sw.Buyer.PublicKey, offer.ClaimKey, sw.Buyer.RefundLock)
+			if err != nil {
+				sw.Buyer.Zero()
+				return nil, err
+			}
+			sw.Buyer.claim = claimState{keyAgg: keyAgg}
+			if record.Claim != nil && sw.LockingTx != nil {
+				lockValue := sw.LockingTx.TxOut[0].Value
+				err := record.Claim.restore(&sw.Buyer.claim, sw.ClaimTx, sw.Buyer.LockOutput, lockValue, offer.Commitment)
+				if err != nil {
+					sw.Buyer.Zero()
+					return nil, err
+				}
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown swap role %d", record.Role)
+	}
+
+	return sw, nil
+}
+
+// restoreSeller rebuilds the seller from the signer with the recorded
+// public key and the signer of the offer's claim key, and restores its
+// event.
+func restoreSeller(record *SwapRecord, keys SwapKeys) (*SwapSeller, error) {
+	for _, signer := range keys.Sellers {
+		if crypto.HexEncode(schnorr.SerializePubKey(signer.PubKey())) != record.SellerPub {
+			continue
+		}
+		claimKey, err := restoreClaimKey(record, signer, keys.Claims)
+		if err != nil {
+			return nil, err
+		}
+		seller, err := NewSellerWithClaimKey(signer, claimKey)
+		if err != nil {
+			return nil, err
+		}
+		seller.shared = true
+		if err := restoreSellerEvent(seller, record); err != nil {
+			seller.Discard()
+			return nil, err
+		}
+		return seller, nil
+	}
+
+	return nil, fmt.Errorf("no signer for seller key %s", record.SellerPub)
+}
+
+// restoreClaimKey returns the signer of the offer's claim key: the seller's
+// own signer when it is the claim key, or one of claims.
+func restoreClaimKey(record *SwapRecord, signer nostr.EventSigner, claims []crypto.Signer) (crypto.Signer, error) {
+	if record.Offer.ClaimKey == nil {
+		return nil, fmt.Errorf("record has no claim key")
+	}
+	if keySigner, ok := signer.(crypto.Signer); ok && keySigner.PubKey().IsEqual(record.Offer.ClaimKey) {
+		return keySigner, nil
+	}
+	for _, claimKey := range claims {
+		if claimKey.PubKey().IsEqual(record.Offer.ClaimKey) {
+			return claimKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no signer for claim key %s", crypto.HexEncode(record.Offer.ClaimKey.SerializeCompressed()))
+}
+
+// restoreSellerEvent restores the seller's event: the signed event, or the
+// pending signature with the nonce the signer commits to again. Either must
+// match the offer.
+func restoreSellerEvent(seller *SwapSeller, record *SwapRecord) error {
+	offer := record.Offer
+	if record.Event.Sig != "" {
+		seller.Event = *record.Event
+		seller.Nonce = offer.Nonce
+		seller.Commitment = offer.Commitment
+		seller.NonceProof = offer.NonceProof
+		return nil
+	}
+
+	pending, err := nostr.ResumeEvent(seller.signer, *record.Event)
+	if err != nil {
+		return fmt.Errorf("failed to resume event: %v", err)
+	}
+	if !pending.Nonce.IsEqual(offer.Nonce) || !pending.Commitment.IsEqual(offer.Commitment) {
+		pending.Discard()
+		return fmt.Errorf("recorded event does not match the offer")
+	}
+
+	seller.pending = pending
+	seller.Event = pending.Event
+	seller.Nonce = pending.Nonce
+	seller.Commitment = pending.Commitment
+	seller.NonceProof = offer.NonceProof
+
+	return nil
+}
+
+// restoreBuyer rebuilds the buyer's key and lock output from a record.
+func restoreBuyer(record *SwapRecord, keys SwapKeys) (*SwapBuyer, error) {
+	buyerKey, shared, err := restoreBuyerKey(record, keys)
+	if err != nil {
+		return nil, err
+	}
+	buyer, err := NewBuyer(buyerKey)
+	if err != nil {
+		return nil, err
+	}
+	buyer.shared = shared
+	if record.KeyIndex != nil {
+		index := *record.KeyIndex
+		buyer.KeyIndex = &index
+	}
+
+	if record.SigHash != "" {
+		if buyer.SigHash, err = crypto.HexDecode(record.SigHash); err != nil {
+			return nil, fmt.Errorf("invalid signature hash: %v", err)
+		}
+	}
+
+	for _, funding := range record.Funding {
+		script, err := crypto.HexDecode(funding.Script)
+		if err != nil {
+			return nil, fmt.Errorf("invalid funding script: %v", err)
+		}
+		buyer.FundingOutputs = append(buyer.FundingOutputs, wire.NewTxOut(funding.Value, script))
+	}
+
+	if record.LockOutput != nil {
+		if buyer.LockOutput, err = record.LockOutput.output(); err != nil {
+			return nil, err
+		}
+		if record.RefundLock != nil {
+			buyer.RefundLock = *record.RefundLock
+		}
+	}
+
+	return buyer, nil
+}
+
+// restoreBuyerKey returns the signer of keys with the recorded public key,
+// or derives the key from the wallet at the recorded index. It reports
+// whether the key is the caller's.
+func restoreBuyerKey(record *SwapRecord, keys SwapKeys) (crypto.Signer, bool, error) {
+	for _, signer := range keys.Buyers {
+		if crypto.HexEncode(signer.PubKey().SerializeCompressed()) == record.BuyerPub {
+			return signer, true, nil
+		}
+	}
+
+	if record.KeyIndex == nil {
+		return nil, false, fmt.Errorf("no signer for buyer key %s", record.BuyerPub)
+	}
+	if keys.Wallet == nil {
+		return nil, false, fmt.Errorf("buyer key %d is in an HD wallet, but no wallet was given", *record.KeyIndex)
+	}
+	buyerKey, err := keys.Wallet.Key(*record.KeyIndex)
+	if err != nil {
+		return nil, false, err
+	}
+	if crypto.HexEncode(buyerKey.PubKey().SerializeCompressed()) != record.BuyerPub {
+		buyerKey.Zero()
+		return nil, false, fmt.Errorf("buyer key %d is not from this wallet", *record.KeyIndex)
+	}
+	keys.Wallet.MarkUsed(*record.KeyIndex)
+
+	return buyerKey, false, nil
+}
+
+// output rebuilds the recorded lock output and checks that it still pays to
+// the recorded script.
+func (r *LockOutputRecord) output() (*bitcoin.TaprootOutput, error) {
+	keyBytes, err := crypto.HexDecode(r.InternalKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid internal key: %v", err)
+	}
+	internalKey, err := schnorr.ParsePubKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid internal key: %v", err)
+	}
+
+	scripts := make([][]byte, len(r.Scripts))
+	for i, script := range r.Scripts {
+		if scripts[i], err = crypto.HexDecode(script); err != nil {
+			return nil, fmt.Errorf("invalid leaf script: %v", err)
+		}
+	}
+
+	params, err := networkForAddress(r.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := bitcoin.NewTaprootOutputFromScripts(internalKey, params, scripts...)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.HexEncode(output.PkScript) != r.PkScript {
+		return nil, fmt.Errorf("rebuilt lock output does not match the recorded script")
+	}
+
+	return output, nil
+}
+
+// networkForAddress finds the network of a segwit address from its prefix.
+func networkForAddress(address string) (*chaincfg.Params, error) {
+	networks := []*chaincfg.Params{
+		&chaincfg.MainNetParams,
+		&chaincfg.TestNet3Params,
+		&chaincfg.RegressionNetParams,
+		&chaincfg.SigNetParams,
+		&chaincfg.SimNetParams,
+	}
+
+	// Regtest's "bcrt" must be tried before mainnet's "bc"
+	var best *chaincfg.Params
+	for _, params := range networks {
+		if strings.HasPrefix(address, params.Bech32HRPSegwit+"1") &&
+			(best == nil || len(params.Bech32HRPSegwit) > len(best.Bech32HRPSegwit)) {
+			best = params
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("unknown network for address %s", address)
+	}
+
+	return best, nil
+}
+
+// persistHook returns a hook saving the swap to the store on every transition.
+func persistHook(store SwapStore) Hook {
+	return func(swap *Swap, _, _ Phase) error {
+		record, err := swap.Record()
+		if err != nil {
+			return err
+		}
+
+		return store.Save(record)
+	}
+}
+
+// Persist saves the swap to the store now and after every phase transition.
+// A failed save makes the transition fail, so the swap never gets ahead of
+// what is on disk.
+func (sw *Swap) Persist(store SwapStore) error {
+	hook := persistHook(store)
+	if err := hook(sw, sw.Phase, sw.Phase); err != nil {
+		return fmt.Errorf("failed to save swap: %v", err)
+	}
+
+	sw.OnTransition(hook)
+
+	return nil
+}
+
+// ResumeSwaps restores every swap of the store that has not reached a
+// terminal phase, with their keys from keys as in RestoreSwap, and keeps
+// persisting their transitions.
+func ResumeSwaps(store SwapStore, keys SwapKeys) ([]*Swap, error) {
+	records, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list swaps: %v", err)
+	}
+
+	var swaps []*Swap
+	for _, record := range records {
+		if record.Phase.Terminal() {
+			continue
+		}
+
+		sw, err := RestoreSwap(record, keys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore swap %s: %v", record.ID, err)
+		}
+		sw.OnTransition(persistHook(store))
+
+		swaps = append(swaps, sw)
+	}
+
+	return swaps, nil
+}
@@ -0,0 +1,308 @@
+package tanos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+	"tanos/pkg/nostr"
+)
+
+// TestFileStoreResumesAfterCrash persists a buyer swap, simulates a crash
+// that tears the last journal write, and completes the swap from a fresh
+// store opened on the same directory.
+func TestFileStoreResumesAfterCrash(t *testing.T) {
+	ctx := context.Background()
+	chain := bitcoin.NewSimChain()
+	dir := t.TempDir()
+	sellerSwap, buyerSwap := newTestSwaps(t)
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if err := buyerSwap.Persist(store); err != nil {
+		t.Fatalf("Failed to persist swap: %v", err)
+	}
+
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyerSwap.Buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(144))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+
+	// Crash in the middle of writing the next record
+	journal := filepath.Join(dir, buyerSwap.ID+journalExt)
+	file, err := os.OpenFile(journal, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	file.WriteString(`{"version":1,"id":"` + buyerSwap.ID + `","phase":`)
+	file.Close()
+
+	store, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	swaps, err := ResumeSwaps(store, swapKeys(buyerSwap))
+	if err != nil {
+		t.Fatalf("Failed to resume swaps: %v", err)
+	}
+	if len(swaps) != 1 {
+		t.Fatalf("Expected 1 swap to resume, got %d", len(swaps))
+	}
+
+	resumed := swaps[0]
+	if resumed.Phase != PhaseFunded {
+		t.Fatalf("Resumed swap in phase %s", resumed.Phase)
+	}
+	if resumed.LockingTx.TxHash() != buyerSwap.LockingTx.TxHash() {
+		t.Fatalf("Resumed swap has a different locking transaction")
+	}
+	if !bytes.Equal(resumed.Buyer.LockOutput.PkScript, buyerSwap.Buyer.LockOutput.PkScript) {
+		t.Fatalf("Resumed swap has a different lock output")
+	}
+
+	// The resumed swap signs the claim and learns the signature from it
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	signSwapClaim(t, sellerSwap, resumed)
+	claimTx, err := sellerSwap.CompleteClaim()
+	if err != nil {
+		t.Fatalf("Seller failed to complete claim: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+		t.Fatalf("Claim transaction rejected: %v", err)
+	}
+	if _, err := resumed.WatchClaim(ctx, chain, 0); err != nil {
+		t.Fatalf("Resumed swap failed to watch the claim: %v", err)
+	}
+
+	record, err := store.Load(buyerSwap.ID)
+	if err != nil {
+		t.Fatalf("Failed to load swap: %v", err)
+	}
+	if record.Phase != PhaseClaimed || record.NostrSig != sellerSwap.Seller.Event.Sig {
+		t.Fatalf("Claim was not persisted: phase %s", record.Phase)
+	}
+
+	// The claimed swap is finished and must not be resumed again
+	swaps, err = ResumeSwaps(store, swapKeys(buyerSwap))
+	if err != nil {
+		t.Fatalf("Failed to resume swaps: %v", err)
+	}
+	if len(swaps) != 0 {
+		t.Fatalf("Expected no swap to resume, got %d", len(swaps))
+	}
+}
+
+// swapKeys returns the keys of the swaps, with a new signer for a seller's
+// key as after a restart.
+func swapKeys(swaps ...*Swap) SwapKeys {
+	var keys SwapKeys
+	for _, sw := range swaps {
+		if sw.Seller != nil {
+			keys.Sellers = append(keys.Sellers, nostr.NewLocalSigner(sw.Seller.signer.(crypto.Signer)))
+		}
+		if sw.Buyer != nil {
+			keys.Buyers = append(keys.Buyers, sw.Buyer.signer)
+		}
+	}
+
+	return keys
+}
+
+// resumeBoth resumes the seller and buyer swaps of the store, which are
+// kept apart although they trade the same event.
+func resumeBoth(t *testing.T, store SwapStore, keys SwapKeys) (*Swap, *Swap) {
+	t.Helper()
+
+	swaps, err := ResumeSwaps(store, keys)
+	if err != nil {
+		t.Fatalf("Failed to resume swaps: %v", err)
+	}
+	if len(swaps) != 2 {
+		t.Fatalf("Expected 2 swaps to resume, got %d", len(swaps))
+	}
+	if swaps[0].Role == RoleBuyer {
+		swaps[0], swaps[1] = swaps[1], swaps[0]
+	}
+
+	return swaps[0], swaps[1]
+}
+
+// TestClaimSurvivesRestart restarts both parties during the claim signing.
+// Without their secret nonces they sign again with fresh ones, and once the
+// buyer signed, the restored pre-signatures complete and extract the claim.
+func TestClaimSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	chain := bitcoin.NewSimChain()
+	sellerSwap, buyerSwap := newTestSwaps(t)
+
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	for _, sw := range []*Swap{sellerSwap, buyerSwap} {
+		if err := sw.Persist(store); err != nil {
+			t.Fatalf("Failed to persist swap: %v", err)
+		}
+		if err := sw.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyerSwap.Buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(144))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	notice, err := buyerSwap.FundingNotice()
+	if err != nil {
+		t.Fatalf("Buyer failed to create funding notice: %v", err)
+	}
+	if err := sellerSwap.ObserveFunding(notice); err != nil {
+		t.Fatalf("Seller failed to observe funding: %v", err)
+	}
+	buyerNonce, err := buyerSwap.ClaimNonce()
+	if err != nil {
+		t.Fatalf("Buyer failed to create claim nonce: %v", err)
+	}
+	if _, err := sellerSwap.ClaimNonce(); err != nil {
+		t.Fatalf("Seller failed to create claim nonce: %v", err)
+	}
+	proposal, err := sellerSwap.ProposeClaim(fundScript, bitcoin.FeeRatePerVByte(5), buyerNonce)
+	if err != nil {
+		t.Fatalf("Seller failed to propose claim: %v", err)
+	}
+
+	// The restarted buyer cannot sign for the nonce it lost
+	keys := swapKeys(sellerSwap, buyerSwap)
+	sellerSwap, buyerSwap = resumeBoth(t, store, keys)
+	if _, err := buyerSwap.SignClaim(proposal); err == nil {
+		t.Fatalf("Restarted buyer signed without its secret nonce")
+	}
+	if buyerNonce, err = buyerSwap.ClaimNonce(); err != nil {
+		t.Fatalf("Buyer failed to restart the claim: %v", err)
+	}
+	if _, err := sellerSwap.ClaimNonce(); err != nil {
+		t.Fatalf("Seller failed to restart the claim: %v", err)
+	}
+	if proposal, err = sellerSwap.ProposeClaim(fundScript, bitcoin.FeeRatePerVByte(5), buyerNonce); err != nil {
+		t.Fatalf("Seller failed to propose claim: %v", err)
+	}
+	if _, err := buyerSwap.SignClaim(proposal); err != nil {
+		t.Fatalf("Buyer failed to sign claim: %v", err)
+	}
+
+	// Both restart again before the seller accepted the buyer's signature
+	sellerSwap, buyerSwap = resumeBoth(t, store, keys)
+	if sellerSwap.Phase != PhaseClaimSigned || buyerSwap.Phase != PhaseAdaptorSigned {
+		t.Fatalf("Resumed swaps in phases %s and %s", sellerSwap.Phase, buyerSwap.Phase)
+	}
+	if _, err := buyerSwap.ClaimNonce(); err == nil {
+		t.Fatalf("Buyer restarted a claim it signed")
+	}
+	record, err := store.Load(buyerSwap.ID)
+	if err != nil {
+		t.Fatalf("Failed to load buyer swap: %v", err)
+	}
+	partial, err := decodeScalar(record.Claim.Partial)
+	if err != nil {
+		t.Fatalf("Failed to decode buyer partial signature: %v", err)
+	}
+	if err := sellerSwap.AcceptAdaptor(partial); err != nil {
+		t.Fatalf("Restored seller rejected the buyer's claim signature: %v", err)
+	}
+
+	// The pre-signatures survive a last restart
+	sellerSwap, buyerSwap = resumeBoth(t, store, keys)
+	claimTx, err := sellerSwap.CompleteClaim()
+	if err != nil {
+		t.Fatalf("Restored seller failed to complete claim: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+		t.Fatalf("Claim transaction rejected: %v", err)
+	}
+	reveal, err := buyerSwap.WatchClaim(ctx, chain, 0)
+	if err != nil {
+		t.Fatalf("Restored buyer failed to watch the claim: %v", err)
+	}
+	if reveal.NostrSig != sellerSwap.Seller.Event.Sig {
+		t.Fatalf("Restored buyer rebuilt the wrong Nostr signature")
+	}
+}
+
+// TestSellerRecordRoundTrip checks that a seller swap survives a save and
+// restore unchanged.
+func TestSellerRecordRoundTrip(t *testing.T) {
+	sellerSwap, _ := newTestSwaps(t)
+
+	record, err := sellerSwap.Record()
+	if err != nil {
+		t.Fatalf("Failed to record swap: %v", err)
+	}
+	var keyHex string
+	sellerSwap.Seller.signer.(crypto.Signer).WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		keyHex = crypto.HexEncode(privKey.Serialize())
+		return nil
+	})
+	if data, _ := json.Marshal(record); strings.Contains(string(data), keyHex) {
+		t.Fatalf("Record holds the seller's private key")
+	}
+	if _, err := RestoreSwap(record, SwapKeys{}); err == nil {
+		t.Fatalf("Restored a seller without its signer")
+	}
+	restored, err := RestoreSwap(record, swapKeys(sellerSwap))
+	if err != nil {
+		t.Fatalf("Failed to restore swap: %v", err)
+	}
+
+	// The restored pending signature completes to the same signature
+	if restored.Seller.Event.Sig != "" {
+		t.Fatalf("Restored seller has a signature before revealing")
+	}
+	if signedEvent(t, restored.Seller) != signedEvent(t, sellerSwap.Seller) {
+		t.Fatalf("Restored seller has a different event")
+	}
+	if !restored.Offer.Commitment.IsEqual(sellerSwap.Offer.Commitment) {
+		t.Fatalf("Restored seller has a different commitment")
+	}
+	if !restored.Seller.signer.PubKey().IsEqual(sellerSwap.Seller.PublicKey) {
+		t.Fatalf("Restored seller has a different key")
+	}
+}
+
+// TestFileStoreErrors covers missing swaps and unsafe IDs.
+func TestFileStoreErrors(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	if _, err := store.Load("missing"); !errors.Is(err, ErrSwapNotFound) {
+		t.Fatalf("Expected ErrSwapNotFound, got %v", err)
+	}
+	if err := store.Delete("missing"); !errors.Is(err, ErrSwapNotFound) {
+		t.Fatalf("Expected ErrSwapNotFound, got %v", err)
+	}
+	if err := store.Save(&SwapRecord{ID: "../escape"}); err == nil {
+		t.Fatalf("Expected an unsafe swap ID to be rejected")
+	}
+}
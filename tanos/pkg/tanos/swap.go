@@ -3,11 +3,15 @@
 package tanos
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 
 	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	nostrlib "github.com/nbd-wtf/go-nostr"
 
@@ -17,128 +21,253 @@ import (
 	"tanos/pkg/nostr"
 )
 
+// ErrNoAdaptorSignature is returned when the buyer has not created or
+// received an adaptor signature yet.
+var ErrNoAdaptorSignature = errors.New("no adaptor signature")
+
 // SwapSeller represents the seller in the atomic swap,
 // who owns a Nostr private key and wants to sell access to a signed Nostr event.
 type SwapSeller struct {
-	PrivateKey    string           // Nostr private key in hex
-	PrivateKeyBtc *secp.PrivateKey // Same key in secp256k1 format
-	PublicKey     *secp.PublicKey  // Public key in secp256k1 format
-	NostrPubKey   string           // Nostr public key in hex
-	Event         nostrlib.Event   // The Nostr event being sold
-	Nonce         *secp.PublicKey  // Nonce extracted from the signature
-	Commitment    *secp.PublicKey  // The commitment point T = R + e*P
+	PublicKey   *secp.PublicKey // Public key in secp256k1 format
+	NostrPubKey string          // Nostr public key in hex
+	Event       nostrlib.Event  // The Nostr event being sold, signed by SignEvent
+	Nonce       *secp.PublicKey // Nonce R of the signature
+	Commitment  *secp.PublicKey // The commitment point T = R + e*P
+	NonceProof  *NonceProof     // Proof of knowledge of the nonce
+	ClaimKey    *secp.PublicKey // Key the seller signs the claim with
+
+	LockOutput  *bitcoin.TaprootOutput    // MuSig2 swap output, if used
+	SegwitLock  *bitcoin.SegwitLockOutput // P2WSH swap output, if used
+	signer      nostr.EventSigner         // Holder of the Nostr private key
+	claimSigner crypto.Signer             // Holder of the claim key, nil without one
+	shared      bool                      // The signers belong to the caller, who zeroes them
+	claim       claimState
+	pending     *nostr.PendingEvent // Unfinished signature of Event, until SignEvent
 }
 
 // SwapBuyer represents the buyer in the atomic swap,
 // who wants to purchase access to a signed Nostr event.
 type SwapBuyer struct {
-	PrivateKey *secp.PrivateKey   // Bitcoin private key
-	PublicKey  *secp.PublicKey    // Bitcoin public key
-	AdaptorSig *adaptor.Signature // Adaptor signature
-	LockingTx  *wire.MsgTx        // Transaction that locks the coins
-	SigHash    []byte             // Signature hash of the locking transaction
+	PublicKey      *secp.PublicKey           // Bitcoin public key
+	AdaptorSig     *adaptor.Signature        // Adaptor signature
+	LockingTx      *wire.MsgTx               // Transaction that locks the coins
+	FundingOutputs []*wire.TxOut             // Outputs spent by the locking transaction, in input order
+	SigHash        []byte                    // Signature hash of the first input of the locking transaction
+	LockOutput     *bitcoin.TaprootOutput    // Swap output with the refund leaf, if any
+	SegwitLock     *bitcoin.SegwitLockOutput // P2WSH swap output, if used instead
+	SegwitClaimSig *adaptor.ECDSASignature   // ECDSA adaptor signature of the P2WSH claim
+	RefundLock     bitcoin.Timelock          // Timelock guarding the refund leaf
+	KeyIndex       *uint32                   // Index of the key in the buyer's HD wallet, if derived from one
+
+	signer crypto.Signer // Holder of the Bitcoin private key
+	shared bool          // The signer belongs to the caller, who zeroes it
+	claim  claimState
 }
 
-// NewSeller creates a new seller for the atomic swap.
-func NewSeller(nostrPrivateKey string) (*SwapSeller, error) {
-	// Parse the Nostr private key
-	privBytes, err := crypto.HexDecode(nostrPrivateKey)
-	if err != nil {
-		return nil, fmt.Errorf("invalid seller private key: %v", err)
-	}
+// zeroer is a signer whose key can be wiped, such as crypto.SecretKey.
+type zeroer interface {
+	Zero()
+}
 
-	// Convert to secp256k1 private key
-	sellerPriv, _ := secp.PrivKeyFromBytes(privBytes)
-	sellerPub := sellerPriv.PubKey()
+// NewSeller creates a new seller for the atomic swap, signing with the
+// seller's Nostr key held by signer. A nostr.LocalSigner also signs the
+// MuSig2 claim with the same key. A remote signer such as a NIP-46 bunker,
+// which keeps the key out of the process, only signs events, so it needs a
+// claim key from NewSellerWithClaimKey. The seller takes ownership of the
+// signer and zeroes it in Zero.
+func NewSeller(signer nostr.EventSigner) (*SwapSeller, error) {
+	keySigner, _ := signer.(crypto.Signer)
+	return NewSellerWithClaimKey(signer, keySigner)
+}
 
-	// Get the Nostr public key
-	nostrPub, err := nostr.GetPublicKey(nostrPrivateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get public key from nostr private key: %v", err)
+// NewSellerWithClaimKey creates a seller signing events with signer and the
+// MuSig2 claim with the local claimKey, which the offer names and its nonce
+// proof binds to the event. It lets a seller whose Nostr key is in a remote
+// signer finish a swap. The seller takes ownership of both signers.
+func NewSellerWithClaimKey(signer nostr.EventSigner, claimKey crypto.Signer) (*SwapSeller, error) {
+	if signer == nil || signer.PubKey() == nil {
+		return nil, fmt.Errorf("seller needs a signer")
 	}
+	sellerPub := signer.PubKey()
 
-	return &SwapSeller{
-		PrivateKey:    nostrPrivateKey,
-		PrivateKeyBtc: sellerPriv,
-		PublicKey:     sellerPub,
-		NostrPubKey:   nostrPub,
-	}, nil
+	seller := &SwapSeller{
+		PublicKey:   sellerPub,
+		NostrPubKey: crypto.HexEncode(schnorr.SerializePubKey(sellerPub)),
+		signer:      signer,
+	}
+	if claimKey != nil {
+		if claimKey.PubKey() == nil {
+			return nil, fmt.Errorf("claim key has no public key")
+		}
+		seller.ClaimKey = claimKey.PubKey()
+		seller.claimSigner = claimKey
+	}
+
+	return seller, nil
 }
 
-// NewBuyer creates a new buyer for the atomic swap.
-func NewBuyer() (*SwapBuyer, error) {
-	// Generate a new private key for the buyer
-	buyerPriv, err := secp.NewPrivateKey()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate buyer private key: %v", err)
+// NewBuyer creates a new buyer for the atomic swap, signing with the
+// Bitcoin key held by signer. The buyer takes ownership of the signer and
+// zeroes it in Zero.
+func NewBuyer(signer crypto.Signer) (*SwapBuyer, error) {
+	if signer == nil || signer.PubKey() == nil {
+		return nil, fmt.Errorf("buyer needs a signer")
 	}
 
 	return &SwapBuyer{
-		PrivateKey: buyerPriv,
-		PublicKey:  buyerPriv.PubKey(),
+		PublicKey: signer.PubKey(),
+		signer:    signer,
 	}, nil
 }
 
-// CreateEvent creates a signed Nostr event that will be sold in the swap.
+// Zero discards the pending event and the claim nonce and zeroes the
+// seller's keys, when the signers support it and the seller owns them. The
+// seller cannot sign anything afterwards.
+func (s *SwapSeller) Zero() {
+	s.Discard()
+	s.claim.zero()
+	if s.shared {
+		return
+	}
+	if z, ok := s.signer.(zeroer); ok {
+		z.Zero()
+	}
+	if z, ok := s.claimSigner.(zeroer); ok {
+		z.Zero()
+	}
+}
+
+// Zero discards the claim nonce and zeroes the buyer's key, when the signer
+// supports it and the buyer owns it. Only call it once the swap can no
+// longer need a refund.
+func (b *SwapBuyer) Zero() {
+	b.claim.zero()
+	if z, ok := b.signer.(zeroer); ok && !b.shared {
+		z.Zero()
+	}
+}
+
+// CreateEvent prepares a kind 1 text note that will be sold in the swap.
 func (s *SwapSeller) CreateEvent(content string) error {
-	// Create and sign the event
-	event, err := nostr.CreateSignedEvent(s.PrivateKey, content)
+	return s.CreateEventFromTemplate(nostr.NoteTemplate(content))
+}
+
+// CreateEventFromTemplate prepares an event of any kind from the template,
+// after validating it, to be sold in the swap. The event is not signed yet:
+// only its nonce R and the commitment point T = R + e*P are computed, and
+// the signature is produced by SignEvent when the seller claims.
+func (s *SwapSeller) CreateEventFromTemplate(template nostr.EventTemplate) error {
+	if s.ClaimKey == nil {
+		return fmt.Errorf("seller has no claim key")
+	}
+
+	pending, err := nostr.PrepareEvent(s.signer, template)
 	if err != nil {
-		return fmt.Errorf("failed to create signed event: %v", err)
+		return fmt.Errorf("failed to prepare event: %v", err)
 	}
 
-	s.Event = event
+	if err := s.setPending(pending); err != nil {
+		pending.Discard()
+		return err
+	}
+
+	return nil
+}
 
-	// Extract the nonce from the signature
-	nonce, err := adaptor.ExtractNonceFromSig(event.Sig)
+// setPending makes the pending event the one being sold and proves knowledge
+// of its nonce, so buyers can check the offer.
+func (s *SwapSeller) setPending(pending *nostr.PendingEvent) error {
+	eventID, err := crypto.DecodeHexStrict(pending.Event.ID, 32)
 	if err != nil {
-		return fmt.Errorf("failed to extract nonce from signature: %v", err)
+		return fmt.Errorf("invalid event ID: %v", err)
 	}
 
-	s.Nonce = nonce
+	e, z, err := pending.ProveNonce(func(A *secp.PublicKey) *secp.ModNScalar {
+		return nonceProofChallenge(A, eventID, s.PublicKey, pending.Nonce, pending.Commitment, s.ClaimKey)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prove knowledge of the nonce: %v", err)
+	}
 
-	// Compute the challenge e
-	msgHash := []byte(event.ID)
-	eBigInt := adaptor.SchnorrChallenge(nonce, s.PublicKey, msgHash)
+	s.Discard()
+	s.pending = pending
+	s.Event = pending.Event
+	s.Nonce = pending.Nonce
+	s.Commitment = pending.Commitment
+	s.NonceProof = &NonceProof{E: e, S: z}
 
-	// Convert to bytes
-	eBytes := crypto.PadTo32(eBigInt.Bytes())
+	return nil
+}
 
-	// Compute e*P
-	x, y := secp.S256().ScalarMult(s.PublicKey.X(), s.PublicKey.Y(), eBytes)
-	fx, fy := new(secp.FieldVal), new(secp.FieldVal)
-	if overflow := fx.SetByteSlice(x.Bytes()); overflow {
-		return fmt.Errorf("x-coordinate overflow in scalar multiplication")
+// SignEvent completes the signature of the event being sold and returns it.
+// The nonce and key material of the pending signature are zeroed. Once
+// signed, the same signature is returned again.
+func (s *SwapSeller) SignEvent() (string, error) {
+	if s.Event.Sig != "" {
+		return s.Event.Sig, nil
 	}
-	if overflow := fy.SetByteSlice(y.Bytes()); overflow {
-		return fmt.Errorf("y-coordinate overflow in scalar multiplication")
+	if s.pending == nil {
+		return "", fmt.Errorf("no event to sign")
 	}
 
-	// Compute commitment point T = R + e*P
-	commitment, err := adaptor.AddPubKeys(nonce, secp.NewPublicKey(fx, fy))
+	event, err := s.pending.Sign()
 	if err != nil {
-		return fmt.Errorf("failed to compute commitment point: %v", err)
+		return "", fmt.Errorf("failed to sign event: %v", err)
 	}
+	s.pending = nil
+	s.Event = event
 
-	s.Commitment = commitment
+	return event.Sig, nil
+}
 
-	return nil
+// Discard has the signer forget the nonce of the pending event, once the
+// event is signed for good or when the seller abandons the swap unsigned.
+func (s *SwapSeller) Discard() {
+	if s.pending != nil {
+		s.pending.Discard()
+		s.pending = nil
+	}
+}
+
+// withSecret calls fn with the signature scalar s of the event, either from
+// the signature or computed from the pending signature and zeroed after.
+func (s *SwapSeller) withSecret(fn func(secret *secp.ModNScalar) error) error {
+	if s.pending != nil {
+		return s.pending.WithSecret(fn)
+	}
+	if s.Event.Sig == "" {
+		return fmt.Errorf("no event to sign")
+	}
+
+	secret, err := nostr.ExtractSecretFromSignature(s.Event.Sig)
+	if err != nil {
+		return err
+	}
+	defer secret.Zero()
+
+	return fn(secret)
 }
 
 // CreateLockingTransaction creates a Bitcoin transaction that locks funds
 // in a Pay-to-Taproot output that can be spent with an adaptor signature.
+// The funding output being spent holds prevOutputValue satoshis locked by
+// prevOutputScript; both are committed to by the BIP341 signature hash.
 func (b *SwapBuyer) CreateLockingTransaction(
 	amount int64,
 	prevTxID string,
 	prevOutputIndex uint32,
+	prevOutputValue int64,
+	prevOutputScript []byte,
 	network *chaincfg.Params,
 ) error {
 	// Create the locking transaction
-	lockTx, lockScript, err := bitcoin.CreateLockingTransaction(
+	lockTx, _, sigHash, err := bitcoin.CreateLockingTransaction(
 		b.PublicKey,
 		amount,
 		prevTxID,
 		prevOutputIndex,
+		prevOutputValue,
+		prevOutputScript,
 		network,
 	)
 	if err != nil {
@@ -146,13 +275,7 @@ func (b *SwapBuyer) CreateLockingTransaction(
 	}
 
 	b.LockingTx = lockTx
-
-	// Calculate the signature hash
-	sigHash, err := bitcoin.CalculateSighash(lockTx, 0, lockScript)
-	if err != nil {
-		return fmt.Errorf("failed to calculate signature hash: %v", err)
-	}
-
+	b.FundingOutputs = []*wire.TxOut{wire.NewTxOut(prevOutputValue, prevOutputScript)}
 	b.SigHash = sigHash
 
 	return nil
@@ -162,19 +285,26 @@ func (b *SwapBuyer) CreateLockingTransaction(
 // in a Pay-to-Taproot output that can only be spent with knowledge of a Nostr signature.
 // This is an enhanced version that uses the seller's Nostr public key and commitment
 // to create a script that enforces the atomic swap condition.
+// The output also carries a refund leaf that lets the buyer reclaim the funds
+// with BuildRefundTransaction once refundLock expires.
 func (b *SwapBuyer) CreateLockingTransactionWithNostrLock(
 	amount int64,
 	prevTxID string,
 	prevOutputIndex uint32,
+	prevOutputValue int64,
+	prevOutputScript []byte,
 	nostrPubKey *secp.PublicKey,
 	commitment *secp.PublicKey,
+	refundLock bitcoin.Timelock,
 	network *chaincfg.Params,
 ) error {
-	// Create a taproot address that locks to the Nostr signature
-	_, lockScript, err := bitcoin.CreateNostrSignatureLockScript(nostrPubKey, commitment, network)
+	// Create a taproot output that locks to the Nostr signature, with a
+	// timelocked refund path back to the buyer
+	lockOutput, err := bitcoin.CreateNostrSignatureLockOutput(nostrPubKey, commitment, b.PublicKey, refundLock, network)
 	if err != nil {
-		return fmt.Errorf("failed to create Nostr signature lock script: %v", err)
+		return fmt.Errorf("failed to create Nostr signature lock output: %v", err)
 	}
+	lockScript := lockOutput.PkScript
 
 	// Create a new transaction
 	lockTx := wire.NewMsgTx(2) // Version 2 for taproot support
@@ -195,9 +325,13 @@ func (b *SwapBuyer) CreateLockingTransactionWithNostrLock(
 	lockTx.AddTxOut(txOut)
 
 	b.LockingTx = lockTx
+	b.FundingOutputs = []*wire.TxOut{wire.NewTxOut(prevOutputValue, prevOutputScript)}
+	b.LockOutput = lockOutput
+	b.RefundLock = refundLock
 
-	// Calculate the signature hash
-	sigHash, err := bitcoin.CalculateSighash(lockTx, 0, lockScript)
+	// Calculate the signature hash of the funding input
+	prevOutFetcher := txscript.NewCannedPrevOutputFetcher(prevOutputScript, prevOutputValue)
+	sigHash, err := bitcoin.CalculateSighash(lockTx, 0, prevOutFetcher, bitcoin.SigHashDefault)
 	if err != nil {
 		return fmt.Errorf("failed to calculate signature hash: %v", err)
 	}
@@ -207,10 +341,108 @@ func (b *SwapBuyer) CreateLockingTransactionWithNostrLock(
 	return nil
 }
 
+// SignLockingTransaction signs the inputs of the locking transaction that
+// spend the buyer's own key path P2TR output, the first one included. Other
+// inputs are left unsigned for their wallet, through LockingPSBT.
+func (b *SwapBuyer) SignLockingTransaction() error {
+	if b.LockingTx == nil || len(b.FundingOutputs) != len(b.LockingTx.TxIn) {
+		return fmt.Errorf("no locking transaction to sign")
+	}
+
+	keyScript, err := b.keyPathScript()
+	if err != nil {
+		return err
+	}
+	fetcher, err := bitcoin.NewPrevOutputFetcher(b.LockingTx, b.FundingOutputs)
+	if err != nil {
+		return fmt.Errorf("failed to sign locking transaction: %v", err)
+	}
+	sigHashes := make(map[int][]byte)
+	for i := range b.LockingTx.TxIn {
+		if !bytes.Equal(b.FundingOutputs[i].PkScript, keyScript) {
+			continue
+		}
+		if sigHashes[i], err = bitcoin.CalculateSighash(b.LockingTx, i, fetcher, bitcoin.SigHashDefault); err != nil {
+			return fmt.Errorf("failed to calculate signature hash: %v", err)
+		}
+	}
+
+	// The funding outputs commit to the tweaked key
+	sigs := make(map[int]*schnorr.Signature, len(sigHashes))
+	err = b.signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		tweakedPrivKey := txscript.TweakTaprootPrivKey(*privKey, nil)
+		defer tweakedPrivKey.Zero()
+
+		for i, sigHash := range sigHashes {
+			sig, err := schnorr.Sign(tweakedPrivKey, sigHash)
+			if err != nil {
+				return err
+			}
+			sigs[i] = sig
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign locking transaction: %v", err)
+	}
+
+	for i, sig := range sigs {
+		b.LockingTx.TxIn[i].Witness = wire.TxWitness{sig.Serialize()}
+	}
+
+	return nil
+}
+
+// keyPathScript returns the script of the buyer's BIP86 key path output.
+func (b *SwapBuyer) keyPathScript() ([]byte, error) {
+	// Only the script of the output is used, so the network is moot
+	output, err := bitcoin.NewTaprootOutput(b.PublicKey, nil, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.PkScript, nil
+}
+
+// BuildRefundTransaction creates a signed transaction that returns the locked
+// funds to destScript through the refund leaf of the swap output. It is only
+// valid once the refund timelock has expired, so it should be broadcast
+// after expiry if the seller never claims the output.
+func (b *SwapBuyer) BuildRefundTransaction(destScript []byte, fee int64) (*wire.MsgTx, error) {
+	if b.LockingTx == nil || b.LockOutput == nil {
+		return nil, fmt.Errorf("no refundable locking transaction")
+	}
+
+	var refundTx *wire.MsgTx
+	err := b.signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		var err error
+		refundTx, err = bitcoin.CreateRefundTransaction(
+			b.LockingTx,
+			0,
+			b.LockOutput,
+			b.RefundLock,
+			privKey,
+			destScript,
+			fee,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund transaction: %v", err)
+	}
+
+	return refundTx, nil
+}
+
 // CreateAdaptorSignature creates an adaptor signature using the commitment point.
 func (b *SwapBuyer) CreateAdaptorSignature(commitment *secp.PublicKey) error {
 	// Create the adaptor signature
-	adaptorSig, err := adaptor.New(b.PrivateKey, commitment, b.SigHash)
+	var adaptorSig *adaptor.Signature
+	err := b.signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		var err error
+		adaptorSig, err = adaptor.New(privKey, commitment, b.SigHash)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create adaptor signature: %v", err)
 	}
@@ -222,12 +454,20 @@ func (b *SwapBuyer) CreateAdaptorSignature(commitment *secp.PublicKey) error {
 
 // VerifyAdaptorSignature verifies the adaptor signature with the commitment point.
 // This is an important step to ensure the adaptor signature is valid before proceeding.
+// It reports false when there is no adaptor signature yet.
 func (b *SwapBuyer) VerifyAdaptorSignature(commitment *secp.PublicKey) bool {
+	if b.AdaptorSig == nil {
+		return false
+	}
 	return b.AdaptorSig.Verify(commitment)
 }
 
 // CompleteAdaptorSignature completes the adaptor signature with the secret from the Nostr signature.
 func (b *SwapBuyer) CompleteAdaptorSignature(nostrSig string) ([]byte, error) {
+	if b.AdaptorSig == nil {
+		return nil, ErrNoAdaptorSignature
+	}
+
 	// Extract the secret from the Nostr signature
 	secret, err := nostr.ExtractSecretFromSignature(nostrSig)
 	if err != nil {
@@ -244,138 +484,46 @@ func (b *SwapBuyer) CompleteAdaptorSignature(nostrSig string) ([]byte, error) {
 // VerifyNostrSecret verifies that the secret extracted from the Bitcoin signature
 // matches the secret in the Nostr signature.
 //
-// When verifying a completed signature with BIP340 parity rules, there's a critical
-// insight: When R'.Y is odd, we need to negate the completed signature before
-// extracting the secret. This is because:
-//
-// 1. During signature creation with odd R'.Y, we negate the nonce scalar k
-// 2. During BIP340 finalization, the signature may be further adjusted based on R.Y
-// 3. These negations affect how the secret needs to be extracted
-//
-// For more reliability, we try multiple approaches to extract the secret:
-// - Direct extraction: t = s' - s
-// - Negate the completed signature: t = (-s') - s
-// - Negate the extracted secret: t = -(s' - s)
-// - Negate both: t = -(-s' - s)
+// The adaptor signature records the parity of its nonce, so the completed
+// signature gives exactly one secret and no negated variants are tried.
 func (b *SwapBuyer) VerifyNostrSecret(completedSig *secp.ModNScalar, nostrSig string) (bool, error) {
+	if b.AdaptorSig == nil {
+		return false, ErrNoAdaptorSignature
+	}
+
 	// Extract the secret from the Nostr signature
 	nostrSecret, err := nostr.ExtractSecretFromSignature(nostrSig)
 	if err != nil {
 		return false, fmt.Errorf("failed to extract secret from Nostr signature: %v", err)
 	}
 
-	// Try multiple approaches to extract the secret correctly
-
-	// 1. Direct extraction
-	extractedSecret := b.AdaptorSig.ExtractSecret(completedSig)
-	if extractedSecret.Equals(nostrSecret) {
-		return true, nil
-	}
-
-	// 2. Negate the extracted secret
-	negatedSecret := new(secp.ModNScalar)
-	negatedSecret.Set(extractedSecret)
-	negatedSecret.Negate()
-	if negatedSecret.Equals(nostrSecret) {
-		return true, nil
-	}
-
-	// 3. Negate the completedSig before extraction
-	// This is the critical approach for odd R'.Y cases
-	negatedCompletedSig := new(secp.ModNScalar)
-	negatedCompletedSig.Set(completedSig)
-	negatedCompletedSig.Negate()
-
-	extractedFromNegated := b.AdaptorSig.ExtractSecret(negatedCompletedSig)
-	if extractedFromNegated.Equals(nostrSecret) {
-		return true, nil
-	}
-
-	// 4. Negate both the completed sig and the extracted secret
-	negatedExtractedFromNegated := new(secp.ModNScalar)
-	negatedExtractedFromNegated.Set(extractedFromNegated)
-	negatedExtractedFromNegated.Negate()
-
-	if negatedExtractedFromNegated.Equals(nostrSecret) {
-		return true, nil
-	}
-
-	// No match found with any approach
-	return false, nil
+	return b.AdaptorSig.ExtractSecret(completedSig).Equals(nostrSecret), nil
 }
 
-// DebugAdaptorSignature performs a detailed analysis of the adaptor signature,
-// explaining all the parity adjustments and steps in the BIP340 verification process.
+// DebugAdaptorSignature describes the adaptor signature, its recorded parities
+// and the secret extracted from completedSig.
 // This helps debug issues with secret extraction and verification.
 func (b *SwapBuyer) DebugAdaptorSignature(completedSig *secp.ModNScalar, nostrSecret *secp.ModNScalar) map[string]string {
 	results := make(map[string]string)
+	if b.AdaptorSig == nil {
+		results["Error"] = ErrNoAdaptorSignature.Error()
+		return results
+	}
 
-	// Check if the nonce point's Y-coordinate is odd
-	rPrimeYIsOdd := b.AdaptorSig.NoncePoint.Y().Bit(0) == 1
-	results["R'.Y is odd"] = fmt.Sprintf("%v", rPrimeYIsOdd)
+	parity := b.AdaptorSig.Parity
+	results["R'.Y is odd"] = fmt.Sprintf("%v", parity.Has(adaptor.NonceOdd))
+	results["P.Y is odd"] = fmt.Sprintf("%v", parity.Has(adaptor.KeyOdd))
+	results["R.Y is odd"] = fmt.Sprintf("%v", parity.Has(adaptor.RandomNonceOdd))
+	results["T.Y is odd"] = fmt.Sprintf("%v", parity.Has(adaptor.AdaptorOdd))
 
 	// Generate a BIP340-compliant signature from the adaptor signature
 	finalSig := b.AdaptorSig.GenerateFinalSignature(completedSig)
 	results["Final Signature"] = crypto.HexEncode(finalSig)
 
-	// Extract the scalar S from the final signature
-	sBytes := finalSig[32:]
-	sScalar := new(secp.ModNScalar)
-	if overflow := sScalar.SetByteSlice(sBytes); overflow {
-		results["Error"] = "Scalar overflow in final signature"
-		return results
-	}
-	results["Final s scalar"] = crypto.HexEncode(crypto.SerializeModNScalar(sScalar))
-
-	// Extract the secret directly from the adaptor signature
+	// Extract the secret from the completed signature
 	extractedSecret := b.AdaptorSig.ExtractSecret(completedSig)
 	results["Extracted secret"] = crypto.HexEncode(crypto.SerializeModNScalar(extractedSecret))
-
-	// Check if the extracted secret matches the nostr secret
-	matches := extractedSecret.Equals(nostrSecret)
-	results["Direct match"] = fmt.Sprintf("%v", matches)
-
-	// If there's no match and R'.Y is odd, try negating
-	if !matches && rPrimeYIsOdd {
-		negatedSecret := new(secp.ModNScalar)
-		negatedSecret.Set(extractedSecret)
-		negatedSecret.Negate()
-		results["Negated secret"] = crypto.HexEncode(crypto.SerializeModNScalar(negatedSecret))
-
-		negatedMatches := negatedSecret.Equals(nostrSecret)
-		results["Negated match"] = fmt.Sprintf("%v", negatedMatches)
-	}
-
-	// Try negating the completedSig before extraction
-	negatedCompletedSig := new(secp.ModNScalar)
-	negatedCompletedSig.Set(completedSig)
-	negatedCompletedSig.Negate()
-	results["Negated completedSig"] = crypto.HexEncode(crypto.SerializeModNScalar(negatedCompletedSig))
-
-	extractedFromNegated := b.AdaptorSig.ExtractSecret(negatedCompletedSig)
-	results["Extracted from negated"] = crypto.HexEncode(crypto.SerializeModNScalar(extractedFromNegated))
-
-	negatedExtractionMatches := extractedFromNegated.Equals(nostrSecret)
-	results["Negated extraction match"] = fmt.Sprintf("%v", negatedExtractionMatches)
-
-	// Calculate a raw secret extraction without BIP340 adjustments
-	adaptorS := b.AdaptorSig.S
-
-	// Calculate t = s' - s directly
-	directSecret := new(secp.ModNScalar)
-	directSecret.Set(completedSig)
-
-	// Negate adaptor S
-	negS := new(secp.ModNScalar)
-	negS.Set(adaptorS)
-	negS.Negate()
-
-	// t = s' + (-s) = s' - s
-	directSecret.Add(negS)
-	results["Direct secret calculation"] = crypto.HexEncode(crypto.SerializeModNScalar(directSecret))
-
-	directMatches := directSecret.Equals(nostrSecret)
-	results["Direct calculation match"] = fmt.Sprintf("%v", directMatches)
+	results["Match"] = fmt.Sprintf("%v", extractedSecret.Equals(nostrSecret))
 
 	return results
 }
@@ -383,35 +531,50 @@ func (b *SwapBuyer) DebugAdaptorSignature(completedSig *secp.ModNScalar, nostrSe
 // CreateSpendingTransaction creates a Bitcoin transaction that spends a previous output
 // and locks the funds in a new Taproot output that can be spent with an adaptor signature.
 // This enables chaining multiple atomic swaps by spending outputs from previous swaps.
+// The previous output is spent by its key path, and the fee is what the
+// transaction's virtual size costs at feeRate.
 func (b *SwapBuyer) CreateSpendingTransaction(
 	prevTxID string,
 	prevOutputIndex uint32,
 	prevOutputValue int64,
 	prevOutputScript []byte,
-	fee int64,
+	feeRate bitcoin.FeeRate,
 	newCommitment *secp.PublicKey,
 	network *chaincfg.Params,
 ) error {
+	_, pkScript, err := bitcoin.CreateP2TRAddress(newCommitment, network)
+	if err != nil {
+		return err
+	}
+	fee := feeRate.FeeForTx([]int64{bitcoin.KeyPathInputWeight}, []*wire.TxOut{wire.NewTxOut(0, pkScript)})
+
 	// Create the spending transaction
-	spendTx, pkScript, err := bitcoin.CreateSpendingTransaction(
-		prevTxID,
-		prevOutputIndex,
-		prevOutputValue,
-		prevOutputScript,
-		fee,
-		b.PrivateKey,
-		newCommitment,
-		network,
-	)
+	var spendTx *wire.MsgTx
+	err = b.signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		var err error
+		spendTx, _, err = bitcoin.CreateSpendingTransaction(
+			prevTxID,
+			prevOutputIndex,
+			prevOutputValue,
+			prevOutputScript,
+			fee,
+			privKey,
+			newCommitment,
+			network,
+		)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create spending transaction: %v", err)
 	}
 
 	// Set the locking transaction
 	b.LockingTx = spendTx
+	b.FundingOutputs = []*wire.TxOut{wire.NewTxOut(prevOutputValue, prevOutputScript)}
 
 	// Calculate the signature hash for the new locking transaction
-	sigHash, err := bitcoin.CalculateSighash(spendTx, 0, pkScript)
+	prevOutFetcher := txscript.NewCannedPrevOutputFetcher(prevOutputScript, prevOutputValue)
+	sigHash, err := bitcoin.CalculateSighash(spendTx, 0, prevOutFetcher, bitcoin.SigHashDefault)
 	if err != nil {
 		return fmt.Errorf("failed to calculate signature hash: %v", err)
 	}
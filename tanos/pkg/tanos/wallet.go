@@ -0,0 +1,91 @@
+package tanos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/wallet"
+)
+
+// RecoveryBackend is a chain backend that can also scan for the outputs of
+// a wallet's keys, as every backend of the bitcoin package can. Backends
+// that are also bitcoin.HistoryScanners find keys whose outputs are all
+// spent too.
+type RecoveryBackend interface {
+	bitcoin.ChainBackend
+	bitcoin.ScriptScanner
+}
+
+// Recovery is what RecoverSwaps found of a buyer's funds.
+type Recovery struct {
+	Swaps []*Swap         // Swaps whose lock output is still unspent
+	Funds []*wallet.Found // Outputs paying to the wallet's keys, such as change and refunds
+}
+
+// NewWalletBuyer creates a buyer signing with the next unused key of the
+// HD wallet. Its swap records the index of the key instead of the key, so
+// the wallet's mnemonic backs it up.
+func NewWalletBuyer(w *wallet.Wallet) (*SwapBuyer, error) {
+	buyerKey, index, err := w.NextKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive buyer key: %v", err)
+	}
+	buyer, err := NewBuyer(buyerKey)
+	if err != nil {
+		buyerKey.Zero()
+		return nil, err
+	}
+	buyer.KeyIndex = &index
+
+	return buyer, nil
+}
+
+// RecoverSwaps finds the buyer's funds after a restart from the wallet's
+// mnemonic. The keys of the records are marked used first, since their lock
+// outputs never pay to the keys' own outputs, then the wallet is rescanned
+// for outputs paying to its keys past them. Buyer swaps whose lock output
+// is still unspent are restored, to be refunded once their timelock allows,
+// whatever phase they were recorded at; swaps with keys from outside the
+// wallet are left to ResumeSwaps. Lock outputs cannot be found without
+// their records, since their keys include the seller's.
+func RecoverSwaps(ctx context.Context, records []*SwapRecord, w *wallet.Wallet, backend RecoveryBackend) (*Recovery, error) {
+	for _, record := range records {
+		if record.Role == RoleBuyer && record.KeyIndex != nil {
+			w.MarkUsed(*record.KeyIndex)
+		}
+	}
+
+	funds, err := w.Rescan(ctx, backend, wallet.DefaultGapLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rescan wallet: %v", err)
+	}
+	recovery := &Recovery{Funds: funds}
+
+	for _, record := range records {
+		if record.Role != RoleBuyer || record.KeyIndex == nil || record.LockingTx == "" {
+			continue
+		}
+
+		sw, err := RestoreSwap(record, SwapKeys{Wallet: w})
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore swap %s: %v", record.ID, err)
+		}
+		lockOutPoint := wire.OutPoint{Hash: sw.LockingTx.TxHash(), Index: 0}
+		_, err = backend.GetUTXO(ctx, lockOutPoint)
+		if errors.Is(err, bitcoin.ErrUTXONotFound) {
+			sw.Buyer.Zero()
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up lock output of swap %s: %v", record.ID, err)
+		}
+
+		recovery.Swaps = append(recovery.Swaps, sw)
+	}
+
+	return recovery, nil
+}
@@ -0,0 +1,161 @@
+package tanos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/nostr"
+	"tanos/pkg/wallet"
+)
+
+// newTestWallet opens a wallet from a fresh mnemonic, returning both.
+func newTestWallet(t *testing.T) (*wallet.Wallet, string) {
+	t.Helper()
+
+	mnemonic, err := wallet.NewMnemonic()
+	if err != nil {
+		t.Fatalf("Failed to create mnemonic: %v", err)
+	}
+	w, err := wallet.FromMnemonic(mnemonic, "", &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to open wallet: %v", err)
+	}
+	return w, mnemonic
+}
+
+// newWalletBuyerSwap creates a buyer swap with a key from w, on a fresh offer.
+func newWalletBuyerSwap(t *testing.T, w *wallet.Wallet) (*Swap, *Swap) {
+	t.Helper()
+
+	seller, err := NewSeller(nostr.NewLocalSigner(newTestKey(t)))
+	if err != nil {
+		t.Fatalf("Failed to create seller: %v", err)
+	}
+	if err := seller.CreateEvent("wallet swap test"); err != nil {
+		t.Fatalf("Failed to create event: %v", err)
+	}
+	sellerSwap, err := NewSellerSwap(seller)
+	if err != nil {
+		t.Fatalf("Failed to create seller swap: %v", err)
+	}
+	buyer, err := NewWalletBuyer(w)
+	if err != nil {
+		t.Fatalf("Failed to create buyer: %v", err)
+	}
+	buyerSwap, err := NewBuyerSwap(buyer, sellerSwap.Offer)
+	if err != nil {
+		t.Fatalf("Failed to create buyer swap: %v", err)
+	}
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+
+	return sellerSwap, buyerSwap
+}
+
+// TestRecoverSwaps abandons a funded swap and an unfunded one, then finds
+// the funded one and the change of its locking transaction from the
+// mnemonic and the records alone, and refunds it.
+func TestRecoverSwaps(t *testing.T) {
+	ctx := context.Background()
+	params := &chaincfg.RegressionNetParams
+	chain := bitcoin.NewSimChain()
+	w, mnemonic := newTestWallet(t)
+
+	_, buyerSwap := newWalletBuyerSwap(t, w)
+	buyer := buyerSwap.Buyer
+	if buyer.KeyIndex == nil || *buyer.KeyIndex != 0 {
+		t.Fatalf("First wallet buyer does not use key 0")
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyer)
+	builder := &bitcoin.FundingBuilder{
+		UTXOs:        []*bitcoin.UTXO{{OutPoint: wire.OutPoint{Hash: fundTx.TxHash()}, Output: fundTx.TxOut[0]}},
+		FeeRate:      bitcoin.FeeRatePerVByte(1),
+		ChangeScript: fundScript,
+	}
+	err := buyerSwap.Fund(func(b *SwapBuyer, offer *Offer) error {
+		err := b.CreateMuSig2LockingTransaction(
+			50000, fundTx.TxHash().String(), 0, 110000, fundScript,
+			offer.ClaimKey, bitcoin.RelativeBlocks(10), params,
+		)
+		if err != nil {
+			return err
+		}
+		if _, err := b.FundLockingTransaction(builder); err != nil {
+			return err
+		}
+		return b.SignLockingTransaction()
+	})
+	if err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	chain.Mine(10)
+
+	_, unfundedSwap := newWalletBuyerSwap(t, w)
+	if *unfundedSwap.Buyer.KeyIndex != 1 {
+		t.Fatalf("Second wallet buyer uses key %d", *unfundedSwap.Buyer.KeyIndex)
+	}
+	if err := unfundedSwap.Fund(fundWithRefund); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+
+	var records []*SwapRecord
+	for _, sw := range []*Swap{buyerSwap, unfundedSwap} {
+		record, err := sw.Record()
+		if err != nil {
+			t.Fatalf("Failed to record swap: %v", err)
+		}
+		if record.KeyIndex == nil {
+			t.Fatalf("Record holds the buyer key instead of its index")
+		}
+		records = append(records, record)
+	}
+
+	if _, err := RestoreSwap(records[0], SwapKeys{}); err == nil {
+		t.Fatalf("Restored a wallet swap without the wallet")
+	}
+	other, _ := newTestWallet(t)
+	if _, err := RestoreSwap(records[0], SwapKeys{Wallet: other}); err == nil {
+		t.Fatalf("Restored a swap with another wallet")
+	}
+
+	// Start over from the mnemonic
+	restored, err := wallet.FromMnemonic(mnemonic, "", params)
+	if err != nil {
+		t.Fatalf("Failed to reopen wallet: %v", err)
+	}
+	recovery, err := RecoverSwaps(ctx, records, restored, chain)
+	if err != nil {
+		t.Fatalf("Failed to recover swaps: %v", err)
+	}
+	if restored.NextIndex() != 2 {
+		t.Fatalf("Recovered wallet would reuse key %d", restored.NextIndex())
+	}
+	if len(recovery.Swaps) != 1 || recovery.Swaps[0].ID != buyerSwap.ID {
+		t.Fatalf("Recovered %d swaps, expected the funded one", len(recovery.Swaps))
+	}
+	changeHash := buyerSwap.LockingTx.TxHash()
+	if len(recovery.Funds) != 1 || recovery.Funds[0].Index != 0 || recovery.Funds[0].UTXO.OutPoint.Hash != changeHash {
+		t.Fatalf("Rescan did not find the change of the locking transaction")
+	}
+
+	sw := recovery.Swaps[0]
+	fee, err := sw.Buyer.RefundFee(fundScript, bitcoin.FeeRatePerVByte(1))
+	if err != nil {
+		t.Fatalf("Failed to estimate refund fee: %v", err)
+	}
+	refundTx, err := sw.Refund(fundScript, fee)
+	if err != nil {
+		t.Fatalf("Failed to refund recovered swap: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, refundTx); err != nil {
+		t.Fatalf("Refund rejected: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package tanos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/adaptor"
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+)
+
+// ErrLockRefunded is returned by the claim watchers when the lock output was
+// spent through a script path, such as the refund leaf, instead of being
+// claimed with a key path signature, or through the refund branch of a
+// P2WSH lock output.
+var ErrLockRefunded = errors.New("lock output was spent through a script path")
+
+// ErrLockClaimed is returned by Swap.WatchRefund when the lock output was
+// claimed with a key path signature before the refund went through.
+var ErrLockClaimed = errors.New("lock output was claimed through the key path")
+
+// ClaimReveal is what the buyer learns from a claim transaction seen on chain.
+type ClaimReveal struct {
+	Spend    *bitcoin.SpendEvent // The claim transaction
+	Secret   *secp.ModNScalar    // The adaptor secret, the s value of the Nostr signature
+	NostrSig string              // The reconstructed Nostr signature, in hex
+}
+
+// secretExtractor returns the adaptor secret behind the witness of a claim.
+type secretExtractor func(witness wire.TxWitness) (*secp.ModNScalar, error)
+
+// WatchClaim waits, through backend, for the lock output at outpoint to be
+// claimed with the completion of preSig. It extracts the adaptor secret from
+// the claim's witness and rebuilds the Nostr signature of the offered event.
+// heightHint is a height at or below the one the lock output confirmed at.
+func WatchClaim(
+	ctx context.Context,
+	backend bitcoin.ChainBackend,
+	outpoint wire.OutPoint,
+	heightHint int32,
+	preSig *adaptor.Signature,
+	offer *Offer,
+) (*ClaimReveal, error) {
+	if preSig == nil {
+		return nil, fmt.Errorf("no adaptor signature to extract the secret from")
+	}
+
+	return watchClaim(ctx, backend, outpoint, heightHint, offer, keyPathSecret(adaptorSecret(preSig)))
+}
+
+// WatchSegwitClaim waits, through backend, for the P2WSH lock output at
+// outpoint to be claimed with the completion of the buyer's ECDSA adaptor
+// signature preSig, like WatchClaim does for taproot lock outputs.
+func WatchSegwitClaim(
+	ctx context.Context,
+	backend bitcoin.ChainBackend,
+	outpoint wire.OutPoint,
+	heightHint int32,
+	preSig *adaptor.ECDSASignature,
+	lockOutput *bitcoin.SegwitLockOutput,
+	offer *Offer,
+) (*ClaimReveal, error) {
+	if preSig == nil {
+		return nil, fmt.Errorf("no adaptor signature to extract the secret from")
+	}
+
+	return watchClaim(ctx, backend, outpoint, heightHint, offer, segwitSecret(preSig, lockOutput))
+}
+
+// keyPathSecret extracts the secret from the signature of a key path
+// witness with extract.
+func keyPathSecret(extract func(sig []byte) (*secp.ModNScalar, error)) secretExtractor {
+	return func(witness wire.TxWitness) (*secp.ModNScalar, error) {
+		sig, err := keyPathSignature(witness)
+		if err != nil {
+			return nil, err
+		}
+
+		return extract(sig)
+	}
+}
+
+// segwitSecret extracts the secret from the buyer's signature in the claim
+// witness of a P2WSH lock output, the completion of preSig.
+func segwitSecret(preSig *adaptor.ECDSASignature, lockOutput *bitcoin.SegwitLockOutput) secretExtractor {
+	return func(witness wire.TxWitness) (*secp.ModNScalar, error) {
+		_, buyerSig, err := bitcoin.SegwitClaimSignatures(lockOutput, witness)
+		if errors.Is(err, bitcoin.ErrRefundBranch) {
+			return nil, ErrLockRefunded
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The r of the completed signature is the x-coordinate of the nonce
+		// point, reduced mod n
+		var nonceX secp.ModNScalar
+		nonceX.SetByteSlice(crypto.PadTo32(preSig.NoncePoint.X().Bytes()))
+		if r := buyerSig.R(); !r.Equals(&nonceX) {
+			return nil, fmt.Errorf("claim signature does not complete the adaptor signature")
+		}
+		s := buyerSig.S()
+
+		return preSig.ExtractSecret(&s), nil
+	}
+}
+
+// adaptorSecret extracts the secret from the completion of an adaptor
+// signature.
+func adaptorSecret(preSig *adaptor.Signature) func(sig []byte) (*secp.ModNScalar, error) {
+	return func(sig []byte) (*secp.ModNScalar, error) {
+		if !bytes.Equal(sig[:32], crypto.PadTo32(preSig.NoncePoint.X().Bytes())) {
+			return nil, fmt.Errorf("claim signature does not complete the adaptor signature")
+		}
+
+		completed := new(secp.ModNScalar)
+		if overflow := completed.SetByteSlice(sig[32:]); overflow {
+			return nil, fmt.Errorf("claim signature scalar overflow")
+		}
+
+		return preSig.ExtractSecret(completed), nil
+	}
+}
+
+// watchClaim waits for the spend of outpoint and recovers the secret from it.
+func watchClaim(
+	ctx context.Context,
+	backend bitcoin.ChainBackend,
+	outpoint wire.OutPoint,
+	heightHint int32,
+	offer *Offer,
+	extract secretExtractor,
+) (*ClaimReveal, error) {
+	spends, err := backend.WatchSpend(ctx, outpoint, heightHint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch lock output: %v", err)
+	}
+
+	spend, ok := <-spends
+	if !ok {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("spend watch for %s ended", outpoint)
+	}
+
+	secret, err := extract(spend.SpendingTx.TxIn[spend.InputIndex].Witness)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the secret really is the discrete logarithm of the commitment
+	var t secp.JacobianPoint
+	secp.ScalarBaseMultNonConst(secret, &t)
+	t.ToAffine()
+	if !secp.NewPublicKey(&t.X, &t.Y).IsEqual(offer.Commitment) {
+		return nil, fmt.Errorf("claim signature does not reveal the commitment secret")
+	}
+
+	nostrSig, err := rebuildNostrSignature(offer, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClaimReveal{Spend: spend, Secret: secret, NostrSig: nostrSig}, nil
+}
+
+// keyPathSignature returns the Schnorr signature of a key path witness,
+// without its sighash type byte.
+func keyPathSignature(witness wire.TxWitness) ([]byte, error) {
+	// A key path witness is the signature, optionally followed by an annex
+	if len(witness) == 2 && len(witness[1]) > 0 && witness[1][0] == txscript.TaprootAnnexTag {
+		witness = witness[:1]
+	}
+	if len(witness) != 1 {
+		return nil, ErrLockRefunded
+	}
+
+	sig := witness[0]
+	switch len(sig) {
+	case schnorr.SignatureSize:
+		return sig, nil
+	case schnorr.SignatureSize + 1:
+		return sig[:schnorr.SignatureSize], nil
+	default:
+		return nil, fmt.Errorf("invalid key path signature length %d", len(sig))
+	}
+}
+
+// rebuildNostrSignature combines the offered nonce with the secret into the
+// event's BIP340 signature and verifies it.
+func rebuildNostrSignature(offer *Offer, secret *secp.ModNScalar) (string, error) {
+	sig := make([]byte, schnorr.SignatureSize)
+	copy(sig, schnorr.SerializePubKey(offer.Nonce))
+	copy(sig[32:], crypto.SerializeModNScalar(secret))
+
+	parsed, err := schnorr.ParseSignature(sig)
+	if err != nil {
+		return "", fmt.Errorf("invalid rebuilt signature: %v", err)
+	}
+	eventID, err := crypto.DecodeHexStrict(offer.EventID, 32)
+	if err != nil {
+		return "", fmt.Errorf("invalid event ID: %v", err)
+	}
+	pubKeyBytes, err := crypto.DecodeHexStrict(offer.NostrPubKey, 32)
+	if err != nil {
+		return "", fmt.Errorf("invalid Nostr public key: %v", err)
+	}
+	pubKey, err := schnorr.ParsePubKey(pubKeyBytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid Nostr public key: %v", err)
+	}
+	if !parsed.Verify(eventID, pubKey) {
+		return "", fmt.Errorf("rebuilt Nostr signature does not verify")
+	}
+
+	return crypto.HexEncode(sig), nil
+}
+
+// WatchClaim waits for the seller's claim of the lock output, rebuilds the
+// Nostr signature from it and completes the buyer's side of the swap. The
+// secret is extracted with the pre-signature of the MuSig2 claim, so the
+// buyer must have signed the claim first.
+func (sw *Swap) WatchClaim(ctx context.Context, backend bitcoin.ChainBackend, heightHint int32) (*ClaimReveal, error) {
+	if err := sw.check(PhaseClaimed, RoleBuyer, "watching for the claim"); err != nil {
+		return nil, err
+	}
+	preSig := sw.Buyer.claim.preSig
+	if preSig == nil {
+		return nil, fmt.Errorf("claim has not been signed")
+	}
+
+	outpoint := wire.OutPoint{Hash: sw.LockingTx.TxHash(), Index: 0}
+	reveal, err := watchClaim(ctx, backend, outpoint, heightHint, &sw.Offer, keyPathSecret(preSig.ExtractSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	sw.NostrSig = reveal.NostrSig
+	sw.ClaimTx = reveal.Spend.SpendingTx
+	if err := sw.transition(PhaseClaimed); err != nil {
+		sw.NostrSig, sw.ClaimTx = "", nil
+		return nil, err
+	}
+
+	return reveal, nil
+}
+
+// WatchRefund waits for the refund of a swap in PhaseRefundPending to spend
+// the lock output and moves it to PhaseRefunded. The refund seen on chain,
+// which may be a bumped one, replaces RefundTx. If the seller claimed the
+// lock first ErrLockClaimed is returned and the swap is left pending:
+// WatchClaim then recovers the Nostr signature from the claim. A spend with
+// a malformed key path witness is reported as an error of its own.
+func (sw *Swap) WatchRefund(ctx context.Context, backend bitcoin.ChainBackend, heightHint int32) (*bitcoin.SpendEvent, error) {
+	if err := sw.check(PhaseRefunded, RoleBuyer, "watching for the refund"); err != nil {
+		return nil, err
+	}
+	if sw.Phase != PhaseRefundPending {
+		return nil, fmt.Errorf("no refund is pending")
+	}
+
+	outpoint := wire.OutPoint{Hash: sw.LockingTx.TxHash(), Index: 0}
+	spends, err := backend.WatchSpend(ctx, outpoint, heightHint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch lock output: %v", err)
+	}
+
+	spend, ok := <-spends
+	if !ok {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("spend watch for %s ended", outpoint)
+	}
+	// Only a parsed key path signature is a claim; a malformed witness is
+	// neither a claim nor a refund
+	_, err = keyPathSignature(spend.SpendingTx.TxIn[spend.InputIndex].Witness)
+	if err == nil {
+		return nil, ErrLockClaimed
+	}
+	if !errors.Is(err, ErrLockRefunded) {
+		return nil, fmt.Errorf("failed to read spend of lock output: %v", err)
+	}
+
+	refundTx := sw.RefundTx
+	sw.RefundTx = spend.SpendingTx
+	if err := sw.transition(PhaseRefunded); err != nil {
+		sw.RefundTx = refundTx
+		return nil, err
+	}
+
+	return spend, nil
+}
@@ -0,0 +1,317 @@
+package tanos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/adaptor"
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/nostr"
+)
+
+// fundOnChain funds the buyer's key path output on the simulated chain and
+// returns the funding transaction.
+func fundOnChain(t *testing.T, chain *bitcoin.SimChain, buyer *SwapBuyer) (*wire.MsgTx, []byte) {
+	_, fundScript, err := bitcoin.CreateP2TRAddress(buyer.PublicKey, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("Failed to create funding script: %v", err)
+	}
+
+	return chain.Fund(fundScript, 110000), fundScript
+}
+
+// fundFrom returns a funding function locking the coin of fundTx to the
+// offer's MuSig2 output, signed so the simulated chain accepts it.
+func fundFrom(fundTx *wire.MsgTx, fundScript []byte, lock bitcoin.Timelock) func(*SwapBuyer, *Offer) error {
+	return func(b *SwapBuyer, offer *Offer) error {
+		err := b.CreateMuSig2LockingTransaction(
+			100000, fundTx.TxHash().String(), 0, fundTx.TxOut[0].Value, fundScript,
+			offer.ClaimKey, lock, &chaincfg.RegressionNetParams,
+		)
+		if err != nil {
+			return err
+		}
+		return b.SignLockingTransaction()
+	}
+}
+
+// TestWatchClaimMuSig2 runs a MuSig2 swap on the simulated chain: the seller
+// publishes the claim and the buyer's watcher recovers the Nostr signature
+// from it.
+func TestWatchClaimMuSig2(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chain := bitcoin.NewSimChain()
+
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	seller := sellerSwap.Seller
+
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyerSwap.Buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(144))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	lockHeight := chain.Mine(1)
+
+	signSwapClaim(t, sellerSwap, buyerSwap)
+	claimTx, err := sellerSwap.CompleteClaim()
+	if err != nil {
+		t.Fatalf("Seller failed to complete claim: %v", err)
+	}
+
+	// The completed claim also travels as a PSBT with the tap key signature
+	claimPSBT, err := seller.ClaimPSBT(claimTx, 100000)
+	if err != nil {
+		t.Fatalf("Failed to export claim PSBT: %v", err)
+	}
+	encoded, err := bitcoin.EncodePSBT(claimPSBT)
+	if err != nil {
+		t.Fatalf("Failed to encode claim PSBT: %v", err)
+	}
+	fromPSBT, err := bitcoin.ImportPSBT(encoded, claimTx, []*wire.TxOut{buyerSwap.LockingTx.TxOut[0]})
+	if err != nil {
+		t.Fatalf("Failed to finalize claim PSBT: %v", err)
+	}
+	if fromPSBT.WitnessHash() != claimTx.WitnessHash() {
+		t.Fatalf("Claim PSBT finalized to another transaction")
+	}
+
+	type result struct {
+		reveal *ClaimReveal
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reveal, err := buyerSwap.WatchClaim(ctx, chain, lockHeight)
+		done <- result{reveal, err}
+	}()
+
+	if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+		t.Fatalf("Claim transaction rejected: %v", err)
+	}
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("Watcher failed: %v", res.err)
+	}
+	if res.reveal.NostrSig != seller.Event.Sig {
+		t.Fatalf("Watcher rebuilt the wrong Nostr signature")
+	}
+	if buyerSwap.Phase != PhaseClaimed || buyerSwap.NostrSig != seller.Event.Sig {
+		t.Fatalf("Buyer swap not claimed, phase %s", buyerSwap.Phase)
+	}
+}
+
+// TestWatchClaimAdaptorSignature has the seller spend the buyer's output
+// with a completed single-key adaptor signature, and checks that the watcher
+// recovers the Nostr signature from the witness.
+func TestWatchClaimAdaptorSignature(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chain := bitcoin.NewSimChain()
+
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	seller, buyer := sellerSwap.Seller, buyerSwap.Buyer
+	secret, err := nostr.ExtractSecretFromSignature(signedEvent(t, seller))
+	if err != nil {
+		t.Fatalf("Failed to extract secret: %v", err)
+	}
+
+	// Enough runs to cover both parities of the adaptor nonce
+	for i := 0; i < 8; i++ {
+		fundTx, _ := fundOnChain(t, chain, buyer)
+		outpoint := wire.OutPoint{Hash: fundTx.TxHash(), Index: 0}
+
+		claimTx := wire.NewMsgTx(2)
+		claimTx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+		claimTx.AddTxOut(wire.NewTxOut(109000, fundTx.TxOut[0].PkScript))
+		sigHash, err := bitcoin.KeyPathSighash(claimTx, fundTx.TxOut[0])
+		if err != nil {
+			t.Fatalf("Failed to compute sighash: %v", err)
+		}
+
+		var preSig *adaptor.Signature
+		err = buyer.signer.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+			preSig, err = adaptor.New(txscript.TweakTaprootPrivKey(*privKey, nil), seller.Commitment, sigHash)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Failed to create adaptor signature: %v", err)
+		}
+
+		// The seller completes the signature with the Nostr secret
+		claimTx.TxIn[0].Witness = wire.TxWitness{preSig.GenerateFinalSignature(preSig.Complete(secret))}
+		if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+			t.Fatalf("Run %d: completed adaptor signature rejected: %v", i, err)
+		}
+
+		reveal, err := WatchClaim(ctx, chain, outpoint, 0, preSig, &buyerSwap.Offer)
+		if err != nil {
+			t.Fatalf("Run %d: watcher failed: %v", i, err)
+		}
+		if reveal.NostrSig != seller.Event.Sig {
+			t.Fatalf("Run %d: watcher rebuilt the wrong Nostr signature", i)
+		}
+	}
+}
+
+// TestWatchClaimReportsRefund checks that a refund of the lock output is
+// reported as ErrLockRefunded.
+func TestWatchClaimReportsRefund(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chain := bitcoin.NewSimChain()
+
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	buyer := buyerSwap.Buyer
+
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(10))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	chain.Mine(10)
+	signSwapClaim(t, sellerSwap, buyerSwap)
+
+	refundTx, err := buyer.BuildRefundTransaction(fundScript, 1000)
+	if err != nil {
+		t.Fatalf("Failed to build refund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, refundTx); err != nil {
+		t.Fatalf("Refund rejected: %v", err)
+	}
+
+	if _, err := buyerSwap.WatchClaim(ctx, chain, 0); !errors.Is(err, ErrLockRefunded) {
+		t.Fatalf("Expected ErrLockRefunded, got %v", err)
+	}
+	if buyerSwap.Phase != PhaseAdaptorSigned {
+		t.Fatalf("Refunded swap moved to %s", buyerSwap.Phase)
+	}
+}
+
+// TestWatchRefundReportsClaim has the seller claim the lock while the
+// buyer's refund is pending, which leaves the buyer to recover the Nostr
+// signature from the claim.
+func TestWatchRefundReportsClaim(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chain := bitcoin.NewSimChain()
+
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyerSwap.Buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(10))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	chain.Mine(10)
+	signSwapClaim(t, sellerSwap, buyerSwap)
+
+	if _, err := buyerSwap.Refund(fundScript, 1000); err != nil {
+		t.Fatalf("Buyer failed to refund: %v", err)
+	}
+	claimTx, err := sellerSwap.CompleteClaim()
+	if err != nil {
+		t.Fatalf("Seller failed to complete claim: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, claimTx); err != nil {
+		t.Fatalf("Claim transaction rejected: %v", err)
+	}
+
+	if _, err := buyerSwap.WatchRefund(ctx, chain, 0); !errors.Is(err, ErrLockClaimed) {
+		t.Fatalf("Expected ErrLockClaimed, got %v", err)
+	}
+	if buyerSwap.Phase != PhaseRefundPending {
+		t.Fatalf("Claimed swap moved to %s", buyerSwap.Phase)
+	}
+	if _, err := buyerSwap.WatchClaim(ctx, chain, 0); err != nil {
+		t.Fatalf("Watcher failed: %v", err)
+	}
+	if buyerSwap.Phase != PhaseClaimed || buyerSwap.NostrSig != sellerSwap.Seller.Event.Sig {
+		t.Fatalf("Buyer swap not claimed, phase %s", buyerSwap.Phase)
+	}
+}
+
+// spendBackend is a SimChain whose WatchSpend reports a given spend, so that
+// tests can deliver spends the chain would reject.
+type spendBackend struct {
+	*bitcoin.SimChain
+	spend *bitcoin.SpendEvent
+}
+
+// WatchSpend reports the given spend.
+func (b *spendBackend) WatchSpend(context.Context, wire.OutPoint, int32) (<-chan *bitcoin.SpendEvent, error) {
+	spends := make(chan *bitcoin.SpendEvent, 1)
+	spends <- b.spend
+	close(spends)
+	return spends, nil
+}
+
+// TestWatchRefundMalformedSpend checks that a spend with a malformed key
+// path witness is an error of its own rather than ErrLockClaimed.
+func TestWatchRefundMalformedSpend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chain := bitcoin.NewSimChain()
+
+	sellerSwap, buyerSwap := newTestSwaps(t)
+	if err := buyerSwap.Commit(); err != nil {
+		t.Fatalf("Buyer failed to commit: %v", err)
+	}
+	if err := sellerSwap.Commit(); err != nil {
+		t.Fatalf("Seller failed to commit: %v", err)
+	}
+	fundTx, fundScript := fundOnChain(t, chain, buyerSwap.Buyer)
+	if err := buyerSwap.Fund(fundFrom(fundTx, fundScript, bitcoin.RelativeBlocks(10))); err != nil {
+		t.Fatalf("Buyer failed to fund: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, buyerSwap.LockingTx); err != nil {
+		t.Fatalf("Locking transaction rejected: %v", err)
+	}
+	chain.Mine(10)
+	refundTx, err := buyerSwap.Refund(fundScript, 1000)
+	if err != nil {
+		t.Fatalf("Buyer failed to refund: %v", err)
+	}
+
+	spendTx := refundTx.Copy()
+	spendTx.TxIn[0].Witness = wire.TxWitness{make([]byte, 10)}
+	backend := &spendBackend{SimChain: chain, spend: &bitcoin.SpendEvent{SpendingTx: spendTx}}
+	_, err = buyerSwap.WatchRefund(ctx, backend, 0)
+	if err == nil || errors.Is(err, ErrLockClaimed) || errors.Is(err, ErrLockRefunded) {
+		t.Fatalf("Expected a malformed spend error, got %v", err)
+	}
+	if buyerSwap.Phase != PhaseRefundPending {
+		t.Fatalf("Swap moved to %s", buyerSwap.Phase)
+	}
+}
@@ -0,0 +1,276 @@
+// Package wallet derives the buyer's Bitcoin keys from a BIP39 mnemonic,
+// one key per swap, along the BIP86 taproot path m/86'/coin'/0'/0/index.
+// Backing up the mnemonic backs up the key of every swap, and the swaps
+// only need to record the index of their key.
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/tyler-smith/go-bip39"
+
+	"tanos/pkg/bitcoin"
+	"tanos/pkg/crypto"
+)
+
+// Purpose is the BIP43 purpose of BIP86 single key taproot outputs.
+const Purpose = 86
+
+// DefaultGapLimit is how many unused keys in a row Rescan looks past the
+// last used one before stopping, as BIP44 recommends.
+const DefaultGapLimit = 20
+
+// Wallet hands out the keys of the external chain of the first BIP86
+// account of a seed. It is safe for concurrent use.
+type Wallet struct {
+	mu     sync.Mutex
+	chain  *hdkeychain.ExtendedKey // m/86'/coin'/0'/0
+	params *chaincfg.Params
+	next   uint32 // Index of the next unused key
+}
+
+// Found is an unspent output paying to a key of the wallet.
+type Found struct {
+	Index uint32 // Index of the key
+	UTXO  *bitcoin.UTXO
+}
+
+// NewMnemonic creates a random 24 word BIP39 mnemonic.
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(256)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate entropy: %v", err)
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// FromMnemonic opens the wallet of a BIP39 mnemonic and optional
+// passphrase on the network. The mnemonic's checksum must be valid.
+func FromMnemonic(mnemonic, passphrase string, params *chaincfg.Params) (*Wallet, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic: %v", err)
+	}
+	defer zero(seed)
+
+	return FromSeed(seed, params)
+}
+
+// FromSeed opens the wallet of a BIP32 seed on the network.
+func FromSeed(seed []byte, params *chaincfg.Params) (*Wallet, error) {
+	master, err := hdkeychain.NewMaster(seed, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create master key: %v", err)
+	}
+	defer master.Zero()
+
+	path := []uint32{
+		hdkeychain.HardenedKeyStart + Purpose,
+		hdkeychain.HardenedKeyStart + params.HDCoinType,
+		hdkeychain.HardenedKeyStart + 0,
+		0,
+	}
+	key := master
+	for _, index := range path {
+		child, err := key.Derive(index)
+		if key != master {
+			key.Zero()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive account key: %v", err)
+		}
+		key = child
+	}
+
+	return &Wallet{chain: key, params: params}, nil
+}
+
+// Path returns the derivation path of the key at index.
+func (w *Wallet) Path(index uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/0'/0/%d", Purpose, w.params.HDCoinType, index)
+}
+
+// Key derives the key at index. The caller owns the key and should zero it.
+func (w *Wallet) Key(index uint32) (*crypto.SecretKey, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.key(index)
+}
+
+// key derives the key at index with the lock held.
+func (w *Wallet) key(index uint32) (*crypto.SecretKey, error) {
+	if index >= hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("key index %d is out of range", index)
+	}
+
+	child, err := w.chain.Derive(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key %d: %v", index, err)
+	}
+	defer child.Zero()
+
+	privKey, err := child.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	defer privKey.Zero()
+	keyBytes := privKey.Serialize()
+	defer zero(keyBytes)
+
+	return crypto.SecretKeyFromBytes(keyBytes)
+}
+
+// NextKey derives the next unused key and returns it with its index, which
+// is not handed out again. Indexes that derive no valid key are skipped.
+func (w *Wallet) NextKey() (*crypto.SecretKey, uint32, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.next < hdkeychain.HardenedKeyStart {
+		index := w.next
+		w.next++
+
+		key, err := w.key(index)
+		if err == nil {
+			return key, index, nil
+		}
+		if _, derr := w.chain.Derive(index); derr != hdkeychain.ErrInvalidChild {
+			return nil, 0, err
+		}
+	}
+
+	return nil, 0, fmt.Errorf("wallet has no unused keys left")
+}
+
+// NextIndex returns the index NextKey hands out next.
+func (w *Wallet) NextIndex() uint32 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.next
+}
+
+// MarkUsed records that the key at index is in use, such as by a restored
+// swap, so that NextKey does not hand it out again.
+func (w *Wallet) MarkUsed(index uint32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if index >= w.next {
+		w.next = index + 1
+	}
+}
+
+// KeyPathScript returns the script of the BIP86 output of the key at index.
+func (w *Wallet) KeyPathScript(index uint32) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.keyPathScript(index)
+}
+
+// keyPathScript returns the BIP86 output script of index with the lock held.
+func (w *Wallet) keyPathScript(index uint32) ([]byte, error) {
+	child, err := w.chain.Derive(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key %d: %v", index, err)
+	}
+	defer child.Zero()
+
+	pubKey, err := child.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	_, pkScript, err := bitcoin.CreateP2TRAddress(pubKey, w.params)
+
+	return pkScript, err
+}
+
+// Rescan looks for unspent outputs paying to the BIP86 outputs of the
+// wallet's keys, such as change or refunds of abandoned swaps, scanning
+// until gap keys in a row, past the last key in use, are unused. Keys
+// already marked used, such as those of swap records, count as used before
+// the search starts, and keys found in use are marked used.
+//
+// A key is in use when it has unspent outputs, mempool included, or, when
+// the scanner is a bitcoin.HistoryScanner, when anything was ever paid to
+// it. Without the history, keys whose outputs are all spent look unused
+// and can end the search early, so a larger gap is needed.
+func (w *Wallet) Rescan(ctx context.Context, scanner bitcoin.ScriptScanner, gap uint32) ([]*Found, error) {
+	if gap == 0 {
+		gap = DefaultGapLimit
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var found []*Found
+	var start uint32
+	end := w.next + gap
+	for start < end && start < hdkeychain.HardenedKeyStart {
+		indexes := make(map[string]uint32, end-start)
+		pkScripts := make([][]byte, 0, end-start)
+		for index := start; index < end; index++ {
+			pkScript, err := w.keyPathScript(index)
+			if err == hdkeychain.ErrInvalidChild {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			indexes[string(pkScript)] = index
+			pkScripts = append(pkScripts, pkScript)
+		}
+
+		utxos, err := scanner.ScanScripts(ctx, pkScripts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan keys %d to %d: %v", start, end-1, err)
+		}
+		if history, ok := scanner.(bitcoin.HistoryScanner); ok {
+			used, err := history.UsedScripts(ctx, pkScripts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan history of keys %d to %d: %v", start, end-1, err)
+			}
+			for _, pkScript := range used {
+				if index, ok := indexes[string(pkScript)]; ok && index >= w.next {
+					w.next = index + 1
+				}
+			}
+		}
+		for _, utxo := range utxos {
+			index, ok := indexes[string(utxo.Output.PkScript)]
+			if !ok {
+				continue
+			}
+			found = append(found, &Found{Index: index, UTXO: utxo})
+			if index >= w.next {
+				w.next = index + 1
+			}
+		}
+
+		start, end = end, w.next+gap
+	}
+
+	return found, nil
+}
+
+// Zero wipes the wallet's keys. It cannot derive keys afterwards.
+func (w *Wallet) Zero() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.chain.Zero()
+}
+
+// zero overwrites b with zeros.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
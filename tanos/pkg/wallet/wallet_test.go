@@ -0,0 +1,224 @@
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	secp "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"tanos/pkg/bitcoin"
+)
+
+// testMnemonic is the mnemonic of the BIP86 test vectors.
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// TestBIP86Vector checks the first key against the BIP86 test vectors.
+func TestBIP86Vector(t *testing.T) {
+	w, err := FromMnemonic(testMnemonic, "", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to open wallet: %v", err)
+	}
+	defer w.Zero()
+
+	if path := w.Path(0); path != "m/86'/0'/0'/0/0" {
+		t.Fatalf("Unexpected path %s", path)
+	}
+	key, err := w.Key(0)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+	defer key.Zero()
+	internal := hex.EncodeToString(key.PubKey().SerializeCompressed()[1:])
+	if internal != "cc8a4bc64d897bddc5fbc2f670f7a8ba0b386779106cf1223c6fc5d7cd6fc115" {
+		t.Fatalf("Unexpected internal key %s", internal)
+	}
+
+	pkScript, err := w.KeyPathScript(0)
+	if err != nil {
+		t.Fatalf("Failed to create script: %v", err)
+	}
+	if hex.EncodeToString(pkScript) != "5120a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c" {
+		t.Fatalf("Unexpected script %x", pkScript)
+	}
+	addr, _, err := bitcoin.CreateP2TRAddress(key.PubKey(), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to create address: %v", err)
+	}
+	if addr != "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr" {
+		t.Fatalf("Unexpected address %s", addr)
+	}
+
+	if _, err := FromMnemonic(strings.Replace(testMnemonic, "about", "abandon", 1), "", &chaincfg.MainNetParams); err == nil {
+		t.Fatalf("Opened a wallet with a bad checksum")
+	}
+}
+
+// TestNextKey checks that keys are handed out once, in order, and that a
+// wallet opened again from the mnemonic derives the same keys.
+func TestNextKey(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		t.Fatalf("Failed to create mnemonic: %v", err)
+	}
+	if words := len(strings.Fields(mnemonic)); words != 24 {
+		t.Fatalf("Mnemonic has %d words", words)
+	}
+	w, err := FromMnemonic(mnemonic, "secret", params)
+	if err != nil {
+		t.Fatalf("Failed to open wallet: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := uint32(0); i < 3; i++ {
+		key, index, err := w.NextKey()
+		if err != nil {
+			t.Fatalf("Failed to get key: %v", err)
+		}
+		if index != i {
+			t.Fatalf("Got index %d, expected %d", index, i)
+		}
+		pub := hex.EncodeToString(key.PubKey().SerializeCompressed())
+		if seen[pub] {
+			t.Fatalf("Key %d handed out twice", index)
+		}
+		seen[pub] = true
+	}
+
+	restored, err := FromMnemonic(mnemonic, "secret", params)
+	if err != nil {
+		t.Fatalf("Failed to open wallet: %v", err)
+	}
+	key, _ := restored.Key(2)
+	if !seen[hex.EncodeToString(key.PubKey().SerializeCompressed())] {
+		t.Fatalf("Reopened wallet derives other keys")
+	}
+	other, _ := FromMnemonic(mnemonic, "", params)
+	key, _ = other.Key(2)
+	if seen[hex.EncodeToString(key.PubKey().SerializeCompressed())] {
+		t.Fatalf("Passphrase does not change the keys")
+	}
+
+	restored.MarkUsed(9)
+	if _, index, _ := restored.NextKey(); index != 10 {
+		t.Fatalf("Got index %d after marking 9 used", index)
+	}
+}
+
+// TestRescan finds funds sent to keys a reopened wallet no longer knows are
+// used, including one past the gap of the first batch.
+func TestRescan(t *testing.T) {
+	ctx := context.Background()
+	params := &chaincfg.RegressionNetParams
+	chain := bitcoin.NewSimChain()
+
+	w, err := FromMnemonic(testMnemonic, "", params)
+	if err != nil {
+		t.Fatalf("Failed to open wallet: %v", err)
+	}
+	funded := map[uint32]int64{3: 10000, 7: 20000, 12: 30000}
+	for index, value := range funded {
+		pkScript, err := w.KeyPathScript(index)
+		if err != nil {
+			t.Fatalf("Failed to create script: %v", err)
+		}
+		chain.Fund(pkScript, value)
+	}
+	other, _ := FromMnemonic(testMnemonic, "other", params)
+	otherScript, _ := other.KeyPathScript(0)
+	chain.Fund(otherScript, 40000)
+
+	found, err := w.Rescan(ctx, chain, 5)
+	if err != nil {
+		t.Fatalf("Failed to rescan: %v", err)
+	}
+	if len(found) != len(funded) {
+		t.Fatalf("Found %d outputs, expected %d", len(found), len(funded))
+	}
+	for _, f := range found {
+		if f.UTXO.Output.Value != funded[f.Index] {
+			t.Fatalf("Found %d at key %d", f.UTXO.Output.Value, f.Index)
+		}
+	}
+	if next := w.NextIndex(); next != 13 {
+		t.Fatalf("Next index is %d after rescan, expected 13", next)
+	}
+
+	// Funds past the gap are not found
+	far, _ := w.KeyPathScript(30)
+	chain.Fund(far, btcutil.SatoshiPerBitcoin)
+	found, err = w.Rescan(ctx, chain, 5)
+	if err != nil {
+		t.Fatalf("Failed to rescan: %v", err)
+	}
+	if len(found) != len(funded) {
+		t.Fatalf("Found %d outputs past the gap", len(found)-len(funded))
+	}
+}
+
+// utxoScanner hides the history of a backend, as Bitcoin Core does.
+type utxoScanner struct {
+	bitcoin.ScriptScanner
+}
+
+// TestRescanFindsSpentKeys checks that a key whose only output is spent,
+// in the mempool here, still counts as used when the backend has the
+// history of its scripts.
+func TestRescanFindsSpentKeys(t *testing.T) {
+	ctx := context.Background()
+	params := &chaincfg.RegressionNetParams
+	chain := bitcoin.NewSimChain()
+
+	w, err := FromMnemonic(testMnemonic, "", params)
+	if err != nil {
+		t.Fatalf("Failed to open wallet: %v", err)
+	}
+	spentScript, _ := w.KeyPathScript(3)
+	fundTx := chain.Fund(spentScript, 10000)
+	keptScript, _ := w.KeyPathScript(7)
+	chain.Fund(keptScript, 20000)
+
+	key, err := w.Key(3)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %v", err)
+	}
+	spend := wire.NewMsgTx(2)
+	spend.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: fundTx.TxHash(), Index: 0}, nil, nil))
+	spend.AddTxOut(wire.NewTxOut(9000, []byte{txscript.OP_TRUE}))
+	fetcher := txscript.NewCannedPrevOutputFetcher(spentScript, 10000)
+	err = key.WithPrivateKey(func(privKey *secp.PrivateKey) error {
+		witness, err := txscript.TaprootWitnessSignature(spend, txscript.NewTxSigHashes(spend, fetcher), 0,
+			10000, spentScript, txscript.SigHashDefault, privKey)
+		spend.TxIn[0].Witness = witness
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to sign spend: %v", err)
+	}
+	if _, err := chain.Broadcast(ctx, spend); err != nil {
+		t.Fatalf("Spend rejected: %v", err)
+	}
+
+	// Without the history, the search ends before key 7
+	found, err := w.Rescan(ctx, utxoScanner{chain}, 5)
+	if err != nil {
+		t.Fatalf("Failed to rescan: %v", err)
+	}
+	if len(found) != 0 || w.NextIndex() != 0 {
+		t.Fatalf("Found %d outputs without the history", len(found))
+	}
+
+	found, err = w.Rescan(ctx, chain, 5)
+	if err != nil {
+		t.Fatalf("Failed to rescan: %v", err)
+	}
+	if len(found) != 1 || found[0].Index != 7 || w.NextIndex() != 8 {
+		t.Fatalf("Expected the output of key 7, found %d outputs", len(found))
+	}
+}